@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"  // نگه‌دارنده‌ی نام کاربر در context
+	"io"       // مقصد access log
+	"log"      // نوشتن خط‌های access log بدون prefix
+	"log/slog" // access log در قالب text یا json
+	"net/http" // هسته HTTP در Go
+	"strconv"  // status و حجم پاسخ
+	"strings"  // ساختن خط لاگ
+	"time"     // زمان درخواست
+)
+
+// ================= Combined Access Log =================
+
+// قالب زمان Apache، مثل [10/Oct/2000:13:55:36 -0700]
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// combinedLog اگر LOG_FORMAT=combined باشد خط‌های access log را خام روی ACCESS_LOG_DEST می‌نویسد؛
+// nil یعنی accessLogger. log.Logger نوشتن همزمان خط‌ها را سریالی می‌کند.
+var combinedLog *log.Logger
+
+// accessLogger خط‌های access log در قالب text یا json؛ جدا از لاگر برنامه تا مقصد خودش را داشته باشد
+var accessLogger = slog.Default()
+
+// setupAccessLog access log را با قالب انتخاب‌شده روی out (ACCESS_LOG_DEST) آماده می‌کند
+func setupAccessLog(format string, out io.Writer) {
+	if format == "combined" {
+		combinedLog = log.New(out, "", 0)
+		return
+	}
+	accessLogger = slog.New(newLogHandler(format, out))
+}
+
+// کلید context برای نگه‌دارنده‌ی نام کاربر احراز هویت‌شده؛
+// basicAuthMiddleware داخل زنجیره است و context جدیدش به loggingMiddleware نمی‌رسد
+type accessUserKey struct{}
+
+// withUserHolder یک نگه‌دارنده‌ی خالی برای نام کاربر در context درخواست می‌گذارد
+func withUserHolder(r *http.Request) (*http.Request, *string) {
+	user := new(string)
+	return r.WithContext(context.WithValue(r.Context(), accessUserKey{}, user)), user
+}
+
+// setAccessUser نام کاربر را (اگر کسی منتظرش باشد) برای access log ثبت می‌کند
+func setAccessUser(ctx context.Context, user string) {
+	addLogFields(ctx, "user", user)
+	if p, ok := ctx.Value(accessUserKey{}).(*string); ok {
+		*p = user
+	}
+}
+
+// formatCombined یک خط در Apache Combined Log Format می‌سازد:
+// %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+func formatCombined(r *http.Request, host, user string, start time.Time, status int, size int64) string {
+	var b strings.Builder
+
+	b.WriteString(host)
+	b.WriteString(" - ") // %l (identd) همیشه خالی است
+	b.WriteString(clfEscape(clfField(user)))
+
+	b.WriteString(" [")
+	b.WriteString(start.Format(clfTimeLayout))
+	b.WriteString(`] "`)
+	b.WriteString(clfEscape(r.Method + " " + r.RequestURI + " " + r.Proto))
+	b.WriteString(`" `)
+
+	b.WriteString(strconv.Itoa(status))
+	b.WriteByte(' ')
+	if size > 0 {
+		b.WriteString(strconv.FormatInt(size, 10))
+	} else {
+		b.WriteByte('-') // %b برای پاسخ بدون body
+	}
+
+	b.WriteString(` "`)
+	b.WriteString(clfEscape(clfField(r.Referer())))
+	b.WriteString(`" "`)
+	b.WriteString(clfEscape(clfField(r.UserAgent())))
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// clfField مقدار خالی را مثل Apache با - نشان می‌دهد
+func clfField(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+// clfEscape مثل Apache، " و \ را با \ و بایت‌های کنترلی و غیر ASCII را به شکل \xhh escape می‌کند
+// تا مقدار کلاینت نتواند خط لاگ را بشکند یا فیلد جعلی بسازد
+func clfEscape(s string) string {
+	const hex = "0123456789abcdef"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			b.WriteString(`\x`)
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
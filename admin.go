@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"      // پیام canary ناشناخته
+	"maps"     // کپی flagها و درصدها برای snapshot جدید
+	"net/http" // هسته HTTP در Go
+)
+
+// ================= Admin API =================
+
+// بدنه‌ی PATCH /admin/config؛ فیلدهای nil تغییر نمی‌کنند
+type runtimeConfigPatch struct {
+	Maintenance    *bool    `json:"maintenance"`
+	RateLimitRPS   *float64 `json:"rate_limit_rps"`
+	RateLimitBurst *int     `json:"rate_limit_burst"`
+	LogLevel       *string  `json:"log_level"`
+
+	// فقط flagهای آمده عوض می‌شوند، مثل {"features": {"beta_api": true}}؛ فقط با JSON
+	Features map[string]bool `json:"features" form:"-"`
+
+	// درصد canaryهای موجود، مثل {"canaries": {"search_v2": 25}}؛ فقط با JSON
+	Canaries map[string]int `json:"canaries" form:"-"`
+}
+
+// /api/env → تنظیمات مؤثر همین پروسه (env و پیش‌فرض‌ها بعد از loadConfig) بدون رمزها.
+// نام فیلدها و مقدارها همان‌اند که در لاگ "config loaded" آمده‌اند (durationها به نانوثانیه)؛
+// تغییرهای PATCH /admin/config فقط در /admin/config دیده می‌شوند.
+func envConfigHandler(cfg Config) http.HandlerFunc {
+	safe := cfg.redacted()
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, safe)
+	}
+}
+
+// /admin/config → خواندن (GET) و تغییر (PATCH) تنظیمات زمان اجرا
+func adminConfigHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, runtimeCfg.Load())
+		return
+	}
+
+	// هم JSON و هم فرم (مثل curl -d maintenance=true) پذیرفته می‌شود
+	var patch runtimeConfigPatch
+	if err := bindBody(w, r, &patch); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	// نسخه‌ی جدید از روی snapshot فعلی ساخته و فقط اگر در این فاصله عوض نشده باشد جایگزین می‌شود؛
+	// وگرنه PATCH همزمان دیگری (یا registerCanary) از دست می‌رفت
+	for {
+		old := runtimeCfg.Load()
+		next, err := patch.apply(*old)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		swapped, err := swapRuntimeConfig(old, &next)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		if !swapped {
+			continue
+		}
+
+		// مقدار قبلی و جدید در رکورد audit این درخواست ثبت می‌شود
+		addAuditDetail(r.Context(), "old", *old)
+		addAuditDetail(r.Context(), "new", next)
+
+		writeJSON(w, http.StatusOK, next)
+		return
+	}
+}
+
+// apply فیلدهای آمده‌ی patch را روی یک کپی از old می‌نویسد؛ mapهای old دست نمی‌خورند
+func (patch runtimeConfigPatch) apply(old RuntimeConfig) (RuntimeConfig, error) {
+	next := old
+
+	if patch.Maintenance != nil {
+		next.Maintenance = *patch.Maintenance
+	}
+	if patch.RateLimitRPS != nil {
+		next.RateLimitRPS = *patch.RateLimitRPS
+	}
+	if patch.RateLimitBurst != nil {
+		next.RateLimitBurst = *patch.RateLimitBurst
+	}
+	if patch.LogLevel != nil {
+		next.LogLevel = *patch.LogLevel
+	}
+	if len(patch.Features) > 0 {
+		if err := validateFeaturePatch(old.Features, patch.Features); err != nil {
+			return next, err
+		}
+		next.Features = maps.Clone(old.Features)
+		maps.Copy(next.Features, patch.Features)
+	}
+	if len(patch.Canaries) > 0 {
+		for name := range patch.Canaries {
+			if _, ok := old.Canaries[name]; !ok {
+				return next, fmt.Errorf("unknown canary %q", name)
+			}
+		}
+		next.Canaries = maps.Clone(old.Canaries)
+		maps.Copy(next.Canaries, patch.Canaries)
+	}
+	return next, nil
+}
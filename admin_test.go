@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// patchConfig یک PATCH /admin/config با body JSON می‌فرستد
+func patchConfig(body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPatch, "/admin/config", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	adminConfigHandler(w, r)
+	return w
+}
+
+// setTestRuntimeConfig rc را برای مدت تست فعال می‌کند و بعد از آن snapshot قبلی را برمی‌گرداند
+func setTestRuntimeConfig(t *testing.T, rc RuntimeConfig) {
+	t.Helper()
+	prev := runtimeCfg.Load()
+	level := logLevel.Level()
+	t.Cleanup(func() {
+		runtimeCfg.Store(prev)
+		logLevel.Set(level)
+	})
+	if err := applyRuntimeConfig(rc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminConfigPatch(t *testing.T) {
+	captureLogs(t)
+	setTestRuntimeConfig(t, RuntimeConfig{LogLevel: "info", Features: map[string]bool{"beta": false}})
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"log_level": "DEBUG", "features": {"beta": true}}`, http.StatusOK},
+		{`{"features": {"unknown": true}}`, http.StatusUnprocessableEntity},
+		{`{"canaries": {"unknown": 10}}`, http.StatusUnprocessableEntity},
+		{`{"rate_limit_rps": -1}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		if w := patchConfig(tt.body); w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.body, w.Code, tt.status, w.Body)
+		}
+	}
+
+	// فقط PATCH موفق اعمال شده است
+	rc := runtimeCfg.Load()
+	if rc.LogLevel != "debug" || !rc.Features["beta"] || rc.RateLimitRPS != 0 {
+		t.Errorf("runtime config = %+v", *rc)
+	}
+}
+
+// PATCHهای همزمان روی flagهای مختلف همدیگر را پاک نمی‌کنند
+func TestAdminConfigPatchConcurrent(t *testing.T) {
+	captureLogs(t)
+	const n = 20
+	features := make(map[string]bool, n)
+	for i := range n {
+		features[fmt.Sprintf("f%d", i)] = false
+	}
+	setTestRuntimeConfig(t, RuntimeConfig{LogLevel: "info", Features: features})
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := patchConfig(fmt.Sprintf(`{"features": {"f%d": true}}`, i))
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d: %s", w.Code, w.Body)
+			}
+			var rc RuntimeConfig
+			if err := json.Unmarshal(w.Body.Bytes(), &rc); err != nil || !rc.Features[fmt.Sprintf("f%d", i)] {
+				t.Errorf("response lacks its own flag: %s", w.Body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for name, on := range runtimeCfg.Load().Features {
+		if !on {
+			t.Errorf("feature %s lost its update", name)
+		}
+	}
+}
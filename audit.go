@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"       // نگه داشتن جزئیات audit در طول درخواست
+	"encoding/json" // قالب JSON برای هر رکورد
+	"log"           // لاگ خطای نوشتن audit
+	"net/http"      // هسته HTTP در Go
+	"os"            // فایل audit
+	"sync"          // سریال کردن نوشتن‌ها
+	"time"          // زمان هر رکورد
+)
+
+// ================= Audit Log =================
+
+// auditLogger رکوردهای audit را به صورت JSON (هر خط یک رکورد) در یک مقصد جدا می‌نویسد.
+// برخلاف لاگ دسترسی، این رکوردها هیچ‌وقت بر اساس سطح لاگ حذف نمی‌شوند.
+type auditLogger struct {
+	mu   sync.Mutex
+	out  *os.File
+	sync bool // برای فایل‌ها بعد از هر رکورد Sync می‌کنیم
+}
+
+// openAuditLog مقصد audit را باز می‌کند؛ "-" یعنی stderr.
+// فایل فقط در حالت append باز می‌شود تا رکوردهای قبلی بازنویسی نشوند.
+func openAuditLog(path string) (*auditLogger, error) {
+	if path == "" || path == "-" {
+		return &auditLogger{out: os.Stderr}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLogger{out: f, sync: true}, nil
+}
+
+// close فایل audit را می‌بندد؛ stderr بسته نمی‌شود
+func (a *auditLogger) close(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.out == os.Stderr {
+		return nil
+	}
+	return a.out.Close()
+}
+
+// یک رکورد audit
+type auditEntry struct {
+	Time    time.Time      `json:"time"`
+	User    string         `json:"user"`              // کاربر احراز هویت‌شده
+	IP      string         `json:"ip"`                // IP واقعی کلاینت
+	Addr    string         `json:"clientAddr"`        // IP:port واقعی کلاینت (port اگر معلوم باشد)
+	Method  string         `json:"method"`            // متد HTTP
+	Path    string         `json:"path"`              // مسیر درخواست
+	Status  int            `json:"status"`            // نتیجه‌ی درخواست
+	Details map[string]any `json:"details,omitempty"` // جزئیاتی که handler اضافه کرده
+}
+
+// write رکورد را می‌نویسد و بلافاصله flush می‌کند
+func (a *auditLogger) write(e *auditEntry) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("audit: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.out.Write(line); err != nil {
+		log.Printf("audit: write failed: %v", err)
+		return
+	}
+	if a.sync {
+		_ = a.out.Sync()
+	}
+}
+
+// کلید context برای رکورد audit در حال ساخت
+type auditEntryKey struct{}
+
+// auditMiddleware برای هر درخواست یک رکورد audit ثبت می‌کند.
+// باید بعد از middleware احراز هویت اجرا شود تا کاربر مشخص باشد.
+func auditMiddleware(a *auditLogger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			e := &auditEntry{
+				Time:   time.Now().UTC(),
+				User:   authUser(r),
+				IP:     anonymizeIP(clientIP(r)).String(),
+				Addr:   logClientAddr(r),
+				Method: r.Method,
+				Path:   r.URL.Path,
+			}
+
+			// handler می‌تواند با addAuditDetail جزئیات اضافه کند
+			rec := newStatusRecorder(w)
+			ctx := context.WithValue(r.Context(), auditEntryKey{}, e)
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			e.Status = rec.status
+			a.write(e)
+		})
+	}
+}
+
+// addAuditDetail یک جزئیات به رکورد audit درخواست فعلی اضافه می‌کند
+func addAuditDetail(ctx context.Context, key string, value any) {
+	e, ok := ctx.Value(auditEntryKey{}).(*auditEntry)
+	if !ok {
+		return // این route audit نمی‌شود
+	}
+	if e.Details == nil {
+		e.Details = make(map[string]any)
+	}
+	e.Details[key] = value
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"      // پیام خطای فیلدها
+	"mime"     // پارس Content-Type
+	"net/http" // هسته HTTP در Go
+	"reflect"  // پر کردن فیلدهای struct از روی tag
+	"strconv"  // تبدیل مقدارهای فرم
+	"strings"  // خواندن tagها
+)
+
+// ================= Request Binding =================
+
+// bindBody بدنه‌ی درخواست را بر اساس Content-Type در dst (اشاره‌گر به struct) می‌ریزد:
+//
+//	application/json                   → readJSON
+//	application/x-www-form-urlencoded  → r.ParseForm و tagهای form (یا json)
+//
+// نوع‌های دیگر با 415 رد می‌شوند. خطای برگشتی *bodyError است و با writeBodyError ارسال می‌شود.
+func bindBody(w http.ResponseWriter, r *http.Request, dst any) error {
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "" // Content-Type خالی یا نامعتبر
+	}
+
+	switch mediaType {
+	case "application/json":
+		return readJSON(w, r, dst)
+
+	case "application/x-www-form-urlencoded":
+		r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)
+		if err := r.ParseForm(); err != nil {
+			be := newBodyError(err)
+			if be.Status == http.StatusBadRequest {
+				be.Message = "malformed form body"
+			}
+			return be
+		}
+		return bindForm(r.PostForm, dst)
+	}
+
+	return &bodyError{
+		Status:  http.StatusUnsupportedMediaType,
+		Message: "Content-Type must be application/json or application/x-www-form-urlencoded",
+	}
+}
+
+// bindForm مقدارهای فرم را در فیلدهای struct می‌ریزد.
+// نام هر فیلد از tag form و در نبود آن از tag json خوانده می‌شود؛ مثل readJSON فیلد ناشناخته خطاست.
+func bindForm(values map[string][]string, dst any) error {
+
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		panic("bindForm: dst must be a pointer to a struct") // خطای برنامه‌نویسی
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	// نام فرم → شماره‌ی فیلد
+	fields := make(map[string]int, t.NumField())
+	for i := range t.NumField() {
+		if name := formFieldName(t.Field(i)); name != "" {
+			fields[name] = i
+		}
+	}
+
+	for name, vals := range values {
+		i, ok := fields[name]
+		if !ok {
+			return &bodyError{Status: http.StatusBadRequest, Message: fmt.Sprintf("unknown field %q", name), Field: name}
+		}
+		if err := setFormValue(v.Field(i), vals); err != nil {
+			return &bodyError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("field %q must be %s", name, jsonTypeName(v.Field(i).Type())),
+				Field:   name,
+			}
+		}
+	}
+
+	return nil
+}
+
+// formFieldName نام فیلد در فرم را از tagها پیدا می‌کند ("" یعنی نادیده گرفته شود)
+func formFieldName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	for _, key := range []string{"form", "json"} {
+		if tag, ok := f.Tag.Lookup(key); ok {
+			name, _, _ := strings.Cut(tag, ",")
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+	}
+	return f.Name
+}
+
+// setFormValue مقدار(های) فرم را به نوع فیلد تبدیل می‌کند
+func setFormValue(f reflect.Value, vals []string) error {
+
+	switch f.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(f.Type().Elem())
+		if err := setFormValue(elem.Elem(), vals); err != nil {
+			return err
+		}
+		f.Set(elem)
+		return nil
+
+	case reflect.Slice:
+		s := reflect.MakeSlice(f.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setFormValue(s.Index(i), []string{val}); err != nil {
+				return err
+			}
+		}
+		f.Set(s)
+		return nil
+	}
+
+	// برای فیلدهای تک‌مقداری آخرین مقدار فرم استفاده می‌شود
+	val := vals[len(vals)-1]
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(val, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field kind %s", f.Kind())
+	}
+	return nil
+}
+
+// ================= Content-Type Middleware =================
+
+// requireContentType درخواست‌های دارای body را که media type آن‌ها در types نیست با 415 رد می‌کند.
+// پارامترهایی مثل charset در مقایسه نادیده گرفته می‌شوند؛ درخواست بدون body بررسی نمی‌شود.
+func requireContentType(types ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			// ContentLength برابر -1 یعنی حجم نامعلوم (مثل chunked)، پس body دارد
+			if r.ContentLength == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err == nil {
+				for _, t := range types {
+					if strings.EqualFold(mediaType, t) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be one of: "+strings.Join(types, ", "))
+		})
+	}
+}
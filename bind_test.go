@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		types       []string
+		contentType string // "" یعنی بدون هدر
+		body        string
+		chunked     bool // بدون Content-Length
+		want        int
+	}{
+		{"exact", []string{"application/json"}, "application/json", `{}`, false, http.StatusOK},
+		{"charset parameter", []string{"application/json"}, "application/json; charset=utf-8", `{}`, false, http.StatusOK},
+		{"spaces around parameter", []string{"application/json"}, "application/json ; charset=UTF-8", `{}`, false, http.StatusOK},
+		{"media type case", []string{"application/json"}, "Application/JSON", `{}`, false, http.StatusOK},
+		{"allowed type case", []string{"Application/Json"}, "application/json", `{}`, false, http.StatusOK},
+		{"second allowed type", []string{"application/json", "application/x-www-form-urlencoded"}, "application/x-www-form-urlencoded", `a=1`, false, http.StatusOK},
+		{"missing header", []string{"application/json"}, "", `{}`, false, http.StatusUnsupportedMediaType},
+		{"missing header chunked", []string{"application/json"}, "", `{}`, true, http.StatusUnsupportedMediaType},
+		{"other type", []string{"application/json"}, "text/plain", `{}`, false, http.StatusUnsupportedMediaType},
+		{"type as parameter", []string{"application/json"}, "text/plain; x=application/json", `{}`, false, http.StatusUnsupportedMediaType},
+		{"suffix type", []string{"application/json"}, "application/problem+json", `{}`, false, http.StatusUnsupportedMediaType},
+		{"malformed", []string{"application/json"}, "application/json; charset", `{}`, false, http.StatusUnsupportedMediaType},
+		{"no body", []string{"application/json"}, "", ``, false, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := requireContentType(tt.types...)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				called = true
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/api/echo", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if called != (tt.want == http.StatusOK) {
+				t.Errorf("handler called = %v", called)
+			}
+			if tt.want != http.StatusUnsupportedMediaType {
+				return
+			}
+
+			var body apiError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body is not JSON: %v\n%s", err, w.Body)
+			}
+			if want := "Content-Type must be one of: " + strings.Join(tt.types, ", "); body.Error != want {
+				t.Errorf("error = %q, want %q", body.Error, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"expvar" // انتشار وضعیت breaker به‌عنوان metric
+	"log"    // لاگ تغییر وضعیت
+	"sync"   // دسترسی همزمان امن به وضعیت
+	"time"   // cooldown
+)
+
+// ================= Circuit Breaker =================
+
+// وضعیت‌های breaker
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // عادی: درخواست‌ها عبور می‌کنند
+	breakerOpen                         // upstream خراب است: درخواست‌ها فوراً رد می‌شوند
+	breakerHalfOpen                     // بعد از cooldown: یک درخواست آزمایشی عبور می‌کند
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// metricهای breakerها؛ در /admin/vars قابل مشاهده است
+var (
+	breakerStates      = expvar.NewMap("breaker_state")       // وضعیت فعلی هر breaker
+	breakerTransitions = expvar.NewMap("breaker_transitions") // تعداد تغییر وضعیت‌ها، مثل "upstream:closed->open"
+)
+
+// circuitBreaker بعد از threshold خطای پشت‌سرهم باز می‌شود، تا cooldown درخواست‌ها را رد می‌کند
+// و سپس با یک درخواست آزمایشی (half-open) بررسی می‌کند upstream برگشته است یا نه.
+type circuitBreaker struct {
+	name      string
+	threshold int           // تعداد خطای پشت‌سرهم برای باز شدن
+	cooldown  time.Duration // مدت باز ماندن قبل از آزمایش دوباره
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int       // خطاهای پشت‌سرهم در وضعیت closed
+	openedAt time.Time // زمان باز شدن
+	probing  bool      // درخواست آزمایشی در جریان است
+}
+
+// newCircuitBreaker یک breaker بسته می‌سازد
+func newCircuitBreaker(name string, threshold int, cooldown time.Duration) *circuitBreaker {
+	b := &circuitBreaker{name: name, threshold: threshold, cooldown: cooldown}
+	breakerStates.Set(name, stateVar(breakerClosed))
+	return b
+}
+
+// allow می‌گوید درخواست می‌تواند به upstream برود یا نه.
+// اگر ok=true باشد، فراخواننده باید حتماً done یا release را با همان probe صدا بزند.
+// probe=true یعنی این درخواست آزمایشی half-open است.
+func (b *circuitBreaker) allow() (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false, false
+		}
+		b.setState(breakerHalfOpen)
+		fallthrough
+
+	case breakerHalfOpen:
+		// در half-open فقط یک درخواست آزمایشی همزمان مجاز است
+		if b.probing {
+			return false, false
+		}
+		b.probing = true
+		return true, true
+	}
+
+	return true, false
+}
+
+// done نتیجه‌ی درخواستی را که allow اجازه داده بود ثبت می‌کند
+func (b *circuitBreaker) done(probe, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// نتیجه‌ی درخواست آزمایشی تصمیم می‌گیرد breaker بسته شود یا دوباره باز
+	if probe {
+		b.probing = false
+		b.failures = 0
+		if success {
+			b.setState(breakerClosed)
+		} else {
+			b.openedAt = time.Now()
+			b.setState(breakerOpen)
+		}
+		return
+	}
+
+	// درخواست‌های قدیمی‌تر که بعد از باز شدن تمام می‌شوند وضعیت را تغییر نمی‌دهند
+	if b.state != breakerClosed {
+		return
+	}
+
+	if success {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+// release درخواستی را که نتیجه‌ی قابل قضاوتی نداشت (مثل لغو توسط کلاینت) آزاد می‌کند
+func (b *circuitBreaker) release(probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// isOpen می‌گوید breaker فعلاً همه‌ی درخواست‌ها را رد می‌کند یا نه (بدون تغییر وضعیت)
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerOpen && time.Since(b.openedAt) < b.cooldown
+}
+
+// setState وضعیت را عوض می‌کند و آن را لاگ و در metricها ثبت می‌کند؛ باید زیر قفل صدا زده شود
+func (b *circuitBreaker) setState(s breakerState) {
+	if b.state == s {
+		return
+	}
+
+	log.Printf("Circuit breaker %s: %s -> %s", b.name, b.state, s)
+	breakerTransitions.Add(b.name+":"+b.state.String()+"->"+s.String(), 1)
+	breakerStates.Set(b.name, stateVar(s))
+	b.state = s
+}
+
+// stateVar وضعیت را به شکل رشته‌ی expvar درمی‌آورد
+func stateVar(s breakerState) *expvar.String {
+	v := new(expvar.String)
+	v.Set(s.String())
+	return v
+}
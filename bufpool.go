@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes" // بافر قابل استفاده‌ی دوباره
+	"sync"  // pool
+)
+
+// ================= Buffer Pool =================
+
+// بافرهای بزرگ‌تر از این به pool برنمی‌گردند تا یک پاسخ بزرگ حافظه را برای همیشه نگه ندارد
+const maxPooledBufferBytes = 64 << 10
+
+// bufferPool بافرهای موقت (مثل encode کردن JSON در writeJSON) را بین درخواست‌ها دوباره استفاده می‌کند
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// getBuffer یک بافر خالی از pool برمی‌دارد؛ بعد از استفاده باید با putBuffer برگردانده شود
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer بافر را خالی کرده و به pool برمی‌گرداند
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferBytes {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+type benchItem struct {
+	ID   int      `json:"id"`
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// BenchmarkWriteJSON writeJSON (بافر از bufferPool) را با json.Marshal که برای هر پاسخ بافر تازه می‌سازد مقایسه می‌کند
+func BenchmarkWriteJSON(b *testing.B) {
+	items := make([]benchItem, 100)
+	for i := range items {
+		items[i] = benchItem{ID: i, Name: "mini-http-server", Tags: []string{"a", "b", "c"}}
+	}
+
+	b.Run("pooled", func(b *testing.B) {
+		w := newDiscardWriter()
+		b.ReportAllocs()
+		for b.Loop() {
+			w.reset()
+			writeJSON(w, http.StatusOK, items)
+		}
+	})
+
+	b.Run("unpooled", func(b *testing.B) {
+		w := newDiscardWriter()
+		b.ReportAllocs()
+		for b.Loop() {
+			w.reset()
+			body, _ := json.Marshal(items)
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			w.Write(body)
+		}
+	})
+}
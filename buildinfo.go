@@ -0,0 +1,60 @@
+package main
+
+import (
+	"runtime"       // نسخه‌ی Go
+	"runtime/debug" // اطلاعات build از go.mod و VCS
+	"time"          // زمان شروع پروسه
+)
+
+// ================= Build Info =================
+
+// با ldflags در زمان build مقدار می‌گیرند:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse --short HEAD)"
+//
+// بدون آن‌ها commit از اطلاعات VCS که go build خودش در باینری می‌گذارد خوانده می‌شود.
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// زمان شروع پروسه برای uptime
+var processStart = time.Now()
+
+// buildInfo نسخه و commit باینری و نسخه‌ی Go
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// readBuildInfo مقدارهای ldflags را با اطلاعات debug.ReadBuildInfo کامل می‌کند
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, GoVersion: runtime.Version()}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version // مثلاً با go install module@v1.4.0
+	}
+	if info.Commit == "" {
+		dirty := false
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.modified":
+				dirty = s.Value == "true" // build از درخت کاری با تغییرات commit‌نشده
+			}
+		}
+		if dirty && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+	return info
+}
+
+// اطلاعات build در طول اجرای پروسه عوض نمی‌شود
+var currentBuild = readBuildInfo()
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"    // نگه داشتن body پاسخ در حافظه
+	"context"  // جدا کردن اجرای مشترک از لغو یک کلاینت
+	"net/http" // هسته HTTP در Go
+	"strconv"  // پارس max-age
+	"strings"  // تجزیه‌ی هدر Cache-Control
+	"sync"     // دسترسی همزمان امن به cache
+	"time"     // زمان انقضای entryها
+
+	"golang.org/x/sync/singleflight" // ادغام درخواست‌های همزمان یکسان
+)
+
+// ================= Response Cache =================
+
+// حداکثر تعداد پاسخ‌هایی که همزمان در cache نگه داشته می‌شوند
+const responseCacheMaxEntries = 1024
+
+// یک پاسخ ضبط‌شده که می‌تواند دوباره برای کلاینت‌های دیگر ارسال شود
+type cachedResponse struct {
+	status  int         // status code
+	header  http.Header // هدرهای پاسخ
+	body    []byte      // محتوای پاسخ
+	stored  time.Time   // زمان ساخت پاسخ (برای max-age درخواست)
+	expires time.Time   // زمان انقضا
+}
+
+// responseCache پاسخ‌های موفق GET را برای مدت ttl نگه می‌دارد.
+// وقتی entry منقضی شده باشد، فقط یکی از درخواست‌های همزمان handler را اجرا می‌کند
+// و بقیه منتظر همان نتیجه می‌مانند (جلوگیری از thundering herd).
+type responseCache struct {
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]*cachedResponse
+
+	group singleflight.Group // اجرای یکتا برای هر کلید
+}
+
+// newResponseCache یک cache خالی با مدت اعتبار ttl می‌سازد
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		entries: make(map[string]*cachedResponse),
+	}
+}
+
+// middleware پاسخ‌های GET را cache و اجرای همزمان آن‌ها را ادغام می‌کند
+func (c *responseCache) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// فقط GET (و HEAD با همان پاسخ) امن و idempotent است؛ بقیه مستقیم اجرا می‌شوند
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// no-store کلاینت: نه از cache خوانده می‌شود و نه نتیجه ذخیره یا با دیگران شریک می‌شود
+		policy := requestCachePolicy(r)
+		if policy.noStore {
+			w.Header().Set("X-Cache", "BYPASS")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// نوع مذاکره‌شده (JSON یا XML) هم بخشی از کلید است
+		key := r.Host + r.URL.RequestURI() + "\x00" + negotiatedType(r.Context())
+
+		// -------- Cache Hit --------
+		// با no-cache پاسخ ذخیره‌شده استفاده نمی‌شود؛ نتیجه‌ی اجرای تازه (یا اجرای در جریان) ذخیره می‌شود
+		if !policy.noCache {
+			if resp, ok := c.lookup(key, policy.maxAge); ok {
+				writeCachedResponse(w, resp, "HIT")
+				return
+			}
+		}
+
+		// -------- Miss: اجرای مشترک --------
+		ch := c.group.DoChan(key, func() (any, error) {
+
+			// اجرای مشترک نباید با رفتن یک کلاینت لغو شود، چون بقیه منتظر نتیجه‌اند
+			shared := r.WithContext(context.WithoutCancel(r.Context()))
+
+			rec := newResponseBuffer()
+			next.ServeHTTP(rec, shared)
+
+			now := time.Now()
+			resp := &cachedResponse{
+				status:  rec.status,
+				header:  rec.header,
+				body:    rec.body.Bytes(),
+				stored:  now,
+				expires: now.Add(c.ttl),
+			}
+
+			// فقط پاسخ‌های موفق cache می‌شوند
+			if resp.status == http.StatusOK {
+				c.store(key, resp)
+			}
+			return resp, nil
+		})
+
+		select {
+		case <-r.Context().Done():
+			// کلاینت رفته است؛ نتیجه برای بقیه‌ی منتظرها و cache باقی می‌ماند
+			return
+
+		case res := <-ch:
+			state := "MISS"
+			if res.Shared {
+				state = "SHARED" // نتیجه از اجرای درخواست دیگری آمده است
+			}
+			writeCachedResponse(w, res.Val.(*cachedResponse), state)
+		}
+	})
+}
+
+// lookup پاسخ معتبر (منقضی‌نشده) را برای کلید پیدا می‌کند؛
+// maxAge نامنفی پاسخ‌های قدیمی‌تر از آن را هم رد می‌کند
+func (c *responseCache) lookup(key string, maxAge time.Duration) (*cachedResponse, bool) {
+	c.mu.RLock()
+	resp, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(resp.expires) {
+		return nil, false
+	}
+	if maxAge >= 0 && time.Since(resp.stored) > maxAge {
+		return nil, false
+	}
+	return resp, true
+}
+
+// ================= Request Cache-Control =================
+
+// cachePolicy خواسته‌ی کلاینت از cache بر اساس Cache-Control درخواست (RFC 7234 بخش 5.2.1)
+type cachePolicy struct {
+	noStore bool          // پاسخ نه از cache بیاید و نه ذخیره شود
+	noCache bool          // پاسخ ذخیره‌شده بدون اجرای دوباره استفاده نشود
+	maxAge  time.Duration // حداکثر سن قابل قبول پاسخ؛ منفی یعنی بدون محدودیت
+}
+
+// requestCachePolicy directiveهای no-store، no-cache و max-age را از درخواست می‌خواند.
+// Pragma: no-cache فقط وقتی Cache-Control نباشد حساب می‌شود (HTTP/1.0).
+func requestCachePolicy(r *http.Request) cachePolicy {
+	p := cachePolicy{maxAge: -1}
+
+	values := r.Header.Values("Cache-Control")
+	if len(values) == 0 {
+		p.noCache = strings.EqualFold(strings.TrimSpace(r.Header.Get("Pragma")), "no-cache")
+		return p
+	}
+
+	for name, value := range parseCacheControl(strings.Join(values, ",")) {
+		switch name {
+		case "no-store":
+			p.noStore = true
+		case "no-cache":
+			p.noCache = true
+		case "max-age":
+			// مقدار نامعتبر نادیده گرفته می‌شود؛ مقدار خیلی بزرگ مثل RFC به 2^31 ثانیه محدود می‌شود
+			if secs, err := strconv.ParseInt(value, 10, 64); err == nil && secs >= 0 {
+				p.maxAge = time.Duration(min(secs, 1<<31)) * time.Second
+			}
+		}
+	}
+	return p
+}
+
+// parseCacheControl هدر Cache-Control را به directiveها (با حروف کوچک) و مقدار بدون کوتیشن آن‌ها تجزیه می‌کند
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		directives[name] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return directives
+}
+
+// store پاسخ را ذخیره می‌کند؛ اگر cache پر باشد اول entryهای منقضی پاک می‌شوند
+func (c *responseCache) store(key string, resp *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= responseCacheMaxEntries {
+		now := time.Now()
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	// هنوز پر است؛ این پاسخ cache نمی‌شود ولی برای منتظرها ارسال می‌شود
+	if len(c.entries) >= responseCacheMaxEntries {
+		return
+	}
+
+	c.entries[key] = resp
+}
+
+// writeCachedResponse پاسخ ضبط‌شده را برای کلاینت ارسال می‌کند
+func writeCachedResponse(w http.ResponseWriter, resp *cachedResponse, state string) {
+	for k, v := range resp.header {
+		if k == "X-Request-Id" {
+			continue // هر پاسخ شناسه‌ی درخواست خودش را نگه می‌دارد
+		}
+		w.Header()[k] = append([]string(nil), v...) // کپی تا پاسخ‌ها هدر مشترک نداشته باشند
+	}
+	w.Header().Set("X-Cache", state)
+	w.WriteHeader(resp.status)
+	_, _ = w.Write(resp.body)
+}
+
+// ================= Response Buffer =================
+
+// responseBuffer یک http.ResponseWriter است که پاسخ را به جای ارسال در حافظه نگه می‌دارد
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *responseBuffer) Header() http.Header { return b.header }
+
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.wrote {
+		return // مثل ResponseWriter واقعی فقط اولین status حساب است
+	}
+	b.status = status
+	b.wrote = true
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.wrote = true
+	return b.body.Write(p)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// counterHandler در هر اجرا شماره‌ی اجرا را برمی‌گرداند تا تازه بودن پاسخ دیده شود
+func counterHandler(calls *atomic.Int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, calls.Add(1))
+	})
+}
+
+func TestResponseCacheControl(t *testing.T) {
+	type step struct {
+		header map[string]string // هدرهای درخواست
+		state  string            // X-Cache
+		body   string            // شماره‌ی اجرایی که پاسخ از آن آمده
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"hit after miss", []step{
+			{nil, "MISS", "1"},
+			{nil, "HIT", "1"},
+		}},
+		{"no-cache revalidates and refreshes the entry", []step{
+			{nil, "MISS", "1"},
+			{map[string]string{"Cache-Control": "no-cache"}, "MISS", "2"},
+			{nil, "HIT", "2"},
+		}},
+		{"no-cache is case-insensitive", []step{
+			{nil, "MISS", "1"},
+			{map[string]string{"Cache-Control": "No-Cache"}, "MISS", "2"},
+		}},
+		{"Pragma no-cache without Cache-Control", []step{
+			{nil, "MISS", "1"},
+			{map[string]string{"Pragma": "no-cache"}, "MISS", "2"},
+			{nil, "HIT", "2"},
+		}},
+		{"Cache-Control wins over Pragma", []step{
+			{nil, "MISS", "1"},
+			{map[string]string{"Pragma": "no-cache", "Cache-Control": "max-age=60"}, "HIT", "1"},
+		}},
+		{"no-store bypasses without storing", []step{
+			{map[string]string{"Cache-Control": "no-store"}, "BYPASS", "1"},
+			{nil, "MISS", "2"},
+		}},
+		{"no-store does not read a stored entry", []step{
+			{nil, "MISS", "1"},
+			{map[string]string{"Cache-Control": "no-store"}, "BYPASS", "2"},
+			{nil, "HIT", "1"},
+		}},
+		{"no-store with other directives", []step{
+			{nil, "MISS", "1"},
+			{map[string]string{"Cache-Control": "max-age=60, no-store"}, "BYPASS", "2"},
+		}},
+		{"max-age=0 refuses the stored entry", []step{
+			{nil, "MISS", "1"},
+			{map[string]string{"Cache-Control": "max-age=0"}, "MISS", "2"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int64
+			h := newResponseCache(time.Minute).middleware(counterHandler(&calls))
+
+			for i, s := range tt.steps {
+				r := httptest.NewRequest(http.MethodGet, "/api/time", nil)
+				for k, v := range s.header {
+					r.Header.Set(k, v)
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				if got := w.Header().Get("X-Cache"); got != s.state {
+					t.Errorf("step %d: X-Cache = %q, want %q", i, got, s.state)
+				}
+				if got := w.Body.String(); got != s.body {
+					t.Errorf("step %d: body from run %s, want run %s", i, got, s.body)
+				}
+			}
+		})
+	}
+}
+
+// همان رفتار روی /api/time واقعی با RESPONSE_CACHE_TTL و کل زنجیره‌ی middlewareها
+func TestResponseCacheControlEndToEnd(t *testing.T) {
+	captureLogs(t)
+	a, _ := newTestApp(t, map[string]string{"RESPONSE_CACHE_TTL": "1m"})
+	ts := httptest.NewServer(a.handler)
+	t.Cleanup(ts.Close)
+
+	for i, s := range []struct {
+		cacheControl string
+		state        string
+	}{
+		{"", "MISS"},
+		{"", "HIT"},
+		{"no-cache", "MISS"},
+		{"no-store", "BYPASS"},
+		{"", "HIT"},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/time", nil)
+		if s.cacheControl != "" {
+			req.Header.Set("Cache-Control", s.cacheControl)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("step %d: status = %d", i, resp.StatusCode)
+		}
+		if got := resp.Header.Get("X-Cache"); got != s.state {
+			t.Errorf("step %d (Cache-Control %q): X-Cache = %q, want %q", i, s.cacheControl, got, s.state)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http" // هسته HTTP در Go
+	"path"     // پسوند فایل
+	"regexp"   // تشخیص نام‌های hashدار
+	"strconv"  // ساختن max-age
+	"strings"  // یکسان کردن پسوند
+)
+
+// ================= Static Cache-Control =================
+
+// نام‌هایی مثل app.ab12cd.js یا index-BvQ3kz1x.css که محتوایشان با نام عوض می‌شود؛
+// بخش hash باید حداقل یک رقم داشته باشد تا نام‌هایی مثل bundle.js یا document.pdf اشتباه نشوند
+var hashedNameRe = regexp.MustCompile(`[.-]([0-9a-fA-F]{6,}|[A-Za-z0-9_]{8,})\.[A-Za-z0-9]+$`)
+
+// staticMaxAge مدت cache مرورگر برای فایل‌های static به ازای پسوند
+type staticMaxAge struct {
+	def   int            // max-age (ثانیه) پسوندهایی که در byExt نیستند
+	byExt map[string]int // پسوند با حروف کوچک و نقطه، مثل .js → max-age
+}
+
+// newStaticMaxAge پسوندها را یکسان می‌کند (js و .JS هر دو .js می‌شوند)
+func newStaticMaxAge(def int, byExt map[string]int) staticMaxAge {
+	m := staticMaxAge{def: def, byExt: make(map[string]int, len(byExt))}
+	for ext, age := range byExt {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		m.byExt[ext] = age
+	}
+	return m
+}
+
+// enabled وقتی هیچ‌کدام تنظیم نشده، هدر Cache-Control مثل قبل گذاشته نمی‌شود
+func (m staticMaxAge) enabled() bool {
+	return m.def > 0 || len(m.byExt) > 0
+}
+
+// header مقدار Cache-Control برای فایل name؛ فایل‌های hashدار immutable هم می‌گیرند
+func (m staticMaxAge) header(name string) string {
+	age, ok := m.byExt[strings.ToLower(path.Ext(name))]
+	if !ok {
+		age = m.def
+	}
+	if age == 0 {
+		return "no-cache" // هر بار با ETag/Last-Modified بررسی شود
+	}
+
+	v := "public, max-age=" + strconv.Itoa(age)
+	if hasDigit(hashedPart(name)) {
+		v += ", immutable"
+	}
+	return v
+}
+
+// hashedPart بخش hash نام فایل را (اگر شبیه نام hashدار باشد) برمی‌گرداند
+func hashedPart(name string) string {
+	m := hashedNameRe.FindStringSubmatch(path.Base(name))
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// hasDigit می‌گوید s حداقل یک رقم دارد
+func hasDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789")
+}
+
+// staticCacheControl هدر Cache-Control را بر اساس پسوند مسیر درخواست روی پاسخ‌های موفق می‌گذارد.
+// پاسخ‌های خطا (مثل 404) دست نمی‌خورند تا در cache مرورگر نمانند.
+func staticCacheControl(m staticMaxAge, next http.Handler) http.Handler {
+	if !m.enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&cacheControlWriter{ResponseWriter: w, value: m.header(r.URL.Path)}, r)
+	})
+}
+
+// cacheControlWriter هدر را در لحظه‌ی WriteHeader و فقط برای پاسخ‌های موفق تنظیم می‌کند
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (cw *cacheControlWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		switch status {
+		case http.StatusOK, http.StatusPartialContent, http.StatusNotModified:
+			if cw.Header().Get("Cache-Control") == "" {
+				cw.Header().Set("Cache-Control", cw.value)
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheControlWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush قبل از اولین Write هدرها را می‌فرستد؛ پس Cache-Control قبلش تنظیم می‌شود
+func (cw *cacheControlWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap به http.ResponseController اجازه می‌دهد به writer اصلی برسد
+func (cw *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"expvar"   // شمارنده‌ی درخواست‌های هر نسخه
+	"fmt"      // پیام خطای اعتبارسنجی
+	"hash/fnv" // hash پایدار کلاینت
+	"maps"     // کپی درصدها برای snapshot جدید
+	"net/http" // هسته HTTP در Go
+)
+
+// ================= Canary Routing =================
+//
+// canaryMiddleware درصدی از کلاینت‌ها را به handler جدید می‌فرستد و بقیه را به handler فعلی:
+//
+//	h, err := canaryMiddleware("search_v2", 5, searchV2, searchV1)
+//	router.Register(http.MethodGet, "/api/search", h)
+//
+// انتخاب با hash آدرس IP کلاینت است (بدون IP: شناسه‌ی درخواست)؛ پس هر کلاینت تا وقتی درصد عوض نشده
+// همیشه یک نسخه را می‌بیند و با بالا رفتن درصد، کلاینت‌های canary قبلی canary می‌مانند.
+// درصد فعلی در RuntimeConfig.Canaries است و مثل بقیه‌ی تنظیمات زمان اجرا از /admin/config عوض می‌شود.
+// CANARY_UPSTREAMS همین را روی PROXY_PREFIX با نام upstreams استفاده می‌کند.
+
+// تعداد درخواست‌های هر نسخه، با کلید name/canary یا name/stable
+var canaryRequests = expvar.NewMap("canary_requests")
+
+// canaryMiddleware درصد percent از کلاینت‌ها را به canary و بقیه را به stable می‌فرستد؛
+// percent فقط مقدار اولیه است و مقدار CANARIES یا /admin/config بر آن مقدم است.
+// باید بعد از applyRuntimeConfig (هنگام ثبت routeها) صدا زده شود؛ نام یا درصد نامعتبر خطاست.
+func canaryMiddleware(name string, percent int, canary, stable http.Handler) (http.Handler, error) {
+	if err := registerCanary(name, percent); err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		variant, h := "stable", stable
+		if canaryBucket(name, r) < runtimeCfg.Load().Canaries[name] {
+			variant, h = "canary", canary
+		}
+
+		canaryRequests.Add(name+"/"+variant, 1)
+		addLogFields(r.Context(), "variant", name+"/"+variant) // فیلد access log
+
+		// آمار مدت پاسخ و requests_by_route هر نسخه جدا باشد تا قابل مقایسه باشند
+		if route := matchedRoute(r.Context()); route != "" {
+			setMatchedRoute(r.Context(), route+" ["+variant+"]")
+		}
+
+		h.ServeHTTP(w, r)
+	}), nil
+}
+
+// registerCanary اگر درصدی برای name تنظیم نشده باشد percent را در snapshot فعلی می‌گذارد
+func registerCanary(name string, percent int) error {
+	if err := validateCanary(name, percent); err != nil {
+		return err
+	}
+	for {
+		old := runtimeCfg.Load()
+		if _, ok := old.Canaries[name]; ok {
+			return nil
+		}
+		next := *old
+		next.Canaries = maps.Clone(old.Canaries)
+		if next.Canaries == nil {
+			next.Canaries = make(map[string]int)
+		}
+		next.Canaries[name] = percent
+		if runtimeCfg.CompareAndSwap(old, &next) {
+			return nil
+		}
+	}
+}
+
+// validateCanary نام و درصد یک canary را بررسی می‌کند
+func validateCanary(name string, percent int) error {
+	if !featureNameRe.MatchString(name) {
+		return fmt.Errorf("invalid canary name %q (use lowercase letters, digits, _ and -)", name)
+	}
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("canary %q: percent must be between 0 and 100", name)
+	}
+	return nil
+}
+
+// canaryBucket عدد پایدار 0 تا 99 برای کلاینت؛ نام canary در hash است تا canaryهای مختلف
+// همیشه روی یک گروه از کلاینت‌ها نیفتند
+func canaryBucket(name string, r *http.Request) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	if ip := clientIP(r); ip.IsValid() {
+		b := ip.As16()
+		h.Write(b[:])
+	} else {
+		h.Write([]byte(requestIDFromContext(r.Context())))
+	}
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// variantHandler نام نسخه را در body می‌نویسد
+func variantHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name)
+	})
+}
+
+// serveCanary یک درخواست از IP داده‌شده به h می‌فرستد و نسخه‌ی سرودهنده را برمی‌گرداند
+func serveCanary(h http.Handler, ip string) string {
+	r := httptest.NewRequest(http.MethodGet, "/api/search", nil)
+	r.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Body.String()
+}
+
+// canaryCount مقدار فعلی canary_requests برای name/variant
+func canaryCount(key string) int64 {
+	if v, ok := canaryRequests.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestCanaryMiddlewareInvalid(t *testing.T) {
+	setTestRuntimeConfig(t, RuntimeConfig{LogLevel: "info"})
+	for _, tt := range []struct {
+		name    string
+		percent int
+	}{
+		{"Search", 5},
+		{"", 5},
+		{"search", -1},
+		{"search", 101},
+	} {
+		if _, err := canaryMiddleware(tt.name, tt.percent, variantHandler("canary"), variantHandler("stable")); err == nil {
+			t.Errorf("canaryMiddleware(%q, %d): no error", tt.name, tt.percent)
+		}
+	}
+	if len(runtimeCfg.Load().Canaries) != 0 {
+		t.Errorf("invalid canaries registered: %v", runtimeCfg.Load().Canaries)
+	}
+}
+
+// سهم canary نزدیک درصد است، هر کلاینت همیشه یک نسخه را می‌بیند و با بالا رفتن درصد canary می‌ماند
+func TestCanaryBucketing(t *testing.T) {
+	setTestRuntimeConfig(t, RuntimeConfig{LogLevel: "info"})
+	h, err := canaryMiddleware("bucket_test", 30, variantHandler("canary"), variantHandler("stable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const clients = 2000
+	ips := make([]string, clients)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("10.%d.%d.1", i/256, i%256)
+	}
+	assign := func() map[string]string {
+		m := make(map[string]string, clients)
+		for _, ip := range ips {
+			m[ip] = serveCanary(h, ip)
+		}
+		return m
+	}
+
+	first := assign()
+	canaries := 0
+	for _, v := range first {
+		if v == "canary" {
+			canaries++
+		}
+	}
+	if canaries < clients*25/100 || canaries > clients*35/100 {
+		t.Errorf("%d of %d clients on canary, want about 30%%", canaries, clients)
+	}
+
+	// sticky: دور دوم همان نتیجه
+	for ip, v := range assign() {
+		if first[ip] != v {
+			t.Fatalf("client %s moved from %s to %s", ip, first[ip], v)
+		}
+	}
+
+	// با 60٪ هیچ کلاینت canary به stable برنمی‌گردد
+	next := *runtimeCfg.Load()
+	next.Canaries = map[string]int{"bucket_test": 60}
+	runtimeCfg.Store(&next)
+	for ip, v := range assign() {
+		if first[ip] == "canary" && v != "canary" {
+			t.Fatalf("canary client %s moved to %s at 60%%", ip, v)
+		}
+	}
+
+	for _, tt := range []struct {
+		percent int
+		want    string
+	}{{0, "stable"}, {100, "canary"}} {
+		next.Canaries = map[string]int{"bucket_test": tt.percent}
+		runtimeCfg.Store(&next)
+		for ip, v := range assign() {
+			if v != tt.want {
+				t.Fatalf("%d%%: client %s got %s", tt.percent, ip, v)
+			}
+		}
+	}
+}
+
+// مقدار CANARIES بر درصد داخل کد مقدم است و canary_requests هر نسخه را جدا می‌شمارد
+func TestCanaryConfiguredPercentAndCounts(t *testing.T) {
+	setTestRuntimeConfig(t, RuntimeConfig{LogLevel: "info", Canaries: map[string]int{"count_test": 100}})
+	h, err := canaryMiddleware("count_test", 0, variantHandler("canary"), variantHandler("stable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canaryBefore, stableBefore := canaryCount("count_test/canary"), canaryCount("count_test/stable")
+	for i := range 5 {
+		if v := serveCanary(h, fmt.Sprintf("192.0.2.%d", i)); v != "canary" {
+			t.Fatalf("got %s with CANARIES=count_test=100", v)
+		}
+	}
+	next := *runtimeCfg.Load()
+	next.Canaries = map[string]int{"count_test": 0}
+	runtimeCfg.Store(&next)
+	for i := range 3 {
+		serveCanary(h, fmt.Sprintf("192.0.2.%d", i))
+	}
+
+	if got := canaryCount("count_test/canary") - canaryBefore; got != 5 {
+		t.Errorf("canary_requests count_test/canary += %d, want 5", got)
+	}
+	if got := canaryCount("count_test/stable") - stableBefore; got != 3 {
+		t.Errorf("canary_requests count_test/stable += %d, want 3", got)
+	}
+}
+
+// CANARY_UPSTREAMS روی PROXY_PREFIX: درصد canary "upstreams" تعیین می‌کند کدام backend جواب بدهد
+func TestCanaryUpstreams(t *testing.T) {
+	captureLogs(t)
+	stable := httptest.NewServer(variantHandler("stable"))
+	t.Cleanup(stable.Close)
+	canary := httptest.NewServer(variantHandler("canary"))
+	t.Cleanup(canary.Close)
+
+	for _, tt := range []struct {
+		canaries string
+		want     string
+	}{
+		{"", "stable"}, // پیش‌فرض 0
+		{"upstreams=100", "canary"},
+	} {
+		setTestRuntimeConfig(t, RuntimeConfig{LogLevel: "info"})
+		a, _ := newTestApp(t, map[string]string{
+			"UPSTREAMS":        stable.URL,
+			"CANARY_UPSTREAMS": canary.URL,
+			"CANARIES":         tt.canaries,
+		})
+		ts := httptest.NewServer(a.handler)
+		resp, err := http.Get(ts.URL + "/proxy/x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		ts.Close()
+
+		if string(body) != tt.want {
+			t.Errorf("CANARIES=%q: served by %q, want %q", tt.canaries, body, tt.want)
+		}
+	}
+}
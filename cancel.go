@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"  // وضعیت لغو درخواست
+	"errors"   // تشخیص نوع لغو
+	"expvar"   // شمارنده‌ی درخواست‌های رهاشده
+	"net/http" // هسته HTTP در Go
+	"syscall"  // خطاهای قطع اتصال
+	"time"     // فاصله‌ی مراحل کار نمونه
+)
+
+// ================= Client Cancellation =================
+//
+// net/http وقتی کلاینت اتصال را می‌بندد context درخواست را لغو می‌کند. middlewareها همیشه
+// context جدید را از r.Context() می‌سازند (نه context.Background) تا این لغو به handler برسد.
+// الگو برای handlerهای طولانی:
+//
+//	for ... {
+//		select {
+//		case <-r.Context().Done():
+//			if isClientGone(r.Context()) { ... کار نیمه‌کاره را رها کن ... }
+//			return // در timeout پاسخ 504 را timeoutMiddleware می‌دهد
+//		case <-step:
+//		}
+//	}
+//
+// استثنا: cache پاسخ‌ها اجرای مشترک را با WithoutCancel جدا می‌کند چون بقیه‌ی کلاینت‌ها منتظرش هستند.
+
+// تعداد درخواست‌هایی که handler به خاطر رفتن کلاینت نیمه‌کاره رها کرده است
+var requestsAbandoned = expvar.NewInt("requests_abandoned")
+
+// isClientGone می‌گوید context به خاطر قطع شدن کلاینت لغو شده است (نه timeout سرور).
+// handler بعد از آن نباید پاسخی بنویسد؛ کسی برای خواندنش نیست.
+func isClientGone(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// status غیر استاندارد nginx برای درخواستی که کلاینت قبل از پایان پاسخ رها کرده؛ فقط در لاگ و آمار
+const statusClientClosed = 499
+
+// تعداد پاسخ‌هایی که کلاینت وسطشان رفته است (broken pipe، connection reset، لغو context)
+var clientDisconnects = expvar.NewInt("client_disconnects")
+
+// isClientDisconnect خطای نوشتن ناشی از بسته شدن اتصال توسط کلاینت را تشخیص می‌دهد؛
+// این خطاها اشکال سرور نیستند و فقط در سطح debug لاگ می‌شوند
+func isClientDisconnect(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// حداکثر تعداد مراحل /api/slow (هر مرحله 100ms)
+const slowMaxSteps = 50
+
+// /api/slow?steps=N → نمونه‌ی handler طولانی که با رفتن کلاینت یا timeout بلافاصله متوقف می‌شود
+func apiSlowHandler(w http.ResponseWriter, r *http.Request) {
+
+	steps, err := queryInt(r.URL.Query(), "steps", 10, 1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	steps = min(steps, slowMaxSteps)
+
+	ctx := r.Context()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for done := 0; done < steps; {
+		select {
+		case <-ctx.Done():
+			if isClientGone(ctx) {
+				requestsAbandoned.Add(1)
+				requestLogger(ctx).Info("client gone, /api/slow stopped", "done", done, "steps", steps)
+			}
+			return
+
+		case <-ticker.C:
+			done++ // یک مرحله از کار (در handler واقعی: یک batch از query یا محاسبه)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"steps": steps})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"      // خطای handler و خط‌های /api/count
+	"io"       // writer داده‌شده به تولیدکننده
+	"net/http" // هسته HTTP در Go
+	"sync"     // Write و flush دوره‌ای از دو goroutine
+	"time"     // فاصله‌ی flush و تأخیر /api/count
+)
+
+// ================= Chunked Responses =================
+//
+// writeChunked برای پاسخ‌هایی است که طولشان از قبل معلوم نیست (گزارش، export، خروجی یک پروسه).
+// Content-Length گذاشته نمی‌شود، پس net/http پاسخ HTTP/1.1 را chunked می‌فرستد (در HTTP/2 فریم DATA)؛
+// هیچ چیز بافر نمی‌شود و داده‌ی نوشته‌شده حداکثر بعد از interval به کلاینت می‌رسد:
+//
+//	writeChunked(w, r, "text/csv", time.Second, func(w io.Writer) error {
+//		for rows.Next() {
+//			if _, err := fmt.Fprintln(w, row.CSV()); err != nil {
+//				return err // کلاینت رفته
+//			}
+//		}
+//		return rows.Err()
+//	})
+//
+// خطای قبل از اولین بایت پاسخ 500 معمولی است. بعد از آن status 200 رفته است؛ خطا لاگ و اتصال بدون
+// chunk پایانی قطع می‌شود تا کلاینت body ناقص را کامل نپندارد. این مسیرها نباید پشت
+// timeoutMiddleware باشند (پاسخ را بافر می‌کند). gzip و wrapperهای دیگر Flush را پاس می‌دهند.
+
+// فاصله‌ی پیش‌فرض flush در writeChunked
+const chunkedFlushInterval = 200 * time.Millisecond
+
+// chunkedWriter نوشتن‌ها را مستقیم به ResponseWriter می‌دهد و یک ticker هر interval
+// داده‌ی flush نشده را می‌فرستد؛ Write و flush با یک قفل سریال می‌شوند
+type chunkedWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	ctype   string
+	started bool // هدرها و status 200 رفته‌اند
+	dirty   bool // داده‌ی flush نشده هست
+}
+
+func (cw *chunkedWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if !cw.started {
+		cw.started = true
+		h := cw.w.Header()
+		h.Set("Content-Type", cw.ctype)
+		h.Del("Content-Length") // بدون حجم معلوم → Transfer-Encoding: chunked
+		h.Set("X-Content-Type-Options", "nosniff")
+		cw.w.WriteHeader(http.StatusOK)
+	}
+	cw.dirty = true
+	return cw.w.Write(p)
+}
+
+// Flush داده‌ی نوشته‌شده را همین حالا می‌فرستد؛ تولیدکننده می‌تواند قبل از یک کار طولانی صدایش بزند
+func (cw *chunkedWriter) Flush() {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.dirty {
+		cw.dirty = false
+		_ = cw.rc.Flush() // writer بدون Flush (ErrNotSupported) فقط بافر می‌کند
+	}
+}
+
+// writeChunked خروجی produce را با Content-Type داده‌شده و بدون Content-Length stream می‌کند.
+// writer داده‌شده http.Flusher هم هست؛ interval صفر یعنی chunkedFlushInterval.
+func writeChunked(w http.ResponseWriter, r *http.Request, contentType string, interval time.Duration, produce func(io.Writer) error) {
+	if interval <= 0 {
+		interval = chunkedFlushInterval
+	}
+	cw := &chunkedWriter{w: w, rc: http.NewResponseController(w), ctype: contentType}
+
+	done := make(chan struct{})
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				cw.Flush()
+			}
+		}
+	}()
+
+	err := produce(cw)
+	close(done)
+	<-flushed // بعد از برگشتن handler نباید کسی به ResponseWriter دست بزند
+
+	cw.mu.Lock()
+	started := cw.started
+	cw.mu.Unlock()
+
+	switch {
+	case err == nil && !started:
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK) // پاسخ خالی
+	case err == nil:
+		cw.Flush()
+	case !started:
+		writeServerError(w, http.StatusInternalServerError, fmt.Errorf("writeChunked: %w", err))
+	default:
+		if r.Context().Err() == nil {
+			requestLogger(r.Context()).Error("writeChunked: aborted mid-response",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"err", err,
+			)
+		}
+		panic(http.ErrAbortHandler) // بدون chunk پایانی؛ کلاینت پاسخ را ناقص می‌بیند
+	}
+}
+
+// حداکثرهای /api/count
+const (
+	countMaxNumbers = 1000
+	countMaxDelayMS = 5000
+)
+
+// /api/count?count=N&delay_ms=D → نمونه‌ی پاسخ chunked: عددهای 1 تا N هر کدام در یک خط با D میلی‌ثانیه فاصله
+// (پیش‌فرض 10 عدد و 500ms)؛ با curl -N دیده می‌شود که خط‌ها یکی‌یکی می‌رسند
+func apiCountHandler(w http.ResponseWriter, r *http.Request) {
+
+	q := r.URL.Query()
+	count, err := queryInt(q, "count", 10, 1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	delay, err := queryInt(q, "delay_ms", 500, 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	count, delay = min(count, countMaxNumbers), min(delay, countMaxDelayMS)
+
+	ctx := r.Context()
+	writeChunked(w, r, "text/plain; charset=utf-8", 0, func(w io.Writer) error {
+		for i := 1; i <= count; i++ {
+			if i > 1 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Duration(delay) * time.Millisecond):
+				}
+			}
+			if _, err := fmt.Fprintln(w, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
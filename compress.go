@@ -0,0 +1,245 @@
+package main
+
+import (
+	"compress/gzip" // فشرده‌سازی پاسخ
+	"expvar"        // شمارنده‌ی خطاهای فشرده‌سازی
+	"io"            // writer خالی برای ساختن gzip.Writer در pool
+	"mime"          // پارس Content-Type
+	"net/http"      // هسته HTTP در Go
+	"strconv"       // خواندن Content-Length
+	"strings"       // ETag ضعیف و هدر Vary
+	"sync"          // pool نویسنده‌های gzip
+)
+
+// ================= Compression Middleware =================
+
+// پاسخ‌هایی که حجمشان از قبل معلوم و کمتر از این است فشرده نمی‌شوند؛
+// سربار gzip برایشان بیشتر از صرفه‌جویی است
+const compressMinBytes = 1024
+
+// خطاهای فشرده‌سازی در /debug/vars (و /admin/vars) بر اساس مرحله: init (پاسخ بدون فشرده‌سازی رفت)
+// یا write (وسط پاسخ؛ شامل رفتن کلاینت)
+var compressionErrors = expvar.NewMap("compression_errors")
+
+// newGzipWriter سازنده‌ی encoder برای pool هر middleware؛ تست‌ها با جایگزینی آن شکست init را شبیه‌سازی می‌کنند
+var newGzipWriter = gzip.NewWriterLevel
+
+// انواع پیش‌فرض COMPRESS_TYPES: متن‌ها و فرمت‌های متنی؛ تصویر، ویدیو و فایل‌های از قبل فشرده عمداً نیستند
+var defaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/manifest+json",
+	"image/svg+xml",
+}
+
+// انواع فشرده‌پذیر (COMPRESS_TYPES)؛ هم برای پاسخ‌های پویا و هم نسخه‌ی gzip فایل‌های static cache.
+// فقط یک بار در شروع برنامه تنظیم می‌شود.
+var compressTypes = defaultCompressTypes
+
+// isCompressible بررسی می‌کند media type پاسخ در compressTypes باشد؛ "text/*" یعنی هر زیرنوع text
+func isCompressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range compressTypes {
+		if t == mt || strings.HasSuffix(t, "/*") && strings.HasPrefix(mt, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// validCompressType الگوی COMPRESS_TYPES را بررسی می‌کند: type/subtype یا type/*
+func validCompressType(t string) bool {
+	typ, sub, ok := strings.Cut(t, "/")
+	return ok && typ != "" && typ != "*" && sub != "" && !strings.Contains(sub, "/") && t == strings.ToLower(t)
+}
+
+// compressionMiddleware پاسخ‌های متنی را برای کلاینت‌هایی که gzip قبول می‌کنند فشرده می‌کند.
+// Brotli عمداً نیست (وابستگی تازه می‌خواهد؛ README)؛ Accept-Encoding: br به تنهایی یعنی بدون فشرده‌سازی.
+// level بین gzip.BestSpeed (1) و gzip.BestCompression (9) است؛ 0 یعنی خاموش.
+// gzip.Writerها در یک pool (مخصوص همین level) دوباره استفاده می‌شوند.
+// پاسخ‌هایی که خودشان Content-Encoding دارند (مثل gzip آماده‌ی static cache یا پاسخ upstream) دست نمی‌خورند.
+func compressionMiddleware(level int) Middleware {
+	return func(next http.Handler) http.Handler {
+		if level == 0 {
+			return next // فشرده‌سازی خاموش است
+		}
+
+		// اگر ساختن writer شکست بخورد، خطا به‌جای writer در pool برمی‌گردد و پاسخ بدون فشرده‌سازی
+		// فرستاده می‌شود (level در loadConfig بررسی شده، پس در عمل فقط با newGzipWriter دیگری)
+		pool := &sync.Pool{
+			New: func() any {
+				zw, err := newGzipWriter(io.Discard, level)
+				if err != nil {
+					return err
+				}
+				return zw
+			},
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			// پاسخ به ازای Accept-Encoding فرق می‌کند؛ حتی اگر این بار فشرده نشود
+			addVary(w.Header(), "Accept-Encoding")
+
+			// بازه‌ها روی نسخه‌ی اصلی معنی دارند
+			if !acceptsGzip(r) || r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, r: r, pool: pool}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// compressWriter در اولین WriteHeader تصمیم می‌گیرد پاسخ را فشرده کند یا نه؛
+// تا آن لحظه هدرها (از جمله Content-Type که handler گذاشته) هنوز ارسال نشده‌اند
+type compressWriter struct {
+	http.ResponseWriter
+	r           *http.Request // برای لاگ خطا
+	pool        *sync.Pool
+	zw          *gzip.Writer // nil یعنی پاسخ بدون فشرده‌سازی ارسال می‌شود
+	wroteHeader bool
+	failed      bool // خطای فشرده‌سازی این پاسخ قبلاً ثبت شده
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		cw.ResponseWriter.WriteHeader(status) // رفتار معمول net/http (هشدار superfluous) حفظ می‌شود
+		return
+	}
+	cw.wroteHeader = true
+
+	if cw.shouldCompress(status) && cw.getWriter() {
+		h := cw.Header()
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length") // حجم فشرده از قبل معلوم نیست
+		h.Del("Accept-Ranges")  // بازه روی نسخه‌ی فشرده پشتیبانی نمی‌شود
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag) // نمایش متفاوت از همان محتوا
+		}
+		h.Del("Repr-Digest") // hash نسخه‌ی فشرده‌نشده است
+		h.Del("Digest")
+	}
+
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// getWriter یک gzip.Writer از pool روی پاسخ آماده می‌کند؛ false یعنی ساختن encoder شکست خورده و
+// پاسخ (هنوز هیچ هدری نرفته) بدون فشرده‌سازی و بدون Content-Encoding فرستاده می‌شود
+func (cw *compressWriter) getWriter() bool {
+	switch v := cw.pool.Get().(type) {
+	case *gzip.Writer:
+		cw.zw = v
+		cw.zw.Reset(cw.ResponseWriter)
+		return true
+	case error:
+		cw.fail("init", v)
+	}
+	return false
+}
+
+// fail خطای فشرده‌سازی را یک بار برای هر پاسخ در compression_errors می‌شمارد و لاگ می‌کند.
+// خطای وسط پاسخ قابل جبران نیست (بخشی از body فشرده رفته است)؛ رفتن کلاینت فقط شمرده می‌شود.
+func (cw *compressWriter) fail(stage string, err error) {
+	if cw.failed {
+		return
+	}
+	cw.failed = true
+	compressionErrors.Add(stage, 1)
+	if isClientDisconnect(err) {
+		return
+	}
+	msg := "compression failed mid-response"
+	if stage == "init" {
+		msg = "compression unavailable, sending identity encoding"
+	}
+	requestLogger(cw.r.Context()).Error(msg,
+		"method", cw.r.Method,
+		"path", cw.r.URL.Path,
+		"err", err,
+	)
+}
+
+// shouldCompress فقط پاسخ‌های متنی با body و بدون encoding قبلی را فشرده می‌کند
+func (cw *compressWriter) shouldCompress(status int) bool {
+	h := cw.Header()
+
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		status == http.StatusPartialContent {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" || !isCompressible(h.Get("Content-Type")) {
+		return false
+	}
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && n < compressMinBytes {
+		return false
+	}
+	return true
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.zw == nil {
+		return cw.ResponseWriter.Write(p)
+	}
+	n, err := cw.zw.Write(p)
+	if err != nil {
+		cw.fail("write", err)
+	}
+	return n, err
+}
+
+// Flush داده‌ی بافرشده‌ی gzip را هم برای پاسخ‌های streaming می‌فرستد.
+// Flush قبل از اولین Write هدرها را می‌فرستد؛ پس تصمیم فشرده‌سازی همین‌جا گرفته می‌شود.
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.zw != nil {
+		if err := cw.zw.Flush(); err != nil {
+			cw.fail("write", err)
+		}
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap به http.ResponseController اجازه می‌دهد به writer اصلی برسد
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close انتهای stream gzip را می‌نویسد و writer را به pool برمی‌گرداند
+func (cw *compressWriter) close() {
+	if cw.zw == nil {
+		return
+	}
+	if err := cw.zw.Close(); err != nil {
+		cw.fail("write", err) // انتهای stream gzip نرسید؛ کلاینت body ناقص دارد
+	}
+	cw.zw.Reset(io.Discard) // به writer پاسخ قبلی اشاره نکند
+	cw.pool.Put(cw.zw)
+	cw.zw = nil
+}
+
+// addVary نام هدر را (اگر قبلاً نباشد) به Vary اضافه می‌کند
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values("Vary") {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"expvar"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// متن JSON حدود 8KB، مثل یک پاسخ لیست معمولی
+var benchBody = []byte(`[` + strings.Repeat(`{"id":12345,"name":"mini-http-server","tags":["a","b","c"]},`, 140) + `{}]`)
+
+func jsonHandler(body []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+// BenchmarkCompression کل compressionMiddleware (gzip.Writer از pool) را با ساختن یک gzip.Writer تازه
+// برای هر پاسخ مقایسه می‌کند؛ اختلاف allocs/op و B/op همان فشاری است که pool از GC برمی‌دارد
+func BenchmarkCompression(b *testing.B) {
+	req := httptest.NewRequest(http.MethodGet, "/api/list", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	b.Run("pooled", func(b *testing.B) {
+		h := compressionMiddleware(gzip.DefaultCompression)(jsonHandler(benchBody))
+		w := newDiscardWriter()
+		b.ReportAllocs()
+		b.SetBytes(int64(len(benchBody)))
+		for b.Loop() {
+			w.reset()
+			h.ServeHTTP(w, req)
+		}
+	})
+
+	b.Run("unpooled", func(b *testing.B) {
+		w := newDiscardWriter()
+		b.ReportAllocs()
+		b.SetBytes(int64(len(benchBody)))
+		for b.Loop() {
+			w.reset()
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			zw, _ := gzip.NewWriterLevel(w, gzip.DefaultCompression)
+			zw.Write(benchBody)
+			zw.Close()
+		}
+	})
+}
+
+// پاسخ فشرده‌شده‌ی middleware باید همان body اصلی را برگرداند
+func TestCompressionRoundTrip(t *testing.T) {
+	h := compressionMiddleware(gzip.DefaultCompression)(jsonHandler(benchBody))
+	req := httptest.NewRequest(http.MethodGet, "/api/list", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	for range 3 { // دور دوم و سوم writer دوباره‌استفاده‌شده از pool را می‌گیرند
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Content-Encoding = %q, want gzip", w.Header().Get("Content-Encoding"))
+		}
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got bytes.Buffer
+		if _, err := got.ReadFrom(zr); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), benchBody) {
+			t.Fatalf("decompressed body differs (%d bytes, want %d)", got.Len(), len(benchBody))
+		}
+	}
+}
+
+// اگر encoder ساخته نشود، پاسخ کامل با identity encoding و بدون Content-Encoding می‌رود و خطای init
+// شمرده و لاگ می‌شود
+func TestCompressionInitFailure(t *testing.T) {
+	logs := captureLogs(t)
+	prev := newGzipWriter
+	newGzipWriter = func(io.Writer, int) (*gzip.Writer, error) { return nil, errors.New("no encoder") }
+	t.Cleanup(func() { newGzipWriter = prev })
+
+	before := compressionErrorCount("init")
+	h := compressionMiddleware(gzip.DefaultCompression)(jsonHandler(benchBody))
+	req := httptest.NewRequest(http.MethodGet, "/api/list", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+	if ce := w.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("Content-Encoding = %q, want none", ce)
+	}
+	if !bytes.Equal(w.Body.Bytes(), benchBody) {
+		t.Errorf("body differs from identity body (%d bytes, want %d)", w.Body.Len(), len(benchBody))
+	}
+	if got := compressionErrorCount("init"); got != before+1 {
+		t.Errorf("compression_errors[init] = %d, want %d", got, before+1)
+	}
+	if !strings.Contains(logs.String(), "compression unavailable, sending identity encoding") {
+		t.Errorf("init failure not logged:\n%s", logs)
+	}
+}
+
+func compressionErrorCount(stage string) int64 {
+	if v, ok := compressionErrors.Get(stage).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestIsCompressible(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"text/html; charset=utf-8", true},
+		{"text/css", true},
+		{"image/svg+xml", true},
+		{"image/png", false},
+		{"image/jpeg", false},
+		{"application/gzip", false},
+		{"application/zip", false},
+		{"video/mp4", false},
+		{"application/octet-stream", false},
+		{"textual/plain", false}, // "text/*" فقط زیرنوع‌های text
+		{"", false},
+		{"not a media type", false},
+	}
+	for _, tt := range tests {
+		if got := isCompressible(tt.contentType); got != tt.want {
+			t.Errorf("isCompressible(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+// با COMPRESS_TYPES پیش‌فرض پاسخ JSON فشرده می‌شود ولی PNG (از قبل فشرده) دست نمی‌خورد
+func TestCompressionSkipsImages(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 4096)...)
+
+	tests := []struct {
+		contentType string
+		body        []byte
+		encoding    string
+	}{
+		{"application/json", benchBody, "gzip"},
+		{"image/png", png, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			h := compressionMiddleware(gzip.DefaultCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write(tt.body)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/file", nil)
+			req.Header.Set("Accept-Encoding", "gzip, br")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if tt.encoding == "" && !bytes.Equal(w.Body.Bytes(), tt.body) {
+				t.Errorf("uncompressed body changed (%d bytes, want %d)", w.Body.Len(), len(tt.body))
+			}
+		})
+	}
+}
+
+// فقط gzip پشتیبانی می‌شود؛ کلاینتی که gzip را قبول نمی‌کند پاسخ اصلی را می‌گیرد
+func TestCompressionGzipOnly(t *testing.T) {
+	h := compressionMiddleware(gzip.DefaultCompression)(jsonHandler(benchBody))
+
+	for _, ae := range []string{"br", "br, zstd", "gzip;q=0, br", "identity", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/api/list", nil)
+		if ae != "" {
+			req.Header.Set("Accept-Encoding", ae)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if ce := w.Header().Get("Content-Encoding"); ce != "" {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want none", ae, ce)
+		}
+		if !bytes.Equal(w.Body.Bytes(), benchBody) {
+			t.Errorf("Accept-Encoding %q: body changed", ae)
+		}
+	}
+}
@@ -0,0 +1,782 @@
+package main
+
+import (
+	"compress/gzip" // محدوده‌ی سطح فشرده‌سازی
+	"flag"          // فلگ -bind
+	"fmt"           // برای ساختن پیام خطای پیکربندی
+	"maps"          // افزودن flagهای FEATURES_FILE
+	"net"           // جدا کردن host و پورت
+	"net/netip"     // بررسی آدرس IP در HOST
+	"net/url"       // بررسی SITE_BASE_URL
+	"os"            // خواندن متغیرهای محیطی
+	"path/filepath" // مسیر پیش‌فرض پوشه‌ها
+	"regexp"        // بررسی نام host
+	"slices"        // بررسی نام بررسی‌های SELFTEST_CHECKS
+	"strconv"       // تبدیل مقدارهای عددی
+	"strings"       // کار با رشته‌ها
+	"time"          // مقدارهای زمانی مثل TTL
+)
+
+// ================= Config =================
+
+// Config همه‌ی تنظیمات سرور که در شروع برنامه از env خوانده می‌شوند
+type Config struct {
+	Port      string // پورت سرور (PORT)
+	Host      string // interface گوش دادن، مثل 127.0.0.1؛ خالی یعنی همه (HOST، یا BIND_ADDR و فلگ -bind با پورت اختیاری)
+	SchemaDir string // پوشه‌ی schemaهای اضافه (SCHEMA_DIR)
+
+	TrustedProxies []string      // CIDR پروکسی‌های مورد اعتماد (TRUSTED_PROXIES)
+	HSTSMaxAge     time.Duration // مدت Strict-Transport-Security برای درخواست‌های HTTPS؛ 0 یعنی خاموش (HSTS_MAX_AGE)
+	AnonymizeIPs   bool          // ناشناس کردن IP در لاگ‌ها (LOG_ANONYMIZE_IP)
+	LogFormat      string        // قالب لاگ: text یا json یا combined (LOG_FORMAT)
+	AccessLogSkip  []string      // مسیرهایی که access log ندارند (ACCESS_LOG_SKIP)
+	AccessLogDest  string        // مقصد access log: stdout، stderr یا مسیر فایل (ACCESS_LOG_DEST)
+	ErrorLogDest   string        // مقصد بقیه‌ی لاگ‌های برنامه: stdout، stderr یا مسیر فایل (ERROR_LOG_DEST)
+	Prefork        int           // تعداد پروسه‌های فرزند با SO_REUSEPORT؛ 0 یعنی خاموش (PREFORK)
+	H2C            bool          // HTTP/2 بدون TLS در کنار HTTP/1.1 (H2C)؛ prior knowledge و Upgrade: h2c
+	TLSCertFile    string        // فایل PEM گواهی (زنجیره‌ی کامل) برای HTTPS مستقیم؛ خالی یعنی HTTP (TLS_CERT_FILE)
+	TLSKeyFile     string        // فایل PEM کلید خصوصی همان گواهی (TLS_KEY_FILE)
+	RecoverPanics  bool          // panic هر handler با 500 جواب داده شود؛ false یعنی کرش پروسه (RECOVER_PANICS)
+	ErrorDetail    string        // safe: خطای داخلی فقط لاگ می‌شود، full: در پاسخ 5xx هم می‌آید (ERROR_DETAIL)
+	HealthVerbose  bool          // نسخه، commit، نسخه‌ی Go و uptime در پاسخ /health (HEALTH_VERBOSE)
+	SelfTestChecks []string      // بررسی‌های شروع: listener، static، schemas، dependencies یا none (SELFTEST_CHECKS)
+	SelfTestOnFail string        // warn، block (readiness تا موفقیت) یا abort (خروج) (SELFTEST_ON_FAIL)
+
+	WatchdogTimeout time.Duration // بدون پیشرفت سرو یا کارهای پس‌زمینه تا این مدت یعنی گیر کرده؛ صفر یعنی خاموش (WATCHDOG_TIMEOUT)
+	WatchdogAction  string        // livez (503 در /livez) یا exit (خروج پروسه) (WATCHDOG_ACTION)
+
+	// هدرهایی که روی همه‌ی پاسخ‌ها گذاشته می‌شوند، مثل X-App-Env=prod؛ مقدار خالی (X-Powered-By=) یعنی حذف (DEFAULT_HEADERS)
+	DefaultHeaders map[string]string
+	ServerHeader   string // مقدار هدر Server همه‌ی پاسخ‌ها؛ خالی یعنی حذف آن (SERVER_HEADER)
+
+	// سیگنال‌های شروع graceful shutdown؛ SIGQUIT همیشه اول stack goroutineها را لاگ می‌کند (SHUTDOWN_SIGNALS)
+	ShutdownSignals []string
+	PrestopDelay    time.Duration // مهلت سرو ادامه‌دار بعد از 503 شدن /readyz و قبل از Shutdown (PRESTOP_DELAY)
+
+	GeoIPDB             string   // مسیر دیتابیس MaxMind (GEOIP_DB)
+	GeoIPBlockCountries []string // کد کشورهای مسدود (GEOIP_BLOCK_COUNTRIES)
+
+	IndexFile               string   // فایل صفحه‌ی اصلی و index پوشه‌های static (INDEX_FILE)
+	StaticPreload           []string // globهای فایل‌هایی که در شروع در حافظه بارگذاری می‌شوند (STATIC_PRELOAD)
+	StaticCacheBytes        int64    // سقف حجم cache فایل‌های static؛ 0 یعنی خاموش (STATIC_CACHE_BYTES)
+	StaticCacheMaxFileBytes int64    // فایل‌های بزرگ‌تر از این cache نمی‌شوند (STATIC_CACHE_MAX_FILE_BYTES)
+
+	// max-age (ثانیه) فایل‌های static؛ اگر هر دو خالی باشند Cache-Control گذاشته نمی‌شود
+	StaticMaxAge    int            // پسوندهایی که در map نیستند (STATIC_MAXAGE)
+	StaticMaxAgeMap map[string]int // به ازای پسوند، مثل .js=31536000,.png=3600 (STATIC_MAXAGE_MAP)
+
+	// پوشه‌ی static هر دامنه، مثل a.example.com=static-a (VHOSTS)؛ خالی یعنی فقط ./static
+	VHosts        map[string]string
+	VHostFallback string // سایت hostهای ناشناخته: default (./static) یا 404 (VHOST_FALLBACK)
+
+	StaticManifest       bool // نام‌های hashدار و /static/manifest.json (STATIC_MANIFEST)
+	StaticManifestReload bool // ساخت دوباره‌ی manifest با تغییر فایل‌ها، برای محیط توسعه (STATIC_MANIFEST_RELOAD)
+	StaticDigest         bool // ETag و Repr-Digest برای فایل‌هایی که از دیسک سرو می‌شوند (STATIC_DIGEST)
+
+	SiteBaseURL string // آدرس عمومی سایت برای /sitemap.xml، مثل https://example.com؛ خالی یعنی خاموش (SITE_BASE_URL)
+
+	MaxURLLen        int   // سقف طول مسیر و query درخواست (بایت)؛ 0 یعنی خاموش (MAX_URL_LEN)
+	StrictFraming    bool  // رد درخواست‌های HTTP/1.x با Content-Length/Transfer-Encoding مبهم (STRICT_FRAMING)
+	MaxResponseBytes int64 // سقف حجم body هر پاسخ؛ 0 یعنی خاموش (MAX_RESPONSE_BYTES)
+	MaxJSONBodyBytes int64 // سقف حجم body درخواست‌های JSON و فرم (MAX_JSON_BODY_BYTES)
+	CompressionLevel int   // سطح gzip پاسخ‌های پویا از 1 (سریع) تا 9 (کوچک)؛ 0 یعنی خاموش (COMPRESSION_LEVEL)
+
+	// media typeهایی که فشرده می‌شوند، مثل text/*,application/json (COMPRESS_TYPES)
+	CompressTypes []string
+
+	MaxConcurrent int           // سقف درخواست‌های همزمان؛ 0 یعنی خاموش (MAX_CONCURRENT)
+	QueueSize     int           // حداکثر درخواست منتظر slot قبل از 503 فوری (QUEUE_SIZE)
+	QueueTimeout  time.Duration // حداکثر انتظار در صف (QUEUE_TIMEOUT)
+	MaxConnsPerIP int           // سقف اتصال‌های باز هر IP (جز پروکسی‌های مورد اعتماد)؛ 0 یعنی خاموش (MAX_CONNS_PER_IP)
+	MaxStreams    int           // سقف کلاینت‌های همزمان SSE و WebSocket؛ 0 یعنی بدون سقف (MAX_STREAM_CLIENTS)
+
+	TCPKeepAlivePeriod time.Duration // دوره‌ی keep-alive سطح TCP اتصال‌ها؛ 0 یعنی پیش‌فرض Go (TCP_KEEPALIVE_PERIOD)
+
+	MinBodyRate      int64         // حداقل نرخ رسیدن body (بایت در ثانیه)؛ 0 یعنی خاموش (MIN_BODY_RATE)
+	MinBodyRateGrace time.Duration // مهلت اولیه‌ی body قبل از اعمال نرخ (MIN_BODY_RATE_GRACE)
+
+	ResponseCacheTTL time.Duration // مدت cache پاسخ‌های GET در API؛ 0 یعنی خاموش (RESPONSE_CACHE_TTL)
+	IdempotencyTTL   time.Duration // مدت نگه‌داری پاسخ هر Idempotency-Key؛ 0 یعنی خاموش (IDEMPOTENCY_TTL)
+
+	RequestTimeout    time.Duration // timeout پیش‌فرض درخواست‌های API؛ 0 یعنی خاموش (REQUEST_TIMEOUT)
+	RequestTimeoutMax time.Duration // سقف timeoutی که کلاینت با X-Request-Timeout می‌خواهد (REQUEST_TIMEOUT_MAX)
+
+	// timeout اختصاصی بعضی routeها به جای REQUEST_TIMEOUT، مثل /health=1s (ROUTE_TIMEOUTS)
+	RouteTimeouts map[string]time.Duration
+
+	UploadDir      string        // پوشه‌ی فایل‌های آپلود قابل ادامه (UPLOAD_DIR)
+	UploadMaxBytes int64         // سقف حجم هر آپلود (و کل فرم multipart)؛ 0 یعنی خاموش، پیش‌فرض (UPLOAD_MAX_BYTES)
+	UploadMaxParts int           // سقف تعداد partهای آپلود multipart (UPLOAD_MAX_PARTS)
+	UploadMaxCount int           // سقف تعداد آپلودهای نگه‌داشته‌شده، ناتمام و کامل (UPLOAD_MAX_ACTIVE)
+	UploadTTL      time.Duration // آپلود ناتمام بعد از این مدت بی‌فعالیتی پاک می‌شود (UPLOAD_TTL)
+
+	KVMaxKeys       int // سقف تعداد کلیدهای /api/kv؛ 0 یعنی خاموش، نیاز به ADMIN_PASSWORD (KV_MAX_KEYS)
+	KVMaxValueBytes int // سقف حجم JSON هر مقدار (KV_MAX_VALUE_BYTES)
+
+	Upstreams        []string      // backendهای reverse proxy با وزن اختیاری؛ خالی یعنی خاموش (UPSTREAMS یا UPSTREAM_URL)
+	ProxyPrefix      string        // مسیری که به upstream فرستاده می‌شود (PROXY_PREFIX)
+	CanaryUpstreams  []string      // نسخه‌ی canary همان backend؛ درصد با canary "upstreams" (CANARY_UPSTREAMS)
+	BreakerThreshold int           // تعداد خطای پشت‌سرهم برای باز شدن circuit breaker (BREAKER_THRESHOLD)
+	BreakerCooldown  time.Duration // مدت باز ماندن breaker قبل از آزمایش دوباره (BREAKER_COOLDOWN)
+	ProxyRetries     int           // حداکثر تلاش دوباره‌ی GET/HEAD روی خطای اتصال یا 502/503/504؛ صفر یعنی خاموش (PROXY_RETRIES)
+	ProxyRetryWait   time.Duration // فاصله‌ی اولین تلاش دوباره؛ هر بار دو برابر می‌شود (PROXY_RETRY_BACKOFF)
+	ProxyFlush       time.Duration // فاصله‌ی flush پاسخ upstream؛ proxyFlushImmediate یعنی بعد از هر Write (PROXY_FLUSH_INTERVAL)
+	ProxyBufferSize  int           // اندازه‌ی بافرهای کپی body پاسخ upstream (PROXY_BUFFER_SIZE)
+
+	// prefix → upstreamها و گزینه‌ها، مثل /users/=http://users:8080;strip؛ هر کدام pool خودش را دارد (PROXY_ROUTES)
+	ProxyRoutes map[string]string
+
+	// مقدار اولیه‌ی تنظیمات زمان اجرا (بعداً از /admin/config قابل تغییر است)
+	Runtime RuntimeConfig // MAINTENANCE, RATE_LIMIT_RPS, RATE_LIMIT_BURST, LOG_LEVEL, FEATURES, CANARIES
+
+	FeaturesFile  string            // فایل name=bool که flagهای FEATURES را تکمیل می‌کند و با SIGHUP دوباره خوانده می‌شود (FEATURES_FILE)
+	FeatureRoutes map[string]string // prefix مسیر → flagی که آن را پنهان یا آشکار می‌کند (FEATURE_ROUTES)
+
+	// سیاست CORS پیش‌فرض (مسیرهای /admin/ سیاست جدای خودشان را دارند)
+	CORS CORSConfig // CORS_ALLOW_ORIGINS, CORS_ALLOW_METHODS, CORS_ALLOW_HEADERS, CORS_ALLOW_CREDENTIALS, CORS_MAX_AGE
+
+	AdminAllowIPs []string // IP/CIDRهای مجاز برای شرط ip مسیرهای محافظت‌شده (ADMIN_ALLOW_IPS)
+	AdminUser     string   // نام کاربری basic auth ادمین (ADMIN_USER)
+	AdminPassword string   // رمز ادمین؛ خالی یعنی API ادمین خاموش (ADMIN_PASSWORD)
+
+	// شرط‌های هر prefix حساس، مثل /debug/=ip+token؛ /admin/، /debug/ و /api/env همیشه قاعده دارند (PROTECTED_PATHS)
+	ProtectedPaths    map[string]string
+	AccessToken       string // توکن مشترک شرط token؛ خالی یعنی شرط token قابل استفاده نیست (ACCESS_TOKEN)
+	AccessTokenHeader string // هدر حامل توکن (ACCESS_TOKEN_HEADER)
+
+	// توکن مشترک سرویس‌به‌سرویس شرط internal؛ خالی یعنی شرط internal قابل استفاده نیست (INTERNAL_TOKEN)
+	InternalToken       string
+	InternalTokenHeader string // هدر حامل توکن داخلی (INTERNAL_TOKEN_HEADER)
+
+	AuditLog string // مقصد audit log؛ مسیر فایل یا "-" برای stderr (AUDIT_LOG)
+}
+
+// loadConfig تنظیمات را از متغیرهای محیطی می‌خواند و مقدار پیش‌فرض می‌گذارد
+func loadConfig() (Config, error) {
+
+	cfg := Config{
+		Port:                envString("PORT", "8080"),
+		Host:                strings.TrimSpace(os.Getenv("HOST")),
+		SchemaDir:           os.Getenv("SCHEMA_DIR"),
+		LogFormat:           strings.ToLower(envString("LOG_FORMAT", "text")),
+		ErrorDetail:         strings.ToLower(envString("ERROR_DETAIL", "safe")),
+		ErrorLogDest:        envString("ERROR_LOG_DEST", "stderr"),
+		AccessLogDest:       os.Getenv("ACCESS_LOG_DEST"),
+		SelfTestOnFail:      strings.ToLower(envString("SELFTEST_ON_FAIL", selfTestWarn)),
+		WatchdogAction:      strings.ToLower(envString("WATCHDOG_ACTION", watchdogLivez)),
+		VHostFallback:       strings.ToLower(envString("VHOST_FALLBACK", vhostFallbackDefault)),
+		TrustedProxies:      envList("TRUSTED_PROXIES"),
+		GeoIPDB:             os.Getenv("GEOIP_DB"),
+		TLSCertFile:         os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:          os.Getenv("TLS_KEY_FILE"),
+		SiteBaseURL:         os.Getenv("SITE_BASE_URL"),
+		ServerHeader:        strings.TrimSpace(os.Getenv("SERVER_HEADER")),
+		GeoIPBlockCountries: envList("GEOIP_BLOCK_COUNTRIES"),
+		IndexFile:           envString("INDEX_FILE", "index.html"),
+		StaticPreload:       envList("STATIC_PRELOAD"),
+		AdminAllowIPs:       envList("ADMIN_ALLOW_IPS"),
+		AdminUser:           envString("ADMIN_USER", "admin"),
+		AdminPassword:       os.Getenv("ADMIN_PASSWORD"),
+		AccessToken:         os.Getenv("ACCESS_TOKEN"),
+		AccessTokenHeader:   envString("ACCESS_TOKEN_HEADER", "X-Access-Token"),
+		InternalToken:       os.Getenv("INTERNAL_TOKEN"),
+		InternalTokenHeader: envString("INTERNAL_TOKEN_HEADER", "X-Internal-Token"),
+		AuditLog:            envString("AUDIT_LOG", "-"),
+		UploadDir:           envString("UPLOAD_DIR", filepath.Join(os.TempDir(), "mini-http-server-uploads")),
+		Upstreams:           envList("UPSTREAMS"),
+		ProxyPrefix:         envString("PROXY_PREFIX", "/proxy/"),
+		CanaryUpstreams:     envList("CANARY_UPSTREAMS"),
+		FeaturesFile:        os.Getenv("FEATURES_FILE"),
+	}
+
+	// -------- CORS --------
+	cfg.CORS = CORSConfig{
+		AllowedOrigins: envList("CORS_ALLOW_ORIGINS"),
+		AllowedMethods: envList("CORS_ALLOW_METHODS"),
+		AllowedHeaders: envList("CORS_ALLOW_HEADERS"),
+		ExposedHeaders: []string{"X-Request-ID", "Retry-After", "Idempotent-Replayed"},
+	}
+	if len(cfg.CORS.AllowedMethods) == 0 {
+		cfg.CORS.AllowedMethods = []string{"GET", "POST", "PATCH", "HEAD"}
+	}
+	if len(cfg.CORS.AllowedHeaders) == 0 {
+		cfg.CORS.AllowedHeaders = []string{"Content-Type", "X-Request-ID", "X-Request-Timeout", "Idempotency-Key"}
+	}
+
+	// probe پرتکرار /api/ping لاگ را شلوغ نمی‌کند
+	if cfg.AccessLogSkip = envList("ACCESS_LOG_SKIP"); len(cfg.AccessLogSkip) == 0 {
+		cfg.AccessLogSkip = []string{"/api/ping"}
+	}
+
+	// متن‌ها فشرده می‌شوند؛ تصویر و فایل‌های از قبل فشرده نه
+	if cfg.CompressTypes = envList("COMPRESS_TYPES"); len(cfg.CompressTypes) == 0 {
+		cfg.CompressTypes = defaultCompressTypes
+	}
+	for _, t := range cfg.CompressTypes {
+		if !validCompressType(t) {
+			return cfg, fmt.Errorf("COMPRESS_TYPES: %q must be a lowercase type/subtype or type/*", t)
+		}
+	}
+
+	// Ctrl+C و kill
+	if cfg.ShutdownSignals = envList("SHUTDOWN_SIGNALS"); len(cfg.ShutdownSignals) == 0 {
+		cfg.ShutdownSignals = []string{"SIGINT", "SIGTERM"}
+	}
+
+	// پیش‌فرض: ادمین فقط از خود سرور
+	if len(cfg.AdminAllowIPs) == 0 {
+		cfg.AdminAllowIPs = []string{"127.0.0.1", "::1"}
+	}
+
+	var err error
+	if cfg.StaticCacheBytes, err = envInt64("STATIC_CACHE_BYTES", 32<<20); err != nil {
+		return cfg, err
+	}
+	if cfg.StaticCacheMaxFileBytes, err = envInt64("STATIC_CACHE_MAX_FILE_BYTES", 1<<20); err != nil {
+		return cfg, err
+	}
+	if cfg.StaticMaxAge, err = envInt("STATIC_MAXAGE", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.StaticMaxAgeMap, err = envIntMap("STATIC_MAXAGE_MAP"); err != nil {
+		return cfg, err
+	}
+	if cfg.VHosts, err = envStringMap("VHOSTS"); err != nil {
+		return cfg, err
+	}
+	if cfg.StaticManifest, err = envBool("STATIC_MANIFEST", false); err != nil {
+		return cfg, err
+	}
+	if cfg.StaticManifestReload, err = envBool("STATIC_MANIFEST_RELOAD", false); err != nil {
+		return cfg, err
+	}
+	if cfg.StaticDigest, err = envBool("STATIC_DIGEST", true); err != nil {
+		return cfg, err
+	}
+
+	if cfg.ProxyRoutes, err = envStringMap("PROXY_ROUTES"); err != nil {
+		return cfg, err
+	}
+
+	// مسیرهای ادمین، debug و /api/env هیچ‌وقت بدون قاعده نمی‌مانند؛ بدون ADMIN_PASSWORD فقط IP بررسی می‌شود
+	if cfg.ProtectedPaths, err = envStringMap("PROTECTED_PATHS"); err != nil {
+		return cfg, err
+	}
+	defaultProtect := "ip+basic"
+	if cfg.AdminPassword == "" {
+		defaultProtect = "ip"
+	}
+	for _, prefix := range []string{"/admin/", "/debug/", "/api/env"} {
+		if _, ok := cfg.ProtectedPaths[prefix]; !ok {
+			cfg.ProtectedPaths[prefix] = defaultProtect
+		}
+	}
+	if cfg.CORS.AllowCredentials, err = envBool("CORS_ALLOW_CREDENTIALS", false); err != nil {
+		return cfg, err
+	}
+	if cfg.CORS.MaxAge, err = envDuration("CORS_MAX_AGE", 10*time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.Prefork, err = envInt("PREFORK", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.H2C, err = envBool("H2C", false); err != nil {
+		return cfg, err
+	}
+	if cfg.RecoverPanics, err = envBool("RECOVER_PANICS", true); err != nil {
+		return cfg, err
+	}
+	if cfg.HealthVerbose, err = envBool("HEALTH_VERBOSE", false); err != nil {
+		return cfg, err
+	}
+	// 8KB همان سقف رایج request line در nginx و Apache است
+	if cfg.MaxURLLen, err = envInt("MAX_URL_LEN", 8192); err != nil {
+		return cfg, err
+	}
+	if cfg.StrictFraming, err = envBool("STRICT_FRAMING", false); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxResponseBytes, err = envInt64("MAX_RESPONSE_BYTES", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxJSONBodyBytes, err = envInt64("MAX_JSON_BODY_BYTES", 1<<20); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxConcurrent, err = envInt("MAX_CONCURRENT", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.QueueSize, err = envInt("QUEUE_SIZE", 100); err != nil {
+		return cfg, err
+	}
+	if cfg.QueueTimeout, err = envDuration("QUEUE_TIMEOUT", 2*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxConnsPerIP, err = envInt("MAX_CONNS_PER_IP", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxStreams, err = envInt("MAX_STREAM_CLIENTS", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.TCPKeepAlivePeriod, err = envDuration("TCP_KEEPALIVE_PERIOD", 0); err != nil {
+		return cfg, err
+	}
+	// پیش‌فرض 6 همان تعادل سرعت و حجم در zlib است
+	if cfg.CompressionLevel, err = envInt("COMPRESSION_LEVEL", 6); err != nil {
+		return cfg, err
+	}
+	if cfg.ResponseCacheTTL, err = envDuration("RESPONSE_CACHE_TTL", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.IdempotencyTTL, err = envDuration("IDEMPOTENCY_TTL", 24*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.HSTSMaxAge, err = envDuration("HSTS_MAX_AGE", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.DefaultHeaders, err = envHeaderMap("DEFAULT_HEADERS"); err != nil {
+		return cfg, err
+	}
+	if cfg.RequestTimeout, err = envDuration("REQUEST_TIMEOUT", 5*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.RequestTimeoutMax, err = envDuration("REQUEST_TIMEOUT_MAX", 30*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.RouteTimeouts, err = envDurationMap("ROUTE_TIMEOUTS"); err != nil {
+		return cfg, err
+	}
+	if cfg.UploadMaxBytes, err = envInt64("UPLOAD_MAX_BYTES", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.UploadMaxParts, err = envInt("UPLOAD_MAX_PARTS", 10); err != nil {
+		return cfg, err
+	}
+	if cfg.UploadMaxCount, err = envInt("UPLOAD_MAX_ACTIVE", 100); err != nil {
+		return cfg, err
+	}
+	if cfg.UploadTTL, err = envDuration("UPLOAD_TTL", 24*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.PrestopDelay, err = envDuration("PRESTOP_DELAY", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.MinBodyRate, err = envInt64("MIN_BODY_RATE", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.MinBodyRateGrace, err = envDuration("MIN_BODY_RATE_GRACE", 2*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.KVMaxKeys, err = envInt("KV_MAX_KEYS", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.KVMaxValueBytes, err = envInt("KV_MAX_VALUE_BYTES", 64<<10); err != nil {
+		return cfg, err
+	}
+	if cfg.BreakerThreshold, err = envInt("BREAKER_THRESHOLD", 5); err != nil {
+		return cfg, err
+	}
+	if cfg.BreakerCooldown, err = envDuration("BREAKER_COOLDOWN", 30*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.ProxyRetries, err = envInt("PROXY_RETRIES", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.ProxyRetryWait, err = envDuration("PROXY_RETRY_BACKOFF", 100*time.Millisecond); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("PROXY_FLUSH_INTERVAL"); v != "" {
+		if cfg.ProxyFlush, err = parseFlushInterval(v); err != nil {
+			return cfg, fmt.Errorf("PROXY_FLUSH_INTERVAL: %w", err)
+		}
+	}
+	if cfg.ProxyBufferSize, err = envInt("PROXY_BUFFER_SIZE", defaultProxyBufferSize); err != nil {
+		return cfg, err
+	}
+	if cfg.AnonymizeIPs, err = envBool("LOG_ANONYMIZE_IP", false); err != nil {
+		return cfg, err
+	}
+
+	// -------- Runtime --------
+	cfg.Runtime.LogLevel = envString("LOG_LEVEL", "info")
+	if cfg.Runtime.Maintenance, err = envBool("MAINTENANCE", false); err != nil {
+		return cfg, err
+	}
+	if cfg.Runtime.RateLimitRPS, err = envFloat("RATE_LIMIT_RPS", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.Runtime.RateLimitBurst, err = envInt("RATE_LIMIT_BURST", 20); err != nil {
+		return cfg, err
+	}
+	if cfg.Runtime.Features, err = envBoolMap("FEATURES"); err != nil {
+		return cfg, err
+	}
+	if cfg.FeaturesFile != "" {
+		flags, err := readFeaturesFile(cfg.FeaturesFile)
+		if err != nil {
+			return cfg, fmt.Errorf("FEATURES_FILE: %w", err)
+		}
+		maps.Copy(cfg.Runtime.Features, flags)
+	}
+	if cfg.FeatureRoutes, err = envStringMap("FEATURE_ROUTES"); err != nil {
+		return cfg, err
+	}
+	for prefix, name := range cfg.FeatureRoutes {
+		if !strings.HasPrefix(prefix, "/") {
+			return cfg, fmt.Errorf("FEATURE_ROUTES: prefix must start with /, got %q", prefix)
+		}
+		if _, ok := cfg.Runtime.Features[name]; !ok {
+			return cfg, fmt.Errorf("FEATURE_ROUTES: %s uses feature %q, which FEATURES or FEATURES_FILE does not declare", prefix, name)
+		}
+	}
+	if cfg.Runtime.Canaries, err = envIntMap("CANARIES"); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Runtime.validate(); err != nil {
+		return cfg, err
+	}
+
+	// UPSTREAM_URL همان حالت تک‌upstream است
+	if len(cfg.Upstreams) == 0 {
+		if u := os.Getenv("UPSTREAM_URL"); u != "" {
+			cfg.Upstreams = []string{u}
+		}
+	}
+
+	// INDEX_FILE فقط نام فایل است، نه مسیر
+	if strings.ContainsAny(cfg.IndexFile, `/\`) || cfg.IndexFile == ".." {
+		return cfg, fmt.Errorf("INDEX_FILE: must be a file name, got %q", cfg.IndexFile)
+	}
+
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" && cfg.LogFormat != "combined" {
+		return cfg, fmt.Errorf("LOG_FORMAT: must be text, json or combined, got %q", cfg.LogFormat)
+	}
+
+	// بدون SELFTEST_CHECKS همه‌ی بررسی‌ها؛ none یعنی خاموش
+	switch cfg.SelfTestChecks = envList("SELFTEST_CHECKS"); {
+	case len(cfg.SelfTestChecks) == 0:
+		cfg.SelfTestChecks = selfTestNames
+	case len(cfg.SelfTestChecks) == 1 && cfg.SelfTestChecks[0] == "none":
+		cfg.SelfTestChecks = nil
+	}
+	for _, name := range cfg.SelfTestChecks {
+		if !slices.Contains(selfTestNames, name) {
+			return cfg, fmt.Errorf("SELFTEST_CHECKS: unknown check %q (want %s or none)", name, strings.Join(selfTestNames, ", "))
+		}
+	}
+	if cfg.SelfTestOnFail != selfTestWarn && cfg.SelfTestOnFail != selfTestBlock && cfg.SelfTestOnFail != selfTestAbort {
+		return cfg, fmt.Errorf("SELFTEST_ON_FAIL: must be warn, block or abort, got %q", cfg.SelfTestOnFail)
+	}
+	if cfg.WatchdogTimeout, err = envDuration("WATCHDOG_TIMEOUT", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.WatchdogTimeout > 0 && cfg.WatchdogTimeout < time.Second {
+		return cfg, fmt.Errorf("WATCHDOG_TIMEOUT: must be 0 (off) or at least 1s, got %s", cfg.WatchdogTimeout)
+	}
+	if cfg.WatchdogAction != watchdogLivez && cfg.WatchdogAction != watchdogExit {
+		return cfg, fmt.Errorf("WATCHDOG_ACTION: must be livez or exit, got %q", cfg.WatchdogAction)
+	}
+
+	// بدون ACCESS_LOG_DEST همان رفتار قبلی: combined روی stdout و بقیه کنار لاگ‌های برنامه
+	if cfg.AccessLogDest == "" {
+		cfg.AccessLogDest = cfg.ErrorLogDest
+		if cfg.LogFormat == "combined" {
+			cfg.AccessLogDest = "stdout"
+		}
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return cfg, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.H2C && cfg.TLSCertFile != "" {
+		return cfg, fmt.Errorf("H2C: cannot be combined with TLS_CERT_FILE (HTTPS already negotiates HTTP/2)")
+	}
+
+	if cfg.ErrorDetail != "safe" && cfg.ErrorDetail != "full" {
+		return cfg, fmt.Errorf("ERROR_DETAIL: must be safe or full, got %q", cfg.ErrorDetail)
+	}
+
+	if cfg.VHostFallback != vhostFallbackDefault && cfg.VHostFallback != vhostFallbackNotFound {
+		return cfg, fmt.Errorf("VHOST_FALLBACK: must be default or 404, got %q", cfg.VHostFallback)
+	}
+
+	// BIND_ADDR (و فلگ -bind که بر آن مقدم است) host و در صورت وجود پورت را با هم تعیین می‌کند
+	bind, err := parseFlags(os.Args[1:])
+	if err != nil {
+		return cfg, err
+	}
+	if bind == "" {
+		bind = strings.TrimSpace(os.Getenv("BIND_ADDR"))
+	}
+	if bind != "" {
+		cfg.Host, cfg.Port = splitBindAddr(bind, cfg.Port)
+	}
+	if !validHost(cfg.Host) {
+		return cfg, fmt.Errorf("HOST/BIND_ADDR: invalid host %q; use an IP address like 127.0.0.1 or a host name", cfg.Host)
+	}
+	if p, err := strconv.Atoi(cfg.Port); err != nil || p < 0 || p > 65535 {
+		return cfg, fmt.Errorf("PORT: must be a number between 0 and 65535, got %q", cfg.Port)
+	}
+
+	// kernel دوره‌ی keep-alive را به ثانیه‌ی کامل گرد می‌کند
+	if cfg.TCPKeepAlivePeriod > 0 && cfg.TCPKeepAlivePeriod < time.Second {
+		return cfg, fmt.Errorf("TCP_KEEPALIVE_PERIOD: must be at least 1s, got %s", cfg.TCPKeepAlivePeriod)
+	}
+
+	// هدر Server فقط با SERVER_HEADER تنظیم می‌شود
+	for name := range cfg.DefaultHeaders {
+		if strings.EqualFold(name, "Server") {
+			return cfg, fmt.Errorf("DEFAULT_HEADERS: use SERVER_HEADER to set or remove the Server header")
+		}
+	}
+
+	// آدرس‌های sitemap باید کامل باشند (scheme و host)
+	if cfg.SiteBaseURL != "" {
+		u, err := url.Parse(cfg.SiteBaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return cfg, fmt.Errorf("SITE_BASE_URL: must be an absolute http(s) URL like https://example.com, got %q", cfg.SiteBaseURL)
+		}
+	}
+
+	// prefix proxy باید مسیر پوشه‌ای مثل /proxy/ باشد
+	if !strings.HasPrefix(cfg.ProxyPrefix, "/") || !strings.HasSuffix(cfg.ProxyPrefix, "/") || cfg.ProxyPrefix == "/" {
+		return cfg, fmt.Errorf("PROXY_PREFIX: must look like /name/, got %q", cfg.ProxyPrefix)
+	}
+	if len(cfg.CanaryUpstreams) > 0 && len(cfg.Upstreams) == 0 {
+		return cfg, fmt.Errorf("CANARY_UPSTREAMS: requires UPSTREAMS or UPSTREAM_URL")
+	}
+	if cfg.CompressionLevel > gzip.BestCompression {
+		return cfg, fmt.Errorf("COMPRESSION_LEVEL: must be between 0 and 9, got %d", cfg.CompressionLevel)
+	}
+	if cfg.BreakerThreshold < 1 {
+		return cfg, fmt.Errorf("BREAKER_THRESHOLD: must be >= 1")
+	}
+	if cfg.KVMaxKeys > 0 && cfg.AdminPassword == "" {
+		return cfg, fmt.Errorf("KV_MAX_KEYS: writes to /api/kv require ADMIN_PASSWORD")
+	}
+	if cfg.UploadMaxParts < 1 {
+		return cfg, fmt.Errorf("UPLOAD_MAX_PARTS: must be at least 1")
+	}
+	if cfg.UploadMaxCount < 1 {
+		return cfg, fmt.Errorf("UPLOAD_MAX_ACTIVE: must be at least 1")
+	}
+	if cfg.MaxJSONBodyBytes < 1 {
+		return cfg, fmt.Errorf("MAX_JSON_BODY_BYTES: must be at least 1")
+	}
+	if cfg.KVMaxValueBytes < 1 || int64(cfg.KVMaxValueBytes) > cfg.MaxJSONBodyBytes {
+		return cfg, fmt.Errorf("KV_MAX_VALUE_BYTES: must be between 1 and MAX_JSON_BODY_BYTES (%d)", cfg.MaxJSONBodyBytes)
+	}
+	if cfg.ProxyRetries > 10 {
+		return cfg, fmt.Errorf("PROXY_RETRIES: must be at most 10, got %d", cfg.ProxyRetries) // backoff هر بار دو برابر می‌شود
+	}
+	if cfg.ProxyBufferSize < 1<<10 || cfg.ProxyBufferSize > 16<<20 {
+		return cfg, fmt.Errorf("PROXY_BUFFER_SIZE: must be between 1KB and 16MB, got %d", cfg.ProxyBufferSize)
+	}
+
+	// کد کشورها همیشه با حروف بزرگ مقایسه می‌شوند (مثل IR یا US)
+	for i, c := range cfg.GeoIPBlockCountries {
+		if len(c) != 2 {
+			return cfg, fmt.Errorf("GEOIP_BLOCK_COUNTRIES: invalid country code %q", c)
+		}
+		cfg.GeoIPBlockCountries[i] = strings.ToUpper(c)
+	}
+
+	return cfg, nil
+}
+
+// envString مقدار env یا مقدار پیش‌فرض را برمی‌گرداند
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envList مقدار env را با کاما جدا می‌کند و فاصله‌ها و آیتم‌های خالی را حذف می‌کند
+func envList(key string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// envInt64 مقدار عددی env را می‌خواند؛ مقدار نامعتبر یا منفی خطا است
+func envInt64(key string, def int64) (int64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s: invalid number %q", key, v)
+	}
+	return n, nil
+}
+
+// envDuration مقدار زمانی env را می‌خواند (مثل 500ms یا 2s)
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s: invalid duration %q", key, v)
+	}
+	return d, nil
+}
+
+// envDurationMap لیست key=duration جداشده با کاما را می‌خواند (مثل /health=1s,/api/echo=2s)
+func envDurationMap(key string) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration)
+	for _, item := range envList(key) {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: expected key=duration, got %q", key, item)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("%s: invalid duration %q", key, v)
+		}
+		out[strings.TrimSpace(k)] = d
+	}
+	return out, nil
+}
+
+// envStringMap لیست key=value جداشده با کاما را می‌خواند (مثل a.example.com=static-a)
+func envStringMap(key string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, item := range envList(key) {
+		k, v, ok := strings.Cut(item, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("%s: expected key=value, got %q", key, item)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// parseFlags فلگ‌های خط فرمان را می‌خواند؛ تنظیمات دیگر فقط از env هستند.
+// فرزندهای prefork همان آرگومان‌ها را می‌گیرند.
+func parseFlags(args []string) (bind string, err error) {
+	fs := flag.NewFlagSet("mini-http-server", flag.ContinueOnError)
+	fs.StringVar(&bind, "bind", "", "listen address as host or host:port, e.g. 127.0.0.1:8080 (overrides BIND_ADDR, HOST and PORT)")
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() > 0 {
+		return "", fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	return bind, nil
+}
+
+// splitBindAddr مقدار BIND_ADDR را به host و پورت جدا می‌کند؛ بدون پورت، port قبلی می‌ماند.
+// IPv6 با پورت باید در [] باشد، مثل [::1]:8080.
+func splitBindAddr(addr, port string) (string, string) {
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		return h, p
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"), port
+}
+
+// validHost آدرس IP یا نام host معتبر (یا خالی برای همه‌ی interfaceها)
+func validHost(h string) bool {
+	if h == "" {
+		return true
+	}
+	if _, err := netip.ParseAddr(h); err == nil {
+		return true
+	}
+	return hostNameRe.MatchString(h)
+}
+
+var hostNameRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
+// listenAddr آدرس http.Server.Addr؛ IPv6 داخل [] قرار می‌گیرد
+func (c Config) listenAddr() string {
+	return net.JoinHostPort(c.Host, c.Port)
+}
+
+// envHeaderMap لیست Name=value هدرها را می‌خواند؛ برخلاف envStringMap مقدار خالی مجاز است (یعنی حذف هدر).
+// مقدارها نمی‌توانند کاما داشته باشند چون کاما جداکننده‌ی لیست است.
+func envHeaderMap(key string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, item := range envList(key) {
+		k, v, ok := strings.Cut(item, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || strings.ContainsAny(k, " \t:\"(),/;<>?@[\\]{}") {
+			return nil, fmt.Errorf("%s: expected Header-Name=value, got %q", key, item)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// envIntMap لیست key=عدد جداشده با کاما را می‌خواند (مثل .js=31536000,.png=3600)
+func envIntMap(key string) (map[string]int, error) {
+	out := make(map[string]int)
+	for _, item := range envList(key) {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: expected key=number, got %q", key, item)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s: invalid number %q", key, v)
+		}
+		out[strings.TrimSpace(k)] = n
+	}
+	return out, nil
+}
+
+// envBoolMap لیست name=bool جداشده با کاما را می‌خواند (مثل beta_api=true,new_ui=false)
+func envBoolMap(key string) (map[string]bool, error) {
+	out := make(map[string]bool)
+	for _, item := range envList(key) {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: expected name=bool, got %q", key, item)
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid boolean %q", key, v)
+		}
+		out[strings.TrimSpace(k)] = b
+	}
+	return out, nil
+}
+
+// envInt نسخه‌ی int از envInt64
+func envInt(key string, def int) (int, error) {
+	n, err := envInt64(key, int64(def))
+	return int(n), err
+}
+
+// envFloat مقدار اعشاری غیرمنفی env را می‌خواند
+func envFloat(key string, def float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("%s: invalid number %q", key, v)
+	}
+	return f, nil
+}
+
+// envBool مقدارهایی مثل 1, true, 0, false را می‌خواند
+func envBool(key string, def bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid boolean %q", key, v)
+	}
+	return b, nil
+}
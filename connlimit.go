@@ -0,0 +1,73 @@
+package main
+
+import (
+	"expvar"    // شمارنده‌ی اتصال‌های ردشده
+	"log/slog"  // لاگ رد اتصال
+	"net"       // اتصال‌های TCP
+	"net/http"  // وضعیت اتصال (ConnState)
+	"net/netip" // کلید شمارنده‌ی هر IP
+	"sync"      // دسترسی همزمان امن به شمارنده‌ها
+)
+
+// ================= Per-IP Connection Limit =================
+
+// تعداد اتصال‌هایی که به خاطر MAX_CONNS_PER_IP بسته شده‌اند
+var connsRejected = expvar.NewInt("conns_rejected")
+
+// connLimiter تعداد اتصال‌های باز هر IP را از روی ConnState می‌شمارد و اتصال اضافه را
+// همان لحظه‌ی باز شدن می‌بندد. برخلاف rate limiter، جلوی کلاینتی را می‌گیرد که با
+// اتصال‌های زیاد و کند (مثل slowloris) ظرفیت سرور را اشغال می‌کند.
+// پروکسی‌های مورد اعتماد محدود نمی‌شوند چون کلاینت‌های زیادی پشت IP آن‌ها هستند.
+type connLimiter struct {
+	max     int
+	trusted []netip.Prefix
+
+	mu    sync.Mutex
+	perIP map[netip.Addr]int
+}
+
+// newConnLimiter یک limiter با سقف maxConns اتصال برای هر IP می‌سازد؛ صفر یعنی خاموش (nil)
+func newConnLimiter(maxConns int, trusted []netip.Prefix) *connLimiter {
+	if maxConns == 0 {
+		return nil
+	}
+	return &connLimiter{max: maxConns, trusted: trusted, perIP: make(map[netip.Addr]int)}
+}
+
+// track در کنار connTracker.track از http.Server.ConnState صدا زده می‌شود
+func (l *connLimiter) track(c net.Conn, state http.ConnState) {
+	if l == nil {
+		return
+	}
+
+	ap, err := netip.ParseAddrPort(c.RemoteAddr().String())
+	if err != nil {
+		return
+	}
+	ip := ap.Addr().Unmap()
+	if isTrusted(l.trusted, ip) {
+		return
+	}
+
+	switch state {
+	case http.StateNew:
+		l.mu.Lock()
+		l.perIP[ip]++
+		n := l.perIP[ip]
+		l.mu.Unlock()
+
+		// اتصال بسته می‌شود ولی شمارش را StateClosed همان اتصال کم می‌کند
+		if n > l.max {
+			connsRejected.Add(1)
+			slog.Debug("connection rejected, too many connections from IP", "ip", anonymizeIP(ip).String(), "open", n-1)
+			_ = c.Close()
+		}
+
+	case http.StateClosed, http.StateHijacked:
+		l.mu.Lock()
+		if l.perIP[ip]--; l.perIP[ip] <= 0 {
+			delete(l.perIP, ip)
+		}
+		l.mu.Unlock()
+	}
+}
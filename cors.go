@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http" // هسته HTTP در Go
+	"slices"   // جستجو در لیست originها
+	"strconv"  // هدر Access-Control-Max-Age
+	"strings"  // ساختن هدرها و مقایسه‌ی مسیرها
+	"time"     // مدت cache پاسخ preflight
+)
+
+// ================= CORS Middleware =================
+
+// CORSConfig سیاست CORS یک گروه از routeها.
+// بدون AllowedOrigins هیچ درخواست cross-origin مجاز نیست.
+type CORSConfig struct {
+	AllowedOrigins   []string      // originهای مجاز؛ "*" یعنی همه
+	AllowedMethods   []string      // متدهای مجاز در preflight
+	AllowedHeaders   []string      // هدرهای مجاز در preflight
+	ExposedHeaders   []string      // هدرهای پاسخ که جاوااسکریپت می‌تواند بخواند
+	AllowCredentials bool          // اجازه‌ی ارسال cookie و Authorization
+	MaxAge           time.Duration // مدت cache پاسخ preflight در مرورگر
+
+	// مسیرهایی که سیاست خودشان را دارند و این instance روی آن‌ها کاری نمی‌کند
+	// (برای سیاست پیش‌فرض در chain سراسری)
+	Skip []string
+}
+
+// corsMiddleware سیاست cfg را اجرا می‌کند: به درخواست‌های preflight (OPTIONS) خودش جواب می‌دهد
+// و به پاسخ درخواست‌های cross-origin مجاز هدرهای Access-Control-* را اضافه می‌کند.
+// هم در chain سراسری (سیاست پیش‌فرض) و هم روی یک گروه route (سیاست اختصاصی) قابل استفاده است.
+func corsMiddleware(cfg CORSConfig) Middleware {
+
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			origin := r.Header.Get("Origin")
+			if origin == "" || hasAnyPrefix(r.URL.Path, cfg.Skip) {
+				next.ServeHTTP(w, r) // درخواست same-origin یا مسیری با سیاست جدا
+				return
+			}
+
+			// پاسخ به ازای Origin فرق می‌کند؛ cacheها باید این را بدانند
+			w.Header().Add("Vary", "Origin")
+
+			allowed := anyOrigin || slices.Contains(cfg.AllowedOrigins, origin)
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if !allowed {
+				if preflight {
+					writeError(w, http.StatusForbidden, "CORS origin not allowed")
+					return
+				}
+				next.ServeHTTP(w, r) // بدون هدر CORS؛ مرورگر خودش پاسخ را از اسکریپت پنهان می‌کند
+				return
+			}
+
+			// با credentials نمی‌توان "*" فرستاد؛ خود origin برگردانده می‌شود
+			if anyOrigin && !cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// -------- Preflight --------
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			if methods != "" {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+			}
+			if headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// hasAnyPrefix بررسی می‌کند path با یکی از prefixها شروع شود
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"report.csv", `attachment; filename="report.csv"`},
+		{"my report (1).pdf", `attachment; filename="my report (1).pdf"`},
+		// نقل‌قول و backslash نباید از داخل filename بیرون بزنند
+		{`a"b\c.txt`, `attachment; filename="a_b_c.txt"; filename*=UTF-8''a%22b%5Cc.txt`},
+		{"x\r\nSet-Cookie: a=b", `attachment; filename="x__Set-Cookie: a=b"; filename*=UTF-8''x%0D%0ASet-Cookie%3A%20a%3Db`},
+		{"گزارش.csv", `attachment; filename="_____.csv"; filename*=UTF-8''%DA%AF%D8%B2%D8%A7%D8%B1%D8%B4.csv`},
+		{"café.txt", `attachment; filename="caf_.txt"; filename*=UTF-8''caf%C3%A9.txt`},
+	}
+	for _, tt := range tests {
+		if got := contentDisposition(tt.filename); got != tt.want {
+			t.Errorf("contentDisposition(%q)\n got  %s\nwant %s", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestServeDownload(t *testing.T) {
+	const content = "hello world"
+
+	tests := []struct {
+		name        string
+		reader      func() io.Reader
+		rangeHeader string
+		status      int
+		body        string
+		length      string
+	}{
+		{"seeker full", func() io.Reader { return bytes.NewReader([]byte(content)) }, "", http.StatusOK, content, "11"},
+		{"seeker range", func() io.Reader { return bytes.NewReader([]byte(content)) }, "bytes=6-", http.StatusPartialContent, "world", "5"},
+		{"seeker bad range", func() io.Reader { return bytes.NewReader([]byte(content)) }, "bytes=20-", http.StatusRequestedRangeNotSatisfiable, "", ""},
+		// بدون Seek، Range نادیده گرفته و کل محتوا با Content-Length معلوم فرستاده می‌شود
+		{"non-seeker ignores range", func() io.Reader { return bytes.NewBufferString(content) }, "bytes=6-", http.StatusOK, content, "11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/download", nil)
+			if tt.rangeHeader != "" {
+				r.Header.Set("Range", tt.rangeHeader)
+			}
+			w := httptest.NewRecorder()
+			serveDownload(w, r, tt.reader(), "hello.txt", "text/plain")
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status >= 300 {
+				return
+			}
+			if w.Body.String() != tt.body || w.Header().Get("Content-Length") != tt.length {
+				t.Errorf("body %q Content-Length %q, want %q %q", w.Body, w.Header().Get("Content-Length"), tt.body, tt.length)
+			}
+			if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="hello.txt"` {
+				t.Errorf("Content-Disposition = %q", got)
+			}
+			if got := w.Header().Get("Content-Type"); got != "text/plain" {
+				t.Errorf("Content-Type = %q", got)
+			}
+		})
+	}
+}
+
+// GET /api/uploads/{id}: فقط آپلود کامل، با نام فایل فرم و Range
+func TestUploadDownload(t *testing.T) {
+	captureLogs(t)
+	s := newTestUploads(t, 1000, 10)
+	get := func(id, rangeHeader string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/uploads/"+id, nil)
+		if rangeHeader != "" {
+			r.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		s.download(w, r)
+		return w
+	}
+
+	_, id := createUpload(t, s, "11")
+	patchUpload(s, id, "hello ", map[string]string{"Upload-Offset": "0"})
+	if w := get(id, ""); w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != "6" {
+		t.Errorf("incomplete upload: status = %d Upload-Offset %q, want 409 6", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	patchUpload(s, id, "world", map[string]string{"Upload-Offset": "6"})
+
+	w := get(id, "bytes=6-")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "world" {
+		t.Errorf("range: status = %d body %q, want 206 world", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="`+id+`"` {
+		t.Errorf("Content-Disposition = %q, want upload id", got)
+	}
+
+	mw := postMultipart(t, s, map[string]string{"report": "a,b\n1,2\n"})
+	var resp struct {
+		Files []multipartFile `json:"files"`
+	}
+	if err := json.Unmarshal(mw.Body.Bytes(), &resp); err != nil || len(resp.Files) != 1 {
+		t.Fatalf("multipart: %d %s", mw.Code, mw.Body)
+	}
+	w = get(resp.Files[0].ID, "")
+	if w.Code != http.StatusOK || w.Body.String() != "a,b\n1,2\n" || w.Header().Get("Content-Disposition") != `attachment; filename="report.txt"` {
+		t.Errorf("multipart file: %d %q %q", w.Code, w.Header().Get("Content-Disposition"), w.Body)
+	}
+
+	if w := get("missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing upload: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/sha256"   // محاسبه‌ی hash محتوا برای ETag
+	"encoding/base64" // مقدار هدر Repr-Digest
+	"encoding/hex"    // تبدیل hash به رشته
+	"net/http"        // هسته HTTP در Go
+	"strings"         // پارس هدرهای If-Match و If-None-Match
+	"time"            // مقایسه‌ی If-Modified-Since
+)
+
+// ================= ETag / Preconditions =================
+
+// strongETag یک ETag قوی از روی محتوا می‌سازد، مثل "3f2a..."
+func strongETag(data []byte) string {
+	return etagFromSum(sha256.Sum256(data))
+}
+
+// etagFromSum ETag قوی را از hash کامل می‌سازد تا محتوا برای ETag و digest دو بار hash نشود
+func etagFromSum(sum [sha256.Size]byte) string {
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// contentDigest مقدار digest (base64 کل hash) برای setDigest
+func contentDigest(sum [sha256.Size]byte) string {
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// setDigest hash کل نمایش را در Repr-Digest (RFC 9530) و Digest قدیمی (RFC 3230) می‌گذارد.
+// برخلاف Content-Digest به بازه‌ی ارسال‌شده بستگی ندارد؛ پس کلاینت بعد از کنار هم گذاشتن
+// تکه‌های Range می‌تواند کل فایل را با آن بررسی کند.
+func setDigest(h http.Header, digest string) {
+	if digest != "" {
+		h.Set("Repr-Digest", "sha-256=:"+digest+":")
+		h.Set("Digest", "sha-256="+digest)
+	}
+}
+
+// weakETag یک ETag ضعیف می‌سازد، مثل W/"3f2a..."؛
+// برای نمایش‌هایی که از نظر معنا یکی هستند ولی بایت‌به‌بایت نه (مثلاً بعد از فشرده‌سازی)
+func weakETag(data []byte) string {
+	return "W/" + strongETag(data)
+}
+
+// setETag هدر ETag پاسخ را تنظیم می‌کند
+func setETag(w http.ResponseWriter, etag string) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+}
+
+// ETagFunc ETag فعلی منبع را برای درخواست برمی‌گرداند؛
+// exists=false یعنی منبع هنوز وجود ندارد
+type ETagFunc func(r *http.Request) (etag string, exists bool)
+
+// checkPreconditions هدرهای If-Match و If-None-Match را با ETag فعلی منبع مقایسه می‌کند.
+// اگر false برگرداند، پاسخ 412 یا 304 قبلاً ارسال شده و handler نباید ادامه دهد.
+func checkPreconditions(w http.ResponseWriter, r *http.Request, current string, exists bool) bool {
+	status := preconditionStatus(r, current, exists)
+	if status == 0 {
+		return true
+	}
+	writePrecondition(w, status, current)
+	return false
+}
+
+// preconditionStatus نتیجه‌ی If-Match و If-None-Match را بدون نوشتن پاسخ برمی‌گرداند:
+// 0 یعنی ادامه، وگرنه 304 یا 412. برای handlerی که باید پیش‌شرط را زیر قفل خودش دوباره بسنجد.
+func preconditionStatus(r *http.Request, current string, exists bool) int {
+
+	// -------- If-Match (مقایسه‌ی قوی) --------
+	// جلوی lost update را می‌گیرد: فقط اگر کلاینت آخرین نسخه را دیده باشد تغییر مجاز است
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !exists || !etagListMatches(im, current, false) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	// -------- If-None-Match (مقایسه‌ی ضعیف) --------
+	if inm := r.Header.Get("If-None-Match"); inm != "" && exists {
+		if etagListMatches(inm, current, true) {
+			// برای GET/HEAD یعنی نسخه‌ی کلاینت هنوز معتبر است
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				return http.StatusNotModified
+			}
+
+			// برای متدهای نوشتنی (مثل PUT با If-None-Match: *) یعنی منبع از قبل وجود دارد
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	return 0
+}
+
+// writePrecondition پاسخ 304 یا 412 را همراه ETag فعلی منبع می‌نویسد
+func writePrecondition(w http.ResponseWriter, status int, current string) {
+	setETag(w, current)
+	if status == http.StatusNotModified {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeError(w, status, "Precondition Failed")
+}
+
+// preconditionMiddleware پیش‌شرط‌ها را قبل از اجرای handler بررسی می‌کند.
+// current باید ETag فعلی منبع را از روی درخواست پیدا کند.
+func preconditionMiddleware(current ETagFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			// بدون هدر شرطی نیازی به پیدا کردن ETag نیست
+			if r.Header.Get("If-Match") == "" && r.Header.Get("If-None-Match") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			etag, exists := current(r)
+			if !checkPreconditions(w, r, etag, exists) {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// checkModifiedSince هدر Last-Modified را می‌گذارد و If-Modified-Since کلاینت را با modtime منبع مقایسه می‌کند.
+// اگر false برگرداند، پاسخ 304 ارسال شده و handler نباید ادامه دهد.
+// تاریخ HTTP دقت ثانیه دارد؛ پس modtime قبل از مقایسه به ثانیه گرد می‌شود وگرنه منبعی که
+// در همان ثانیه (ولی چند میلی‌ثانیه بعد) ثبت شده همیشه "تغییرکرده" دیده می‌شد.
+// طبق RFC 9110 وقتی If-None-Match هست If-Modified-Since نادیده گرفته می‌شود (ETag دقیق‌تر است).
+func checkModifiedSince(w http.ResponseWriter, r *http.Request, modtime time.Time) bool {
+	if modtime.IsZero() || modtime.Equal(time.Unix(0, 0)) {
+		return true // زمان نامعلوم؛ شرطی در کار نیست
+	}
+	modtime = modtime.Truncate(time.Second)
+	w.Header().Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return true
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || r.Header.Get("If-None-Match") != "" {
+		return true
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return true // تاریخ نامعتبر نادیده گرفته می‌شود
+	}
+	if modtime.After(t) {
+		return true
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return false
+}
+
+// writeJSONModified مثل writeJSON است ولی Last-Modified را می‌گذارد و اگر نسخه‌ی کلاینت
+// (If-Modified-Since) هنوز معتبر باشد فقط 304 برمی‌گرداند؛ modtime را handler می‌دهد
+func writeJSONModified(w http.ResponseWriter, r *http.Request, status int, v any, modtime time.Time) {
+	if checkModifiedSince(w, r, modtime) {
+		writeJSON(w, status, v)
+	}
+}
+
+// etagListMatches بررسی می‌کند etag در لیست هدر (یا "*") باشد.
+// weak=true یعنی مقایسه‌ی ضعیف (W/ نادیده گرفته می‌شود)؛ در مقایسه‌ی قوی
+// هیچ ETag ضعیفی با چیزی برابر نیست.
+func etagListMatches(header, etag string, weak bool) bool {
+
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+
+		if strings.HasPrefix(candidate, "W/") || strings.HasPrefix(etag, "W/") {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreconditionMiddleware(t *testing.T) {
+	strong := strongETag([]byte("v1"))
+	weak := weakETag([]byte("v1"))
+
+	tests := []struct {
+		name    string
+		method  string
+		header  string
+		value   string
+		current string
+		exists  bool
+		want    int
+	}{
+		{"no headers", http.MethodPut, "", "", strong, true, http.StatusOK},
+		{"If-Match strong match", http.MethodPut, "If-Match", strong, strong, true, http.StatusOK},
+		{"If-Match in list", http.MethodPut, "If-Match", `"other", ` + strong, strong, true, http.StatusOK},
+		{"If-Match stale", http.MethodPut, "If-Match", strongETag([]byte("v0")), strong, true, http.StatusPreconditionFailed},
+		{"If-Match weak candidate", http.MethodPut, "If-Match", "W/" + strong, strong, true, http.StatusPreconditionFailed},
+		{"If-Match weak current", http.MethodPut, "If-Match", weak, weak, true, http.StatusPreconditionFailed},
+		{"If-Match missing resource", http.MethodPut, "If-Match", strong, "", false, http.StatusPreconditionFailed},
+		{"If-Match * existing", http.MethodDelete, "If-Match", "*", strong, true, http.StatusOK},
+		{"If-Match * missing", http.MethodDelete, "If-Match", "*", "", false, http.StatusPreconditionFailed},
+		{"If-None-Match * existing", http.MethodPut, "If-None-Match", "*", strong, true, http.StatusPreconditionFailed},
+		{"If-None-Match * missing", http.MethodPut, "If-None-Match", "*", "", false, http.StatusOK},
+		{"If-None-Match GET weak match", http.MethodGet, "If-None-Match", weak, strong, true, http.StatusNotModified},
+		{"If-None-Match GET changed", http.MethodGet, "If-None-Match", strongETag([]byte("v0")), strong, true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookups := 0
+			h := preconditionMiddleware(func(*http.Request) (string, bool) {
+				lookups++
+				return tt.current, tt.exists
+			})(http.HandlerFunc(apiPingHandler))
+
+			r := httptest.NewRequest(tt.method, "/api/kv/a", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK && w.Header().Get("ETag") != tt.current {
+				t.Errorf("ETag = %q, want current %q", w.Header().Get("ETag"), tt.current)
+			}
+			if tt.header == "" && lookups != 0 {
+				t.Error("ETag looked up without a conditional header")
+			}
+		})
+	}
+}
+
+// /api/kv: ساخت فقط-اگر-نیست، نوشتن با ETag دیده‌شده و GET شرطی
+func TestKVConditionalWrites(t *testing.T) {
+	captureLogs(t)
+	a, _ := newTestApp(t, map[string]string{"KV_MAX_KEYS": "10", "ADMIN_PASSWORD": "secret"})
+	ts := httptest.NewServer(a.handler)
+	t.Cleanup(ts.Close)
+
+	do := func(method, header, value, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+"/api/kv/doc", strings.NewReader(body))
+		req.SetBasicAuth("admin", "secret")
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := do(http.MethodPut, "If-None-Match", "*", `{"value": 1}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201", resp.StatusCode)
+	}
+	v1 := resp.Header.Get("ETag")
+	if v1 != strongETag([]byte("1")) {
+		t.Errorf("create: ETag = %q, want hash of value", v1)
+	}
+	if resp := do(http.MethodPut, "If-None-Match", "*", `{"value": 9}`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("second create: status = %d, want 412", resp.StatusCode)
+	}
+
+	resp = do(http.MethodPut, "If-Match", v1, `{"value": 2}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("update with current ETag: status = %d, want 200", resp.StatusCode)
+	}
+	v2 := resp.Header.Get("ETag")
+
+	// کلاینتی که هنوز v1 را دارد نباید v2 را بازنویسی یا حذف کند
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		resp := do(method, "If-Match", v1, `{"value": 3}`)
+		if resp.StatusCode != http.StatusPreconditionFailed || resp.Header.Get("ETag") != v2 {
+			t.Errorf("%s with stale ETag: status = %d ETag = %q, want 412 %q", method, resp.StatusCode, resp.Header.Get("ETag"), v2)
+		}
+	}
+
+	if resp := do(http.MethodGet, "If-None-Match", v2, ""); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("GET with current ETag: status = %d, want 304", resp.StatusCode)
+	}
+	if resp := do(http.MethodDelete, "If-Match", v2, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE with current ETag: status = %d, want 204", resp.StatusCode)
+	}
+	if resp := do(http.MethodPut, "If-Match", v2, `{"value": 4}`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("If-Match on deleted key: status = %d, want 412", resp.StatusCode)
+	}
+}
+
+// دو نویسنده با یک ETag: بررسی زیر قفل store فقط یکی را می‌پذیرد حتی اگر هر دو از middleware رد شده باشند
+func TestKVConditionalPutUnderLock(t *testing.T) {
+	kv := &kvStore{maxKeys: 10, maxValueBytes: 1024, items: make(map[string]kvItem)}
+	put := func(ifMatch, body string) int {
+		r := httptest.NewRequest(http.MethodPut, "/api/kv/a", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		kv.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	put("", `{"value": 1}`)
+	etag := strongETag([]byte("1"))
+	if got := put(etag, `{"value": 2}`); got != http.StatusOK {
+		t.Fatalf("first writer: status = %d, want 200", got)
+	}
+	if got := put(etag, `{"value": 3}`); got != http.StatusPreconditionFailed {
+		t.Errorf("second writer with the same ETag: status = %d, want 412", got)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"     // خواندن خط به خط FEATURES_FILE
+	"context"   // امضای featureEnabled در handlerها
+	"fmt"       // پیام خطای flag ناشناخته
+	"log/slog"  // لاگ reload با SIGHUP
+	"maps"      // کپی flagها برای snapshot جدید
+	"net/http"  // هسته HTTP در Go
+	"os"        // باز کردن FEATURES_FILE
+	"os/signal" // reload با SIGHUP
+	"regexp"    // اعتبارسنجی نام flag
+	"slices"    // ترتیب prefixهای FEATURE_ROUTES
+	"strconv"   // مقدار bool هر flag
+	"strings"   // جدا کردن name=bool
+	"syscall"   // SIGHUP
+)
+
+// ================= Feature Flags =================
+//
+// flagها بخشی از RuntimeConfig هستند؛ پس مثل بقیه‌ی تنظیمات زمان اجرا با یک Store اتمی عوض می‌شوند
+// و هر ارزیابی بعدی (حتی در درخواستی که در جریان است) مقدار جدید را می‌بیند.
+// فهرست flagها فقط از FEATURES و FEATURES_FILE در شروع می‌آید؛ /admin/config فقط همان‌ها را روشن و خاموش می‌کند.
+// با SIGHUP فایل FEATURES_FILE دوباره خوانده می‌شود و flagهای آن (حتی نام‌های تازه) اعمال می‌شوند.
+//
+//	router.Register(http.MethodGet, "/api/beta", featureGate("beta_api")(betaHandler))
+//	if featureEnabled(r.Context(), "new_ranking") { ... }
+//
+// بدون تغییر کد، FEATURE_ROUTES هر prefix مسیر را پشت یک flag می‌برد (featureRoutes).
+
+// نام flag: حروف کوچک، عدد، _ و -
+var featureNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// featureEnabled وضعیت فعلی flag را برمی‌گرداند؛ flag تعریف‌نشده همیشه خاموش است.
+// ctx فعلاً استفاده نمی‌شود ولی جای override هر درخواست (مثلاً برای کاربران آزمایشی) را نگه می‌دارد.
+func featureEnabled(ctx context.Context, name string) bool {
+	return runtimeCfg.Load().Features[name]
+}
+
+// featureGate مسیر را تا وقتی flag خاموش است پنهان می‌کند (404، مثل مسیری که وجود ندارد)
+func featureGate(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !featureEnabled(r.Context(), name) {
+				writeError(w, http.StatusNotFound, "Not Found")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validateFeaturePatch فقط تغییر flagهایی را می‌پذیرد که در شروع تعریف شده‌اند؛
+// غلط تایپی در نام نباید بی‌صدا یک flag تازه بسازد
+func validateFeaturePatch(current, patch map[string]bool) error {
+	for name := range patch {
+		if _, ok := current[name]; !ok {
+			return fmt.Errorf("unknown feature %q (features are declared with FEATURES)", name)
+		}
+	}
+	return nil
+}
+
+// featureRoutes مسیرهای هر prefix در routes (prefix → نام flag) را با featureGate پشت flag آن می‌برد؛
+// طولانی‌ترین prefix منطبق برنده است
+func featureRoutes(routes map[string]string) Middleware {
+	prefixes := slices.SortedFunc(maps.Keys(routes), func(a, b string) int { return len(b) - len(a) })
+
+	return func(next http.Handler) http.Handler {
+		if len(prefixes) == 0 {
+			return next
+		}
+		gated := make(map[string]http.Handler, len(prefixes))
+		for _, prefix := range prefixes {
+			gated[prefix] = featureGate(routes[prefix])(next)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					gated[prefix].ServeHTTP(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// readFeaturesFile فایل flagها را می‌خواند: هر خط name=bool؛ خط خالی و خطی که با # شروع شود نادیده گرفته می‌شود
+func readFeaturesFile(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	flags := make(map[string]bool)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, v, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !featureNameRe.MatchString(name) {
+			return nil, fmt.Errorf("%s:%d: expected name=bool, got %q", path, n, line)
+		}
+		on, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid boolean %q", path, n, v)
+		}
+		flags[name] = on
+	}
+	return flags, sc.Err()
+}
+
+// reloadFeatures flagهای FEATURES_FILE را روی snapshot فعلی می‌نویسد؛ flagهایی که در فایل نیستند
+// (از FEATURES یا /admin/config) دست نمی‌خورند. فایل خراب هیچ flagی را عوض نمی‌کند.
+func reloadFeatures(path string) error {
+	flags, err := readFeaturesFile(path)
+	if err != nil {
+		return err
+	}
+	for {
+		old := runtimeCfg.Load()
+		next := *old
+		next.Features = maps.Clone(old.Features)
+		if next.Features == nil {
+			next.Features = make(map[string]bool, len(flags))
+		}
+		maps.Copy(next.Features, flags)
+
+		swapped, err := swapRuntimeConfig(old, &next)
+		if err != nil {
+			return err
+		}
+		if swapped {
+			for name, on := range flags {
+				if was, ok := old.Features[name]; !ok || was != on {
+					slog.Info("feature flag changed", "feature", name, "enabled", on)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// watchFeatures با هر SIGHUP فایل FEATURES_FILE را دوباره اعمال می‌کند
+func watchFeatures(ctx context.Context, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	backgroundTasks.Add(1)
+	go func() {
+		defer backgroundTasks.Done()
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				slog.Info("signal received, reloading feature flags", "signal", "SIGHUP", "file", path)
+				if err := reloadFeatures(path); err != nil {
+					slog.Error("feature flags reload failed, keeping the current ones", "err", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeFeaturesFile محتوای داده‌شده را در فایل flagهای تست می‌نویسد
+func writeFeaturesFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setFeature یک flag را مثل PATCH /admin/config در snapshot فعلی عوض می‌کند
+func setFeature(name string, on bool) {
+	next := *runtimeCfg.Load()
+	next.Features = maps.Clone(next.Features)
+	next.Features[name] = on
+	runtimeCfg.Store(&next)
+}
+
+func TestFeatureGate(t *testing.T) {
+	setTestRuntimeConfig(t, RuntimeConfig{LogLevel: "info", Features: map[string]bool{"beta": false}})
+	h := featureGate("beta")(http.HandlerFunc(apiPingHandler))
+	undeclared := featureGate("undeclared")(http.HandlerFunc(apiPingHandler))
+
+	serve := func(h http.Handler) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/ping", nil))
+		return w.Code
+	}
+	if got := serve(h); got != http.StatusNotFound {
+		t.Errorf("flag off: status = %d, want 404", got)
+	}
+	setFeature("beta", true)
+	if got := serve(h); got != http.StatusOK {
+		t.Errorf("flag on: status = %d, want 200", got)
+	}
+	if got := serve(undeclared); got != http.StatusNotFound {
+		t.Errorf("undeclared flag: status = %d, want 404", got)
+	}
+}
+
+// FEATURE_ROUTES روی کل زنجیره: طولانی‌ترین prefix برنده است و تغییر flag فوراً دیده می‌شود
+func TestFeatureRoutes(t *testing.T) {
+	captureLogs(t)
+	setTestRuntimeConfig(t, RuntimeConfig{LogLevel: "info"})
+	a, _ := newTestApp(t, map[string]string{
+		"FEATURES":       "beta=false,ping=true",
+		"FEATURE_ROUTES": "/api/=beta,/api/ping=ping",
+	})
+	ts := httptest.NewServer(a.handler)
+	t.Cleanup(ts.Close)
+
+	get := func(path string) int {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := get("/api/time"); got != http.StatusNotFound {
+		t.Errorf("/api/time with beta off: status = %d, want 404", got)
+	}
+	if got := get("/api/ping"); got != http.StatusOK {
+		t.Errorf("/api/ping behind its own flag: status = %d, want 200", got)
+	}
+	if got := get("/health"); got == http.StatusNotFound {
+		t.Error("/health is not under any FEATURE_ROUTES prefix but got 404")
+	}
+
+	setFeature("beta", true)
+	setFeature("ping", false)
+	if got := get("/api/time"); got != http.StatusOK {
+		t.Errorf("/api/time with beta on: status = %d, want 200", got)
+	}
+	if got := get("/api/ping"); got != http.StatusNotFound {
+		t.Errorf("/api/ping with ping off: status = %d, want 404", got)
+	}
+}
+
+func TestFeatureConfig(t *testing.T) {
+	setTestRuntimeConfig(t, RuntimeConfig{LogLevel: "info"})
+	path := filepath.Join(t.TempDir(), "features")
+	writeFeaturesFile(t, path, "# flags\nbeta = true\n\nnew_ui=false\n")
+
+	cfg := newTestConfig(t, map[string]string{
+		"FEATURES":       "beta=false,old=true",
+		"FEATURES_FILE":  path,
+		"FEATURE_ROUTES": "/api/beta/=beta",
+	})
+	want := map[string]bool{"beta": true, "new_ui": false, "old": true}
+	if !maps.Equal(cfg.Runtime.Features, want) {
+		t.Errorf("features = %v, want %v", cfg.Runtime.Features, want)
+	}
+
+	for _, env := range []map[string]string{
+		{"FEATURE_ROUTES": "/api/beta/=missing"},
+		{"FEATURE_ROUTES": "api=old", "FEATURES": "old=true"},
+		{"FEATURE_ROUTES": "", "FEATURES_FILE": filepath.Join(t.TempDir(), "missing")},
+	} {
+		for k, v := range env {
+			t.Setenv(k, v)
+		}
+		args := os.Args
+		os.Args = args[:1]
+		_, err := loadConfig()
+		os.Args = args
+		if err == nil {
+			t.Errorf("loadConfig with %v: no error", env)
+		}
+	}
+}
+
+func TestReloadFeatures(t *testing.T) {
+	captureLogs(t)
+	setTestRuntimeConfig(t, RuntimeConfig{LogLevel: "info", Features: map[string]bool{"beta": false, "admin_only": true}})
+	path := filepath.Join(t.TempDir(), "features")
+
+	writeFeaturesFile(t, path, "beta=true\nnew_ui=true\n")
+	if err := reloadFeatures(path); err != nil {
+		t.Fatal(err)
+	}
+	// flagهای فایل اعمال و نام تازه تعریف می‌شود؛ flagی که در فایل نیست دست نمی‌خورد
+	want := map[string]bool{"beta": true, "new_ui": true, "admin_only": true}
+	if got := runtimeCfg.Load().Features; !maps.Equal(got, want) {
+		t.Errorf("features = %v, want %v", got, want)
+	}
+
+	for _, content := range []string{"beta=maybe\n", "Beta=false\n", "beta\n"} {
+		writeFeaturesFile(t, path, "new_ui=false\n"+content)
+		if err := reloadFeatures(path); err == nil {
+			t.Errorf("reload of %q: no error", content)
+		}
+		if got := runtimeCfg.Load().Features; !maps.Equal(got, want) {
+			t.Errorf("broken file changed flags: %v", got)
+		}
+	}
+}
+
+// SIGHUP واقعی به همین پروسه فایل را دوباره اعمال می‌کند
+func TestFeaturesSIGHUP(t *testing.T) {
+	captureLogs(t)
+	setTestRuntimeConfig(t, RuntimeConfig{LogLevel: "info", Features: map[string]bool{"beta": false}})
+	path := filepath.Join(t.TempDir(), "features")
+	writeFeaturesFile(t, path, "beta=true\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		waitBackground(context.Background())
+	}()
+	watchFeatures(ctx, path)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !featureEnabled(ctx, "beta") {
+		if time.Now().After(deadline) {
+			t.Fatal("beta still off after SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
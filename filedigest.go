@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256" // hash محتوای فایل
+	"fmt"           // خطای تغییر فایل
+	"io"            // hash کردن فایل بدون خواندن کامل در حافظه
+	"log"           // لاگ خطای خواندن فایل
+	"net/http"      // هسته HTTP در Go
+	"os"            // باز کردن فایل‌ها
+	"path"          // تمیز کردن مسیر درخواست
+	"path/filepath" // مسیر فایل روی دیسک
+	"strconv"       // کلید اجرای یکتا
+	"strings"       // بررسی مسیر index
+	"sync"          // دسترسی همزمان امن به cache
+	"time"          // زمان آخرین تغییر فایل
+
+	"golang.org/x/sync/singleflight" // یک بار hash برای درخواست‌های همزمان
+)
+
+// ================= Static File Digests =================
+//
+// فایل‌هایی که در staticCache جا نمی‌شوند (دانلودهای بزرگ) مستقیم با FileServer سرو می‌شوند و
+// ETag نداشتند؛ پس کلاینت فقط با Last-Modified می‌توانست دانلود قطع‌شده را با If-Range ادامه دهد
+// و راهی برای بررسی سالم رسیدن فایل نبود. fileDigests فایل را یک بار به صورت stream hash می‌کند
+// و ETag قوی و Repr-Digest را تا وقتی modtime و حجم فایل عوض نشده نگه می‌دارد.
+// Range و If-Range را خود FileServer با همین ETag انجام می‌دهد.
+
+// حداکثر فایل‌هایی که digest آن‌ها نگه داشته می‌شود؛ با پر شدن، همه پاک و از نو ساخته می‌شوند
+const fileDigestMaxEntries = 4096
+
+// fileDigest hash یک نسخه‌ی مشخص (modtime + حجم) از فایل
+type fileDigest struct {
+	modTime time.Time
+	size    int64
+	etag    string
+	digest  string
+}
+
+// fileDigests digest فایل‌های پوشه‌ی dir را cache می‌کند
+type fileDigests struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string]fileDigest // کلید: مسیر نسبی
+
+	group singleflight.Group // هر فایل همزمان فقط یک بار hash می‌شود
+}
+
+// newFileDigests یک cache خالی برای پوشه‌ی dir می‌سازد
+func newFileDigests(dir string) *fileDigests {
+	return &fileDigests{dir: dir, entries: make(map[string]fileDigest)}
+}
+
+// handler قبل از next (FileServer) هدرهای ETag و Repr-Digest فایل را می‌گذارد.
+// مسیر درخواست باید نسبت به پوشه باشد (بعد از StripPrefix).
+func (d *fileDigests) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// پوشه‌ها و .../index.html (که FileServer به پوشه redirect می‌کند) digest ندارند
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+			!strings.HasSuffix(r.URL.Path, "/") && !strings.HasSuffix(r.URL.Path, "/index.html") {
+
+			rel := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+			if fd, ok := d.get(rel); ok {
+				w.Header().Set("ETag", fd.etag) // FileServer آن را برای If-None-Match و If-Range استفاده می‌کند
+				setDigest(w.Header(), fd.digest)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// get digest فعلی فایل را برمی‌گرداند و اگر فایل عوض شده باشد دوباره hash می‌کند
+func (d *fileDigests) get(rel string) (fileDigest, bool) {
+
+	full := filepath.Join(d.dir, filepath.FromSlash(rel))
+	info, err := os.Stat(full)
+	if err != nil || !info.Mode().IsRegular() {
+		return fileDigest{}, false
+	}
+
+	d.mu.Lock()
+	fd, ok := d.entries[rel]
+	d.mu.Unlock()
+	if ok && fd.modTime.Equal(info.ModTime()) && fd.size == info.Size() {
+		return fd, true
+	}
+
+	// کلید شامل نسخه‌ی فایل است تا درخواست بعد از تغییر به hash قبلی نچسبد
+	key := rel + "\x00" + strconv.FormatInt(info.ModTime().UnixNano(), 10) + "\x00" + strconv.FormatInt(info.Size(), 10)
+	v, err, _ := d.group.Do(key, func() (any, error) {
+		return digestFile(full, info)
+	})
+	if err != nil {
+		log.Printf("Static digest error: %v", err)
+		return fileDigest{}, false
+	}
+	fd = v.(fileDigest)
+
+	d.mu.Lock()
+	if len(d.entries) >= fileDigestMaxEntries {
+		clear(d.entries)
+	}
+	d.entries[rel] = fd
+	d.mu.Unlock()
+
+	return fd, true
+}
+
+// digestFile فایل را stream و hash می‌کند؛ اگر فایل وسط کار عوض شود نتیجه کنار گذاشته می‌شود
+func digestFile(full string, info os.FileInfo) (fileDigest, error) {
+	f, err := os.Open(full)
+	if err != nil {
+		return fileDigest{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fileDigest{}, err
+	}
+
+	after, err := f.Stat()
+	if err != nil {
+		return fileDigest{}, err
+	}
+	if !after.ModTime().Equal(info.ModTime()) || after.Size() != info.Size() {
+		return fileDigest{}, fmt.Errorf("%s changed while hashing", full)
+	}
+
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return fileDigest{modTime: info.ModTime(), size: info.Size(), etag: etagFromSum(sum), digest: contentDigest(sum)}, nil
+}
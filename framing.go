@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"    // پارس خط‌های header
+	"context"  // رساندن اتصال به middleware
+	"expvar"   // شمارنده‌ی درخواست‌های ردشده
+	"io"       // EOF بعد از درخواست مشکوک و ReadFrom
+	"net"      // پوشاندن اتصال‌ها
+	"net/http" // هسته HTTP در Go
+	"strconv"  // Content-Length و اندازه‌ی chunkها
+	"sync"     // وضعیت مشترک اتصال و handlerها
+)
+
+// ================= Request Smuggling Guard =================
+//
+// پشت یک پروکسی، اگر پروکسی و این سرور طول body یک درخواست را متفاوت بفهمند، بقیه‌ی bytes به‌عنوان
+// درخواست بعدی (مثلاً از طرف کاربر دیگری) خوانده می‌شود. net/http این درخواست‌ها را خودش رد می‌کند:
+//
+//   - چند Content-Length با مقدارهای مختلف، یا مقدار غیر عددی: 400
+//   - Transfer-Encoding غیر از دقیقاً "chunked" یا چند بار تکرار آن: 501
+//
+// ولی این‌ها را بی‌صدا «درست» می‌کند و handler هیچ ردی از آن‌ها نمی‌بیند:
+//
+//   - چند Content-Length با مقدار یکسان (یا "3, 3") → یکی می‌شوند
+//   - Content-Length همراه Transfer-Encoding: chunked → Content-Length دور ریخته می‌شود
+//   - Transfer-Encoding در HTTP/1.0 → نادیده گرفته می‌شود و body صفر بایت حساب می‌شود
+//
+// framingListener همین سه حالت را روی bytes خام هر درخواست HTTP/1.x تشخیص می‌دهد. بعد از header
+// درخواست مشکوک دیگر چیزی از اتصال خوانده نمی‌شود (EOF)، پس bytes قاچاقی هرگز درخواست نمی‌شوند و
+// framingMiddleware همان درخواست را با 400 و Connection: close رد و لاگ می‌کند.
+// اتصال‌های TLS (bytes رمز شده) و HTTP/2 (framing خودش را دارد) بررسی نمی‌شوند؛ هر چیزی که پارسر
+// نفهمد (درخواست خراب، upgrade به WebSocket، CONNECT) هم بقیه‌ی اتصال را بدون بررسی رد می‌کند.
+
+// درخواست‌های ردشده بر اساس علت در /debug/vars (و /admin/vars)
+var framingRejected = expvar.NewMap("framing_rejected")
+
+// علت‌های رد؛ کلیدهای framing_rejected هم همین‌ها هستند
+const (
+	framingDuplicateLength = "duplicate_content_length"
+	framingLengthAndTE     = "content_length_with_transfer_encoding"
+	framingTEOnHTTP10      = "transfer_encoding_on_http10"
+)
+
+// سقف یک خط header قبل از رها کردن بررسی؛ کمی بیشتر از MaxHeaderBytes پیش‌فرض net/http (آن را 431 می‌کند)
+const framingMaxLine = http.DefaultMaxHeaderBytes + 4096
+
+// وضعیت پارسر framingConn
+type framingState int
+
+const (
+	framingHead        framingState = iota // خط‌های request line و header
+	framingBody                            // body با Content-Length؛ remaining بایت مانده
+	framingChunkSize                       // خط اندازه‌ی chunk بعدی
+	framingChunkData                       // داده‌ی chunk؛ remaining بایت مانده
+	framingChunkEnd                        // CRLF بعد از داده‌ی chunk
+	framingTrailers                        // trailerها بعد از chunk آخر
+	framingPassthrough                     // بقیه‌ی اتصال بررسی نمی‌شود
+	framingCut                             // بعد از درخواست مشکوک؛ Read فقط EOF برمی‌گرداند
+)
+
+// framingListener اتصال‌های پذیرفته‌شده را با framingConn می‌پوشاند
+type framingListener struct {
+	net.Listener
+}
+
+func (l framingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &framingConn{Conn: c, bad: -1}, nil
+}
+
+// framingConn bytesی را که net/http می‌خواند هم‌زمان پارس می‌کند. Read همیشه از یک goroutine
+// صدا زده می‌شود؛ mu فقط bad و served را (که handlerها می‌خوانند) محافظت می‌کند.
+type framingConn struct {
+	net.Conn
+
+	state     framingState
+	line      []byte // خط نیمه‌کاره (بدون \n)
+	lines     int    // خط‌های header درخواست فعلی
+	remaining int64  // بایت‌های مانده‌ی body یا chunk فعلی
+	req       framingRequest
+	heads     int // درخواست‌هایی که به handler می‌رسند و header آن‌ها تا حالا خوانده شده
+
+	mu     sync.Mutex
+	bad    int    // شماره‌ی درخواست مشکوک (از 0)؛ -1 یعنی هیچ
+	reason string // علت رد
+	served int    // درخواست‌هایی که به framingMiddleware رسیده‌اند
+}
+
+// framingRequest چیزهایی که از header یک درخواست لازم است
+type framingRequest struct {
+	http10     bool
+	skip       bool // OPTIONS * که net/http بدون handler جواب می‌دهد
+	upgrade    bool // Upgrade یا CONNECT: بعد از این درخواست اتصال دیگر HTTP/1.x نیست
+	lengths    int  // تعداد Content-Length و مقدارهای لیستی
+	length     int64
+	badLength  bool
+	te         bool // Transfer-Encoding آمده است
+	chunked    bool // Transfer-Encoding دقیقاً chunked است
+	teMultiple bool
+}
+
+func (c *framingConn) Read(p []byte) (int, error) {
+	if c.state == framingCut {
+		return 0, io.EOF
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 && c.state != framingPassthrough {
+		if cut := c.scan(p[:n]); cut >= 0 {
+			c.state = framingCut
+			return cut, nil
+		}
+	}
+	return n, err
+}
+
+// ReadFrom تا پاسخ فایل‌های static همچنان با sendfile روی TCPConn فرستاده شود
+func (c *framingConn) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(c.Conn, r)
+}
+
+// scan بایت‌های خوانده‌شده را پارس می‌کند؛ اگر درخواستی مشکوک باشد، طول بخشی از b را برمی‌گرداند
+// که تا انتهای header همان درخواست است (بقیه نباید به net/http برسد) و در غیر این صورت -1
+func (c *framingConn) scan(b []byte) int {
+	for i := 0; i < len(b); {
+		switch c.state {
+		case framingBody, framingChunkData:
+			k := int64(len(b) - i)
+			if k > c.remaining {
+				k = c.remaining
+			}
+			c.remaining -= k
+			i += int(k)
+			if c.remaining == 0 {
+				if c.state == framingBody {
+					c.endRequest()
+				} else {
+					c.state = framingChunkEnd
+				}
+			}
+
+		case framingPassthrough:
+			return -1
+
+		default:
+			j := bytes.IndexByte(b[i:], '\n')
+			if j < 0 {
+				c.line = append(c.line, b[i:]...)
+				if len(c.line) > framingMaxLine {
+					c.state = framingPassthrough
+				}
+				return -1
+			}
+			c.line = append(c.line, b[i:i+j]...)
+			i += j + 1
+			line := bytes.TrimSuffix(c.line, []byte{'\r'})
+			if c.scanLine(line) {
+				return i
+			}
+			c.line = c.line[:0]
+		}
+	}
+	return -1
+}
+
+// scanLine یک خط کامل را پردازش می‌کند؛ true یعنی header یک درخواست مشکوک همین‌جا تمام شد
+func (c *framingConn) scanLine(line []byte) bool {
+	switch c.state {
+	case framingHead:
+		if c.lines == 0 {
+			c.lines++
+			c.req = framingRequest{}
+			if !c.parseRequestLine(line) {
+				c.state = framingPassthrough // درخواست خراب (net/http خودش رد می‌کند) یا HTTP/2 prior knowledge
+			}
+			return false
+		}
+		if len(line) > 0 {
+			c.lines++
+			c.parseHeaderLine(line)
+			return false
+		}
+		return c.endHead()
+
+	case framingChunkSize:
+		size, _, _ := bytes.Cut(line, []byte{';'})
+		n, err := strconv.ParseInt(string(bytes.TrimSpace(size)), 16, 64)
+		switch {
+		case err != nil || n < 0:
+			c.state = framingPassthrough // net/http همین body خراب را رد می‌کند
+		case n == 0:
+			c.state = framingTrailers
+		default:
+			c.state, c.remaining = framingChunkData, n
+		}
+
+	case framingChunkEnd:
+		if len(line) != 0 {
+			c.state = framingPassthrough
+			return false
+		}
+		c.state = framingChunkSize
+
+	case framingTrailers:
+		if len(line) == 0 {
+			c.endRequest()
+		}
+	}
+	return false
+}
+
+// parseRequestLine مثل "POST /x HTTP/1.1"؛ false یعنی این اتصال را نمی‌شود بررسی کرد
+func (c *framingConn) parseRequestLine(line []byte) bool {
+	method, rest, ok1 := bytes.Cut(line, []byte{' '})
+	target, proto, ok2 := bytes.Cut(rest, []byte{' '})
+	if !ok1 || !ok2 {
+		return false
+	}
+	switch string(proto) {
+	case "HTTP/1.1":
+	case "HTTP/1.0":
+		c.req.http10 = true
+	default:
+		return false // از جمله "PRI * HTTP/2.0"
+	}
+	c.req.skip = string(method) == http.MethodOptions && string(target) == "*"
+	c.req.upgrade = string(method) == http.MethodConnect
+	return true
+}
+
+// parseHeaderLine فقط Content-Length، Transfer-Encoding و Upgrade را نگه می‌دارد
+func (c *framingConn) parseHeaderLine(line []byte) {
+	name, value, ok := bytes.Cut(line, []byte{':'})
+	if !ok {
+		return // خط ادامه یا خراب؛ net/http خودش تصمیم می‌گیرد
+	}
+	value = bytes.TrimSpace(value)
+
+	switch {
+	case bytes.EqualFold(name, []byte("Content-Length")):
+		for v := range bytes.SplitSeq(value, []byte{','}) {
+			c.req.lengths++
+			n, err := strconv.ParseInt(string(bytes.TrimSpace(v)), 10, 64)
+			if err != nil || n < 0 {
+				c.req.badLength = true
+			}
+			c.req.length = n
+		}
+	case bytes.EqualFold(name, []byte("Transfer-Encoding")):
+		c.req.teMultiple = c.req.te
+		c.req.te = true
+		c.req.chunked = bytes.EqualFold(value, []byte("chunked"))
+	case bytes.EqualFold(name, []byte("Upgrade")):
+		c.req.upgrade = true
+	}
+}
+
+// endHead بعد از خط خالی انتهای header: درخواست را بررسی و پارسر را برای body آماده می‌کند
+func (c *framingConn) endHead() bool {
+	req := c.req
+
+	var reason string
+	switch {
+	case req.lengths > 1:
+		reason = framingDuplicateLength
+	case req.te && req.lengths > 0:
+		reason = framingLengthAndTE
+	case req.te && req.http10:
+		reason = framingTEOnHTTP10
+	}
+	if reason != "" {
+		c.mu.Lock()
+		if !req.skip {
+			c.bad, c.reason = c.heads, reason
+		}
+		c.mu.Unlock()
+		return true
+	}
+
+	if !req.skip {
+		c.heads++
+	}
+	switch {
+	case req.te && (!req.chunked || req.teMultiple), req.badLength:
+		c.state = framingPassthrough // net/http با 501 یا 400 رد می‌کند و اتصال را می‌بندد
+	case req.te:
+		c.state = framingChunkSize
+	case req.length > 0:
+		c.state, c.remaining = framingBody, req.length
+	default:
+		c.endRequest()
+	}
+	return false
+}
+
+// endRequest بعد از body کامل یک درخواست
+func (c *framingConn) endRequest() {
+	c.lines = 0
+	c.state = framingHead
+	if c.req.upgrade {
+		c.state = framingPassthrough // بعد از 101 یا CONNECT دیگر HTTP/1.x نیست
+	}
+}
+
+// next شماره‌ی درخواست فعلی را می‌گیرد و اگر همان درخواست مشکوک باشد علت را برمی‌گرداند
+func (c *framingConn) next() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.served
+	c.served++
+	if n == c.bad {
+		return c.reason
+	}
+	return ""
+}
+
+type framingConnKey struct{}
+
+// framingConnContext برای http.Server.ConnContext؛ framingConn را به درخواست‌های همان اتصال می‌رساند
+func framingConnContext(ctx context.Context, c net.Conn) context.Context {
+	if fc, ok := c.(*framingConn); ok {
+		return context.WithValue(ctx, framingConnKey{}, fc)
+	}
+	return ctx
+}
+
+// framingMiddleware درخواستی را که framingConn مشکوک دانسته با 400 رد می‌کند؛
+// درخواست‌هایی که از framingListener نیامده‌اند (TLS، HTTP/2) دست نمی‌خورند
+func framingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		fc, ok := r.Context().Value(framingConnKey{}).(*framingConn)
+		if !ok || r.ProtoMajor != 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if reason := fc.next(); reason != "" {
+			framingRejected.Add(reason, 1)
+			requestLogger(r.Context()).Warn("request rejected, ambiguous message framing",
+				"clientAddr", logClientAddr(r),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"reason", reason,
+			)
+			w.Header().Set("Connection", "close") // بقیه‌ی bytes اتصال قابل اعتماد نیست
+			writeError(w, http.StatusBadRequest, "Bad Request: ambiguous message framing ("+reason+")")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// scanRaw تکه‌های chunks را (هر کدام با یک Write جدا، پس یک Read جدا) از طریق net.Pipe به framingConn
+// می‌دهد و همه‌ی bytesی را که به net/http می‌رسید برمی‌گرداند
+func scanRaw(t *testing.T, chunks ...string) (string, *framingConn) {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	go func() {
+		for _, c := range chunks {
+			if _, err := client.Write([]byte(c)); err != nil {
+				return // framingConn بعد از درخواست مشکوک دیگر نمی‌خواند
+			}
+		}
+		client.Close()
+	}()
+
+	fc := &framingConn{Conn: server, bad: -1}
+	got, err := io.ReadAll(fc)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	client.Close()
+	return string(got), fc
+}
+
+func TestFramingConn(t *testing.T) {
+	const (
+		get      = "GET / HTTP/1.1\r\nHost: a\r\n\r\n"
+		smuggled = "GET /admin HTTP/1.1\r\nHost: a\r\n\r\n"
+	)
+
+	tests := []struct {
+		name   string
+		chunks []string
+		passed string // bytesی که باید به net/http برسد؛ "" یعنی همه‌ی ورودی
+		bad    int
+		reason string
+	}{
+		{
+			name:   "duplicate equal Content-Length",
+			chunks: []string{"POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 3\r\nContent-Length: 3\r\n\r\nabc" + smuggled},
+			passed: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 3\r\nContent-Length: 3\r\n\r\n",
+			bad:    0,
+			reason: framingDuplicateLength,
+		},
+		{
+			name:   "Content-Length list",
+			chunks: []string{"POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 3, 3\r\n\r\nabc"},
+			passed: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 3, 3\r\n\r\n",
+			bad:    0,
+			reason: framingDuplicateLength,
+		},
+		{
+			name:   "conflicting Content-Length",
+			chunks: []string{"POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 3\r\nContent-Length: 40\r\n\r\nabc" + smuggled},
+			passed: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 3\r\nContent-Length: 40\r\n\r\n",
+			bad:    0,
+			reason: framingDuplicateLength,
+		},
+		{
+			name:   "Content-Length with Transfer-Encoding chunked",
+			chunks: []string{"POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n" + smuggled},
+			passed: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n",
+			bad:    0,
+			reason: framingLengthAndTE,
+		},
+		{
+			name:   "Transfer-Encoding with obs-fold",
+			chunks: []string{"POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding:\r\n chunked\r\nContent-Length: 4\r\n\r\n0\r\n\r\n" + smuggled},
+			passed: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding:\r\n chunked\r\nContent-Length: 4\r\n\r\n",
+			bad:    0,
+			reason: framingLengthAndTE,
+		},
+		{
+			name:   "Transfer-Encoding on HTTP/1.0",
+			chunks: []string{"POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"},
+			passed: "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n",
+			bad:    0,
+			reason: framingTEOnHTTP10,
+		},
+		{
+			name:   "pipelined second request",
+			chunks: []string{get + "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 1\r\nContent-Length: 1\r\n\r\nx" + smuggled},
+			passed: get + "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 1\r\nContent-Length: 1\r\n\r\n",
+			bad:    1,
+			reason: framingDuplicateLength,
+		},
+		{
+			name:   "head split across reads",
+			chunks: []string{"POST / HT", "TP/1.1\r\nHost: a\r\nContent-Le", "ngth: 3\r", "\nContent-Length: 3\r\n", "\r", "\nabc", smuggled},
+			passed: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 3\r\nContent-Length: 3\r\n\r\n",
+			bad:    0,
+			reason: framingDuplicateLength,
+		},
+		{
+			name:   "valid keep-alive requests",
+			chunks: []string{"POST /a HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhel", "lo" + get, "POST /b HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n" + get},
+			bad:    -1,
+		},
+		{
+			name:   "OPTIONS * is not counted",
+			chunks: []string{"OPTIONS * HTTP/1.1\r\nHost: a\r\n\r\n" + get + "POST / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 1\r\n\r\nx"},
+			passed: "OPTIONS * HTTP/1.1\r\nHost: a\r\n\r\n" + get + "POST / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 1\r\n\r\n",
+			bad:    1,
+			reason: framingDuplicateLength,
+		},
+		{
+			name:   "HTTP/2 prior knowledge is passed through",
+			chunks: []string{"PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", "Content-Length: 1\r\nContent-Length: 1\r\n\r\n"},
+			bad:    -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fc := scanRaw(t, tt.chunks...)
+			want := tt.passed
+			if want == "" {
+				want = strings.Join(tt.chunks, "")
+			}
+			if got != want {
+				t.Errorf("passed bytes:\n got %q\nwant %q", got, want)
+			}
+			if fc.bad != tt.bad || fc.reason != tt.reason {
+				t.Errorf("bad = %d (%q), want %d (%q)", fc.bad, fc.reason, tt.bad, tt.reason)
+			}
+		})
+	}
+}
+
+// درخواست‌های سالم یک اتصال keep-alive همه به handler می‌رسند و هیچ‌کدام رد نمی‌شوند
+func TestFramingConnValidRequestsAreServed(t *testing.T) {
+	_, fc := scanRaw(t, "GET / HTTP/1.1\r\nHost: a\r\n\r\n", "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 2\r\n\r\nok")
+	if fc.heads != 2 {
+		t.Errorf("heads = %d, want 2", fc.heads)
+	}
+	for i := range 2 {
+		if reason := fc.next(); reason != "" {
+			t.Errorf("request %d rejected: %s", i, reason)
+		}
+	}
+	if fc.state != framingHead {
+		t.Errorf("state = %d, want framingHead", fc.state)
+	}
+}
+
+// سرور واقعی: درخواست مشکوک 400 می‌گیرد و درخواست قاچاقی بعد از آن هرگز به handler نمی‌رسد
+func TestFramingMiddlewareRejects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	srv := &http.Server{
+		Handler: framingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+		})),
+		ConnContext: framingConnContext,
+	}
+	go srv.Serve(framingListener{ln})
+	t.Cleanup(func() { srv.Close() })
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	io.WriteString(c, "GET /ok HTTP/1.1\r\nHost: a\r\n\r\n"+
+		"POST /x HTTP/1.1\r\nHost: a\r\nContent-Length: 3\r\nContent-Length: 3\r\n\r\nabc"+
+		"GET /smuggled HTTP/1.1\r\nHost: a\r\n\r\n")
+
+	br := bufio.NewReader(c)
+	var statuses []int
+	for {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			break
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+
+	if !slices.Equal(statuses, []int{http.StatusOK, http.StatusBadRequest}) {
+		t.Errorf("statuses = %v, want [200 400]", statuses)
+	}
+	if !slices.Equal(paths, []string{"/ok"}) {
+		t.Errorf("handler saw %v, want [/ok]", paths)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"  // ذخیره‌ی کد کشور در context درخواست
+	"log"      // لاگ وضعیت دیتابیس و درخواست‌های مسدود
+	"net/http" // هسته HTTP در Go
+	"os"       // بررسی وجود فایل دیتابیس
+
+	"github.com/oschwald/maxminddb-golang/v2" // خواندن دیتابیس MaxMind
+)
+
+// ================= GeoIP Middleware =================
+
+// کلید context برای کد کشور کلاینت
+type countryKey struct{}
+
+// geoIP دیتابیس MaxMind را نگه می‌دارد؛ مقدار nil یعنی lookup غیرفعال است
+type geoIP struct {
+	db *maxminddb.Reader
+}
+
+// openGeoIP دیتابیس را باز می‌کند. اگر مسیر خالی یا فایل خراب باشد،
+// فقط هشدار لاگ می‌شود و nil برمی‌گردد تا سرور بدون GeoIP ادامه دهد.
+func openGeoIP(path string) *geoIP {
+	if path == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("GeoIP disabled: %v", err)
+		return nil
+	}
+
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		log.Printf("GeoIP disabled: %v", err)
+		return nil
+	}
+
+	log.Printf("GeoIP database loaded: %s", path)
+	return &geoIP{db: db}
+}
+
+// close دیتابیس را می‌بندد (g می‌تواند nil باشد)
+func (g *geoIP) close(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	return g.db.Close()
+}
+
+// country کد ISO کشور را برای IP کلاینت برمی‌گرداند (یا رشته‌ی خالی)
+func (g *geoIP) country(r *http.Request) string {
+	if g == nil {
+		return ""
+	}
+
+	ip := clientIP(r)
+	if !ip.IsValid() {
+		return ""
+	}
+
+	var code string
+	if err := g.db.Lookup(ip).DecodePath(&code, "country", "iso_code"); err != nil {
+		return ""
+	}
+	return code
+}
+
+// geoIPMiddleware کشور کلاینت را در context می‌گذارد و کشورهای مسدود را با 403 رد می‌کند.
+// باید بعد از realIPMiddleware اجرا شود تا IP واقعی در دسترس باشد.
+func geoIPMiddleware(g *geoIP, blocked []string) Middleware {
+
+	// ساخت set برای جستجوی سریع
+	blockSet := make(map[string]bool, len(blocked))
+	for _, c := range blocked {
+		blockSet[c] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+
+		// بدون دیتابیس، middleware هیچ کاری نمی‌کند
+		if g == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			code := g.country(r)
+
+			if code != "" && blockSet[code] {
+				requestLogger(r.Context()).Info("geoip blocked",
+					"clientAddr", logClientAddr(r),
+					"country", code,
+					"method", r.Method,
+					"path", r.URL.Path,
+				)
+				writeError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), countryKey{}, code)
+			if code != "" {
+				addLogFields(ctx, "country", code)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// countryFromContext کد کشوری که geoIPMiddleware پیدا کرده را برمی‌گرداند
+func countryFromContext(ctx context.Context) string {
+	code, _ := ctx.Value(countryKey{}).(string)
+	return code
+}
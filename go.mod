@@ -1,3 +1,13 @@
 module mini-http-server
 
 go 1.24.2
+
+require (
+	github.com/oschwald/maxminddb-golang/v2 v2.0.0
+	go.uber.org/goleak v1.3.0
+	golang.org/x/net v0.46.0
+	golang.org/x/sync v0.17.0
+	golang.org/x/sys v0.37.0
+)
+
+require golang.org/x/text v0.30.0 // indirect
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log/slog" // لاگ روشن شدن h2c
+	"net/http" // Protocols و handler سرور
+	"time"     // مهلت بی‌کاری اتصال‌های ارتقایافته
+
+	"golang.org/x/net/http2"     // سرور HTTP/2 اتصال‌های ارتقایافته
+	"golang.org/x/net/http2/h2c" // تشخیص درخواست Upgrade: h2c
+)
+
+// ================= H2C =================
+
+// enableH2C روی srv کنار HTTP/1.1، HTTP/2 بدون TLS را به هر دو شکل RFC 7540 روشن می‌کند:
+//   - prior knowledge (کلاینت مستقیم با preface HTTP/2 شروع می‌کند) را خود net/http جواب می‌دهد،
+//     پس این اتصال‌ها مثل بقیه در ConnState شمرده و با Shutdown آرام بسته می‌شوند
+//   - درخواست HTTP/1.1 با Upgrade: h2c را h2c.NewHandler hijack و به یک http2.Server می‌سپارد
+//
+// باید بعد از تعیین srv.Handler و srv.IdleTimeout صدا زده شود.
+func enableH2C(srv *http.Server) {
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+
+	// اتصال ارتقایافته از دید net/http hijack شده است؛ مهلت بی‌کاری‌اش را خود http2.Server نگه می‌دارد
+	idle := srv.IdleTimeout
+	if idle == 0 {
+		idle = 60 * time.Second
+	}
+	srv.Handler = h2c.NewHandler(srv.Handler, &http2.Server{IdleTimeout: idle})
+
+	slog.Info("h2c enabled", "protocols", srv.Protocols.String(), "upgrade", true)
+}
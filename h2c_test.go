@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// newH2CServer handler کامل سرور را مثل H2C=true با enableH2C اجرا می‌کند و
+// کلاینتی برمی‌گرداند که بدون TLS و بدون Upgrade مستقیم HTTP/2 صحبت می‌کند
+func newH2CServer(t *testing.T) (*httptest.Server, *http.Client) {
+	t.Helper()
+	captureLogs(t)
+	a, _ := newTestApp(t, nil)
+
+	ts := httptest.NewUnstartedServer(a.handler)
+	enableH2C(ts.Config)
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	tr := &http.Transport{Protocols: new(http.Protocols)}
+	tr.Protocols.SetUnencryptedHTTP2(true)
+	t.Cleanup(tr.CloseIdleConnections)
+	return ts, &http.Client{Transport: tr}
+}
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	ts, client := newH2CServer(t)
+
+	resp, err := client.Get(ts.URL + "/api/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("proto = %s, want HTTP/2.0", resp.Proto)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	// middlewareهای زنجیره روی HTTP/2 هم اجرا شده‌اند
+	if resp.Header.Get("X-Request-ID") == "" {
+		t.Error("X-Request-ID missing")
+	}
+}
+
+// پاسخ stream شده روی h2c خط به خط و بدون Transfer-Encoding (که در HTTP/2 معنا ندارد) می‌رسد
+func TestH2CStreaming(t *testing.T) {
+	ts, client := newH2CServer(t)
+
+	resp, err := client.Get(ts.URL + "/api/count?count=3&delay_ms=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("proto = %s, want HTTP/2.0", resp.Proto)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if len(resp.TransferEncoding) != 0 {
+		t.Errorf("Transfer-Encoding = %v on HTTP/2", resp.TransferEncoding)
+	}
+
+	var lines []string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "2", "3"}; !slices.Equal(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
+
+// HTTP/1.1 روی همان listener همچنان کار می‌کند
+func TestH2CKeepsHTTP1(t *testing.T) {
+	ts, _ := newH2CServer(t)
+
+	resp, err := http.Get(ts.URL + "/api/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.ProtoMajor != 1 || resp.StatusCode != http.StatusOK {
+		t.Errorf("got %s %d, want HTTP/1.1 200", resp.Proto, resp.StatusCode)
+	}
+}
+
+// درخواست HTTP/1.1 با Upgrade: h2c پاسخ 101 می‌گیرد و پاسخ همان درخواست روی stream 1 با HTTP/2 می‌آید
+func TestH2CUpgrade(t *testing.T) {
+	ts, _ := newH2CServer(t)
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "GET /api/ping HTTP/1.1\r\n"+
+		"Host: "+ts.Listener.Addr().String()+"\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\n"+
+		"Upgrade: h2c\r\n"+
+		"HTTP2-Settings: AAMAAABkAAQAoAAAAAIAAAAA\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || !strings.EqualFold(resp.Header.Get("Upgrade"), "h2c") {
+		t.Fatalf("got %d, Upgrade %q; want 101 h2c", resp.StatusCode, resp.Header.Get("Upgrade"))
+	}
+
+	// بعد از 101 کلاینت preface و SETTINGS خودش را می‌فرستد و پاسخ درخواست اول را روی stream 1 می‌خواند
+	io.WriteString(conn, http2.ClientPreface)
+	fr := http2.NewFramer(conn, br)
+	if err := fr.WriteSettings(); err != nil {
+		t.Fatal(err)
+	}
+	var status string
+	var body []byte
+	dec := hpack.NewDecoder(4096, func(f hpack.HeaderField) {
+		if f.Name == ":status" {
+			status = f.Value
+		}
+	})
+	for ended := false; !ended; {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		switch f := f.(type) {
+		case *http2.HeadersFrame:
+			if _, err := dec.Write(f.HeaderBlockFragment()); err != nil {
+				t.Fatal(err)
+			}
+			ended = f.StreamID == 1 && f.StreamEnded()
+		case *http2.DataFrame:
+			body = append(body, f.Data()...)
+			ended = f.StreamID == 1 && f.StreamEnded()
+		}
+	}
+	if status != "200" {
+		t.Errorf(":status = %q, want 200", status)
+	}
+	if !strings.Contains(string(body), "pong") {
+		t.Errorf("body = %q", body)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http" // هسته HTTP در Go
+)
+
+// ================= HEAD Requests =================
+
+// headMiddleware برای درخواست‌های HEAD body پاسخ را دور می‌ریزد تا handlerها
+// (که HEAD را از GET به ارث می‌برند) لازم نباشد خودشان متد را بررسی کنند.
+// هدرها، از جمله Content-Length که writeJSON و فایل‌های استاتیک می‌گذارند، دست نمی‌خورند.
+// middlewareهای داخلی (مثل cache و لاگ) همان body کامل GET را می‌بینند.
+func headMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&headWriter{ResponseWriter: w}, r)
+	})
+}
+
+// headWriter نوشتن body را بی‌صدا نادیده می‌گیرد
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (hw *headWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// Unwrap به http.ResponseController اجازه می‌دهد به writer اصلی برسد
+func (hw *headWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
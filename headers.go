@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http" // هسته HTTP در Go
+)
+
+// ================= Default Response Headers =================
+
+// headerRules هدرهایی که روی همه‌ی پاسخ‌ها (API، فایل static، proxy و خطاها) اعمال می‌شوند
+type headerRules struct {
+	set      map[string]string // قبل از handler گذاشته می‌شوند؛ handler می‌تواند عوضشان کند
+	remove   []string          // درست قبل از ارسال هدرها حذف می‌شوند، حتی اگر handler یا upstream گذاشته باشد
+	override map[string]string // درست قبل از ارسال هدرها گذاشته می‌شوند و مقدار handler را عوض می‌کنند
+}
+
+// newHeaderRules از نگاشت DEFAULT_HEADERS (مقدار خالی یعنی حذف) و SERVER_HEADER قانون‌ها را می‌سازد.
+// هدر Server فقط با SERVER_HEADER کنترل می‌شود: خالی یعنی حذف، وگرنه همین مقدار روی همه‌ی پاسخ‌ها.
+func newHeaderRules(headers map[string]string, server string) headerRules {
+	rules := headerRules{set: make(map[string]string), override: make(map[string]string)}
+	for name, value := range headers {
+		name = http.CanonicalHeaderKey(name)
+		if value == "" {
+			rules.remove = append(rules.remove, name)
+		} else {
+			rules.set[name] = value
+		}
+	}
+
+	// پیش‌فرض حذف است تا نرم‌افزار upstreamهای پروکسی (مثل nginx/1.25) لو نرود
+	if server == "" {
+		rules.remove = append(rules.remove, "Server")
+	} else {
+		rules.override["Server"] = server
+	}
+	return rules
+}
+
+// defaultHeadersMiddleware قانون‌های DEFAULT_HEADERS را روی هر پاسخ اعمال می‌کند
+func defaultHeadersMiddleware(rules headerRules) Middleware {
+	return func(next http.Handler) http.Handler {
+		if len(rules.set) == 0 && len(rules.remove) == 0 && len(rules.override) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for name, value := range rules.set {
+				h.Set(name, value)
+			}
+			if len(rules.remove) == 0 && len(rules.override) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(&headerRulesWriter{ResponseWriter: w, rules: rules}, r)
+		})
+	}
+}
+
+// headerRulesWriter هدرهای حذفی و override را لحظه‌ی ارسال هدرها اعمال می‌کند
+type headerRulesWriter struct {
+	http.ResponseWriter
+	rules   headerRules
+	applied bool
+}
+
+// apply فقط یک بار، قبل از اولین ارسال هدرها
+func (hw *headerRulesWriter) apply() {
+	if hw.applied {
+		return
+	}
+	hw.applied = true
+	h := hw.ResponseWriter.Header()
+	for _, name := range hw.rules.remove {
+		h.Del(name)
+	}
+	for name, value := range hw.rules.override {
+		h.Set(name, value)
+	}
+}
+
+func (hw *headerRulesWriter) WriteHeader(status int) {
+	// پاسخ‌های 1xx (مثل 103 Early Hints) هدرهای نهایی نیستند
+	if status >= http.StatusOK {
+		hw.apply()
+	}
+	hw.ResponseWriter.WriteHeader(status)
+}
+
+func (hw *headerRulesWriter) Write(p []byte) (int, error) {
+	hw.apply()
+	return hw.ResponseWriter.Write(p)
+}
+
+// Flush بدون WriteHeader هم هدرها را می‌فرستد؛ پس قانون‌ها قبلش اعمال می‌شوند
+func (hw *headerRulesWriter) Flush() {
+	hw.apply()
+	_ = http.NewResponseController(hw.ResponseWriter).Flush()
+}
+
+// Unwrap به http.ResponseController اجازه می‌دهد به writer اصلی برسد
+func (hw *headerRulesWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"     // timeout هر بررسی
+	"net/http"    // هسته HTTP در Go
+	"sync"        // اجرای همزمان بررسی‌ها
+	"sync/atomic" // وضعیت readiness
+	"time"        // زمان پاسخ و timeout
+)
+
+// ================= Health Checks =================
+
+// هر بررسی سلامت حداکثر این مدت فرصت دارد
+const healthCheckTimeout = 2 * time.Second
+
+// healthCheck یک وابستگی که در /health بررسی می‌شود.
+// خرابی وابستگی critical یعنی سرویس سالم نیست (503)؛ بقیه فقط وضعیت را degraded می‌کنند.
+type healthCheck struct {
+	name     string
+	critical bool
+	check    func(ctx context.Context) error
+}
+
+var (
+	healthMu     sync.RWMutex
+	healthChecks []healthCheck
+)
+
+// با HEALTH_VERBOSE پاسخ /health نسخه، commit، نسخه‌ی Go و uptime را هم دارد
+var healthVerbose = false
+
+// registerHealthCheck یک بررسی جدید به /health اضافه می‌کند
+func registerHealthCheck(name string, critical bool, check func(ctx context.Context) error) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	healthChecks = append(healthChecks, healthCheck{name: name, critical: critical, check: check})
+}
+
+// نتیجه‌ی یک بررسی در پاسخ /health
+type checkResult struct {
+	Status   string `json:"status"` // ok یا fail
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+}
+
+// /health → بررسی سلامت سرور و وابستگی‌هایش
+//
+//	ok        همه‌ی بررسی‌ها موفق
+//	degraded  فقط بررسی‌های غیر critical خطا دارند (پاسخ همچنان 200)
+//	unhealthy حداقل یک بررسی critical خطا دارد (پاسخ 503)
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+
+	healthMu.RLock()
+	checks := healthChecks
+	healthMu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	// بررسی‌ها همزمان اجرا می‌شوند تا یک وابستگی کند بقیه را معطل نکند
+	results := make([]checkResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = checkResult{Status: "ok", Critical: c.critical}
+			if err := runHealthCheck(ctx, c); err != nil {
+				results[i] = checkResult{Status: "fail", Critical: c.critical, Error: err.Error()}
+			}
+		}()
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	byName := make(map[string]checkResult, len(checks))
+	for i, c := range checks {
+		byName[c.name] = results[i]
+		if results[i].Status == "ok" {
+			continue
+		}
+		if c.critical {
+			status, code = "unhealthy", http.StatusServiceUnavailable
+		} else if status == "ok" {
+			status = "degraded"
+		}
+	}
+
+	resp := map[string]any{
+		"ok":     code == http.StatusOK,           // وضعیت سلامت (برای سازگاری با قبل)
+		"status": status,                          // ok, degraded, unhealthy
+		"time":   time.Now().Format(time.RFC3339), // زمان فعلی
+		"checks": byName,                          // جزئیات هر بررسی
+	}
+	if healthVerbose {
+		resp["build"] = currentBuild // version, commit, go_version
+		resp["uptime"] = time.Since(processStart).Round(time.Second).String()
+		resp["uptime_seconds"] = int64(time.Since(processStart).Seconds())
+	}
+	writeJSON(w, code, resp)
+}
+
+// ================= Readiness =================
+
+// serverReady بعد از شروع Serve روشن و با رسیدن سیگنال خاموش‌سازی (قبل از PRESTOP_DELAY) خاموش می‌شود
+var serverReady atomic.Bool
+
+// /readyz → آیا load balancer باید به این نمونه ترافیک بفرستد؛ 503 یعنی هنوز آماده نیست (self-test با
+// SELFTEST_ON_FAIL=block) یا در حال خاموش شدن. برخلاف /health وابستگی‌ها را در هر درخواست بررسی نمی‌کند تا
+// خرابی موقت یک وابستگی همه‌ی نمونه‌ها را از چرخش خارج نکند؛ فقط نتیجه‌ی آخرین self-test را نشان می‌دهد.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]any{"ready": serverReady.Load()}
+	if results := selfTestResults.Load(); results != nil {
+		resp["selftest"] = *results
+	}
+	if !serverReady.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ================= Liveness =================
+
+// /livez → آیا پروسه باید restart شود؛ برخلاف /health و /readyz هیچ وابستگی را بررسی نمی‌کند و در
+// خاموش‌سازی هم 200 می‌دهد. فقط با WATCHDOG_TIMEOUT، وقتی سرو درخواست‌ها یا کارهای پس‌زمینه بیشتر از
+// آن مدت پیشرفت نکرده باشند، 503 برمی‌گرداند.
+func livezHandler(w http.ResponseWriter, r *http.Request) {
+	wd := liveWatchdog.Load()
+	if wd == nil {
+		writeJSON(w, http.StatusOK, map[string]any{"alive": true})
+		return
+	}
+	if part, d := wd.stalled(); part != "" {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{
+			"alive":   false,
+			"stalled": part,
+			"since":   d.Round(time.Millisecond).String(),
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"alive": true, "watchdog": wd.timeout.String()})
+}
+
+// runHealthCheck بررسی را اجرا می‌کند و حتی اگر بررسی به ctx توجه نکند، بعد از timeout برمی‌گردد
+func runHealthCheck(ctx context.Context, c healthCheck) error {
+	done := make(chan error, 1)
+	go func() { done <- c.check(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+)
+
+// logBuffer خروجی لاگ را از چند goroutine (handlerهای سرور تست) جمع می‌کند
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs لاگر پیش‌فرض و access log را تا پایان تست (در سطح debug و قالب json) به یک بافر می‌برد.
+// لاگرها سراسری‌اند، پس تست‌هایی که از آن استفاده می‌کنند نباید Parallel باشند.
+func captureLogs(t *testing.T) *logBuffer {
+	t.Helper()
+	out := &logBuffer{}
+	prevDefault, prevAccess := slog.Default(), accessLogger
+	h := slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug})
+	slog.SetDefault(slog.New(h))
+	accessLogger = slog.New(h)
+	t.Cleanup(func() {
+		slog.SetDefault(prevDefault)
+		accessLogger = prevAccess
+	})
+	return out
+}
+
+// discardWriter یک ResponseWriter بدون هزینه برای benchmarkها؛ هدرها در هر دور پاک و دوباره استفاده می‌شوند
+type discardWriter struct {
+	h http.Header
+}
+
+func newDiscardWriter() *discardWriter { return &discardWriter{h: make(http.Header)} }
+
+func (d *discardWriter) Header() http.Header         { return d.h }
+func (d *discardWriter) WriteHeader(int)             {}
+func (d *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func (d *discardWriter) reset() { clear(d.h) }
+
+// newTestConfig تنظیمات را مثل run از env (به‌علاوه‌ی env داده‌شده) می‌خواند و تنظیمات زمان اجرا را فعال
+// می‌کند. os.Args تست فلگ‌های go test را دارد، پس در مدت loadConfig خالی می‌شود.
+func newTestConfig(t *testing.T, env map[string]string) Config {
+	t.Helper()
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+
+	args := os.Args
+	os.Args = args[:1]
+	cfg, err := loadConfig()
+	os.Args = args
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if err := applyRuntimeConfig(cfg.Runtime); err != nil {
+		t.Fatalf("applyRuntimeConfig: %v", err)
+	}
+	return cfg
+}
+
+// newTestApp همان handler کامل سرور را با newTestConfig می‌سازد؛ goroutineهای پس‌زمینه با پایان تست متوقف می‌شوند
+func newTestApp(t *testing.T, env map[string]string) (*app, Config) {
+	t.Helper()
+	cfg := newTestConfig(t, env)
+	a, err := newApp(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("newApp: %v", err)
+	}
+	return a, cfg
+}
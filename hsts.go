@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http" // هسته HTTP در Go
+	"strconv"  // مقدار max-age
+	"time"     // مدت اعتبار سیاست
+)
+
+// ================= HSTS Middleware =================
+
+// hstsMiddleware به پاسخ درخواست‌های HTTPS هدر Strict-Transport-Security اضافه می‌کند
+// تا مرورگر تا maxAge فقط با HTTPS به سایت وصل شود. طبق RFC 6797 این هدر روی HTTP ساده
+// ارسال نمی‌شود؛ پشت پروکسی TLS، امن بودن از X-Forwarded-Proto پروکسی مورد اعتماد خوانده می‌شود.
+func hstsMiddleware(maxAge time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if maxAge <= 0 {
+			return next // HSTS خاموش است
+		}
+
+		value := "max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isSecure(r) {
+				w.Header().Set("Strict-Transport-Security", value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"  // توقف پاک‌سازی دوره‌ای
+	"net/http" // هسته HTTP در Go
+	"sync"     // دسترسی همزمان امن به کلیدها
+	"time"     // زمان انقضای پاسخ‌ها
+)
+
+// ================= Idempotency Keys =================
+//
+// کلاینتی که POST را بعد از خطای شبکه دوباره می‌فرستد نمی‌داند بار اول اجرا شده یا نه.
+// با هدر Idempotency-Key، اولین پاسخ برای (کلاینت، متد، مسیر، کلید) تا ttl نگه داشته می‌شود و تکرارها
+// همان پاسخ را بدون اجرای دوباره‌ی handler می‌گیرند (با Idempotent-Replayed: true).
+// تکراری که تا اجرای اول تمام نشده برسد 409 با Retry-After می‌گیرد.
+// فقط routeهایی که middleware را دارند پشتیبانی می‌کنند و درخواست بدون هدر عادی اجرا می‌شود.
+// کلید به کلاینت (کاربر احراز هویت‌شده، وگرنه IP واقعی) بسته است تا کسی که کلید کلاینت دیگری را حدس
+// بزند یا ببیند پاسخ او را نگیرد.
+
+// حداکثر تعداد کلیدهایی که همزمان نگه داشته می‌شوند
+const idempotencyMaxEntries = 10_000
+
+// حداکثر طول کلید؛ UUID و مشابه آن خیلی کوتاه‌ترند
+const idempotencyMaxKeyLen = 255
+
+// فاصله‌ی پاک کردن پاسخ‌های منقضی؛ بدون آن کلیدها تا پر شدن store می‌مانند
+const idempotencyPurgeInterval = time.Minute
+
+// idempotencyEntry یک کلید دیده‌شده؛ resp تا پایان اجرای اول nil است
+type idempotencyEntry struct {
+	resp *cachedResponse
+}
+
+// idempotencyStore پاسخ‌های ضبط‌شده‌ی هر کلید را در حافظه نگه می‌دارد
+type idempotencyStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+// newIdempotencyStore یک store خالی با مدت نگه‌داری ttl می‌سازد؛ پاسخ‌های منقضی تا لغو ctx
+// هر idempotencyPurgeInterval پاک می‌شوند
+func newIdempotencyStore(ctx context.Context, ttl time.Duration) *idempotencyStore {
+	s := &idempotencyStore{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+	runEvery(ctx, idempotencyPurgeInterval, s.purge)
+	return s
+}
+
+// middleware پاسخ درخواست‌های دارای Idempotency-Key را ضبط و در تکرارها دوباره ارسال می‌کند
+func (s *idempotencyStore) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		idemKey := r.Header.Get("Idempotency-Key")
+		if idemKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validIdempotencyKey(idemKey) {
+			writeError(w, http.StatusBadRequest, "invalid Idempotency-Key (1-255 visible ASCII characters)")
+			return
+		}
+
+		// همان کلید از کلاینت دیگر یا روی مسیر یا متد دیگر درخواست دیگری است
+		key := idempotencyClient(r) + "\x00" + r.Method + " " + r.URL.Path + "\x00" + idemKey
+
+		entry, existing, ok := s.begin(key)
+		if !ok {
+			writeRetryError(w, http.StatusServiceUnavailable, "too many idempotency keys in progress", time.Second)
+			return
+		}
+		if existing {
+			if entry.resp == nil {
+				writeRetryError(w, http.StatusConflict, "a request with this Idempotency-Key is still in progress", time.Second)
+				return
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeCachedResponse(w, entry.resp, "HIT")
+			return
+		}
+
+		// اگر handler کامل نشود (panic) کلید آزاد می‌شود تا تکرار دوباره اجرا شود
+		completed := false
+		defer func() {
+			if !completed {
+				s.release(key, entry)
+			}
+		}()
+
+		// مثل timeoutMiddleware هدرهای بیرونی (X-Request-ID برای body خطاها) برای handler دیده می‌شوند
+		rec := newResponseBuffer()
+		rec.header = w.Header().Clone()
+		next.ServeHTTP(rec, r)
+		completed = true
+
+		now := time.Now()
+		resp := &cachedResponse{
+			status:  rec.status,
+			header:  rec.header,
+			body:    rec.body.Bytes(),
+			stored:  now,
+			expires: now.Add(s.ttl),
+		}
+
+		// خطای سرور موقت است؛ تکرار باید دوباره اجرا شود نه اینکه همان خطا را بگیرد
+		if resp.status >= 500 {
+			s.release(key, entry)
+		} else {
+			s.mu.Lock()
+			entry.resp = resp
+			s.mu.Unlock()
+		}
+		writeCachedResponse(w, resp, "MISS")
+	})
+}
+
+// begin کلید را پیدا یا به عنوان "در حال اجرا" ثبت می‌کند؛ existing یعنی کلید قبلاً دیده شده.
+// ok=false یعنی store با کلیدهای در حال اجرا پر است.
+func (s *idempotencyStore) begin(key string) (entry *idempotencyEntry, existing, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if e, found := s.entries[key]; found {
+		if e.resp == nil || now.Before(e.resp.expires) {
+			return e, true, true
+		}
+		delete(s.entries, key) // منقضی؛ مثل کلید جدید
+	}
+
+	if len(s.entries) >= idempotencyMaxEntries && !s.evictLocked(now) {
+		return nil, false, false
+	}
+
+	entry = &idempotencyEntry{}
+	s.entries[key] = entry
+	return entry, false, true
+}
+
+// evictLocked entryهای منقضی را پاک می‌کند و اگر کافی نبود قدیمی‌ترین پاسخ کامل را؛
+// کلیدهای در حال اجرا هیچ‌وقت حذف نمی‌شوند. false یعنی جایی آزاد نشد.
+func (s *idempotencyStore) evictLocked(now time.Time) bool {
+	var oldestKey string
+	var oldest *cachedResponse
+	for k, e := range s.entries {
+		if e.resp == nil {
+			continue
+		}
+		if now.After(e.resp.expires) {
+			delete(s.entries, k)
+			continue
+		}
+		if oldest == nil || e.resp.stored.Before(oldest.stored) {
+			oldestKey, oldest = k, e.resp
+		}
+	}
+	if len(s.entries) < idempotencyMaxEntries {
+		return true
+	}
+	if oldest == nil {
+		return false
+	}
+	delete(s.entries, oldestKey)
+	return true
+}
+
+// purge همه‌ی پاسخ‌های منقضی را پاک می‌کند؛ کلیدهای در حال اجرا می‌مانند
+func (s *idempotencyStore) purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, e := range s.entries {
+		if e.resp != nil && now.After(e.resp.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// idempotencyClient صاحب کلید: کاربر احراز هویت‌شده یا اگر نباشد IP واقعی کلاینت
+func idempotencyClient(r *http.Request) string {
+	if u := authUser(r); u != "" {
+		return "user:" + u
+	}
+	return "ip:" + clientIP(r).String()
+}
+
+// release کلید در حال اجرا را حذف می‌کند (فقط اگر هنوز مال همین اجرا باشد)
+func (s *idempotencyStore) release(key string, entry *idempotencyEntry) {
+	s.mu.Lock()
+	if s.entries[key] == entry {
+		delete(s.entries, key)
+	}
+	s.mu.Unlock()
+}
+
+// validIdempotencyKey کلید باید 1 تا 255 کاراکتر ASCII قابل مشاهده باشد
+func validIdempotencyKey(key string) bool {
+	if len(key) > idempotencyMaxKeyLen {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
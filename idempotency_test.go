@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestIdempotencyStore یک store با پاک‌سازی متوقف در پایان تست می‌سازد
+func newTestIdempotencyStore(t *testing.T, ttl time.Duration) *idempotencyStore {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return newIdempotencyStore(ctx, ttl)
+}
+
+// idemRequest یک POST با Idempotency-Key از آدرس remote می‌سازد
+func idemRequest(key, remote string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/echo", strings.NewReader(`{}`))
+	r.Header.Set("Idempotency-Key", key)
+	r.RemoteAddr = remote
+	return r
+}
+
+// countingHandler شماره‌ی اجرا را در body می‌نویسد
+func countingHandler(calls *atomic.Int32, status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.WriteHeader(status)
+		w.Write([]byte("run " + strconv.Itoa(int(n))))
+	})
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestIdempotencyStore(t, time.Hour).middleware(countingHandler(&calls, http.StatusCreated))
+
+	first := httptest.NewRecorder()
+	h.ServeHTTP(first, idemRequest("k1", "192.0.2.1:1000"))
+	second := httptest.NewRecorder()
+	h.ServeHTTP(second, idemRequest("k1", "192.0.2.1:2000")) // همان کلاینت، اتصال دیگر
+
+	if calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls.Load())
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != "run 1" {
+		t.Errorf("replay = %d %q, want 201 \"run 1\"", second.Code, second.Body)
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("replay has no Idempotent-Replayed header")
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("first response marked as replayed")
+	}
+}
+
+// کلید یکسان از کلاینت دیگر پاسخ کلاینت اول را نمی‌گیرد
+func TestIdempotencyScopedToClient(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestIdempotencyStore(t, time.Hour).middleware(countingHandler(&calls, http.StatusOK))
+
+	h.ServeHTTP(httptest.NewRecorder(), idemRequest("shared", "192.0.2.1:1000"))
+
+	other := httptest.NewRecorder()
+	h.ServeHTTP(other, idemRequest("shared", "198.51.100.7:1000"))
+	if other.Body.String() != "run 2" || other.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("other IP got %q (replayed=%q), want its own run", other.Body, other.Header().Get("Idempotent-Replayed"))
+	}
+
+	// کاربر احراز هویت‌شده از هر IP همان کاربر است و IP دیگر با همان کلید کاربر دیگری نیست
+	alice := withAuthUser(idemRequest("shared", "203.0.113.1:1000"), "alice")
+	h.ServeHTTP(httptest.NewRecorder(), alice)
+	aliceAgain := httptest.NewRecorder()
+	h.ServeHTTP(aliceAgain, withAuthUser(idemRequest("shared", "203.0.113.2:1000"), "alice"))
+	bob := httptest.NewRecorder()
+	h.ServeHTTP(bob, withAuthUser(idemRequest("shared", "203.0.113.1:1000"), "bob"))
+
+	if aliceAgain.Body.String() != "run 3" {
+		t.Errorf("alice from another IP got %q, want replay of run 3", aliceAgain.Body)
+	}
+	if bob.Body.String() != "run 4" {
+		t.Errorf("bob got %q, want his own run 4", bob.Body)
+	}
+}
+
+func TestIdempotencyInFlightConflict(t *testing.T) {
+	started, unblock := make(chan struct{}), make(chan struct{})
+	h := newTestIdempotencyStore(t, time.Hour).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-unblock
+		w.Write([]byte("done"))
+	}))
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, idemRequest("k", "192.0.2.1:1000"))
+		done <- w
+	}()
+	<-started
+
+	dup := httptest.NewRecorder()
+	h.ServeHTTP(dup, idemRequest("k", "192.0.2.1:1000"))
+	if dup.Code != http.StatusConflict {
+		t.Errorf("duplicate in flight = %d, want 409", dup.Code)
+	}
+	if dup.Header().Get("Retry-After") == "" {
+		t.Errorf("409 has no Retry-After")
+	}
+
+	close(unblock)
+	if first := <-done; first.Code != http.StatusOK || first.Body.String() != "done" {
+		t.Errorf("first = %d %q", first.Code, first.Body)
+	}
+}
+
+// پاسخ 5xx نگه داشته نمی‌شود تا تکرار دوباره اجرا شود
+func TestIdempotencyReleasesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	status := http.StatusServiceUnavailable
+	h := newTestIdempotencyStore(t, time.Hour).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(status)
+	}))
+
+	first := httptest.NewRecorder()
+	h.ServeHTTP(first, idemRequest("k", "192.0.2.1:1000"))
+	if first.Code != http.StatusServiceUnavailable {
+		t.Fatalf("first = %d, want 503", first.Code)
+	}
+
+	status = http.StatusOK
+	retry := httptest.NewRecorder()
+	h.ServeHTTP(retry, idemRequest("k", "192.0.2.1:1000"))
+	if calls.Load() != 2 || retry.Code != http.StatusOK || retry.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry after 503: calls=%d status=%d replayed=%q, want a fresh 200", calls.Load(), retry.Code, retry.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+// purge پاسخ‌های منقضی را پاک می‌کند ولی کلید در حال اجرا را نه
+func TestIdempotencyPurge(t *testing.T) {
+	s := newTestIdempotencyStore(t, time.Millisecond)
+	h := s.middleware(countingHandler(new(atomic.Int32), http.StatusOK))
+	h.ServeHTTP(httptest.NewRecorder(), idemRequest("old", "192.0.2.1:1000"))
+	inFlight, _, _ := s.begin("in-flight")
+
+	time.Sleep(5 * time.Millisecond)
+	s.purge()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) != 1 || s.entries["in-flight"] != inFlight {
+		t.Errorf("entries after purge = %v, want only the in-flight key", s.entries)
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"         // ساختن object با ترتیب فیلدها
+	"encoding"      // تشخیص TextMarshaler
+	"encoding/json" // encode مقدارها و تشخیص Marshaler
+	"net/http"      // هسته HTTP در Go
+	"reflect"       // پیمایش فیلدهای struct
+	"slices"        // ترتیب فیلدها بعد از حذف هم‌نام‌ها
+	"strings"       // ساختن نام فیلد
+	"sync"          // cache فیلدهای هر نوع
+	"unicode"       // تشخیص مرز کلمه‌ها در نام فیلد
+)
+
+// ================= JSON Field Case =================
+//
+// encoding/json نام فیلد بدون تگ را همان‌طور که در Go است (PascalCase) می‌نویسد.
+// writeJSONCase همان پاسخ را می‌سازد ولی نام فیلدهای بدون تگ json را به سبک دلخواه تبدیل می‌کند:
+//
+//	type order struct {
+//		OrderID   int
+//		CreatedAt time.Time
+//		Note      string `json:"memo,omitempty"` // تگ صریح همیشه برنده است
+//	}
+//	writeJSONCase(w, 200, order{...}, jsonSnakeCase) → {"order_id":1,"created_at":"...","memo":"..."}
+//
+// کلید mapها داده هستند و عوض نمی‌شوند. نوع‌هایی که خودشان MarshalJSON یا MarshalText دارند
+// (مثل time.Time و json.RawMessage) دست نمی‌خورند. writeJSON بدون تغییر می‌ماند؛ این نسخه انتخابی است.
+
+// jsonCase سبک نام فیلدهای بدون تگ در writeJSONCase
+type jsonCase int
+
+const (
+	jsonSnakeCase jsonCase = iota // OrderID → order_id
+	jsonCamelCase                 // OrderID → orderId
+)
+
+// writeJSONCase مثل writeJSON است ولی نام فیلدهای struct بدون تگ json را به سبک style می‌نویسد
+func writeJSONCase(w http.ResponseWriter, status int, v any, style jsonCase) {
+	writeJSON(w, status, caseValue(reflect.ValueOf(v), style))
+}
+
+// caseField یک فیلد object خروجی
+type caseField struct {
+	name  string
+	value any
+}
+
+// caseObject یک struct تبدیل‌شده؛ برخلاف map ترتیب فیلدهای struct را نگه می‌دارد
+type caseObject []caseField
+
+func (o caseObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.name) // رشته همیشه encode می‌شود
+		buf.Write(name)
+		buf.WriteByte(':')
+
+		val, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// caseValue مقدار را به شکلی تبدیل می‌کند که json.Marshal آن را با نام‌های جدید بنویسد
+func caseValue(v reflect.Value, style jsonCase) any {
+	if !v.IsValid() {
+		return nil
+	}
+
+	// encode اختصاصی خود نوع حفظ می‌شود
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	if v.CanAddr() && (reflect.PointerTo(t).Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)) {
+		return v.Addr().Interface() // متد با receiver اشاره‌گر
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return caseValue(v.Elem(), style)
+
+	case reflect.Struct:
+		fields := caseFieldsOf(t, style)
+		obj := make(caseObject, 0, len(fields))
+		for _, f := range fields {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || f.omitEmpty && isEmptyJSON(fv) {
+				continue
+			}
+			obj = append(obj, caseField{name: f.name, value: caseValue(fv, style)})
+		}
+		return obj
+
+	case reflect.Map:
+		if v.IsNil() || t.Key().Kind() != reflect.String {
+			return v.Interface() // کلید غیر رشته‌ای را encoding/json خودش مدیریت می‌کند
+		}
+		out := make(map[string]any, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			out[it.Key().String()] = caseValue(it.Value(), style)
+		}
+		return out
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.IsNil() || t.Elem().Kind() == reflect.Uint8) {
+			return v.Interface() // null یا []byte (base64) مثل encoding/json
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = caseValue(v.Index(i), style)
+		}
+		return out
+	}
+
+	if v.CanInterface() {
+		return v.Interface()
+	}
+	return nil
+}
+
+// fieldByIndex مثل Value.FieldByIndex است ولی روی struct embedded با اشاره‌گر nil توقف می‌کند
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmptyJSON همان تعریف "خالی" در omitempty پکیج encoding/json است (struct هیچ‌وقت خالی نیست)
+func isEmptyJSON(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return v.IsZero()
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// caseStructField یک فیلد قابل encode و نام خروجی آن
+type caseStructField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool // نام از تگ json آمده است
+}
+
+// لیست فیلدهای هر (نوع، سبک) یک بار ساخته می‌شود
+var caseFieldCache sync.Map // caseFieldKey → []caseStructField
+
+type caseFieldKey struct {
+	t     reflect.Type
+	style jsonCase
+}
+
+// caseFieldsOf فیلدهای struct را با قواعد encoding/json (فیلد unexported نه، تگ "-" نه،
+// فیلدهای struct embedded بدون تگ در سطح بالا) و نام تبدیل‌شده برمی‌گرداند.
+// گزینه‌ی ",string" تگ پشتیبانی نمی‌شود و مقدار با نوع خودش نوشته می‌شود.
+//
+// مثل encoding/json سطح به سطح پیش می‌رود و نوعی که در سطح کم‌عمق‌تر دیده شده دوباره باز نمی‌شود؛
+// بدون آن struct خودارجاع مثل struct{ *T; X int } بی‌پایان پیمایش می‌شد.
+func caseFieldsOf(t reflect.Type, style jsonCase) []caseStructField {
+	key := caseFieldKey{t, style}
+	if f, ok := caseFieldCache.Load(key); ok {
+		return f.([]caseStructField)
+	}
+
+	type embedded struct {
+		t     reflect.Type
+		index []int
+	}
+
+	var fields []caseStructField
+	visited := make(map[reflect.Type]bool)
+	for next := []embedded{{t, nil}}; len(next) > 0; {
+		level := next
+		next = nil
+		for _, e := range level {
+			if visited[e.t] {
+				continue // در سطح کم‌عمق‌تر دیده شده و فیلدهایش آن‌جا برنده‌اند
+			}
+			for i := range e.t.NumField() {
+				sf := e.t.Field(i)
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				idx := append(e.index[:len(e.index):len(e.index)], i)
+
+				// struct embedded بدون نام در تگ: فیلدهایش در سطح بعد می‌آیند. struct embedded با نوع
+				// unexported هم مثل encoding/json حساب می‌شود چون ممکن است فیلد exported داشته باشد
+				et := sf.Type
+				if et.Kind() == reflect.Pointer {
+					et = et.Elem()
+				}
+				embeddedStruct := sf.Anonymous && et.Kind() == reflect.Struct
+				if embeddedStruct && name == "" {
+					next = append(next, embedded{et, idx})
+					continue
+				}
+				if !sf.IsExported() && !embeddedStruct {
+					continue
+				}
+
+				f := caseStructField{name: name, index: idx, omitEmpty: strings.Contains(opts, "omitempty"), tagged: name != ""}
+				if !f.tagged {
+					f.name = convertCase(sf.Name, style)
+				}
+				fields = append(fields, f)
+			}
+		}
+		// نوعی که دو بار در همین سطح embed شده دو بار پیمایش می‌شود تا فیلدهایش مثل encoding/json با هم حذف شوند
+		for _, e := range level {
+			visited[e.t] = true
+		}
+	}
+
+	fields = dominantFields(fields)
+	caseFieldCache.Store(key, fields)
+	return fields
+}
+
+// dominantFields از فیلدهای هم‌نام با قاعده‌ی encoding/json یکی را نگه می‌دارد: کم‌عمق‌ترین؛ در یک عمق
+// تنها فیلد تگ‌دار؛ اگر باز هم بیش از یکی بماند هیچ‌کدام. ترتیب خروجی ترتیب فیلدها در struct است.
+func dominantFields(fields []caseStructField) []caseStructField {
+	byName := make(map[string][]caseStructField)
+	for _, f := range fields {
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	kept := make([]caseStructField, 0, len(byName))
+	for _, same := range byName {
+		// fields سطح به سطح جمع شده، پس اولی کم‌عمق‌ترین است
+		depth := len(same[0].index)
+		var top, tagged []caseStructField
+		for _, f := range same {
+			if len(f.index) > depth {
+				break
+			}
+			top = append(top, f)
+			if f.tagged {
+				tagged = append(tagged, f)
+			}
+		}
+		switch {
+		case len(top) == 1:
+			kept = append(kept, top[0])
+		case len(tagged) == 1:
+			kept = append(kept, tagged[0])
+		}
+	}
+
+	slices.SortFunc(kept, func(a, b caseStructField) int { return slices.Compare(a.index, b.index) })
+	return kept
+}
+
+// convertCase نام Go را به کلمه‌ها می‌شکند (UserID → User, ID و HTTPServer → HTTP, Server)
+// و به سبک style کنار هم می‌گذارد
+func convertCase(name string, style jsonCase) string {
+	words := splitWords(name)
+	for i, w := range words {
+		w = strings.ToLower(w)
+		if style == jsonCamelCase && i > 0 {
+			w = strings.ToUpper(w[:1]) + w[1:]
+		}
+		words[i] = w
+	}
+	if style == jsonCamelCase {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words, "_")
+}
+
+// splitWords مرز کلمه‌ها را در PascalCase پیدا می‌کند؛ حروف بزرگ پشت سر هم (مخفف‌ها) یک کلمه‌اند
+// و رقم به کلمه‌ی قبلی می‌چسبد (Page2Size → Page2, Size)
+func splitWords(name string) []string {
+	r := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i < len(r); i++ {
+		upper := unicode.IsUpper(r[i])
+		switch {
+		case upper && !unicode.IsUpper(r[i-1]) && r[i-1] != '_':
+			// aB: شروع کلمه‌ی جدید
+		case upper && i+1 < len(r) && unicode.IsLower(r[i+1]):
+			// ABc: آخرین حرف بزرگ مخفف شروع کلمه‌ی بعدی است
+		case r[i] == '_':
+			if i > start {
+				words = append(words, string(r[start:i]))
+			}
+			start = i + 1
+			continue
+		default:
+			continue
+		}
+		if i > start {
+			words = append(words, string(r[start:i]))
+		}
+		start = i
+	}
+	if start < len(r) {
+		words = append(words, string(r[start:]))
+	}
+	return words
+}
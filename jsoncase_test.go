@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type caseInner struct {
+	InnerID int
+	Shared  string
+}
+
+type caseTagged struct {
+	Shared string `json:"shared"`
+}
+
+type caseUntagged struct {
+	Shared string
+}
+
+// struct خودارجاع که encoding/json آن را بی‌مشکل encode می‌کند
+type caseSelf struct {
+	*caseSelf
+	Value int
+}
+
+type caseCycleA struct {
+	*caseCycleB
+	A int
+}
+
+type caseCycleB struct {
+	*caseCycleA
+	B int
+}
+
+func TestCaseValue(t *testing.T) {
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		v     any
+		style jsonCase
+		want  string
+	}{
+		{"snake", struct {
+			OrderID   int
+			HTTPCode  int
+			Page2Size int
+		}{1, 2, 3}, jsonSnakeCase, `{"order_id":1,"http_code":2,"page2_size":3}`},
+		{"camel", struct {
+			OrderID  int
+			UserName string
+		}{1, "a"}, jsonCamelCase, `{"orderId":1,"userName":"a"}`},
+		{"tags", struct {
+			Note    string `json:"memo"`
+			Skipped string `json:"-"`
+			Dash    string `json:"-,"`
+			secret  string
+		}{"n", "s", "d", "x"}, jsonSnakeCase, `{"memo":"n","-":"d"}`},
+		{"omitempty", struct {
+			Empty  string         `json:",omitempty"`
+			Zero   int            `json:"zero,omitempty"`
+			Nil    *int           `json:",omitempty"`
+			None   map[string]int `json:",omitempty"`
+			Struct struct{}       `json:",omitempty"`
+			Kept   string         `json:",omitempty"`
+		}{Kept: "k"}, jsonSnakeCase, `{"struct":{},"kept":"k"}`},
+		{"embedded promoted", struct {
+			caseInner
+			OuterID int
+		}{caseInner{1, "s"}, 2}, jsonSnakeCase, `{"inner_id":1,"shared":"s","outer_id":2}`},
+		{"embedded nil pointer", struct {
+			*caseInner
+			OuterID int
+		}{nil, 2}, jsonSnakeCase, `{"outer_id":2}`},
+		{"embedded with tag name is nested", struct {
+			caseInner `json:"inner"`
+		}{caseInner{1, "s"}}, jsonSnakeCase, `{"inner":{"inner_id":1,"shared":"s"}}`},
+		{"shallower name wins", struct {
+			caseInner
+			Shared string
+		}{caseInner{1, "deep"}, "top"}, jsonSnakeCase, `{"inner_id":1,"shared":"top"}`},
+		{"same depth, tagged wins", struct {
+			caseTagged
+			caseUntagged
+		}{caseTagged{"tagged"}, caseUntagged{"untagged"}}, jsonSnakeCase, `{"shared":"tagged"}`},
+		{"same depth, both untagged dropped", struct {
+			caseInner
+			caseUntagged
+		}{caseInner{1, "a"}, caseUntagged{"b"}}, jsonSnakeCase, `{"inner_id":1}`},
+		{"self-referential embedded pointer", caseSelf{&caseSelf{nil, 1}, 2}, jsonSnakeCase, `{"value":2}`},
+		{"mutually recursive embedded pointers", caseCycleA{&caseCycleB{nil, 1}, 2}, jsonSnakeCase, `{"b":1,"a":2}`},
+		{"marshalers and maps untouched", struct {
+			CreatedAt time.Time
+			Labels    map[string]int
+			Raw       json.RawMessage
+		}{when, map[string]int{"KeyName": 1}, json.RawMessage(`{"X":1}`)}, jsonSnakeCase,
+			`{"created_at":"2024-01-02T03:04:05Z","labels":{"KeyName":1},"raw":{"X":1}}`},
+		{"nested slices and pointers", struct {
+			Items []*caseInner
+		}{[]*caseInner{{1, "a"}, nil}}, jsonCamelCase, `{"items":[{"innerId":1,"shared":"a"},null]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(caseValue(reflect.ValueOf(tt.v), tt.style))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// وقتی همه‌ی فیلدها تگ دارند، نتیجه باید دقیقاً همان encoding/json باشد
+func TestCaseValueMatchesEncodingJSON(t *testing.T) {
+	type inner struct {
+		A int    `json:"a"`
+		B string `json:"b,omitempty"`
+	}
+	type self struct {
+		*self
+		V int `json:"v"`
+	}
+	values := []any{
+		struct {
+			inner
+			C int `json:"c"`
+		}{inner{1, ""}, 2},
+		struct {
+			*inner
+			A int `json:"a"`
+		}{&inner{1, "x"}, 2},
+		self{&self{nil, 1}, 2},
+		struct {
+			inner `json:"in"`
+		}{inner{1, "x"}},
+	}
+	for _, v := range values {
+		want, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(caseValue(reflect.ValueOf(v), jsonSnakeCase))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%T:\n got  %s\nwant %s", v, got, want)
+		}
+	}
+}
+
+func TestWriteJSONCase(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeJSONCase(w, http.StatusCreated, struct{ OrderID int }{7}, jsonCamelCase)
+
+	if w.Code != http.StatusCreated || strings.TrimSpace(w.Body.String()) != `{"orderId":7}` {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json" // انواع خطای decoder
+	"errors"        // تشخیص نوع خطا
+	"fmt"           // ساختن پیام خطا
+	"io"            // خطاهای پایان body
+	"net/http"      // هسته HTTP در Go
+	"reflect"       // نام نوع مورد انتظار
+	"strings"       // تشخیص خطای فیلد ناشناخته
+)
+
+// ================= JSON Body Errors =================
+
+// bodyError خطای خواندن body با پیامی امن برای کلاینت؛
+// جزئیات داخلی decoder (مثل نام نوع‌های Go) در آن نیست
+type bodyError struct {
+	Status  int    `json:"-"`
+	Message string `json:"-"`
+	Field   string `json:"field,omitempty"`       // فیلد مشکل‌دار (اگر معلوم باشد)
+	Offset  int64  `json:"offset,omitempty"`      // محل خطا در body (بایت)
+	Limit   int64  `json:"limit_bytes,omitempty"` // سقف حجم body در پاسخ 413
+
+	cause error // علت داخلی خطای 5xx؛ با writeServerError لاگ و فقط در ERROR_DETAIL=full نمایش داده می‌شود
+}
+
+func (e *bodyError) Error() string { return e.Message }
+
+// newBodyError خطای decoder را به یک bodyError قابل نمایش برای کلاینت تبدیل می‌کند
+func newBodyError(err error) *bodyError {
+
+	var (
+		be          *bodyError
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+		tooLarge    *http.MaxBytesError
+		invalidDest *json.InvalidUnmarshalError
+	)
+
+	switch {
+	case errors.As(err, &be):
+		return be
+
+	case errors.As(err, &syntaxErr):
+		return &bodyError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset),
+			Offset:  syntaxErr.Offset,
+		}
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &bodyError{Status: http.StatusBadRequest, Message: "malformed JSON: unexpected end of body"}
+
+	case errors.Is(err, io.EOF):
+		return &bodyError{Status: http.StatusBadRequest, Message: "request body must not be empty"}
+
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return &bodyError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("body must be %s", jsonTypeName(typeErr.Type)),
+				Offset:  typeErr.Offset,
+			}
+		}
+		return &bodyError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("field %q must be %s", typeErr.Field, jsonTypeName(typeErr.Type)),
+			Field:   typeErr.Field,
+			Offset:  typeErr.Offset,
+		}
+
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json برای این خطا نوع جدا ندارد
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &bodyError{Status: http.StatusBadRequest, Message: fmt.Sprintf("unknown field %q", field), Field: field}
+
+	case errors.As(err, &tooLarge):
+		return newBodyTooLarge(tooLarge.Limit)
+
+	case errors.Is(err, errBodyTooSlow):
+		return &bodyError{Status: http.StatusRequestTimeout, Message: errBodyTooSlow.Error()}
+
+	case errors.As(err, &invalidDest):
+		// dst اشتباه یعنی خطای برنامه‌نویسی، نه خطای کلاینت
+		return &bodyError{Status: http.StatusInternalServerError, Message: "Internal Server Error", cause: fmt.Errorf("readJSON: %w", err)}
+	}
+
+	return &bodyError{Status: http.StatusBadRequest, Message: "invalid request body"}
+}
+
+// newBodyTooLarge خطای 413 یکسان برای هر body بزرگ‌تر از سقف؛ چه از *http.MaxBytesError
+// آمده باشد (readJSON، تکه‌های آپلود) و چه handler حجم را خودش بررسی کرده باشد
+func newBodyTooLarge(limit int64) *bodyError {
+	return &bodyError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Message: fmt.Sprintf("request body must not exceed %d bytes", limit),
+		Limit:   limit,
+	}
+}
+
+// writeBodyError خطای readJSON را با status و جزئیات مناسب ارسال می‌کند
+func writeBodyError(w http.ResponseWriter, err error) {
+	be := newBodyError(err)
+	if be.cause != nil {
+		writeServerError(w, be.Status, be.cause)
+		return
+	}
+	if be.Field == "" && be.Offset == 0 && be.Limit == 0 {
+		writeError(w, be.Status, be.Message)
+		return
+	}
+	writeErrorDetails(w, be.Status, be.Message, be)
+}
+
+// jsonTypeName نوع Go را به نام نوع JSON (برای پیام کلاینت) تبدیل می‌کند
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Pointer:
+		return jsonTypeName(t.Elem())
+	}
+	return "a valid value"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json" // نوع json.Number و گزینه‌ی decoder
+	"fmt"           // پیام خطای تبدیل
+	"math"          // تشخیص float بدون بخش اعشاری
+)
+
+// ================= JSON Numbers =================
+//
+// decoder پیش‌فرض هر عدد داخل any (یا map[string]any) را float64 می‌کند و شناسه‌ای مثل
+// 9007199254740993 بی‌صدا به ...992 تبدیل می‌شود. با jsonUseNumber همین مقدارها json.Number
+// (متن خام عدد) هستند و handler با jsonInt64 یا jsonFloat64 نوع مورد نیازش را می‌گیرد.
+// فیلدهای با نوع مشخص (int64، float64، ...) در هر دو حالت مستقیم و بدون افت دقت پر می‌شوند.
+
+// jsonOption رفتار decoder در readJSON را تغییر می‌دهد
+type jsonOption func(*json.Decoder)
+
+// jsonUseNumber عددهای داخل any را json.Number نگه می‌دارد (پیش‌فرض /api/echo)
+var jsonUseNumber jsonOption = func(dec *json.Decoder) { dec.UseNumber() }
+
+// jsonInt64 مقدار عددی دیکدشده را به int64 تبدیل می‌کند؛ عدد اعشاری یا خارج از بازه خطاست.
+// هم json.Number (با jsonUseNumber) و هم float64 (بدون آن) را می‌پذیرد.
+func jsonInt64(v any) (int64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("%s is not a 64-bit integer", n)
+		}
+		return i, nil
+
+	case float64:
+		if n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 {
+			return 0, fmt.Errorf("%v is not a 64-bit integer", n)
+		}
+		return int64(n), nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
+
+// jsonFloat64 مقدار عددی دیکدشده را به float64 تبدیل می‌کند
+func jsonFloat64(v any) (float64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("%s is not a valid number", n)
+		}
+		return f, nil
+
+	case float64:
+		return n, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
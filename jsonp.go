@@ -0,0 +1,103 @@
+package main
+
+import (
+	"mime"     // تشخیص پاسخ JSON
+	"net/http" // هسته HTTP در Go
+	"regexp"   // اعتبارسنجی نام callback
+	"strconv"  // اصلاح Content-Length
+)
+
+// ================= JSONP =================
+
+// نام callback فقط یک identifier جاوااسکریپت (یا مسیر نقطه‌دار مثل app.cb) است؛
+// هر چیز دیگری می‌تواند اسکریپت دلخواه به پاسخ تزریق کند
+var jsonpCallbackRe = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+// حداکثر طول نام callback
+const jsonpMaxCallback = 64
+
+// jsonpMiddleware برای handlerهایی که صراحتاً اجازه می‌دهند، پاسخ JSON را وقتی پارامتر
+// callback در query باشد به شکل callback(...) با Content-Type جاوااسکریپت برمی‌گرداند.
+// نام نامعتبر با 400 رد می‌شود. بدون پارامتر callback پاسخ دست نمی‌خورد.
+func jsonpMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		callback := r.URL.Query().Get("callback")
+		if callback == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(callback) > jsonpMaxCallback || !jsonpCallbackRe.MatchString(callback) {
+			writeError(w, http.StatusBadRequest, "invalid JSONP callback name")
+			return
+		}
+
+		// کامنت خالی اول پاسخ جلوی حمله‌هایی مثل Rosetta Flash را می‌گیرد
+		jw := &jsonpWriter{ResponseWriter: w, prefix: "/**/" + callback + "("}
+		next.ServeHTTP(jw, r)
+		jw.finish()
+	})
+}
+
+// jsonpWriter پاسخ JSON را بین prefix و ");" قرار می‌دهد؛ پاسخ‌های غیر JSON را دست نمی‌زند
+type jsonpWriter struct {
+	http.ResponseWriter
+	prefix      string
+	wrapping    bool // پاسخ JSON است و در حال wrap شدن است
+	wroteHeader bool
+}
+
+const jsonpSuffix = ");"
+
+func (jw *jsonpWriter) WriteHeader(status int) {
+	if jw.wroteHeader {
+		jw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	jw.wroteHeader = true
+
+	h := jw.Header()
+	if mt, _, _ := mime.ParseMediaType(h.Get("Content-Type")); mt == "application/json" {
+		jw.wrapping = true
+		h.Set("Content-Type", "application/javascript; charset=utf-8")
+		h.Set("X-Content-Type-Options", "nosniff")
+
+		// اگر حجم JSON معلوم است، حجم پاسخ wrapشده هم معلوم است
+		if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil {
+			h.Set("Content-Length", strconv.Itoa(n+len(jw.prefix)+len(jsonpSuffix)))
+		}
+	}
+
+	jw.ResponseWriter.WriteHeader(status)
+	if jw.wrapping {
+		_, _ = jw.ResponseWriter.Write([]byte(jw.prefix))
+	}
+}
+
+func (jw *jsonpWriter) Write(p []byte) (int, error) {
+	if !jw.wroteHeader {
+		jw.WriteHeader(http.StatusOK)
+	}
+	return jw.ResponseWriter.Write(p)
+}
+
+// finish پرانتز callback را می‌بندد
+func (jw *jsonpWriter) finish() {
+	if jw.wrapping {
+		_, _ = jw.ResponseWriter.Write([]byte(jsonpSuffix))
+	}
+}
+
+// Flush قبل از اولین Write هدرها را می‌فرستد؛ پس تصمیم wrap و prefix قبلش نوشته می‌شوند
+func (jw *jsonpWriter) Flush() {
+	if !jw.wroteHeader {
+		jw.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(jw.ResponseWriter).Flush()
+}
+
+// Unwrap به http.ResponseController اجازه می‌دهد به writer اصلی برسد
+func (jw *jsonpWriter) Unwrap() http.ResponseWriter {
+	return jw.ResponseWriter
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net"  // اتصال‌های TCP
+	"time" // دوره‌ی keep-alive
+)
+
+// ================= TCP Keep-Alive =================
+
+// keepAliveListener روی هر اتصال پذیرفته‌شده keep-alive سطح TCP سیستم‌عامل را با دوره‌ی period روشن می‌کند.
+// این ربطی به keep-alive در HTTP (IdleTimeout) ندارد: kernel بعد از period بی‌کاری probe می‌فرستد و
+// اتصال نیمه‌باز (مثلاً load balancer یا NATی که state را بی‌صدا دور ریخته) بعد از چند probe بی‌جواب بسته می‌شود.
+type keepAliveListener struct {
+	net.Listener
+	period time.Duration
+}
+
+// newKeepAliveListener ln را با دوره‌ی period می‌پوشاند؛ صفر یعنی همان پیش‌فرض Go (15 ثانیه) و ln بدون تغییر
+func newKeepAliveListener(ln net.Listener, period time.Duration) net.Listener {
+	if period == 0 {
+		return ln
+	}
+	return &keepAliveListener{Listener: ln, period: period}
+}
+
+func (l *keepAliveListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	// خطای تنظیم socket اتصال را خراب نمی‌کند؛ فقط همان پیش‌فرض قبلی می‌ماند
+	if tc, ok := c.(*net.TCPConn); ok {
+		_ = tc.SetKeepAlive(true)
+		_ = tc.SetKeepAlivePeriod(l.period)
+	}
+	return c, nil
+}
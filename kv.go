@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"       // توقف پاک‌سازی
+	"encoding/json" // نگه داشتن مقدار به شکل JSON خام
+	"fmt"           // پیام خطای حجم و تعداد
+	"net/http"      // هسته HTTP در Go
+	"strings"       // جدا کردن کلید از مسیر
+	"sync"          // دسترسی همزمان امن به map
+	"time"          // TTL کلیدها
+)
+
+// ================= Key/Value Store =================
+
+// حداکثر طول کلید
+const kvMaxKeyLen = 256
+
+// kvItem یک مقدار و زمان انقضای آن (صفر یعنی بدون انقضا)
+type kvItem struct {
+	value    json.RawMessage // همان JSON ارسالی؛ عددها و ترتیب فیلدها دست نمی‌خورند
+	expires  time.Time
+	modified time.Time // زمان آخرین PUT؛ برای Last-Modified
+}
+
+// kvStore یک ذخیره‌ساز ساده‌ی درون حافظه برای نمونه‌سازی و تست کلاینت‌ها:
+//
+//	GET    /api/kv/{key} → مقدار (با ETag و Last-Modified؛ If-None-Match و If-Modified-Since جواب 304 می‌گیرند)
+//	PUT    /api/kv/{key} با body {"value": ..., "ttl": "30s"} → ساخت یا جایگزینی (نیاز به auth)
+//	DELETE /api/kv/{key} → حذف (نیاز به auth)
+//
+// PUT و DELETE با If-Match (فقط اگر مقدار همان نسخه‌ی دیده‌شده باشد) و If-None-Match: * (فقط اگر کلید
+// وجود نداشته باشد) شرطی می‌شوند؛ ناموفق 412 است. preconditionMiddleware قبل از خواندن body رد می‌کند
+// و خود store دوباره زیر قفل بررسی می‌کند تا دو نویسنده‌ی همزمان با یک ETag هر دو موفق نشوند.
+//
+// داده‌ها با restart از بین می‌روند و با prefork بین پروسه‌ها مشترک نیستند.
+type kvStore struct {
+	maxKeys       int
+	maxValueBytes int
+
+	mu    sync.RWMutex
+	items map[string]kvItem
+}
+
+// newKVStore یک store خالی می‌سازد و کلیدهای منقضی را تا لغو ctx هر دقیقه پاک می‌کند
+func newKVStore(ctx context.Context, maxKeys, maxValueBytes int) *kvStore {
+	s := &kvStore{maxKeys: maxKeys, maxValueBytes: maxValueBytes, items: make(map[string]kvItem)}
+	runEvery(ctx, time.Minute, s.cleanup)
+	return s
+}
+
+// cleanup کلیدهای منقضی را حذف می‌کند
+func (s *kvStore) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purgeExpired(time.Now())
+}
+
+// purgeExpired باید زیر قفل نوشتن صدا زده شود
+func (s *kvStore) purgeExpired(now time.Time) {
+	for k, it := range s.items {
+		if it.expired(now) {
+			delete(s.items, k)
+		}
+	}
+}
+
+func (it kvItem) expired(now time.Time) bool {
+	return !it.expires.IsZero() && !now.Before(it.expires)
+}
+
+// etag ETag قوی مقدار؛ همان مقدار با TTL دیگر همان نسخه است
+func (it kvItem) etag() string {
+	return strongETag(it.value)
+}
+
+// current ETag فعلی کلید برای preconditionMiddleware و بررسی دوباره زیر قفل؛ باید زیر قفل خواندن یا نوشتن
+// صدا زده شود. کلید منقضی وجود ندارد.
+func (s *kvStore) current(key string) (string, bool) {
+	it, ok := s.items[key]
+	if !ok || it.expired(time.Now()) {
+		return "", false
+	}
+	return it.etag(), true
+}
+
+// etag همان current با قفل، به شکل ETagFunc
+func (s *kvStore) etag(r *http.Request) (string, bool) {
+	key := kvKey(r)
+	if key == "" {
+		return "", false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current(key)
+}
+
+// kvKey کلید را از مسیر جدا و بررسی می‌کند؛ "" یعنی کلید نامعتبر
+func kvKey(r *http.Request) string {
+	key := strings.TrimPrefix(r.URL.Path, "/api/kv/")
+	if key == "" || len(key) > kvMaxKeyLen || strings.Contains(key, "/") {
+		return ""
+	}
+	return key
+}
+
+// پاسخ GET و PUT
+type kvResponse struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+}
+
+func (s *kvStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	key := kvKey(r)
+	if key == "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("key must be 1-%d characters without /", kvMaxKeyLen))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		w.Header().Set("Cache-Control", "no-store")
+		s.put(w, r, key)
+	case http.MethodDelete:
+		w.Header().Set("Cache-Control", "no-store")
+		s.delete(w, r, key)
+	default:
+		w.Header().Set("Cache-Control", "no-cache") // مقدار ممکن است هر لحظه عوض شود؛ هر بار با Last-Modified بررسی شود
+		s.get(w, r, key)
+	}
+}
+
+// get → GET /api/kv/{key}
+func (s *kvStore) get(w http.ResponseWriter, r *http.Request, key string) {
+	s.mu.RLock()
+	it, ok := s.items[key]
+	s.mu.RUnlock()
+
+	// کلید منقضی تا پاک‌سازی بعدی در map می‌ماند ولی دیده نمی‌شود
+	if !ok || it.expired(time.Now()) {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	etag := it.etag()
+	if !checkPreconditions(w, r, etag, true) {
+		return
+	}
+	setETag(w, etag)
+	writeJSONModified(w, r, http.StatusOK, it.response(key), it.modified)
+}
+
+// put → PUT /api/kv/{key}
+func (s *kvStore) put(w http.ResponseWriter, r *http.Request, key string) {
+
+	var req struct {
+		Value json.RawMessage `json:"value"` // هر مقدار JSON
+		TTL   string          `json:"ttl"`   // مثل 30s؛ خالی یعنی بدون انقضا
+	}
+	if err := readJSON(w, r, &req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if len(req.Value) == 0 {
+		writeError(w, http.StatusBadRequest, "value is required")
+		return
+	}
+	if len(req.Value) > s.maxValueBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("value exceeds %d bytes", s.maxValueBytes))
+		return
+	}
+
+	it := kvItem{value: req.Value, modified: time.Now()}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, "ttl must be a positive duration like 30s or 5m")
+			return
+		}
+		it.expires = time.Now().Add(ttl)
+	}
+
+	s.mu.Lock()
+	current, exists := s.current(key)
+	if status := preconditionStatus(r, current, exists); status != 0 {
+		s.mu.Unlock()
+		writePrecondition(w, status, current)
+		return
+	}
+	if !exists && len(s.items) >= s.maxKeys {
+		s.purgeExpired(time.Now()) // شاید جای کلیدهای منقضی آزاد شود
+		if len(s.items) >= s.maxKeys {
+			s.mu.Unlock()
+			writeError(w, http.StatusInsufficientStorage, fmt.Sprintf("store is full (%d keys)", s.maxKeys))
+			return
+		}
+	}
+	s.items[key] = it
+	s.mu.Unlock()
+
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+	}
+	setETag(w, it.etag()) // کلاینت می‌تواند PUT بعدی را با همین If-Match بفرستد
+	writeJSON(w, status, kvItem{expires: it.expires}.response(key))
+}
+
+// delete → DELETE /api/kv/{key}
+func (s *kvStore) delete(w http.ResponseWriter, r *http.Request, key string) {
+	s.mu.Lock()
+	current, exists := s.current(key)
+	if status := preconditionStatus(r, current, exists); status != 0 {
+		s.mu.Unlock()
+		writePrecondition(w, status, current)
+		return
+	}
+	delete(s.items, key)
+	s.mu.Unlock()
+
+	if !exists {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// response شکل JSON یک کلید
+func (it kvItem) response(key string) kvResponse {
+	resp := kvResponse{Key: key, Value: it.value}
+	if !it.expires.IsZero() {
+		exp := it.expires.UTC()
+		resp.ExpiresAt = &exp
+	}
+	return resp
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"      // تشخیص نوع خطای bind
+	"log/slog"    // لاگ ساخت‌یافته‌ی چرخه‌ی عمر
+	"net"         // اتصال‌های کلاینت
+	"net/http"    // وضعیت اتصال‌ها
+	"net/netip"   // آدرس listener برای لاگ
+	"net/url"     // حذف رمز از آدرس upstream
+	"os"          // خطای دسترسی
+	"slices"      // مرتب کردن درخواست‌های باقی‌مانده
+	"strconv"     // پورت listener
+	"sync"        // ثبت همزمان درخواست‌های فعال
+	"sync/atomic" // شمارنده‌ی بدون قفل
+	"syscall"     // EADDRINUSE
+	"time"        // سن درخواست‌های فعال
+)
+
+// ================= Lifecycle =================
+
+// کد خروج وقتی پورت قابل bind نیست؛ والد prefork فرزندی را که با این کد خارج شود دوباره اجرا نمی‌کند
+const exitBindError = 2
+
+// exitError خطایی که کد خروج مخصوص خودش را دارد (مثل exitBindError)
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// exitCode کد خروج پروسه برای خطای run: 0 یعنی خاموش شدن تمیز، بقیه‌ی خطاها 1
+func exitCode(err error) int {
+	var ee *exitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &ee):
+		return ee.code
+	}
+	return 1
+}
+
+// bindErrorHint برای خطاهای رایج bind راهنمای قابل اجرا برمی‌گرداند ("" یعنی خطای ناشناخته)
+func bindErrorHint(err error, port string) string {
+	switch {
+	case errors.Is(err, syscall.EADDRINUSE):
+		return "port " + port + " is already in use; stop the other process or set PORT to a free port"
+	case errors.Is(err, os.ErrPermission):
+		return "no permission to bind port " + port + "; ports below 1024 need root or CAP_NET_BIND_SERVICE, or set PORT to 1024 or above"
+	}
+	return ""
+}
+
+// serverURL آدرس قابل استفاده‌ی سرور برای لاگ؛ گوش دادن روی همه‌ی interfaceها (0.0.0.0 یا ::) با localhost نشان داده می‌شود
+func serverURL(addr net.Addr, https bool) string {
+	scheme := "http://"
+	if https {
+		scheme = "https://"
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return scheme + addr.String()
+	}
+	host := ap.Addr().Unmap().String()
+	if ap.Addr().IsUnspecified() {
+		host = "localhost"
+	}
+	return scheme + net.JoinHostPort(host, strconv.Itoa(int(ap.Port())))
+}
+
+// connTracker تعداد اتصال‌های باز را نگه می‌دارد تا هنگام خاموش شدن
+// معلوم باشد چند اتصال هنوز در حال تخلیه هستند
+type connTracker struct {
+	open atomic.Int64
+}
+
+// track به‌عنوان http.Server.ConnState استفاده می‌شود
+func (t *connTracker) track(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		t.open.Add(1)
+	case http.StateClosed, http.StateHijacked:
+		t.open.Add(-1)
+	}
+}
+
+// count تعداد اتصال‌های باز فعلی
+func (t *connTracker) count() int64 {
+	return t.open.Load()
+}
+
+// ================= Active Requests =================
+
+// حداکثر درخواست‌هایی که در پایان مهلت خاموش‌سازی تک‌تک لاگ می‌شوند
+const shutdownReportMax = 20
+
+// activeRequest یک درخواست در حال رسیدگی
+type activeRequest struct {
+	id     string
+	method string
+	path   string
+	start  time.Time
+}
+
+// درخواست‌های در حال رسیدگی؛ loggingMiddleware ثبت و حذفشان می‌کند.
+// کلید اشاره‌گر خود entry است تا ثبت همزمان درخواست‌ها قفل مشترک نداشته باشد.
+var activeRequests sync.Map // *activeRequest → struct{}
+
+// trackRequest درخواست را ثبت می‌کند؛ تابع برگشتی باید در پایان درخواست صدا زده شود
+func trackRequest(r *http.Request, start time.Time) func() {
+	e := &activeRequest{id: requestIDFromContext(r.Context()), method: r.Method, path: r.URL.Path, start: start}
+	activeRequests.Store(e, struct{}{})
+	return func() { activeRequests.Delete(e) }
+}
+
+// logActiveRequests درخواست‌هایی را که هنوز تمام نشده‌اند (قدیمی‌ترین اول) لاگ می‌کند؛
+// بعد از shutdownReportMax فقط تعداد بقیه گفته می‌شود
+func logActiveRequests() {
+	var active []*activeRequest
+	activeRequests.Range(func(k, _ any) bool {
+		active = append(active, k.(*activeRequest))
+		return true
+	})
+	slices.SortFunc(active, func(a, b *activeRequest) int { return a.start.Compare(b.start) })
+
+	now := time.Now()
+	for i, e := range active {
+		if i == shutdownReportMax {
+			slog.Warn("more requests still running", "count", len(active)-shutdownReportMax)
+			break
+		}
+		slog.Warn("request still running",
+			"request_id", e.id,
+			"method", e.method,
+			"path", e.path,
+			"age", now.Sub(e.start).Round(time.Millisecond).String(),
+		)
+	}
+}
+
+// redactedConfig همان Config است بدون متد LogValue؛ برای جلوگیری از بازگشت بی‌پایان
+type redactedConfig Config
+
+// LogValue باعث می‌شود Config در لاگ با مقدارهای مؤثر ولی بدون رمزها نمایش داده شود
+func (c Config) LogValue() slog.Value {
+	return slog.AnyValue(c.redacted())
+}
+
+// redacted کپی Config بدون رمزها؛ برای لاگ شروع برنامه و /api/env
+func (c Config) redacted() redactedConfig {
+	if c.AdminPassword != "" {
+		c.AdminPassword = "[REDACTED]"
+	}
+	if c.AccessToken != "" {
+		c.AccessToken = "[REDACTED]"
+	}
+	if c.InternalToken != "" {
+		c.InternalToken = "[REDACTED]"
+	}
+
+	// آدرس upstream ممکن است user:password داشته باشد
+	c.Upstreams = redactUpstreams(c.Upstreams)
+	c.CanaryUpstreams = redactUpstreams(c.CanaryUpstreams)
+
+	routes := make(map[string]string, len(c.ProxyRoutes))
+	for prefix, spec := range c.ProxyRoutes {
+		routes[prefix] = redactProxyRoute(spec)
+	}
+	c.ProxyRoutes = routes
+
+	return redactedConfig(c)
+}
+
+// redactUpstreams رمز آدرس‌های upstream را با xxxxx عوض می‌کند
+func redactUpstreams(specs []string) []string {
+	out := make([]string, len(specs))
+	for i, spec := range specs {
+		out[i] = spec
+		if u, err := url.Parse(spec); err == nil {
+			out[i] = u.Redacted()
+		}
+	}
+	return out
+}
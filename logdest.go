@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"  // نام متغیر env در خطای باز کردن فایل
+	"io"   // مقصد نوشتن لاگ
+	"os"   // stdout، stderr و فایل‌ها
+	"sync" // سریال کردن نوشتن‌ها در هر مقصد
+)
+
+// ================= Log Destinations =================
+
+// logDest یک مقصد لاگ (stdout، stderr یا فایل) است که هر Write آن زیر قفل انجام می‌شود.
+// لاگر برنامه و access log هر کدام handler و قفل خودشان را دارند؛ اگر هر دو به یک مقصد بنویسند،
+// همین قفل مشترک جلوی درهم رفتن خط‌هایشان را می‌گیرد.
+type logDest struct {
+	mu  sync.Mutex
+	out *os.File
+}
+
+func (d *logDest) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.out.Write(p)
+}
+
+// openLogDests مقصدهای ERROR_LOG_DEST و ACCESS_LOG_DEST را باز می‌کند؛ مقصدهای یکسان یک logDest
+// مشترک می‌گیرند. فایل‌ها فقط append می‌شوند و تا پایان پروسه باز می‌مانند تا آخرین خط‌های
+// خاموش‌سازی هم نوشته شوند.
+func openLogDests(errorDest, accessDest string) (errorOut, accessOut io.Writer, err error) {
+	opened := make(map[string]*logDest)
+	open := func(dest string) (*logDest, error) {
+		if d, ok := opened[dest]; ok {
+			return d, nil
+		}
+		var f *os.File
+		switch dest {
+		case "stdout":
+			f = os.Stdout
+		case "stderr":
+			f = os.Stderr
+		default:
+			var err error
+			if f, err = os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644); err != nil {
+				return nil, err
+			}
+		}
+		d := &logDest{out: f}
+		opened[dest] = d
+		return d, nil
+	}
+
+	e, err := open(errorDest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ERROR_LOG_DEST: %w", err)
+	}
+	a, err := open(accessDest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ACCESS_LOG_DEST: %w", err)
+	}
+	return e, a, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"  // نگه‌داری فیلدها در context درخواست
+	"log/slog" // لاگر با فیلدهای درخواست
+	"sync"     // افزودن فیلد از handler و goroutineهای آن
+)
+
+// ================= Request Log Fields =================
+//
+// middlewareها به‌جای چسباندن مقدارها به متن پیام، فیلدهای key/value را به درخواست اضافه می‌کنند:
+//
+//	addLogFields(r.Context(), "user", name)
+//	requestLogger(r.Context()).Warn("quota exceeded", "limit", max)
+//
+// هر لاگی که از requestLogger بیاید و خط access log همه‌ی فیلدهای جمع‌شده را دارند (در text و json).
+// نگه‌دارنده را requestIDMiddleware در ابتدای زنجیره می‌گذارد و بقیه آن را پر می‌کنند؛ چون context
+// جدید middlewareهای داخلی به بیرونی‌ها نمی‌رسد، فیلدها در خود نگه‌دارنده نوشته می‌شوند.
+
+// کلید context برای فیلدهای لاگ درخواست
+type logFieldsKey struct{}
+
+// logFields فیلدهای جمع‌شده‌ی یک درخواست به ترتیب اضافه شدن
+type logFields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// withLogFields یک نگه‌دارنده با فیلدهای اولیه در context می‌گذارد
+func withLogFields(ctx context.Context, args ...any) context.Context {
+	f := &logFields{}
+	f.add(args)
+	return context.WithValue(ctx, logFieldsKey{}, f)
+}
+
+// addLogFields فیلدها را (مثل آرگومان‌های slog: key, value, ... یا slog.Attr) به درخواست اضافه می‌کند؛
+// کلید تکراری مقدار قبلی را عوض می‌کند. بدون نگه‌دارنده (مثلاً خارج از درخواست) کاری نمی‌کند.
+func addLogFields(ctx context.Context, args ...any) {
+	if f, ok := ctx.Value(logFieldsKey{}).(*logFields); ok {
+		f.add(args)
+	}
+}
+
+func (f *logFields) add(args []any) {
+	// Group با نام خالی همان تبدیل آرگومان‌ها به Attr را انجام می‌دهد که slog.Logger.With
+	attrs := slog.Group("", args...).Value.Group()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+next:
+	for _, a := range attrs {
+		for i := range f.attrs {
+			if f.attrs[i].Key == a.Key {
+				f.attrs[i] = a
+				continue next
+			}
+		}
+		f.attrs = append(f.attrs, a)
+	}
+}
+
+// logFieldsFrom فیلدهای جمع‌شده تا این لحظه را به شکل آرگومان slog برمی‌گرداند
+func logFieldsFrom(ctx context.Context) []any {
+	f, ok := ctx.Value(logFieldsKey{}).(*logFields)
+	if !ok {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	args := make([]any, len(f.attrs))
+	for i, a := range f.attrs {
+		args[i] = a
+	}
+	return args
+}
+
+// requestLogger لاگر پیش‌فرض با فیلدهای جمع‌شده‌ی درخواست تا این لحظه
+func requestLogger(ctx context.Context) *slog.Logger {
+	return slog.Default().With(logFieldsFrom(ctx)...)
+}
@@ -2,12 +2,28 @@ package main // پکیج اصلی؛ برنامه از اینجا اجرا می
 
 import (
 	"context"       // برای مدیریت timeout و خاموش‌سازی امن (graceful shutdown)
+	"crypto/tls"    // HTTPS مستقیم
 	"encoding/json" // برای تبدیل داده‌ها به JSON
+	"encoding/xml"  // نام ریشه‌ی پاسخ XML
 	"errors"        // برای بررسی نوع خطاها (errors.Is)
+	"expvar"        // metricهای داخلی برای /admin/vars و /debug/vars
+	"flag"          // تشخیص -h
+	"fmt"           // ساختن صفحه‌ی خطای HTML
+	"html"          // escape کردن مقدارها در صفحه‌ی HTML
+	"io"            // برای تشخیص پایان body (io.EOF)
 	"log"           // برای لاگ گرفتن
+	"log/slog"      // لاگ ساخت‌یافته‌ی چرخه‌ی عمر سرور
+	"maps"          // ترتیب ثابت routeهای پروکسی
+	"math"          // گرد کردن Retry-After
+	"net"           // ساختن listener قبل از شروع سرور
 	"net/http"      // هسته HTTP در Go
+	"net/netip"     // رنج‌های پروکسی مورد اعتماد
 	"os"            // خواندن متغیرهای محیطی مثل PORT
 	"os/signal"     // دریافت سیگنال‌های سیستم
+	"runtime/debug" // stack trace هنگام panic
+	"slices"        // مسیرهای بدون access log
+	"strconv"       // هدرهای Content-Length و Retry-After
+	"strings"       // حذف prefix مسیر proxy
 	"syscall"       // سیگنال‌های SIGINT و SIGTERM
 	"time"          // زمان و timeout
 )
@@ -28,167 +44,705 @@ func chain(h http.Handler, mws ...Middleware) http.Handler {
 
 // ================= Logging Middleware =================
 
+// مسیرهایی که loggingMiddleware برایشان خط لاگ نمی‌نویسد (ACCESS_LOG_SKIP)؛
+// فقط یک بار در شروع برنامه تنظیم می‌شود
+var accessLogSkip []string
+
 // این middleware هر درخواست را لاگ می‌کند
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		start := time.Now() // زمان شروع رسیدگی به درخواست
 
-		next.ServeHTTP(w, r) // ادامه‌ی مسیر به handler بعدی
+		// router نام route تطبیق‌یافته و basicAuth نام کاربر را اینجا می‌نویسند
+		r, route := withRouteHolder(r)
+		r, user := withUserHolder(r)
 
-		// لاگ نهایی بعد از پاسخ
-		log.Printf(
-			"%s %s %s (%s)",
-			r.RemoteAddr,      // IP کلاینت
-			r.Method,          // متد HTTP
-			r.URL.Path,        // مسیر درخواست
-			time.Since(start), // مدت زمان پاسخ
-		)
+		rec := newStatusRecorder(w)
+		rec.ctx = r.Context() // helperهایی مثل writeJSON که فقط w را دارند با responseContext به آن می‌رسند
+
+		requestsInFlight.Add(1)
+		untrack := trackRequest(r, start) // برای گزارش درخواست‌های مانده در خاموش‌سازی
+		defer func() {
+			requestsInFlight.Add(-1)
+			untrack()
+
+			// ReverseProxy وقتی نوشتن برای کلاینت شکست بخورد با ErrAbortHandler اتصال را قطع می‌کند
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					clientDisconnects.Add(1)
+				} else {
+					// recoveryMiddleware بیرونی پاسخ 500 را می‌فرستد؛ خط لاگ همین حالا با همان شناسه نوشته می‌شود
+					logRequest(r, rec, start, http.StatusInternalServerError, *route, *user)
+				}
+				panic(p)
+			}
+		}()
+
+		next.ServeHTTP(rec, r) // ادامه‌ی مسیر به handler بعدی
+
+		// کلاینتی که وسط پاسخ رفته (broken pipe، connection reset) خطای سرور نیست؛
+		// مثل nginx با 499 ثبت می‌شود و در request_errors نمی‌آید
+		status := rec.status
+		if rec.clientGone || isClientGone(r.Context()) {
+			status = statusClientClosed
+			clientDisconnects.Add(1)
+			requestLogger(r.Context()).Debug("client disconnected during response", "clientAddr", logClientAddr(r), "method", r.Method, "path", r.URL.Path, "err", rec.writeErr)
+		}
+		logRequest(r, rec, start, status, *route, *user)
 	})
 }
 
+// logRequest پایان درخواست را در شمارنده‌ها، آمار route و access log ثبت می‌کند
+func logRequest(r *http.Request, rec *statusRecorder, start time.Time, status int, route, user string) {
+
+	id := requestIDFromContext(r.Context())
+	countRequest(route, status, id) // شمارنده‌های /debug/vars
+
+	elapsed := time.Since(start)
+	stats.observe(route, elapsed) // آمار مدت پاسخ برای /admin/stats
+
+	// آمار بالا همچنان ثبت می‌شود؛ فقط خط لاگ حذف می‌شود
+	if slices.Contains(accessLogSkip, r.URL.Path) {
+		return
+	}
+
+	// LOG_FORMAT=combined: خط خام Apache برای ابزارهای تحلیل لاگ
+	if combinedLog != nil {
+		size := rec.bytes
+		if r.Method == http.MethodHead {
+			size = 0 // body پاسخ HEAD هرگز ارسال نمی‌شود
+		}
+		combinedLog.Print(formatCombined(r, anonymizeIP(clientIP(r)).String(), user, start, status, size))
+		return
+	}
+
+	// لاگ نهایی بعد از پاسخ؛ request_id، country، user، variant و بقیه‌ی فیلدهایی که middlewareها
+	// با addLogFields جمع کرده‌اند به شکل key/value بعد از پیام می‌آیند
+	accessLogger.Info(fmt.Sprintf(
+		"%s %s %s (%s)",
+		logClientAddr(r), // IP:port واقعی کلاینت (در صورت نیاز ناشناس‌شده)
+		r.Method,         // متد HTTP
+		r.URL.Path,       // مسیر درخواست
+		elapsed,          // مدت زمان پاسخ
+	), logFieldsFrom(r.Context())...)
+}
+
+// ================= Status Recorder =================
+
+// statusRecorder یک wrapper روی ResponseWriter است که status و حجم پاسخ را ثبت می‌کند
+type statusRecorder struct {
+	http.ResponseWriter
+	status    int   // status code ارسال‌شده (پیش‌فرض 200)
+	bytes     int64 // تعداد بایت‌های body
+	limit     int64 // سقف حجم body؛ 0 یعنی بدون سقف
+	truncated bool  // پاسخ به سقف رسیده و بقیه‌اش دور ریخته شده
+
+	clientGone bool  // نوشتن به خاطر رفتن کلاینت شکست خورده (EPIPE یا ECONNRESET)
+	writeErr   error // همان خطای نوشتن، برای لاگ debug
+
+	ctx context.Context // context درخواست برای responseContext؛ فقط recorder در loggingMiddleware آن را دارد
+}
+
+// newStatusRecorder یک recorder روی w می‌سازد
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(p []byte) (int, error) {
+
+	// بعد از رسیدن به سقف، نوشتن‌ها دور ریخته می‌شوند و handler خطا می‌گیرد تا متوقف شود
+	if rec.limit > 0 && rec.bytes+int64(len(p)) > rec.limit {
+		allowed := rec.limit - rec.bytes
+		n, _ := rec.ResponseWriter.Write(p[:allowed])
+		rec.bytes += int64(n)
+		rec.truncated = true
+		return n, errResponseTooLarge
+	}
+
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytes += int64(n)
+	if err != nil && isClientDisconnect(err) {
+		rec.clientGone, rec.writeErr = true, err
+	}
+	return n, err
+}
+
+// Flush برای پاسخ‌های streaming به writer اصلی پاس داده می‌شود
+// (با ResponseController تا از wrapperهای بدون متد Flush مثل headWriter هم رد شود)
+func (rec *statusRecorder) Flush() {
+	_ = http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Unwrap به http.ResponseController اجازه می‌دهد به writer اصلی برسد
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
 // ================= Recovery Middleware =================
 
-// این middleware مانع از کرش سرور در صورت panic می‌شود
+// صفحه‌ی خطای 500 برای مسیرهای HTML؛ فقط شناسه‌ی درخواست در آن قرار می‌گیرد
+const internalErrorPage = `<!doctype html>
+<html><head><meta charset="utf-8"><title>500 Internal Server Error</title></head>
+<body><h1>Internal Server Error</h1><p>Request ID: %s</p></body></html>
+`
+
+// اگر false باشد panic بعد از لاگ شدن پروسه را متوقف می‌کند (RECOVER_PANICS)؛
+// فقط یک بار در شروع برنامه تنظیم می‌شود
+var recoverPanics = true
+
+// این middleware مانع از کرش سرور در صورت panic می‌شود.
+// stack trace فقط در لاگ سرور ثبت می‌شود و هرگز به کلاینت نمی‌رسد.
+// با RECOVER_PANICS=0 بعد از لاگ، پروسه با همان panic کرش می‌کند تا supervisor دوباره راهش بیندازد.
 func recoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		// این defer حتی اگر panic رخ دهد اجرا می‌شود
 		defer func() {
-			if rec := recover(); rec != nil { // اگر panic رخ داده باشد
-				log.Printf("panic recovered: %v", rec) // ثبت panic
-				http.Error(
-					w,
-					"Internal Server Error",
-					http.StatusInternalServerError,
-				) // پاسخ 500
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			// ErrAbortHandler یعنی handler عمداً اتصال را قطع کرده است
+			if rec == http.ErrAbortHandler {
+				panic(rec)
 			}
+
+			id := requestIDFromContext(r.Context())
+
+			// ثبت panic همراه با stack برای پیدا کردن علت
+			requestLogger(r.Context()).Error("panic recovered",
+				"clientAddr", logClientAddr(r),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", fmt.Sprint(rec),
+				"stack", string(debug.Stack()),
+			)
+
+			// net/http خودش panic هر handler را recover می‌کند و فقط اتصال را می‌بندد؛
+			// panic در یک goroutine تازه قابل recover نیست و کل پروسه را متوقف می‌کند
+			if !recoverPanics {
+				go func() { panic(rec) }()
+				select {} // تا کرش پروسه هیچ پاسخی ارسال نشود
+			}
+
+			// مسیرهای API خطای JSON می‌گیرند (writeError شناسه را از هدر پاسخ برمی‌دارد)؛
+			// panic بالا با stack لاگ شده و در ERROR_DETAIL=full مقدارش در پاسخ هم می‌آید
+			if isAPIPath(r.URL.Path) {
+				writeErrorDetails(w, http.StatusInternalServerError, "Internal Server Error", errorDetails(fmt.Errorf("panic: %v", rec)))
+				return
+			}
+
+			// بقیه‌ی مسیرها یک صفحه‌ی HTML ساده
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, internalErrorPage, html.EscapeString(id))
 		}()
 
 		next.ServeHTTP(w, r) // ادامه‌ی اجرای درخواست
 	})
 }
 
+// isAPIPath مسیرهایی را که پاسخ JSON می‌دهند مشخص می‌کند
+func isAPIPath(path string) bool {
+	return hasAnyPrefix(path, []string{"/api/", "/admin/", "/debug/"}) || path == "/health" || path == "/readyz" || path == "/livez"
+}
+
+// notFoundHandler مسیرهای ناموجود API را با خطای JSON (همراه request_id) جواب می‌دهد تا کلاینت‌ها
+// همیشه JSON بگیرند؛ بقیه‌ی مسیرها همان 404 متنی net/http را می‌گیرند
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	if isAPIPath(r.URL.Path) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no endpoint matches %s %s", r.Method, r.URL.Path))
+		return
+	}
+	http.NotFound(w, r)
+}
+
 // ================= Helper =================
 
 // تابع کمکی برای ارسال پاسخ JSON
 func writeJSON(w http.ResponseWriter, status int, v any) {
 
-	// تعیین نوع خروجی
+	// تبدیل داده به JSON در یک بافر از pool؛ defer بافر را حتی در صورت panic برمی‌گرداند
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		requestLogger(responseContext(w)).Error("writeJSON: encode failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// تعیین نوع خروجی و حجم آن (برای HEAD هم همین هدرها ارسال می‌شوند)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
 
-	// تنظیم status code
+	// تنظیم status code و ارسال
 	w.WriteHeader(status)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		ctx := responseContext(w)
+		switch {
+		case isClientDisconnect(err), isClientGone(ctx):
+			// کلاینت وسط پاسخ رفته (broken pipe یا لغو درخواست)؛ اشکال سرور نیست و loggingMiddleware آن را 499 ثبت می‌کند
+			requestLogger(ctx).Debug("writeJSON: client disconnected", "err", err)
+		case errors.Is(err, errResponseTooLarge), errors.Is(err, http.ErrHandlerTimeout):
+			// middleware مربوط خودش پاسخ و لاگ را می‌دهد
+		default:
+			requestLogger(ctx).Error("writeJSON: write failed", "err", err)
+		}
+	}
+}
+
+// responseContext context درخواستی را که w پاسخ آن است از روی recorder در loggingMiddleware پیدا می‌کند؛
+// writerهای میانی با Unwrap کنار زده می‌شوند. بیرون از آن زنجیره context.Background است.
+func responseContext(w http.ResponseWriter) context.Context {
+	for {
+		switch v := w.(type) {
+		case *statusRecorder:
+			if v.ctx != nil {
+				return v.ctx
+			}
+			w = v.ResponseWriter
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return context.Background()
+		}
+	}
+}
+
+// ساختار یکسان پاسخ‌های خطا در API
+type apiError struct {
+	Error     string `json:"error"`                // پیام خطا برای کلاینت
+	Details   any    `json:"details,omitempty"`    // جزئیات اضافه (مثلاً خطای هر فیلد)
+	RequestID string `json:"request_id,omitempty"` // شناسه‌ی درخواست برای پیدا کردن آن در لاگ‌ها
 
-	// تبدیل داده به JSON و ارسال
-	_ = json.NewEncoder(w).Encode(v)
+	// همان مقدار هدر Retry-After برای کلاینت‌هایی که فقط body را می‌خوانند (فقط در 429 و 503)
+	RetryAfter int `json:"retry_after_seconds,omitempty"`
+}
+
+// تابع کمکی برای ارسال خطا با قالب JSON
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeErrorDetails(w, status, message, nil)
+}
+
+// مثل writeError ولی جزئیات خطا را هم در پاسخ می‌گذارد
+func writeErrorDetails(w http.ResponseWriter, status int, message string, details any) {
+	// شناسه را requestIDMiddleware قبلاً در هدر پاسخ گذاشته است
+	writeJSON(w, status, apiError{Error: message, Details: details, RequestID: w.Header().Get("X-Request-ID")})
+}
+
+// حالت ERROR_DETAIL=full: پاسخ خطاهای سمت سرور زنجیره‌ی خطای داخلی را هم دارد (برای staging)؛
+// فقط یک بار در شروع برنامه تنظیم می‌شود
+var errorDetailFull bool
+
+// writeServerError خطای سمت سرور را همراه شناسه‌ی درخواست لاگ می‌کند و پاسخ status را می‌فرستد.
+// پیام کلاینت همیشه متن استاندارد status است؛ err فقط در ERROR_DETAIL=full به کلاینت می‌رسد.
+// err باید خودش بگوید کجا رخ داده، مثل fmt.Errorf("upload create: %w", err).
+func writeServerError(w http.ResponseWriter, status int, err error) {
+	requestLogger(responseContext(w)).Error("server error", "status", status, "err", err)
+	writeErrorDetails(w, status, http.StatusText(status), errorDetails(err))
+}
+
+// errorDetails در حالت full زنجیره‌ی err را (بیرونی‌ترین اول) برای details پاسخ برمی‌گرداند و در حالت safe هیچ
+func errorDetails(err error) any {
+	if !errorDetailFull || err == nil {
+		return nil
+	}
+	var chain []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		chain = append(chain, err.Error())
+	}
+	return map[string][]string{"errors": chain}
+}
+
+// writeRetryError پاسخ 429 یا 503 را با Retry-After می‌فرستد؛ هدر و retry_after_seconds در body
+// از یک مقدار ساخته می‌شوند تا هیچ‌وقت اختلاف نداشته باشند. کمتر از یک ثانیه به 1 گرد می‌شود.
+func writeRetryError(w http.ResponseWriter, status int, message string, retryAfter time.Duration) {
+	secs := max(1, int(math.Ceil(retryAfter.Seconds())))
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	writeJSON(w, status, apiError{Error: message, RequestID: w.Header().Get("X-Request-ID"), RetryAfter: secs})
+}
+
+// حداکثر حجم body برای درخواست‌های JSON و فرم (MAX_JSON_BODY_BYTES، پیش‌فرض 1MB)؛
+// فقط یک بار در شروع برنامه تنظیم می‌شود
+var maxJSONBodyBytes int64 = 1 << 20
+
+// تابع کمکی برای خواندن body درخواست به صورت JSON داخل dst.
+// خطای برگشتی *bodyError است و با writeBodyError ارسال می‌شود.
+// بدون jsonUseNumber عدد داخل فیلد any به float64 تبدیل می‌شود (بیش از 2^53 دقت از دست می‌رود).
+func readJSON(w http.ResponseWriter, r *http.Request, dst any, opts ...jsonOption) error {
+
+	// محدود کردن حجم body تا کلاینت نتواند حافظه را پر کند
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields() // فیلدهای ناشناخته خطا حساب می‌شوند
+	for _, opt := range opts {
+		opt(dec)
+	}
+
+	// خطاهای decoder به پیام‌های امن و دقیق برای کلاینت تبدیل می‌شوند (bodyError)
+	if err := dec.Decode(dst); err != nil {
+		return newBodyError(err)
+	}
+
+	// body باید فقط شامل یک مقدار JSON باشد
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return &bodyError{
+			Status:  http.StatusBadRequest,
+			Message: "body must contain a single JSON value",
+			Offset:  dec.InputOffset(),
+		}
+	}
+
+	return nil
 }
 
 // ================= API Handlers =================
 
-// /health → بررسی سلامت سرور
-func healthHandler(w http.ResponseWriter, r *http.Request) {
+// پاسخ ثابت /api/ping؛ از قبل ساخته می‌شود تا هر درخواست allocation نداشته باشد
+var (
+	pongBody        = []byte("pong")
+	pongContentType = []string{"text/plain; charset=utf-8"}
+)
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"ok":   true,                            // وضعیت سلامت
-		"time": time.Now().Format(time.RFC3339), // زمان فعلی
-	})
+// /api/ping → ارزان‌ترین liveness probe: متن ساده، بدون JSON و بدون health check
+func apiPingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header()["Content-Type"] = pongContentType
+	_, _ = w.Write(pongBody)
+}
+
+// پاسخ /api/time؛ struct است تا هم JSON و هم XML شود
+type timeResponse struct {
+	XMLName xml.Name `json:"-" xml:"time"`
+	Unix    int64    `json:"unix" xml:"unix"` // زمان یونیکس
+	ISO     string   `json:"iso" xml:"iso"`   // زمان استاندارد
 }
 
-// /api/time → برگرداندن زمان
+// /api/time → برگرداندن زمان (JSON یا XML بر اساس Accept)
 func apiTimeHandler(w http.ResponseWriter, r *http.Request) {
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"unix": time.Now().Unix(),               // زمان یونیکس
-		"iso":  time.Now().Format(time.RFC3339), // زمان استاندارد
+	now := time.Now()
+	writeNegotiated(w, r, http.StatusOK, timeResponse{
+		Unix: now.Unix(),
+		ISO:  now.Format(time.RFC3339),
 	})
 }
 
+// /api/echo → برگرداندن پیام اعتبارسنجی‌شده (نمونه‌ی استفاده از JSON Schema)
+func apiEchoHandler(w http.ResponseWriter, r *http.Request) {
+
+	var req struct {
+		Message string `json:"message"` // پیام ورودی
+		Repeat  int    `json:"repeat"`  // تعداد تکرار (اختیاری)
+		Meta    any    `json:"meta"`    // داده‌ی دلخواه (اختیاری)؛ عددهایش json.Number هستند
+	}
+
+	// اعتبارسنجی body با schema ثبت‌شده؛ در صورت خطا پاسخ قبلاً ارسال شده است.
+	// echo باید دقیقاً همان را برگرداند؛ پس شناسه‌های 64 بیتی داخل meta نباید float64 شوند
+	if !validateBody(w, r, "echo", &req, jsonUseNumber) {
+		return
+	}
+
+	if req.Repeat == 0 {
+		req.Repeat = 1 // مقدار پیش‌فرض
+	}
+
+	resp := map[string]any{
+		"message": req.Message,
+		"repeat":  req.Repeat,
+	}
+	if req.Meta != nil {
+		resp["meta"] = req.Meta // json.Number بدون تغییر encode می‌شود
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
 // ================= main =================
 
+// سقف کل خواندن هر درخواست (هدر و body)؛ آپلودها آن را با setBodyReadDeadline بالا می‌برند
+const serverReadTimeout = 5 * time.Second
+
 func main() {
+	// os.Exit deferها را اجرا نمی‌کند؛ پس منطق اصلی در run است و اینجا فقط کد خروج تعیین می‌شود
+	if err := run(); err != nil {
+		code := exitCode(err)
+		slog.Error("server exited with error", "err", err, "code", code)
+		os.Exit(code)
+	}
+}
+
+// run سرور را راه‌اندازی و تا سیگنال خاموش شدن اجرا می‌کند.
+// خطای تنظیمات، bind یا خاموش‌سازی ناموفق به‌صورت error برگردانده می‌شود.
+func run() error {
 
 	// -------- Config --------
 
-	// خواندن PORT از env
-	port := os.Getenv("PORT")
+	startedAt := time.Now() // برای گزارش uptime هنگام خاموش شدن
 
-	// اگر تعریف نشده بود، پیش‌فرض 8080
-	if port == "" {
-		port = "8080"
+	// خواندن تنظیمات از env
+	cfg, err := loadConfig()
+	if errors.Is(err, flag.ErrHelp) {
+		return nil // -h: راهنمای فلگ‌ها چاپ شده است
+	}
+	if err != nil {
+		return fmt.Errorf("config error: %w", err)
 	}
 
-	// -------- Router --------
-
-	// ساخت router داخلی Go
-	mux := http.NewServeMux()
+	// لاگر با سطح قابل تغییر در زمان اجرا و قالب انتخاب‌شده؛ access log مقصد خودش را دارد
+	errorOut, accessOut, err := openLogDests(cfg.ErrorLogDest, cfg.AccessLogDest)
+	if err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+	setupLogger(cfg.LogFormat, errorOut)
+	setupAccessLog(cfg.LogFormat, accessOut)
 
-	// ثبت routeهای API
-	mux.HandleFunc("/health", healthHandler)
-	mux.HandleFunc("/api/time", apiTimeHandler)
+	// سیگنال‌های graceful shutdown (پیش‌فرض SIGINT و SIGTERM) به‌علاوه‌ی SIGQUIT برای dump
+	shutdownSigs, err := parseSignals(cfg.ShutdownSignals)
+	if err != nil {
+		return fmt.Errorf("config error: SHUTDOWN_SIGNALS: %w", err)
+	}
+	shutdownSigs = append(shutdownSigs, syscall.SIGQUIT)
 
-	// وقتی کاربر / را می‌زند → index.html
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	// -------- Prefork --------
 
-		// فقط دقیقاً مسیر / مجاز است
-		if r.URL.Path != "/" {
-			http.NotFound(w, r)
-			return
+	// در حالت prefork والد فقط فرزندها را مدیریت می‌کند و خودش سرور اجرا نمی‌کند
+	preforkChild := isPreforkChild()
+	if cfg.Prefork > 0 && !preforkChild {
+		if code := runPreforkParent(cfg.Prefork, shutdownSigs); code != 0 {
+			return &exitError{code: code, err: errors.New("prefork children failed")}
 		}
+		return nil
+	}
+	if preforkChild {
+		slog.SetDefault(slog.Default().With("pid", os.Getpid())) // تشخیص لاگ هر فرزند
+		accessLogger = accessLogger.With("pid", os.Getpid())
+	}
 
-		// ارسال فایل index.html
-		http.ServeFile(w, r, "./static/index.html")
-	})
+	slog.Info("config loaded", "config", cfg) // رمزها در Config.LogValue حذف می‌شوند
 
-	// سرو فایل‌های استاتیک مثل css, js, txt
-	fs := http.FileServer(http.Dir("./static"))
+	// فعال کردن نسخه‌ی اولیه‌ی تنظیمات زمان اجرا
+	if err := applyRuntimeConfig(cfg.Runtime); err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
 
-	// /static/* → پوشه static
-	mux.Handle("/static/", http.StripPrefix("/static/", fs))
+	port := cfg.Port
 
-	// -------- Middleware --------
+	// ناشناس کردن IP در لاگ‌ها (GDPR)
+	anonymizeLogIPs = cfg.AnonymizeIPs
 
-	// سوار کردن middlewareها روی router
-	handler := chain(
-		mux,                // handler اصلی
-		recoveryMiddleware, // جلوگیری از panic
-		loggingMiddleware,  // لاگ گرفتن
-	)
+	// panicها recover شوند یا پروسه را متوقف کنند
+	recoverPanics = cfg.RecoverPanics
+
+	// جزئیات خطاهای داخلی در پاسخ (فقط برای staging)
+	errorDetailFull = cfg.ErrorDetail == "full"
+
+	// اطلاعات build و uptime در /health
+	healthVerbose = cfg.HealthVerbose
+
+	// مسیرهایی که در access log نمی‌آیند (مثل probeهای پرتکرار)
+	accessLogSkip = cfg.AccessLogSkip
+
+	// سقف body در readJSON، bindBody و validateBody
+	maxJSONBodyBytes = cfg.MaxJSONBodyBytes
+
+	// انواع فشرده‌پذیر در compressionMiddleware و static cache
+	compressTypes = cfg.CompressTypes
+
+	// -------- Background Tasks --------
+
+	// context ریشه‌ی goroutineهای دوره‌ای (پاک‌سازی rate limit، uploadها و ...)؛ در خاموش‌سازی لغو می‌شود
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	app, err := newApp(bgCtx, cfg)
+	if err != nil {
+		return err
+	}
+
+	// توقف goroutineهای پس‌زمینه؛ آخر از همه ثبت می‌شود تا در خاموش‌سازی اول اجرا شود
+	onShutdown("background tasks", func(ctx context.Context) error {
+		stopBackground()
+		return waitBackground(ctx)
+	})
 
 	// -------- HTTP Server --------
 
+	conns := &connTracker{} // شمارش اتصال‌های باز برای گزارش تخلیه
+
+	// سقف اتصال‌های همزمان هر IP (اگر MAX_CONNS_PER_IP صفر نباشد)
+	connLimit := newConnLimiter(cfg.MaxConnsPerIP, app.trustedProxies)
+	connState := func(c net.Conn, state http.ConnState) {
+		conns.track(c, state)
+		connLimit.track(c, state)
+	}
+
 	srv := &http.Server{
-		Addr:              ":" + port,       // آدرس گوش دادن
-		Handler:           handler,          // handler نهایی
-		ReadTimeout:       5 * time.Second,  // timeout خواندن body
-		ReadHeaderTimeout: 3 * time.Second,  // timeout header
-		WriteTimeout:      10 * time.Second, // timeout پاسخ
-		IdleTimeout:       60 * time.Second, // keep-alive
+		Addr:              cfg.listenAddr(),  // آدرس گوش دادن (HOST:PORT)
+		Handler:           app.handler,       // handler نهایی
+		ReadTimeout:       serverReadTimeout, // timeout خواندن body
+		ReadHeaderTimeout: 3 * time.Second,   // timeout header
+		WriteTimeout:      10 * time.Second,  // timeout پاسخ
+		IdleTimeout:       60 * time.Second,  // keep-alive
+		ConnState:         connState,         // ثبت باز و بسته شدن اتصال‌ها
+	}
+
+	// streamها تا پایان مهلت خاموش‌سازی باز می‌ماندند (WebSocket حتی بعد از آن)
+	srv.RegisterOnShutdown(app.streams.closeAll)
+
+	// h2c برای پروکسی‌هایی که HTTP/2 را بدون TLS به سرور می‌رسانند؛ HTTP/1.1 همچنان کار می‌کند (h2c.go)
+	if cfg.H2C {
+		enableH2C(srv)
+	}
+
+	// flagهای FEATURES_FILE با SIGHUP بدون restart عوض می‌شوند (مگر SIGHUP در SHUTDOWN_SIGNALS باشد)
+	if cfg.FeaturesFile != "" && !slices.Contains(shutdownSigs, os.Signal(syscall.SIGHUP)) {
+		watchFeatures(bgCtx, cfg.FeaturesFile)
+	}
+
+	// HTTPS مستقیم (اگر TLS_CERT_FILE تنظیم شده باشد)؛ cert با تمدید روی دیسک یا SIGHUP بدون restart عوض می‌شود.
+	// SIGHUP اگر در SHUTDOWN_SIGNALS باشد همان خاموش‌سازی می‌ماند.
+	if cfg.TLSCertFile != "" {
+		certs, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return fmt.Errorf("config error: TLS_CERT_FILE: %w", err)
+		}
+		certs.watch(bgCtx, !slices.Contains(shutdownSigs, os.Signal(syscall.SIGHUP)))
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
 	}
 
 	// -------- Start Server --------
 
+	// listener جدا ساخته می‌شود تا خطای bind قبل از اعلام آماده بودن معلوم شود.
+	// فرزندهای prefork همه روی یک پورت با SO_REUSEPORT گوش می‌دهند.
+	var ln net.Listener
+	if preforkChild {
+		ln, err = listenReusePort(srv.Addr)
+	} else {
+		ln, err = net.Listen("tcp", srv.Addr)
+	}
+	if err != nil {
+		// خطای bind یعنی سرور هرگز شروع نشده؛ مسیر shutdown لازم نیست
+		if hint := bindErrorHint(err, port); hint != "" {
+			err = fmt.Errorf("%w (%s)", err, hint)
+		}
+		return &exitError{code: exitBindError, err: fmt.Errorf("cannot bind listener: %w", err)}
+	}
+	slog.Info("listener bound", "addr", ln.Addr().String())
+
+	// keep-alive سطح TCP (جدا از keep-alive در HTTP) برای تشخیص اتصال‌های مرده پشت load balancer
+	ln = newKeepAliveListener(ln, cfg.TCPKeepAlivePeriod)
+	if cfg.TCPKeepAlivePeriod > 0 {
+		slog.Info("tcp keep-alive", "period", cfg.TCPKeepAlivePeriod.String())
+	} else {
+		slog.Info("tcp keep-alive", "period", "15s", "source", "go default")
+	}
+
+	// بررسی framing درخواست‌های HTTP/1.x روی bytes خام؛ زیر TLS فقط bytes رمزشده دیده می‌شود
+	if cfg.StrictFraming && srv.TLSConfig == nil {
+		ln = framingListener{ln}
+		srv.ConnContext = framingConnContext
+	}
+
 	errCh := make(chan error, 1) // کانال دریافت خطا
 
 	go func() {
-		log.Printf("Server running on http://localhost:%s", port)
-		errCh <- srv.ListenAndServe() // اجرای سرور
+		if srv.TLSConfig != nil {
+			errCh <- srv.ServeTLS(ln, "", "") // cert از TLSConfig.GetCertificate
+			return
+		}
+		errCh <- srv.Serve(ln) // اجرای سرور
 	}()
 
+	// آدرس خود سرور برای probeهای watchdog و self-test
+	url := serverURL(ln.Addr(), srv.TLSConfig != nil)
+
+	// watchdog گیر کردن پروسه را در /livez نشان می‌دهد؛ با شروع خاموش‌سازی متوقف می‌شود چون listener بسته است
+	watchdogCtx, stopWatchdog := context.WithCancel(bgCtx)
+	defer stopWatchdog()
+	if cfg.WatchdogTimeout > 0 {
+		newWatchdog(cfg.WatchdogTimeout, url, cfg.WatchdogAction).start(watchdogCtx)
+		slog.Info("watchdog enabled", "timeout", cfg.WatchdogTimeout.String(), "action", cfg.WatchdogAction)
+	}
+
+	// self-test قبل از اعلام آماده بودن؛ با SELFTEST_ON_FAIL=block آماده شدن تا موفقیت بررسی‌ها عقب می‌افتد
+	selfTestCtx, stopSelfTest := context.WithCancel(bgCtx)
+	defer stopSelfTest()
+	selfTestDone, err := newSelfTest(cfg.SelfTestChecks, cfg, url).gate(selfTestCtx, cfg.SelfTestOnFail, func() {
+		serverReady.Store(true)
+		slog.Info("server ready", "url", url, "startup", time.Since(startedAt).String())
+	})
+	if err != nil {
+		_ = srv.Close()
+		return err
+	}
+
 	// -------- Graceful Shutdown --------
 
 	sigCh := make(chan os.Signal, 1)
 
-	// گوش دادن به Ctrl+C و kill
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	// گوش دادن به سیگنال‌های SHUTDOWN_SIGNALS (پیش‌فرض Ctrl+C و kill) و SIGQUIT
+	signal.Notify(sigCh, shutdownSigs...)
+
+	// خطاهای مسیر خاموش شدن جمع می‌شوند تا کد خروج غیر صفر شود
+	var errs []error
 
+	signaled := false
 	select {
 	case sig := <-sigCh:
-		log.Printf("Shutdown signal received: %s", sig)
+		signaled = true
+		slog.Info("signal received", "signal", sig.String())
+
+		// به‌جای dump و خروج فوری پیش‌فرض Go، stack در لاگ می‌آید و بعد خاموش‌سازی عادی
+		if sig == syscall.SIGQUIT {
+			dumpGoroutines("SIGQUIT received, goroutine dump")
+		}
 
 	case err := <-errCh:
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Printf("Server error: %v", err)
+		// ErrServerClosed فقط بعد از Shutdown می‌آید؛ هر خطای دیگر یعنی Serve از کار افتاده
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server stopped unexpectedly", "err", err)
+			errs = append(errs, fmt.Errorf("serve: %w", err))
+		}
+	}
+
+	// /readyz از همین لحظه 503 می‌دهد تا load balancer این نمونه را از چرخش خارج کند؛
+	// self-test در حال تکرار اول متوقف می‌شود تا بعد از این دوباره ready اعلام نکند
+	stopSelfTest()
+	stopWatchdog()
+	<-selfTestDone
+	serverReady.Store(false)
+	slog.Info("readiness set to not ready")
+
+	// PRESTOP_DELAY: تا load balancer تغییر /readyz را ببیند درخواست‌های جدید همچنان سرو می‌شوند؛
+	// بدون این مهلت، درخواست‌هایی که بین سیگنال و بسته شدن socket می‌رسند رد می‌شوند
+	if signaled && cfg.PrestopDelay > 0 {
+		slog.Info("pre-stop delay started, still serving", "delay", cfg.PrestopDelay.String())
+
+		timer := time.NewTimer(cfg.PrestopDelay)
+		select {
+		case <-timer.C:
+			slog.Info("pre-stop delay finished")
+
+		case sig := <-sigCh:
+			// سیگنال دوم یعنی اپراتور منتظر نمی‌ماند
+			timer.Stop()
+			slog.Info("second signal received, pre-stop delay cut short", "signal", sig.String())
+
+		case err := <-errCh:
+			timer.Stop()
+			slog.Error("server stopped unexpectedly", "err", err)
+			errs = append(errs, fmt.Errorf("serve: %w", err))
 		}
 	}
 
@@ -196,10 +750,315 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	slog.Info("draining started", "connections", conns.count(), "timeout", "10s")
+
 	// خاموش‌سازی سرور
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("Shutdown error: %v", err)
+		slog.Error("shutdown error", "err", err, "connections_remaining", conns.count())
+		logActiveRequests() // کدام endpointها خاموش‌سازی را نگه داشته‌اند
+		errs = append(errs, fmt.Errorf("shutdown: %w", err))
 	} else {
-		log.Printf("Graceful shutdown complete.")
+		slog.Info("connections drained", "connections_remaining", conns.count())
+	}
+
+	// پاک‌سازی اجزای دیگر بعد از اینکه هیچ درخواستی در جریان نیست
+	if err := runShutdownHooks(ctx); err != nil {
+		slog.Error("shutdown hooks failed", "err", err)
+		errs = append(errs, err)
 	}
+
+	slog.Info("shutdown complete", "uptime", time.Since(startedAt).Round(time.Millisecond).String())
+
+	return errors.Join(errs...)
+}
+
+// app handler کامل سرور و چیزهایی از آن که run برای http.Server لازم دارد
+type app struct {
+	handler        http.Handler
+	streams        *streamLimiter
+	trustedProxies []netip.Prefix
+}
+
+// newApp routeها و زنجیره‌ی کامل middlewareها را از روی cfg می‌سازد؛ goroutineهای پس‌زمینه‌ی آن‌ها
+// (پاک‌سازی rate limit، uploadها و ...) با لغو ctx متوقف می‌شوند. تست‌ها همین handler را با
+// httptest.NewServer اجرا می‌کنند.
+func newApp(ctx context.Context, cfg Config) (*app, error) {
+	// رنج‌های پروکسی مورد اعتماد برای تشخیص IP واقعی
+	trustedProxies, err := parsePrefixes(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("config error: TRUSTED_PROXIES: %w", err)
+	}
+
+	// -------- GeoIP --------
+
+	// اگر دیتابیس موجود نباشد geo برابر nil است و lookup انجام نمی‌شود
+	geo := openGeoIP(cfg.GeoIPDB)
+	onShutdown("geoip", geo.close)
+	geoMW := geoIPMiddleware(geo, cfg.GeoIPBlockCountries)
+
+	// -------- JSON Schemas --------
+
+	// کامپایل schemaها یک بار در شروع برنامه تا اعتبارسنجی هر درخواست سریع باشد
+	if err := loadSchemas(cfg.SchemaDir); err != nil {
+		return nil, fmt.Errorf("schema error: %w", err)
+	}
+
+	// -------- Router --------
+
+	// ساخت router؛ routeها در زمان اجرا هم قابل اضافه و حذف هستند
+	router := newRouter()
+	router.NotFound = http.HandlerFunc(notFoundHandler)
+
+	// routeهای API با deadline اجرا می‌شوند؛ کلاینت می‌تواند با X-Request-Timeout آن را کوتاه‌تر کند.
+	// هر الگوی مسیر می‌تواند در ROUTE_TIMEOUTS مهلت خودش را داشته باشد.
+	timeouts := newRouteTimeouts(cfg.RequestTimeout, cfg.RequestTimeoutMax, cfg.RouteTimeouts)
+
+	// ثبت routeهای API
+	router.Register(http.MethodGet, "/health", timeouts.forRoute("/health")(http.HandlerFunc(healthHandler)))
+	router.HandleFunc(http.MethodGet, "/readyz", readyzHandler)
+	router.HandleFunc(http.MethodGet, "/livez", livezHandler)
+	router.HandleFunc(http.MethodGet, "/api/ping", apiPingHandler) // بدون timeout و بافر
+
+	// بدون پوشه‌ی static سایت کار نمی‌کند؛ پس این بررسی critical است،
+	// مگر اینکه پوشه از همان شروع نبوده باشد (استقرار فقط API)
+	_, staticDirErr := os.Stat("./static")
+	registerHealthCheck("static", staticDirErr == nil, func(ctx context.Context) error {
+		_, err := os.Stat("./static")
+		return err
+	})
+
+	// cache پاسخ‌های GET (اگر فعال باشد)؛ درخواست‌های همزمان یکسان فقط یک بار اجرا می‌شوند
+	var timeHandler http.Handler = http.HandlerFunc(apiTimeHandler)
+	if cfg.ResponseCacheTTL > 0 {
+		timeHandler = newResponseCache(cfg.ResponseCacheTTL).middleware(timeHandler)
+	}
+	router.Register(http.MethodGet, "/api/time", chain(timeHandler,
+		producesMiddleware(mediaJSON, mediaXML), // JSON یا XML بر اساس Accept
+		jsonpMiddleware,                         // JSONP برای ویجت‌های قدیمی
+		timeouts.forRoute("/api/time"),
+	))
+	router.Register(http.MethodGet, "/api/slow", chain(http.HandlerFunc(apiSlowHandler), timeouts.forRoute("/api/slow")))
+	router.HandleFunc(http.MethodGet, "/api/sequence", apiSequenceHandler) // بدون timeout چون پاسخ stream است
+	router.HandleFunc(http.MethodGet, "/api/count", apiCountHandler)       // پاسخ chunked؛ همین‌طور بدون timeout
+
+	// POSTهایی که با Idempotency-Key تکرار می‌شوند فقط یک بار اجرا می‌شوند (اگر فعال باشد)
+	idempotent := func(h http.Handler) http.Handler { return h }
+	if cfg.IdempotencyTTL > 0 {
+		idempotent = newIdempotencyStore(ctx, cfg.IdempotencyTTL).middleware
+	}
+	router.Register(http.MethodPost, "/api/echo", chain(http.HandlerFunc(apiEchoHandler),
+		requireContentType("application/json"),
+		timeouts.forRoute("/api/echo"),
+		idempotent, // داخل timeout: پاسخ اجرایی که دیر تمام شود هم برای تکرار نگه داشته می‌شود
+	))
+
+	// آپلودهای قابل ادامه؛ بدون timeoutMiddleware چون تکه‌ها ممکن است طولانی باشند
+	if cfg.UploadMaxBytes > 0 {
+		uploadChunk := requireContentType("application/offset+octet-stream", "application/octet-stream")
+		uploads, err := newUploadStore(ctx, cfg.UploadDir, cfg.UploadMaxBytes, cfg.UploadMaxParts, cfg.UploadMaxCount, cfg.UploadTTL)
+		if err != nil {
+			return nil, fmt.Errorf("config error: UPLOAD_DIR: %w", err)
+		}
+		router.HandleFunc(http.MethodPost, "/api/uploads", uploads.create)
+		registerHealthCheck("uploads", false, uploads.healthCheck)
+		router.HandleFunc(http.MethodHead, "/api/uploads/", uploads.serveUpload)
+		router.HandleFunc(http.MethodGet, "/api/uploads/", uploads.download)
+		router.Register(http.MethodPatch, "/api/uploads/", uploadChunk(http.HandlerFunc(uploads.serveUpload)))
+	}
+
+	// key/value درون حافظه برای نمونه‌سازی؛ نوشتن با همان کاربر و رمز ادمین
+	if cfg.KVMaxKeys > 0 {
+		kv := newKVStore(ctx, cfg.KVMaxKeys, cfg.KVMaxValueBytes)
+		// If-Match / If-None-Match قبل از خواندن body رد می‌شوند؛ kv زیر قفل دوباره بررسی می‌کند
+		kvWrite := router.Group("/api/kv", basicAuthMiddleware(cfg.AdminUser, cfg.AdminPassword), preconditionMiddleware(kv.etag))
+		router.Register(http.MethodGet, "/api/kv/", kv)
+		kvWrite.Register(http.MethodPut, "/", requireContentType("application/json")(kv))
+		kvWrite.Register(http.MethodDelete, "/", kv)
+	}
+
+	// سایت اصلی از ./static؛ با VHOSTS هر دامنه می‌تواند پوشه‌ی خودش را داشته باشد
+	site := newStaticSite("./static", cfg)
+	indexHandler, filesHandler := site.index, site.files
+	if len(cfg.VHosts) > 0 {
+		vhosts := newVHosts(cfg.VHosts, cfg.VHostFallback, site, cfg)
+		indexHandler, filesHandler = vhosts.index(), vhosts.files()
+	}
+
+	// وقتی کاربر / را می‌زند → فایل index
+	// "/{$}" یعنی فقط دقیقاً مسیر /، نه همه‌ی مسیرها
+	router.Register(http.MethodGet, "/{$}", indexHandler)
+
+	// /static/* → پوشه static
+	router.Register(http.MethodGet, "/static/", filesHandler)
+
+	// sitemap صفحه‌های HTML سایت اصلی (فقط با SITE_BASE_URL؛ آدرس‌های sitemap باید کامل باشند)
+	if cfg.SiteBaseURL != "" {
+		router.Register(http.MethodGet, "/sitemap.xml", newStaticSitemap(site.dir, resolveIndexFile(site.dir, cfg.IndexFile), cfg.SiteBaseURL))
+	}
+
+	// -------- Reverse Proxy --------
+
+	// بافرهای کپی پاسخ upstream بین UPSTREAMS و همه‌ی PROXY_ROUTES مشترک‌اند
+	proxyBuffers := newProxyBufferPool(cfg.ProxyBufferSize)
+
+	// PROXY_PREFIX/* → upstreamها (با حذف prefix)، هر کدام پشت circuit breaker خودش
+	if len(cfg.Upstreams) > 0 {
+		proxy, err := newUpstreamPool("", cfg.Upstreams, cfg.BreakerThreshold, cfg.BreakerCooldown, cfg.ProxyRetries, cfg.ProxyRetryWait)
+		if err != nil {
+			return nil, fmt.Errorf("config error: UPSTREAMS: %w", err)
+		}
+		proxy.tune(cfg.ProxyFlush, proxyBuffers)
+		registerHealthCheck("upstreams", false, proxy.healthCheck)
+
+		// CANARY_UPSTREAMS: درصد canary "upstreams" (CANARIES یا /admin/config، پیش‌فرض 0) از کلاینت‌ها
+		// به نسخه‌ی جدید backend می‌روند
+		var h http.Handler = proxy
+		if len(cfg.CanaryUpstreams) > 0 {
+			canary, err := newUpstreamPool("canary", cfg.CanaryUpstreams, cfg.BreakerThreshold, cfg.BreakerCooldown, cfg.ProxyRetries, cfg.ProxyRetryWait)
+			if err != nil {
+				return nil, fmt.Errorf("config error: CANARY_UPSTREAMS: %w", err)
+			}
+			canary.tune(cfg.ProxyFlush, proxyBuffers)
+			registerHealthCheck("canary upstreams", false, canary.healthCheck)
+			if h, err = canaryMiddleware("upstreams", 0, canary, proxy); err != nil {
+				return nil, fmt.Errorf("config error: CANARY_UPSTREAMS: %w", err)
+			}
+		}
+		router.Register("", cfg.ProxyPrefix, http.StripPrefix(strings.TrimSuffix(cfg.ProxyPrefix, "/"), h))
+	}
+
+	// PROXY_ROUTES: هر prefix با upstreamها، breaker، retry و timeout خودش
+	for _, prefix := range slices.Sorted(maps.Keys(cfg.ProxyRoutes)) {
+		if len(cfg.Upstreams) > 0 && prefix == cfg.ProxyPrefix {
+			return nil, fmt.Errorf("config error: PROXY_ROUTES: %s is already PROXY_PREFIX", prefix)
+		}
+		route, err := parseProxyRoute(prefix, cfg.ProxyRoutes[prefix])
+		if err != nil {
+			return nil, fmt.Errorf("config error: PROXY_ROUTES: %w", err)
+		}
+		pool, h, err := route.handler(cfg, proxyBuffers)
+		if err != nil {
+			return nil, fmt.Errorf("config error: PROXY_ROUTES: %w", err)
+		}
+		registerHealthCheck("proxy "+prefix, false, pool.healthCheck)
+		router.Register("", prefix, h)
+		slog.Info("proxy route", "prefix", prefix, "upstreams", len(route.upstreams), "strip", route.strip, "timeout", route.timeout.String())
+	}
+
+	// الگوی ناشناخته در ROUTE_TIMEOUTS به احتمال زیاد اشتباه تایپی است
+	if unused := timeouts.unused(); len(unused) > 0 {
+		return nil, fmt.Errorf("config error: ROUTE_TIMEOUTS: no route with a timeout matches %s", strings.Join(unused, ", "))
+	}
+
+	// -------- Admin --------
+
+	// routeهای ادمین فقط وقتی ثبت می‌شوند که رمز تنظیم شده باشد
+	if cfg.AdminPassword != "" {
+
+		// همه‌ی کارهای ادمین در یک مقصد جدا audit می‌شوند
+		audit, err := openAuditLog(cfg.AuditLog)
+		if err != nil {
+			return nil, fmt.Errorf("config error: AUDIT_LOG: %w", err)
+		}
+		onShutdown("audit log", audit.close)
+
+		// API ادمین هیچ درخواست cross-origin را نمی‌پذیرد (سیاست CORS خالی)
+		adminCORS := corsMiddleware(CORSConfig{})
+
+		// IP و رمز را protector برای کل /admin/ و /debug/ بررسی کرده است (PROTECTED_PATHS)؛
+		// هر route ادمین CORS را رد و سپس audit می‌کند
+		admin := router.Group("",
+			adminCORS,
+			auditMiddleware(audit),
+			requireContentType("application/json", "application/x-www-form-urlencoded"),
+		)
+
+		admin.HandleFunc(http.MethodGet, "/admin/config", adminConfigHandler)
+		admin.HandleFunc(http.MethodPatch, "/admin/config", adminConfigHandler)
+		admin.HandleFunc(http.MethodGet, "/admin/stats", adminStatsHandler)
+		admin.Register(http.MethodGet, "/admin/vars", expvar.Handler())
+		admin.Register(http.MethodGet, "/debug/vars", expvar.Handler()) // مسیر استاندارد expvar
+		admin.HandleFunc(http.MethodGet, "/api/env", envConfigHandler(cfg))
+
+		// preflight مسیرهای ادمین به adminCORS می‌رسد تا صریحاً رد شود
+		for _, p := range []string{"/admin/config", "/admin/stats", "/admin/vars", "/debug/vars", "/api/env"} {
+			router.Register(http.MethodOptions, p, adminCORS(http.NotFoundHandler()))
+		}
+	} else {
+		log.Printf("Admin API disabled (ADMIN_PASSWORD is not set)")
+	}
+
+	// -------- Middleware --------
+
+	// محافظت یکجای مسیرهای حساس (PROTECTED_PATHS)؛ IPهای مجاز از ADMIN_ALLOW_IPS
+	adminIPs, err := parsePrefixes(cfg.AdminAllowIPs)
+	if err != nil {
+		return nil, fmt.Errorf("config error: ADMIN_ALLOW_IPS: %w", err)
+	}
+	protect, err := newProtector(cfg, adminIPs)
+	if err != nil {
+		return nil, fmt.Errorf("config error: %w", err)
+	}
+
+	// حداقل نرخ رسیدن body (اگر MIN_BODY_RATE صفر نباشد)؛ سقف کل همان ReadTimeout سرور است
+	bodyRateMW := minBodyRateMiddleware(cfg.MinBodyRate, cfg.MinBodyRateGrace, serverReadTimeout)
+
+	// سقف طول URL قبل از routing (اگر MAX_URL_LEN صفر نباشد)
+	urlLimitMW := urlLengthMiddleware(cfg.MaxURLLen)
+
+	// هدرهای پیش‌فرض DEFAULT_HEADERS و هدر Server روی همه‌ی پاسخ‌ها، حتی خطاهای middlewareهای بیرونی
+	headersMW := defaultHeadersMiddleware(newHeaderRules(cfg.DefaultHeaders, cfg.ServerHeader))
+
+	// HSTS فقط روی درخواست‌های HTTPS (مستقیم یا پشت پروکسی مورد اعتماد)
+	hstsMW := hstsMiddleware(cfg.HSTSMaxAge)
+
+	// سیاست CORS پیش‌فرض؛ /admin/ و /debug/ سیاست خودشان را روی routeهایشان دارند
+	cfg.CORS.Skip = []string{"/admin/", "/debug/", "/api/env"}
+	corsMW := corsMiddleware(cfg.CORS)
+
+	// سقف حجم پاسخ (اگر MAX_RESPONSE_BYTES تنظیم شده باشد)
+	limitMW := responseLimitMiddleware(cfg.MaxResponseBytes)
+
+	// فشرده‌سازی gzip پاسخ‌های متنی (اگر COMPRESSION_LEVEL صفر نباشد)
+	compressMW := compressionMiddleware(cfg.CompressionLevel)
+	if cfg.CompressionLevel > 0 {
+		slog.Info("compression enabled", "encoding", "gzip", "level", cfg.CompressionLevel)
+	}
+
+	// محدودیت نرخ برای هر IP
+	limiter := newRateLimiter(ctx)
+
+	// سقف درخواست‌های همزمان با صف انتظار محدود (اگر MAX_CONCURRENT صفر نباشد)
+	queue := newRequestQueue(cfg.MaxConcurrent, cfg.QueueSize, cfg.QueueTimeout)
+
+	// سقف کلاینت‌های SSE و WebSocket (اگر MAX_STREAM_CLIENTS صفر نباشد)
+	streams := newStreamLimiter(cfg.MaxStreams)
+
+	// سوار کردن middlewareها روی router
+	handler := chain(
+		router,                           // handler اصلی
+		headersMW,                        // هدرهای DEFAULT_HEADERS و Server
+		requestIDMiddleware,              // شناسه‌ی هر درخواست (X-Request-ID)
+		framingMiddleware,                // رد درخواست‌های با طول body مبهم (request smuggling)
+		urlLimitMW,                       // رد URLهای خیلی بلند (414)
+		bodyRateMW,                       // بستن اتصال‌هایی که body را خیلی کند می‌فرستند
+		serverTimingMiddleware,           // هدر Server-Timing
+		headMiddleware,                   // پاسخ بدون body برای HEAD
+		recoveryMiddleware,               // جلوگیری از panic
+		realIPMiddleware(trustedProxies), // تشخیص IP واقعی کلاینت
+		hstsMW,                           // Strict-Transport-Security روی HTTPS
+		geoMW,                            // تشخیص کشور و مسدودسازی
+		loggingMiddleware,                // لاگ گرفتن
+		limitMW,                          // سقف حجم پاسخ
+		corsMW,                           // CORS پیش‌فرض و پاسخ preflight
+		compressMW,                       // فشرده‌سازی gzip
+		maintenanceMiddleware,            // حالت تعمیرات
+		limiter.middleware,               // محدودیت نرخ برای هر IP
+		featureRoutes(cfg.FeatureRoutes), // 404 برای مسیرهای FEATURE_ROUTES تا وقتی flag خاموش است
+		protect.middleware,               // IP، basic auth و توکن مسیرهای حساس
+		streams.middleware,               // سقف اتصال‌های SSE و WebSocket
+		queue.middleware,                 // صف درخواست‌های همزمان
+	)
+
+	return &app{handler: handler, streams: streams, trustedProxies: trustedProxies}, nil
 }
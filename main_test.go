@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// ================= recoveryMiddleware =================
+
+func TestRecoveryMiddlewareAPI(t *testing.T) {
+	logs := captureLogs(t)
+
+	h := requestIDMiddleware(recoveryMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom: secret internal state")
+	})))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/boom", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want JSON", ct)
+	}
+
+	var body apiError
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v\n%s", err, w.Body)
+	}
+	id := w.Header().Get("X-Request-ID")
+	if id == "" || body.RequestID != id {
+		t.Errorf("request_id = %q, X-Request-ID = %q; want equal and non-empty", body.RequestID, id)
+	}
+	if body.Error != "Internal Server Error" {
+		t.Errorf("error = %q", body.Error)
+	}
+
+	// نه مقدار panic و نه stack به کلاینت نمی‌رسد
+	for _, leak := range []string{"boom", "secret", "goroutine", ".go:"} {
+		if strings.Contains(w.Body.String(), leak) {
+			t.Errorf("response body leaks %q: %s", leak, w.Body)
+		}
+	}
+
+	// ولی در لاگ سرور با همان شناسه هست
+	var entry map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if strings.Contains(line, `"panic recovered"`) {
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if entry == nil {
+		t.Fatalf("no panic log:\n%s", logs)
+	}
+	if entry["request_id"] != id {
+		t.Errorf("logged request_id = %v, want %q", entry["request_id"], id)
+	}
+	if entry["panic"] != "boom: secret internal state" {
+		t.Errorf("logged panic = %v", entry["panic"])
+	}
+	stack, _ := entry["stack"].(string)
+	if !strings.Contains(stack, "goroutine") || !strings.Contains(stack, "TestRecoveryMiddlewareAPI") {
+		t.Errorf("logged stack does not look like a stack trace:\n%s", stack)
+	}
+}
+
+func TestRecoveryMiddlewareHTML(t *testing.T) {
+	captureLogs(t)
+
+	h := requestIDMiddleware(recoveryMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	})))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want HTML", ct)
+	}
+	if id := w.Header().Get("X-Request-ID"); !strings.Contains(w.Body.String(), id) {
+		t.Errorf("page does not contain request id %q", id)
+	}
+	if strings.Contains(w.Body.String(), "boom") || strings.Contains(w.Body.String(), "goroutine") {
+		t.Errorf("page leaks panic details: %s", w.Body)
+	}
+}
+
+// ================= writeJSON =================
+
+// failingWriter هر Write را با err شکست می‌دهد، مثل اتصالی که کلاینت بسته است
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	err error
+}
+
+func (fw *failingWriter) Write([]byte) (int, error) { return 0, fw.err }
+
+// خطای نوشتن در writeJSON وقتی کلاینت رفته (broken pipe یا لغو context درخواست) فقط debug است و
+// بقیه‌ی خطاها error؛ هر دو با request_id درخواست
+func TestWriteJSONWriteErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		cancel bool
+		level  string
+		msg    string
+	}{
+		{"broken pipe", fmt.Errorf("write tcp: %w", syscall.EPIPE), false, "DEBUG", "writeJSON: client disconnected"},
+		{"connection reset", fmt.Errorf("write tcp: %w", syscall.ECONNRESET), false, "DEBUG", "writeJSON: client disconnected"},
+		{"cancelled request context", errors.New("http2: stream closed"), true, "DEBUG", "writeJSON: client disconnected"},
+		{"other write error", errors.New("disk on fire"), false, "ERROR", "writeJSON: write failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+
+			h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+			}), requestIDMiddleware, loggingMiddleware, serverTimingMiddleware) // writer میانی با Unwrap
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			} else {
+				defer cancel()
+			}
+			r := httptest.NewRequestWithContext(ctx, http.MethodGet, "/api/thing", nil)
+			w := &failingWriter{ResponseRecorder: httptest.NewRecorder(), err: tt.err}
+			h.ServeHTTP(w, r)
+			id := w.Header().Get("X-Request-ID")
+
+			var found bool
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				var e map[string]any
+				if err := json.Unmarshal([]byte(line), &e); err != nil {
+					t.Fatal(err)
+				}
+				if e["level"] == "ERROR" && tt.level != "ERROR" {
+					t.Errorf("unexpected error log: %s", line)
+				}
+				if e["msg"] == tt.msg {
+					found = true
+					if e["level"] != tt.level {
+						t.Errorf("level = %v, want %s", e["level"], tt.level)
+					}
+					if e["request_id"] != id {
+						t.Errorf("request_id = %v, want %q", e["request_id"], id)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("no %q log:\n%s", tt.msg, logs)
+			}
+		})
+	}
+}
+
+// بیرون از زنجیره (بدون loggingMiddleware) responseContext همان context.Background است
+func TestResponseContextWithoutRecorder(t *testing.T) {
+	if ctx := responseContext(httptest.NewRecorder()); ctx != context.Background() {
+		t.Errorf("responseContext = %v, want Background", ctx)
+	}
+	if ctx := responseContext(newStatusRecorder(httptest.NewRecorder())); ctx != context.Background() {
+		t.Errorf("responseContext through a bare recorder = %v, want Background", ctx)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"         // سرو manifest با http.ServeContent
+	"crypto/sha256" // hash محتوای فایل‌ها
+	"encoding/hex"  // تبدیل hash به رشته
+	"encoding/json" // بدنه‌ی manifest.json
+	"io"            // hash کردن فایل بدون خواندن کامل در حافظه
+	"io/fs"         // پیمایش پوشه‌ی static
+	"log"           // لاگ ساخت manifest
+	"net/http"      // هسته HTTP در Go
+	"os"            // خواندن فایل‌ها
+	"path"          // جدا کردن پسوند
+	"path/filepath" // تبدیل مسیر دیسک به مسیر URL
+	"strings"       // تمیز کردن مسیر درخواست
+	"sync"          // دسترسی همزمان امن به manifest
+	"time"          // فاصله‌ی بررسی دوباره در حالت reload
+)
+
+// ================= Static Asset Manifest =================
+
+// مسیر manifest نسبت به پوشه‌ی static
+const manifestName = "manifest.json"
+
+// طول بخش hash در نام فایل (کاراکتر hex)
+const manifestHashLen = 8
+
+// فایل‌های hashدار محتوایشان با نام عوض می‌شود؛ پس مرورگر می‌تواند همیشه نگهشان دارد
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// manifestEntry یک فایل static و نام hashدار آن
+type manifestEntry struct {
+	modTime time.Time // برای تشخیص تغییر فایل در حالت reload
+	size    int64
+	hashed  string // مسیر نسبی hashدار، مثل css/app.3f2a1b9c.css
+}
+
+// staticManifest نام منطقی هر فایل static را به نامی با hash محتوا نگاشت می‌کند
+// (app.js → app.3f2a1b9c.js) و درخواست‌های نام hashدار را به فایل اصلی می‌فرستد.
+// با reload، پوشه حداکثر هر staticRevalidateInterval دوباره بررسی و فقط فایل‌های تغییرکرده دوباره hash می‌شوند.
+type staticManifest struct {
+	dir    string
+	reload bool
+
+	mu       sync.RWMutex
+	entries  map[string]manifestEntry // مسیر نسبی اصلی → entry
+	byHashed map[string]string        // مسیر نسبی hashدار → مسیر اصلی
+	body     []byte                   // JSON آماده‌ی manifest
+	etag     string
+	built    time.Time // زمان آخرین تغییر manifest
+	scanned  time.Time // زمان آخرین پیمایش پوشه
+}
+
+// newStaticManifest manifest را یک بار در شروع برنامه می‌سازد
+func newStaticManifest(dir string, reload bool) *staticManifest {
+	m := &staticManifest{dir: dir, reload: reload, entries: make(map[string]manifestEntry)}
+
+	start := time.Now()
+	m.scan()
+	log.Printf("Static manifest: %d files hashed in %s", len(m.entries), time.Since(start))
+
+	return m
+}
+
+// scan پوشه را پیمایش می‌کند و manifest را (اگر فایلی اضافه، حذف یا عوض شده باشد) از نو می‌سازد.
+// باید بدون قفل صدا زده شود.
+func (m *staticManifest) scan() {
+
+	m.mu.RLock()
+	old := m.entries
+	m.mu.RUnlock()
+
+	entries := make(map[string]manifestEntry, len(old))
+	changed := false
+
+	err := filepath.WalkDir(m.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// فایل‌ها و پوشه‌های مخفی (مثل .git) در manifest نمی‌آیند
+		if strings.HasPrefix(d.Name(), ".") && p != m.dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(m.dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == manifestName {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil // فایل وسط پیمایش حذف شده
+		}
+
+		// فایل عوض نشده؛ hash قبلی معتبر است
+		if e, ok := old[rel]; ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+			entries[rel] = e
+			return nil
+		}
+
+		sum, err := hashFile(p)
+		if err != nil {
+			log.Printf("Static manifest: %s: %v", rel, err)
+			return nil
+		}
+		entries[rel] = manifestEntry{modTime: info.ModTime(), size: info.Size(), hashed: hashedName(rel, sum)}
+		changed = true
+		return nil
+	})
+	if err != nil {
+		log.Printf("Static manifest error: %v", err)
+	}
+
+	// فایل حذف‌شده هم manifest را عوض می‌کند
+	if len(entries) != len(old) {
+		changed = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scanned = time.Now()
+	if !changed && m.body != nil {
+		return
+	}
+
+	logical := make(map[string]string, len(entries))
+	byHashed := make(map[string]string, len(entries))
+	for rel, e := range entries {
+		logical[rel] = "/static/" + e.hashed
+		byHashed[e.hashed] = rel
+	}
+
+	body, _ := json.MarshalIndent(logical, "", "  ") // map[string]string همیشه encode می‌شود
+	m.entries, m.byHashed = entries, byHashed
+	m.body, m.etag, m.built = body, strongETag(body), m.scanned
+}
+
+// hashFile hash کوتاه hex محتوای فایل را برمی‌گرداند
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:manifestHashLen], nil
+}
+
+// hashedName hash را قبل از پسوند می‌گذارد: css/app.css → css/app.3f2a1b9c.css
+func hashedName(rel, sum string) string {
+	ext := path.Ext(rel)
+	return strings.TrimSuffix(rel, ext) + "." + sum + ext
+}
+
+// refresh در حالت reload اگر از آخرین پیمایش به اندازه‌ی کافی گذشته باشد پوشه را دوباره بررسی می‌کند
+func (m *staticManifest) refresh() {
+	if !m.reload {
+		return
+	}
+	m.mu.RLock()
+	stale := time.Since(m.scanned) >= staticRevalidateInterval
+	m.mu.RUnlock()
+
+	if stale {
+		m.scan()
+	}
+}
+
+// handler manifest.json را سرو می‌کند و نام‌های hashدار را به فایل اصلی (در next) می‌رساند.
+// مسیر درخواست باید نسبت به پوشه‌ی static باشد (یعنی بعد از StripPrefix).
+func (m *staticManifest) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		rel := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+		if rel == manifestName {
+			m.refresh()
+
+			m.mu.RLock()
+			body, etag, built := m.body, m.etag, m.built
+			m.mu.RUnlock()
+
+			// manifest ممکن است با deploy بعدی عوض شود؛ همیشه با ETag بررسی شود
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", etag)
+			http.ServeContent(w, r, manifestName, built, bytes.NewReader(body))
+			return
+		}
+
+		m.refresh()
+
+		m.mu.RLock()
+		orig, ok := m.byHashed[rel]
+		m.mu.RUnlock()
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		r.URL.Path = orig
+		r.URL.RawPath = ""
+		next.ServeHTTP(&cacheControlWriter{ResponseWriter: w, value: immutableCacheControl}, r)
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"         // تشخیص نوع خطای خواندن
+	"expvar"         // شمارنده‌ی آپلودهای ردشده
+	"fmt"            // پیام خطا برای کلاینت
+	"io"             // کپی محدود هر part
+	"mime"           // تشخیص multipart/form-data
+	"mime/multipart" // خواندن partها به صورت stream
+	"net/http"       // هسته HTTP در Go
+	"os"             // فایل‌های موقت
+	"path/filepath"  // مسیر فایل و نام امن
+	"time"           // deadline خواندن
+)
+
+// ================= Multipart Uploads =================
+
+// حداکثر حجم هر فیلد متنی (غیر فایل) فرم
+const multipartMaxFieldBytes = 64 << 10
+
+// آپلودهای multipart ردشده بر اساس علت: too_large، too_many_parts، too_many_uploads
+var multipartRejected = expvar.NewMap("multipart_rejected")
+
+// errTooManyParts علت رد شدن درخواست وسط خواندن partها وقتی تعداد از سقف بگذرد
+var errTooManyParts = errors.New("too many parts")
+
+// errUploadsFull فایل‌های فرم در سقف UPLOAD_MAX_ACTIVE جا نمی‌شوند
+var errUploadsFull = errors.New("too many uploads")
+
+// partTooLargeError یک فایل یا فیلد بزرگ‌تر از سقف خودش
+type partTooLargeError struct {
+	what  string // مثل file "a.bin"
+	limit int64
+}
+
+func (e *partTooLargeError) Error() string {
+	return fmt.Sprintf("%s must not exceed %d bytes", e.what, e.limit)
+}
+
+// multipartFile یک فایل ذخیره‌شده در پاسخ آپلود
+type multipartFile struct {
+	Field    string `json:"field"`
+	Filename string `json:"filename"` // فقط نام پایه؛ مسیر کلاینت دور ریخته می‌شود
+	Size     int64  `json:"size"`
+	ID       string `json:"id"` // نام فایل در UPLOAD_DIR
+}
+
+// isMultipart بررسی می‌کند body درخواست multipart/form-data باشد
+func isMultipart(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == "multipart/form-data"
+}
+
+// createMultipart → POST /api/uploads با multipart/form-data.
+// partها مستقیم از اتصال خوانده و در دیسک نوشته می‌شوند (بدون ParseMultipartForm و بافر حافظه)؛
+// سقف حجم کل فرم و هر فایل (UPLOAD_MAX_BYTES) و تعداد partها (UPLOAD_MAX_PARTS) همان وسط کپی بررسی
+// می‌شود تا فرم بزرگ زود قطع شود. هر خطا همه‌ی فایل‌های همین درخواست را پاک می‌کند. فایل‌های ذخیره‌شده
+// مثل آپلود کامل‌شده ثبت می‌شوند تا در سقف UPLOAD_MAX_ACTIVE حساب و بعد از UPLOAD_TTL پاک شوند.
+func (s *uploadStore) createMultipart(w http.ResponseWriter, r *http.Request) {
+
+	if s.full() {
+		writeUploadsFull(w)
+		return
+	}
+
+	// کل فرم، نه فقط هر فایل، در سقف یک آپلود می‌ماند؛ بدون آن هر درخواست تا UPLOAD_MAX_PARTS برابر می‌نوشت
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBytes)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid multipart body")
+		return
+	}
+
+	// فرم‌های بزرگ روی اتصال کند بیشتر از ReadTimeout سرور طول می‌کشند
+	setBodyReadDeadline(w, r, time.Now().Add(uploadChunkTimeout)) // MIN_BODY_RATE همچنان اعمال می‌شود
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(uploadChunkTimeout))
+
+	files, fields, err := s.readParts(mr)
+	if err == nil && !s.addFiles(files) {
+		err = errUploadsFull
+	}
+	if err != nil {
+		for _, f := range files {
+			_ = os.Remove(filepath.Join(s.dir, f.ID))
+		}
+		s.writePartError(w, err)
+		return
+	}
+
+	for _, f := range files {
+		requestLogger(r.Context()).Info("upload complete", "id", f.ID, "length", f.Size, "filename", f.Filename)
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"files": files, "fields": fields})
+}
+
+// addFiles فایل‌های یک فرم را یک‌جا مثل آپلودهای کامل ثبت می‌کند؛ false یعنی همه با هم در سقف
+// maxCount جا نمی‌شوند و هیچ‌کدام ثبت نشد
+func (s *uploadStore) addFiles(files []multipartFile) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.uploads)+len(files) > s.maxCount {
+		return false
+	}
+	now := time.Now()
+	for _, f := range files {
+		s.uploads[f.ID] = &upload{path: filepath.Join(s.dir, f.ID), filename: f.Filename, length: f.Size, offset: f.Size, updated: now}
+	}
+	return true
+}
+
+// readParts همه‌ی partها را می‌خواند؛ در خطا هم فایل‌های نوشته‌شده (برای پاک کردن) برگردانده می‌شوند
+func (s *uploadStore) readParts(mr *multipart.Reader) ([]multipartFile, map[string]string, error) {
+
+	files := []multipartFile{}
+	fields := map[string]string{}
+
+	for parts := 0; ; parts++ {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return files, fields, nil
+		}
+		if err != nil {
+			return files, fields, err
+		}
+		if parts == s.maxParts {
+			part.Close()
+			return files, fields, errTooManyParts
+		}
+
+		// فیلد متنی: کوچک است و در حافظه می‌ماند
+		if part.FileName() == "" {
+			v, err := io.ReadAll(io.LimitReader(part, multipartMaxFieldBytes+1))
+			part.Close()
+			if err != nil {
+				return files, fields, err
+			}
+			if len(v) > multipartMaxFieldBytes {
+				return files, fields, &partTooLargeError{what: fmt.Sprintf("field %q", part.FormName()), limit: multipartMaxFieldBytes}
+			}
+			fields[part.FormName()] = string(v)
+			continue
+		}
+
+		f, err := s.savePart(part)
+		part.Close()
+		if f.ID != "" {
+			files = append(files, f) // حتی ناقص؛ تا پاک شود
+		}
+		if err != nil {
+			return files, fields, err
+		}
+	}
+}
+
+// savePart یک part فایل را با سقف maxBytes در یک فایل تازه می‌نویسد؛
+// یک بایت بیشتر از سقف خوانده می‌شود تا بزرگ‌تر بودن بدون خواندن بقیه‌ی فایل معلوم شود
+func (s *uploadStore) savePart(part *multipart.Part) (multipartFile, error) {
+
+	id, err := newUploadID()
+	if err != nil {
+		return multipartFile{}, err
+	}
+	out, err := os.OpenFile(filepath.Join(s.dir, id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return multipartFile{}, fmt.Errorf("create: %w", err)
+	}
+	defer out.Close()
+
+	mf := multipartFile{Field: part.FormName(), Filename: filepath.Base(part.FileName()), ID: id}
+	mf.Size, err = io.Copy(out, io.LimitReader(part, s.maxBytes+1))
+	if err != nil {
+		return mf, err
+	}
+	if mf.Size > s.maxBytes {
+		return mf, &partTooLargeError{what: fmt.Sprintf("file %q", mf.Filename), limit: s.maxBytes}
+	}
+	return mf, nil
+}
+
+// writePartError خطای خواندن فرم را به status مناسب تبدیل می‌کند
+func (s *uploadStore) writePartError(w http.ResponseWriter, err error) {
+	var pathErr *os.PathError
+	var tooLarge *partTooLargeError
+	var formTooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		multipartRejected.Add("too_large", 1)
+		writeBodyError(w, &bodyError{Status: http.StatusRequestEntityTooLarge, Message: tooLarge.Error(), Limit: tooLarge.limit})
+	case errors.As(err, &formTooLarge):
+		multipartRejected.Add("too_large", 1)
+		writeBodyError(w, err) // کل فرم بزرگ‌تر از UPLOAD_MAX_BYTES
+	case errors.Is(err, errUploadsFull):
+		multipartRejected.Add("too_many_uploads", 1)
+		writeUploadsFull(w)
+	case errors.Is(err, errTooManyParts):
+		multipartRejected.Add("too_many_parts", 1)
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("form must not have more than %d parts", s.maxParts))
+	case errors.Is(err, errBodyTooSlow):
+		writeError(w, http.StatusRequestTimeout, errBodyTooSlow.Error())
+	case errors.As(err, &pathErr):
+		writeServerError(w, http.StatusInternalServerError, fmt.Errorf("multipart upload: %w", err))
+	default:
+		writeError(w, http.StatusBadRequest, "invalid multipart body")
+	}
+}
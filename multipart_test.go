@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postMultipart یک فرم با فایل‌های داده‌شده (نام فیلد → محتوا) به create می‌فرستد
+func postMultipart(t *testing.T, s *uploadStore, files map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for field, content := range files {
+		fw, err := mw.CreateFormFile(field, field+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/uploads", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	s.create(w, r)
+	return w
+}
+
+// فایل‌های multipart مثل آپلود کامل ثبت و بعد از TTL پاک می‌شوند
+func TestMultipartUploadExpires(t *testing.T) {
+	captureLogs(t)
+	s := newTestUploads(t, 1000, 10)
+
+	w := postMultipart(t, s, map[string]string{"a": "hello", "b": "world!"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Files []multipartFile `json:"files"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Files) != 2 {
+		t.Fatalf("%d files, want 2", len(resp.Files))
+	}
+	for _, f := range resp.Files {
+		u := s.get(f.ID)
+		if u == nil {
+			t.Fatalf("file %s not registered", f.ID)
+		}
+		if u.offset != f.Size || u.length != f.Size {
+			t.Errorf("file %s: offset %d, length %d, want %d", f.ID, u.offset, u.length, f.Size)
+		}
+		u.updated = time.Now().Add(-2 * s.ttl)
+	}
+
+	s.cleanup()
+	for _, f := range resp.Files {
+		if s.get(f.ID) != nil {
+			t.Errorf("file %s still registered after TTL", f.ID)
+		}
+		if _, err := os.Stat(filepath.Join(s.dir, f.ID)); !os.IsNotExist(err) {
+			t.Errorf("file %s not removed: %v", f.ID, err)
+		}
+	}
+}
+
+func TestMultipartUploadLimits(t *testing.T) {
+	captureLogs(t)
+	tests := []struct {
+		name     string
+		maxCount int
+		active   int // آپلودهای باز از قبل
+		files    map[string]string
+		status   int
+	}{
+		{"one file over the limit", 10, 0, map[string]string{"a": strings.Repeat("x", 1500)}, http.StatusRequestEntityTooLarge},
+		{"form over the limit, each file under it", 10, 0, map[string]string{"a": strings.Repeat("x", 600), "b": strings.Repeat("y", 600)}, http.StatusRequestEntityTooLarge},
+		{"store already full", 1, 1, map[string]string{"a": "hello"}, http.StatusServiceUnavailable},
+		{"files do not fit in the store", 2, 1, map[string]string{"a": "hello", "b": "world"}, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestUploads(t, 1000, tt.maxCount)
+			for range tt.active {
+				createUpload(t, s, "5")
+			}
+
+			w := postMultipart(t, s, tt.files)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			// هیچ فایلی از فرم ردشده نمی‌ماند
+			entries, err := os.ReadDir(s.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.active {
+				t.Errorf("%d files in UPLOAD_DIR, want %d", len(entries), tt.active)
+			}
+		})
+	}
+}
+
+func TestMultipartTooManyParts(t *testing.T) {
+	captureLogs(t)
+	s := newTestUploads(t, 1000, 100)
+	s.maxParts = 2
+
+	w := postMultipart(t, s, map[string]string{"a": "1", "b": "2", "c": "3"})
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413: %s", w.Code, w.Body)
+	}
+	if entries, _ := os.ReadDir(s.dir); len(entries) != 0 {
+		t.Errorf("%d files left in UPLOAD_DIR", len(entries))
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"      // نگه‌داری نوع انتخاب‌شده در context
+	"encoding/xml" // پاسخ XML
+	"net/http"     // هسته HTTP در Go
+	"strconv"      // پارس q و Content-Length
+	"strings"      // پارس هدر Accept
+)
+
+// ================= Content Negotiation =================
+
+// نوع‌هایی که writeNegotiated می‌تواند بسازد
+const (
+	mediaJSON = "application/json"
+	mediaXML  = "application/xml"
+)
+
+// کلید context برای نوع پاسخی که producesMiddleware انتخاب کرده
+type negotiatedKey struct{}
+
+// producesMiddleware نوع پاسخ را از بین types (به ترتیب اولویت سرور) بر اساس هدر Accept انتخاب می‌کند.
+// اگر هیچ‌کدام برای کلاینت قابل قبول نباشد، پاسخ 406 است و handler اجرا نمی‌شود.
+// handler با writeNegotiated پاسخ را در همان نوع انتخاب‌شده می‌نویسد.
+func producesMiddleware(types ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			// پاسخ به ازای Accept فرق می‌کند
+			addVary(w.Header(), "Accept")
+
+			mt := negotiateType(r.Header.Get("Accept"), types)
+			if mt == "" {
+				writeError(w, http.StatusNotAcceptable, "Not Acceptable: supported types are "+strings.Join(types, ", "))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), negotiatedKey{}, mt)))
+		})
+	}
+}
+
+// negotiatedType نوعی که producesMiddleware انتخاب کرده ("" یعنی بدون مذاکره)
+func negotiatedType(ctx context.Context) string {
+	mt, _ := ctx.Value(negotiatedKey{}).(string)
+	return mt
+}
+
+// writeNegotiated v را در نوع انتخاب‌شده (XML یا به‌طور پیش‌فرض JSON) می‌نویسد
+func writeNegotiated(w http.ResponseWriter, r *http.Request, status int, v any) {
+	if negotiatedType(r.Context()) == mediaXML {
+		writeXML(w, status, v)
+		return
+	}
+	writeJSON(w, status, v)
+}
+
+// writeXML مثل writeJSON است ولی با encoding/xml و اعلان <?xml ...?> در ابتدای پاسخ؛
+// v باید struct با tagهای xml باشد (map در encoding/xml پشتیبانی نمی‌شود)
+func writeXML(w http.ResponseWriter, status int, v any) {
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(buf).Encode(v); err != nil {
+		requestLogger(responseContext(w)).Error("writeXML: encode failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	buf.WriteByte('\n')
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// negotiateType بهترین نوع از offers را برای هدر Accept برمی‌گرداند.
+// بیشترین q برنده است و در تساوی ترتیب offers (ترجیح سرور) تعیین می‌کند.
+// Accept خالی یعنی هر نوعی قابل قبول است.
+func negotiateType(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality مقدار q دقیق‌ترین عبارت Accept را که با offer تطبیق دارد برمی‌گرداند (0 یعنی قابل قبول نیست)
+func acceptQuality(accept, offer string) float64 {
+	offerType, offerSub, _ := strings.Cut(offer, "/")
+
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mr, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		typ, sub, ok := strings.Cut(strings.ToLower(strings.TrimSpace(mr)), "/")
+		if !ok {
+			continue
+		}
+
+		// دقت تطبیق: type/sub > type/* > */*
+		var s int
+		switch {
+		case typ == offerType && sub == offerSub:
+			s = 2
+		case typ == offerType && sub == "*":
+			s = 1
+		case typ == "*" && sub == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+
+		specificity, q = s, 1
+		for _, p := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+					q = f
+				}
+			}
+		}
+	}
+	return q
+}
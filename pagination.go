@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"      // پیام خطای پارامترها و ساختن هدر Link
+	"math"     // سقف شماره‌ی صفحه تا offset سرریز نکند
+	"net/http" // هسته HTTP در Go
+	"net/url"  // ساختن آدرس صفحه‌های قبلی و بعدی
+	"strconv"  // پارس پارامترهای عددی
+	"strings"  // اتصال بخش‌های هدر Link
+)
+
+// ================= Pagination =================
+
+const (
+	defaultPerPage = 20  // اندازه‌ی صفحه وقتی کلاینت چیزی نخواسته
+	maxPerPage     = 100 // سقف اندازه‌ی صفحه تا کلاینت نتواند کل مجموعه را یک‌جا بخواهد
+)
+
+// pageParams بازه‌ی درخواست‌شده از یک مجموعه
+type pageParams struct {
+	Offset int // تعداد آیتم‌های رد شده
+	Limit  int // حداکثر تعداد آیتم این صفحه
+
+	offsetStyle bool // کلاینت limit/offset فرستاده؛ لینک‌ها هم به همین شکل ساخته می‌شوند
+}
+
+// Page شماره‌ی صفحه (از 1)
+func (p pageParams) Page() int { return p.Offset/p.Limit + 1 }
+
+// bounds بازه‌ی [start, end) این صفحه در مجموعه‌ای با total آیتم، مناسب برای items[start:end]
+func (p pageParams) bounds(total int) (start, end int) {
+	start = min(p.Offset, total)
+	end = min(start+p.Limit, total)
+	return start, end
+}
+
+// paginate پارامترهای page/per_page یا limit/offset را از query می‌خواند.
+// مقدار پیش‌فرض صفحه‌ی اول با defaultPerPage آیتم است و اندازه‌ی صفحه به maxPerPage محدود می‌شود.
+// خطای برگشتی پیام مناسب برای پاسخ 400 است.
+func paginate(r *http.Request) (pageParams, error) {
+	q := r.URL.Query()
+
+	pageStyle := q.Has("page") || q.Has("per_page")
+	offsetStyle := q.Has("limit") || q.Has("offset")
+	if pageStyle && offsetStyle {
+		return pageParams{}, fmt.Errorf("use either page/per_page or limit/offset, not both")
+	}
+
+	sizeKey := "per_page"
+	if offsetStyle {
+		sizeKey = "limit"
+	}
+	limit, err := queryInt(q, sizeKey, defaultPerPage, 1)
+	if err != nil {
+		return pageParams{}, err
+	}
+	limit = min(limit, maxPerPage)
+
+	if offsetStyle {
+		offset, err := queryInt(q, "offset", 0, 0)
+		if err != nil {
+			return pageParams{}, err
+		}
+		return pageParams{Offset: offset, Limit: limit, offsetStyle: true}, nil
+	}
+
+	page, err := queryInt(q, "page", 1, 1)
+	if err != nil {
+		return pageParams{}, err
+	}
+	// (page-1)*limit برای صفحه‌های خیلی بزرگ سرریز و offset منفی می‌شد
+	if maxPage := math.MaxInt / limit; page > maxPage {
+		return pageParams{}, fmt.Errorf("page must be <= %d", maxPage)
+	}
+	return pageParams{Offset: (page - 1) * limit, Limit: limit}, nil
+}
+
+// queryInt یک پارامتر عددی query را با مقدار پیش‌فرض و حداقل مجاز می‌خواند
+func queryInt(q url.Values, key string, def, minValue int) (int, error) {
+	v := q.Get(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < minValue {
+		return 0, fmt.Errorf("%s must be an integer >= %d", key, minValue)
+	}
+	return n, nil
+}
+
+// paginationMeta اطلاعات صفحه در پاسخ
+type paginationMeta struct {
+	Total      int `json:"total"`
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	TotalPages int `json:"total_pages"`
+}
+
+// paginatedResponse قالب یکسان پاسخ همه‌ی endpointهای لیستی
+type paginatedResponse struct {
+	Items      any            `json:"items"`
+	Pagination paginationMeta `json:"pagination"`
+}
+
+// writePaginated آیتم‌های یک صفحه را همراه با metadata و هدرهای Link (first, prev, next, last)
+// و X-Total-Count می‌فرستد. items باید فقط آیتم‌های همین صفحه باشد و total تعداد کل مجموعه.
+func writePaginated(w http.ResponseWriter, r *http.Request, p pageParams, total int, items any) {
+
+	totalPages := total / p.Limit
+	if total%p.Limit != 0 {
+		totalPages++
+	}
+
+	var links []string
+	link := func(offset int, rel string) {
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, pageURL(r, p, offset), rel))
+	}
+	if total > 0 {
+		link(0, "first")
+		if p.Offset > 0 {
+			link(max(p.Offset-p.Limit, 0), "prev")
+		}
+		if p.Offset < total-p.Limit { // همان p.Offset+p.Limit < total بدون سرریز برای offset خیلی بزرگ
+			link(p.Offset+p.Limit, "next")
+		}
+		link((totalPages-1)*p.Limit, "last")
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	writeJSON(w, http.StatusOK, paginatedResponse{
+		Items: items,
+		Pagination: paginationMeta{
+			Total:      total,
+			Page:       p.Page(),
+			PerPage:    p.Limit,
+			TotalPages: totalPages,
+		},
+	})
+}
+
+// pageURL آدرس همین درخواست را برای offset دیگری می‌سازد؛ بقیه‌ی پارامترهای query حفظ می‌شوند
+func pageURL(r *http.Request, p pageParams, offset int) string {
+	q := r.URL.Query()
+	if p.offsetStyle {
+		q.Set("offset", strconv.Itoa(offset))
+		q.Set("limit", strconv.Itoa(p.Limit))
+	} else {
+		q.Set("page", strconv.Itoa(offset/p.Limit+1))
+		q.Set("per_page", strconv.Itoa(p.Limit))
+	}
+	return r.URL.Path + "?" + q.Encode()
+}
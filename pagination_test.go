@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	maxPage := strconv.Itoa(math.MaxInt / 10)
+
+	tests := []struct {
+		query   string
+		want    pageParams
+		wantErr string
+	}{
+		{"", pageParams{Offset: 0, Limit: defaultPerPage}, ""},
+		{"page=3&per_page=10", pageParams{Offset: 20, Limit: 10}, ""},
+		{"per_page=1000", pageParams{Offset: 0, Limit: maxPerPage}, ""},
+		{"limit=5&offset=7", pageParams{Offset: 7, Limit: 5, offsetStyle: true}, ""},
+		{"offset=9223372036854775807&limit=10", pageParams{Offset: math.MaxInt, Limit: 10, offsetStyle: true}, ""},
+		{"page=" + maxPage + "&per_page=10", pageParams{Offset: (math.MaxInt/10 - 1) * 10, Limit: 10}, ""},
+		{"page=9223372036854775807&per_page=10", pageParams{}, "page must be <= " + maxPage},
+		{"page=9223372036854775807", pageParams{}, "page must be <= "},
+		{"page=0", pageParams{}, "page must be an integer >= 1"},
+		{"page=x", pageParams{}, "page must be an integer >= 1"},
+		{"page=99999999999999999999", pageParams{}, "page must be an integer >= 1"},
+		{"per_page=0", pageParams{}, "per_page must be an integer >= 1"},
+		{"offset=-1", pageParams{}, "offset must be an integer >= 0"},
+		{"page=2&offset=3", pageParams{}, "use either page/per_page or limit/offset"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := paginate(httptest.NewRequest(http.MethodGet, "/api/items?"+tt.query, nil))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("paginate = %+v, want %+v", got, tt.want)
+			}
+			if got.Offset < 0 {
+				t.Errorf("negative offset %d", got.Offset)
+			}
+		})
+	}
+}
+
+func TestPageBounds(t *testing.T) {
+	items := make([]int, 25)
+	tests := []struct {
+		p          pageParams
+		start, end int
+	}{
+		{pageParams{Offset: 0, Limit: 10}, 0, 10},
+		{pageParams{Offset: 20, Limit: 10}, 20, 25},
+		{pageParams{Offset: 30, Limit: 10}, 25, 25},
+		{pageParams{Offset: math.MaxInt, Limit: maxPerPage}, 25, 25},
+	}
+	for _, tt := range tests {
+		start, end := tt.p.bounds(len(items))
+		if start != tt.start || end != tt.end {
+			t.Errorf("bounds(%+v) = [%d, %d), want [%d, %d)", tt.p, start, end, tt.start, tt.end)
+		}
+		_ = items[start:end]
+	}
+}
+
+// فراخوانی writePaginated مثل یک handler لیستی: paginate، bounds و پاسخ
+func servePage(t *testing.T, query string, total int) *httptest.ResponseRecorder {
+	t.Helper()
+	items := make([]int, total)
+	for i := range items {
+		items[i] = i
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/items?"+query, nil)
+	w := httptest.NewRecorder()
+	p, err := paginate(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return w
+	}
+	start, end := p.bounds(total)
+	writePaginated(w, r, p, total, items[start:end])
+	return w
+}
+
+func TestWritePaginated(t *testing.T) {
+	tests := []struct {
+		query      string
+		total      int
+		items      int
+		page       int
+		totalPages int
+		links      []string
+	}{
+		{"page=1&per_page=10", 25, 10, 1, 3, []string{
+			`</api/items?page=1&per_page=10>; rel="first"`,
+			`</api/items?page=2&per_page=10>; rel="next"`,
+			`</api/items?page=3&per_page=10>; rel="last"`,
+		}},
+		{"page=2&per_page=10", 25, 10, 2, 3, []string{
+			`</api/items?page=1&per_page=10>; rel="first"`,
+			`</api/items?page=1&per_page=10>; rel="prev"`,
+			`</api/items?page=3&per_page=10>; rel="next"`,
+			`</api/items?page=3&per_page=10>; rel="last"`,
+		}},
+		{"limit=10&offset=20", 25, 5, 3, 3, []string{
+			`</api/items?limit=10&offset=0>; rel="first"`,
+			`</api/items?limit=10&offset=10>; rel="prev"`,
+			`</api/items?limit=10&offset=20>; rel="last"`,
+		}},
+		{"page=1", 0, 0, 1, 0, nil},
+		{"limit=10&offset=9223372036854775807", 25, 0, math.MaxInt/10 + 1, 3, []string{
+			`</api/items?limit=10&offset=0>; rel="first"`,
+			`</api/items?limit=10&offset=9223372036854775797>; rel="prev"`,
+			`</api/items?limit=10&offset=20>; rel="last"`,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := servePage(t, tt.query, tt.total)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			var body struct {
+				Items      []int          `json:"items"`
+				Pagination paginationMeta `json:"pagination"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Items) != tt.items || body.Pagination.Page != tt.page || body.Pagination.TotalPages != tt.totalPages || body.Pagination.Total != tt.total {
+				t.Errorf("items %d, pagination %+v; want %d items, page %d of %d", len(body.Items), body.Pagination, tt.items, tt.page, tt.totalPages)
+			}
+			if got := w.Header().Get("X-Total-Count"); got != strconv.Itoa(tt.total) {
+				t.Errorf("X-Total-Count = %q", got)
+			}
+			if got, want := w.Header().Get("Link"), strings.Join(tt.links, ", "); got != want {
+				t.Errorf("Link:\n got %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+// صفحه‌ای که offset آن سرریز می‌کرد حالا 400 است، نه panic در items[start:end]
+func TestWritePaginatedHugePage(t *testing.T) {
+	w := servePage(t, "page=9223372036854775807&per_page=10", 25)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log/slog"  // لاگ چرخه‌ی عمر پروسه‌های فرزند
+	"os"        // اجرای دوباره‌ی همین برنامه
+	"os/exec"   // ساختن پروسه‌های فرزند
+	"os/signal" // دریافت سیگنال‌ها در پروسه‌ی والد
+	"sync"      // انتظار برای فرزندها
+	"syscall"   // SIGINT و SIGTERM
+	"time"      // فاصله‌ی راه‌اندازی دوباره
+)
+
+// ================= Prefork =================
+
+// متغیر محیطی که پروسه‌ی فرزند را از والد جدا می‌کند
+const preforkChildEnv = "MINI_HTTP_PREFORK_CHILD"
+
+// اگر فرزندی زودتر از این مدت بعد از شروع بمیرد، با تأخیر دوباره راه‌اندازی می‌شود
+const preforkRestartDelay = time.Second
+
+// isPreforkChild می‌گوید این پروسه یکی از فرزندهای prefork است
+func isPreforkChild() bool {
+	return os.Getenv(preforkChildEnv) == "1"
+}
+
+// runPreforkParent n پروسه‌ی فرزند می‌سازد که هرکدام با SO_REUSEPORT روی همان پورت گوش می‌دهند.
+// والد خودش درخواستی سرو نمی‌کند؛ فقط فرزندهای مرده را دوباره راه می‌اندازد و
+// سیگنال خاموش شدن (یکی از sigs) را به همه می‌رساند. هر فرزند حافظه‌ی جدا دارد (cache، rate limit، آمار و ...).
+func runPreforkParent(n int, sigs []os.Signal) int {
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, sigs...)
+
+	var (
+		mu       sync.Mutex
+		children = make(map[int]*exec.Cmd) // شماره‌ی فرزند → پروسه
+		stopping bool
+		wg       sync.WaitGroup
+		bindFail = make(chan struct{}, 1) // فرزندی نتوانسته پورت را bind کند
+	)
+
+	// start فرزند شماره‌ی i را اجرا می‌کند و بعد از مردن (اگر در حال خاموش شدن نباشیم) دوباره می‌سازد
+	var start func(i int)
+	start = func(i int) {
+		cmd := exec.Command(os.Args[0], os.Args[1:]...)
+		cmd.Env = append(os.Environ(), preforkChildEnv+"=1")
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+
+		mu.Lock()
+		if stopping {
+			mu.Unlock()
+			return
+		}
+		if err := cmd.Start(); err != nil {
+			mu.Unlock()
+			slog.Error("prefork child failed to start", "child", i, "err", err)
+			return
+		}
+		children[i] = cmd
+		mu.Unlock()
+
+		slog.Info("prefork child started", "child", i, "pid", cmd.Process.Pid)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := cmd.Wait()
+
+			mu.Lock()
+			delete(children, i)
+			restart := !stopping
+			mu.Unlock()
+
+			if !restart {
+				slog.Info("prefork child exited", "child", i, "pid", cmd.Process.Pid)
+				return
+			}
+
+			// راه‌اندازی دوباره مشکل پورت را حل نمی‌کند؛ کل سرور متوقف می‌شود
+			if cmd.ProcessState.ExitCode() == exitBindError {
+				slog.Error("prefork child cannot bind, stopping", "child", i, "pid", cmd.Process.Pid)
+				select {
+				case bindFail <- struct{}{}:
+				default:
+				}
+				return
+			}
+
+			slog.Error("prefork child died, restarting", "child", i, "pid", cmd.Process.Pid, "err", err)
+			time.Sleep(preforkRestartDelay)
+			start(i)
+		}()
+	}
+
+	for i := range n {
+		start(i)
+	}
+	slog.Info("prefork parent ready", "children", n, "pid", os.Getpid())
+
+	// سیگنال به همه‌ی فرزندها رسانده می‌شود تا هرکدام graceful shutdown خودش را انجام دهد
+	var sig os.Signal = syscall.SIGTERM
+	code := 0
+	select {
+	case sig = <-sigCh:
+		slog.Info("signal received, stopping prefork children", "signal", sig.String())
+	case <-bindFail:
+		code = exitBindError
+	}
+
+	mu.Lock()
+	stopping = true
+	for _, cmd := range children {
+		_ = cmd.Process.Signal(sig)
+	}
+	mu.Unlock()
+
+	wg.Wait()
+	slog.Info("prefork shutdown complete")
+	return code
+}
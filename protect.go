@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256" // یکسان کردن طول قبل از مقایسه
+	"crypto/subtle" // مقایسه‌ی زمان-ثابت
+	"fmt"           // خطای پیکربندی
+	"net/http"      // هسته HTTP در Go
+	"net/netip"     // لیست IPهای مجاز
+	"slices"        // مرتب کردن قاعده‌ها
+	"strings"       // پارس قاعده‌ها و تطبیق prefix
+)
+
+// ================= Protected Paths =================
+//
+// مسیرهای حساس (/admin/، /debug/ و هر مسیر introspection دیگر) در یک جا محافظت می‌شوند، نه روی
+// تک‌تک routeها. هر prefix در PROTECTED_PATHS یک یا چند شرط دارد که همه باید برقرار باشند:
+//
+//	PROTECTED_PATHS=/admin/=ip+basic,/debug/=ip+token,/metrics=token,/api/kv/=internal
+//
+//	ip       → IP کلاینت در ADMIN_ALLOW_IPS باشد (وگرنه 403)
+//	basic    → basic auth با ADMIN_USER و ADMIN_PASSWORD
+//	token    → هدر ACCESS_TOKEN_HEADER برابر ACCESS_TOKEN باشد
+//	internal → هدر INTERNAL_TOKEN_HEADER برابر INTERNAL_TOKEN باشد (سرویس‌به‌سرویس، جدا از ACCESS_TOKEN
+//	           تا عوض کردن یکی بقیه‌ی کلاینت‌ها را از کار نیندازد)
+//
+// شکست basic، token یا internal همیشه یک پاسخ 401 یکسان می‌گیرد تا معلوم نشود کدام درست بوده است.
+// طولانی‌ترین prefix منطبق برنده است.
+
+// شرط‌های یک قاعده به صورت bit
+type protectCheck uint8
+
+const (
+	protectIP protectCheck = 1 << iota
+	protectBasic
+	protectToken
+	protectInternal
+)
+
+// protectRule شرط‌های لازم برای مسیرهای زیر prefix
+type protectRule struct {
+	prefix string
+	checks protectCheck
+}
+
+// protector قاعده‌ها و اطلاعات لازم برای بررسی آن‌ها
+type protector struct {
+	rules []protectRule // مرتب از طولانی‌ترین prefix
+
+	allowed        []netip.Prefix
+	basic          func(r *http.Request) (string, bool)
+	tokenHeader    string
+	token          [sha256.Size]byte
+	internalHeader string
+	internal       [sha256.Size]byte
+}
+
+// newProtector قاعده‌های cfg.ProtectedPaths را می‌خواند؛ شرطی که داده‌ی لازمش تنظیم نشده
+// (basic بدون ADMIN_PASSWORD، token بدون ACCESS_TOKEN یا internal بدون INTERNAL_TOKEN) خطای پیکربندی است.
+func newProtector(cfg Config, allowed []netip.Prefix) (*protector, error) {
+	p := &protector{
+		allowed:        allowed,
+		basic:          basicAuthCheck(cfg.AdminUser, cfg.AdminPassword),
+		tokenHeader:    cfg.AccessTokenHeader,
+		token:          sha256.Sum256([]byte(cfg.AccessToken)),
+		internalHeader: cfg.InternalTokenHeader,
+		internal:       sha256.Sum256([]byte(cfg.InternalToken)),
+	}
+
+	for prefix, spec := range cfg.ProtectedPaths {
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("PROTECTED_PATHS: prefix must start with /, got %q", prefix)
+		}
+		var checks protectCheck
+		for _, name := range strings.Split(spec, "+") {
+			switch strings.TrimSpace(name) {
+			case "ip":
+				checks |= protectIP
+			case "basic":
+				if cfg.AdminPassword == "" {
+					return nil, fmt.Errorf("PROTECTED_PATHS: %s uses basic but ADMIN_PASSWORD is not set", prefix)
+				}
+				checks |= protectBasic
+			case "token":
+				if cfg.AccessToken == "" {
+					return nil, fmt.Errorf("PROTECTED_PATHS: %s uses token but ACCESS_TOKEN is not set", prefix)
+				}
+				checks |= protectToken
+			case "internal":
+				if cfg.InternalToken == "" {
+					return nil, fmt.Errorf("PROTECTED_PATHS: %s uses internal but INTERNAL_TOKEN is not set", prefix)
+				}
+				checks |= protectInternal
+			default:
+				return nil, fmt.Errorf("PROTECTED_PATHS: %s: unknown check %q (use ip, basic, token, internal joined with +)", prefix, name)
+			}
+		}
+		p.rules = append(p.rules, protectRule{prefix: prefix, checks: checks})
+	}
+
+	slices.SortFunc(p.rules, func(a, b protectRule) int { return len(b.prefix) - len(a.prefix) })
+	return p, nil
+}
+
+// rule قاعده‌ی طولانی‌ترین prefix منطبق با مسیر را برمی‌گرداند
+func (p *protector) rule(path string) (protectRule, bool) {
+	for _, rule := range p.rules {
+		if strings.HasPrefix(path, rule.prefix) {
+			return rule, true
+		}
+	}
+	return protectRule{}, false
+}
+
+// middleware درخواست‌های مسیرهای محافظت‌شده را قبل از router بررسی می‌کند
+func (p *protector) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		rule, ok := p.rule(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// IP راز نیست؛ رد شدن آن جدا (403) گزارش می‌شود
+		if rule.checks&protectIP != 0 {
+			if ip := clientIP(r); !ip.IsValid() || !isTrusted(p.allowed, ip) {
+				requestLogger(r.Context()).Warn("access denied",
+					"clientAddr", logClientAddr(r),
+					"path", r.URL.Path,
+				)
+				writeError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+		}
+
+		// همه‌ی اعتبارنامه‌ها بررسی می‌شوند و نتیجه یکجا اعلام می‌شود
+		authOK := true
+		user := ""
+		if rule.checks&protectBasic != 0 {
+			var ok bool
+			user, ok = p.basic(r)
+			authOK = authOK && ok
+		}
+		if rule.checks&protectToken != 0 {
+			authOK = authOK && headerTokenOK(r, p.tokenHeader, p.token)
+		}
+		if rule.checks&protectInternal != 0 {
+			authOK = authOK && headerTokenOK(r, p.internalHeader, p.internal)
+		}
+		if !authOK {
+			requestLogger(r.Context()).Warn("authentication failed",
+				"user", user,
+				"clientAddr", logClientAddr(r),
+				"path", r.URL.Path,
+			)
+			if rule.checks&protectBasic != 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+			}
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if rule.checks&protectBasic != 0 {
+			r = withAuthUser(r, user)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// headerTokenOK مقدار هدر name را با hash توکن مقایسه می‌کند؛ hash طول‌ها را یکسان می‌کند تا
+// مقایسه‌ی زمان-ثابت طول توکن را هم لو ندهد
+func headerTokenOK(r *http.Request, name string, want [sha256.Size]byte) bool {
+	got := sha256.Sum256([]byte(r.Header.Get(name)))
+	return subtle.ConstantTimeCompare(got[:], want[:]) == 1
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"           // تشخیص لغو درخواست
+	"errors"            // تشخیص لغو درخواست توسط کلاینت
+	"expvar"            // شمارنده‌های هر upstream
+	"fmt"               // پیام خطای تنظیمات
+	"net/http"          // هسته HTTP در Go
+	"net/http/httputil" // reverse proxy آماده
+	"net/url"           // پارس آدرس upstream
+	"strconv"           // وزن upstream
+	"strings"           // جدا کردن وزن از آدرس
+	"sync"              // انتخاب همزمان upstream
+	"time"              // cooldown و زمان پاسخ upstream
+)
+
+// ================= Reverse Proxy =================
+
+// metricهای هر upstream؛ کلید، نام upstream است (host، یا prefix و host برای PROXY_ROUTES)
+var (
+	upstreamRequests = expvar.NewMap("upstream_requests") // تعداد درخواست‌های فرستاده‌شده
+	upstreamErrors   = expvar.NewMap("upstream_errors")   // خطای اتصال یا پاسخ 5xx
+)
+
+// upstreamStartKey زمان ارسال درخواست به upstream را برای Server-Timing نگه می‌دارد
+type upstreamStartKey struct{}
+
+// upstream یک backend با وزن و circuit breaker خودش
+type upstream struct {
+	name    string // host، یا "prefix host" برای routeهای PROXY_ROUTES؛ در metricها، breaker و لاگ
+	weight  int
+	proxy   *httputil.ReverseProxy
+	breaker *circuitBreaker
+	current int // وزن جاری در smooth weighted round-robin
+}
+
+// upstreamPool درخواست‌ها را با weighted round-robin بین upstreamها پخش می‌کند.
+// upstreamی که breaker آن باز است تا پایان cooldown از چرخش خارج می‌شود.
+type upstreamPool struct {
+	mu        sync.Mutex
+	upstreams []*upstream
+	cooldown  time.Duration
+	retries   int           // حداکثر تلاش دوباره برای GET/HEAD
+	backoff   time.Duration // فاصله‌ی اولین تلاش دوباره؛ هر بار دو برابر می‌شود
+
+	// هدرهای درخواست upstream و پاسخ که عوض می‌شوند (PROXY_ROUTES)؛ مقدار خالی یعنی حذف.
+	// فقط قبل از شروع سرور تنظیم می‌شوند.
+	requestHeaders  map[string]string
+	responseHeaders map[string]string
+}
+
+// newUpstreamPool از لیست آدرس‌ها (با وزن اختیاری مثل http://10.0.0.1:9000=3) pool می‌سازد.
+// label (مثلاً prefix یک route) جلوی نام upstreamها در metricها و breakerها می‌آید تا دو pool
+// با upstream یکسان قاطی نشوند؛ خالی برای UPSTREAMS.
+func newUpstreamPool(label string, specs []string, threshold int, cooldown time.Duration, retries int, backoff time.Duration) (*upstreamPool, error) {
+
+	p := &upstreamPool{cooldown: cooldown, retries: retries, backoff: backoff}
+
+	for _, spec := range specs {
+		target, weight, err := parseUpstreamSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		name := target.Host
+		if label != "" {
+			name = label + " " + target.Host
+		}
+		u := &upstream{
+			name:    name,
+			weight:  weight,
+			breaker: newCircuitBreaker(name, threshold, cooldown),
+		}
+		u.proxy = &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.SetXForwarded()
+				if isSecure(pr.In) {
+					// SetXForwarded فقط TLS خود این اتصال را می‌بیند، نه TLS پروکسی جلویی
+					pr.Out.Header.Set("X-Forwarded-Proto", "https")
+				}
+				// upstream همان شناسه را در لاگ خودش ببیند
+				if id := requestIDFromContext(pr.In.Context()); id != "" {
+					pr.Out.Header.Set("X-Request-ID", id)
+				}
+				setHeaders(pr.Out.Header, p.requestHeaders)
+				pr.Out = pr.Out.WithContext(context.WithValue(pr.Out.Context(), upstreamStartKey{}, time.Now()))
+			},
+			ModifyResponse: func(resp *http.Response) error {
+				// X-Request-ID پاسخ همان شناسه‌ی این سرور است، نه مقدار دوم از upstream
+				resp.Header.Del("X-Request-ID")
+				setHeaders(resp.Header, p.responseHeaders)
+
+				// زمان تا رسیدن هدرهای پاسخ upstream در Server-Timing
+				if start, ok := resp.Request.Context().Value(upstreamStartKey{}).(time.Time); ok {
+					addTiming(resp.Request.Context(), "upstream", time.Since(start))
+				}
+				return nil
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				// کلاینت رفته؛ نه خطای upstream است و نه کسی پاسخ 502 را می‌خواند
+				if errors.Is(err, context.Canceled) || isClientDisconnect(err) {
+					return
+				}
+				// timeout route (PROXY_ROUTES) قبل از رسیدن پاسخ upstream تمام شده است
+				if errors.Is(err, context.DeadlineExceeded) {
+					writeServerError(w, http.StatusGatewayTimeout, fmt.Errorf("upstream %s: %w", u.name, err))
+					return
+				}
+				writeServerError(w, http.StatusBadGateway, fmt.Errorf("upstream %s: %w", u.name, err))
+			},
+		}
+
+		p.upstreams = append(p.upstreams, u)
+	}
+
+	if len(p.upstreams) == 0 {
+		return nil, fmt.Errorf("no upstreams configured")
+	}
+	return p, nil
+}
+
+// setHeaders هدرهای set را روی h می‌گذارد؛ مقدار خالی یعنی حذف هدر
+func setHeaders(h http.Header, set map[string]string) {
+	for k, v := range set {
+		if v == "" {
+			h.Del(k)
+		} else {
+			h.Set(k, v)
+		}
+	}
+}
+
+// parseUpstreamSpec آدرس و وزن (پیش‌فرض 1) را از "URL=weight" جدا می‌کند
+func parseUpstreamSpec(spec string) (*url.URL, int, error) {
+
+	weight := 1
+	if i := strings.LastIndex(spec, "="); i >= 0 {
+		// فقط اگر بعد از = عدد باشد وزن است؛ وگرنه بخشی از query آدرس است
+		if w, err := strconv.Atoi(spec[i+1:]); err == nil {
+			if w < 1 {
+				return nil, 0, fmt.Errorf("invalid upstream weight in %q", spec)
+			}
+			spec, weight = spec[:i], w
+		}
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, 0, fmt.Errorf("invalid upstream URL %q", spec)
+	}
+	return u, weight, nil
+}
+
+// pick با smooth weighted round-robin یک upstream سالم انتخاب می‌کند.
+// upstreamهای داخل skip (که breakerشان اجازه نداد) در نظر گرفته نمی‌شوند.
+func (p *upstreamPool) pick(skip map[*upstream]bool) *upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *upstream
+	total := 0
+
+	for _, u := range p.upstreams {
+		if skip[u] || u.breaker.isOpen() {
+			continue
+		}
+		u.current += u.weight
+		total += u.weight
+		if best == nil || u.current > best.current {
+			best = u
+		}
+	}
+
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// acquire یک upstream سالم پیدا می‌کند که breaker آن هم اجازه بدهد؛ nil یعنی هیچ‌کدام.
+// upstreamهای داخل skip کنار گذاشته می‌شوند.
+func (p *upstreamPool) acquire(skip map[*upstream]bool) (*upstream, bool) {
+	for {
+		u := p.pick(skip)
+		if u == nil {
+			return nil, false
+		}
+
+		ok, probe := u.breaker.allow()
+		if !ok {
+			skip[u] = true // مثلاً در half-open درخواست آزمایشی دیگری در جریان است
+			continue
+		}
+		return u, probe
+	}
+}
+
+func (p *upstreamPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	retries := 0
+	if retryable(r) {
+		retries = p.retries
+	}
+
+	var failed *upstream // upstreamی که تلاش قبلی روی آن شکست خورد
+	for attempt := 0; ; attempt++ {
+
+		// تلاش دوباره ترجیحاً روی upstream بعدی؛ اگر upstream دیگری نباشد همان قبلی
+		u, probe := p.acquire(map[*upstream]bool{failed: true})
+		if u == nil && failed != nil {
+			u, probe = p.acquire(make(map[*upstream]bool, len(p.upstreams)))
+		}
+		if u == nil {
+			// همه‌ی upstreamها فعلاً خراب هستند؛ درخواست منتظر نمی‌ماند
+			writeRetryError(w, http.StatusServiceUnavailable, "Upstream unavailable", p.cooldown)
+			return
+		}
+		if attempt > 0 {
+			upstreamRetries.Add(u.name, 1)
+		}
+
+		// آخرین تلاش مستقیم به کلاینت نوشته می‌شود؛ بقیه تا معلوم شدن status نگه داشته می‌شوند
+		if attempt >= retries {
+			status := p.forward(w, r, u, probe)
+			if attempt > 0 && retryableStatus(status) && r.Context().Err() == nil {
+				upstreamRetriesExhausted.Add(1)
+				requestLogger(r.Context()).Warn("upstream retries exhausted",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"attempts", attempt+1,
+					"status", status,
+				)
+			}
+			return
+		}
+
+		rw := newRetryWriter(w)
+		p.forward(rw, r, u, probe)
+		if !rw.discarded || r.Context().Err() != nil {
+			return // پاسخ (موفق یا خطای غیرقابل تکرار) به کلاینت رسیده یا کلاینت رفته است
+		}
+		failed = u
+
+		// backoff نمایی؛ اگر تا deadline درخواست وقت کافی نمانده، تلاش دیگری نمی‌شود
+		wait := p.backoff << attempt
+		if deadline, ok := r.Context().Deadline(); ok && time.Until(deadline) <= wait {
+			upstreamRetriesExhausted.Add(1)
+			requestLogger(r.Context()).Warn("upstream retries stopped, request deadline too close",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"attempts", attempt+1,
+			)
+			writeError(w, rw.status, http.StatusText(rw.status))
+			return
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// forward درخواست را به u می‌فرستد، نتیجه را در breaker و metricها ثبت می‌کند و status پاسخ را برمی‌گرداند
+func (p *upstreamPool) forward(w http.ResponseWriter, r *http.Request, u *upstream, probe bool) int {
+
+	upstreamRequests.Add(u.name, 1)
+
+	rec := newStatusRecorder(w)
+	u.proxy.ServeHTTP(rec, r)
+
+	// اگر کلاینت خودش رفته باشد، نتیجه چیزی درباره‌ی سلامت upstream نمی‌گوید؛
+	// ولی upstreamی که به timeout route نرسیده (504) خطا حساب می‌شود
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		u.breaker.release(probe)
+		return rec.status
+	}
+
+	success := rec.status < 500
+	if !success {
+		upstreamErrors.Add(u.name, 1)
+	}
+	u.breaker.done(probe, success)
+	return rec.status
+}
+
+// healthCheck خطا برمی‌گرداند اگر breaker همه‌ی upstreamها باز باشد
+func (p *upstreamPool) healthCheck(ctx context.Context) error {
+	for _, u := range p.upstreams {
+		if !u.breaker.isOpen() {
+			return nil
+		}
+	}
+	return fmt.Errorf("all %d upstreams are unavailable", len(p.upstreams))
+}
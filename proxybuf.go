@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"               // پیام خطای تنظیمات
+	"net/http/httputil" // رابط BufferPool
+	"sync"              // pool بافرها
+	"time"              // فاصله‌ی flush
+)
+
+// ================= Proxy Buffers =================
+
+// پیش‌فرض PROXY_BUFFER_SIZE؛ همان اندازه‌ای که ReverseProxy بدون BufferPool برای هر پاسخ می‌سازد
+const defaultProxyBufferSize = 32 << 10
+
+// proxyBufferPool بافرهای کپی body پاسخ upstream را بین درخواست‌ها دوباره استفاده می‌کند؛
+// بدون آن ReverseProxy برای هر پاسخ یک بافر تازه می‌سازد. همه‌ی poolهای upstream یکی را مشترک دارند.
+type proxyBufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+var _ httputil.BufferPool = (*proxyBufferPool)(nil)
+
+// newProxyBufferPool یک pool با بافرهای size بایتی می‌سازد
+func newProxyBufferPool(size int) *proxyBufferPool {
+	p := &proxyBufferPool{size: size}
+	p.pool.New = func() any {
+		b := make([]byte, size)
+		return &b
+	}
+	return p
+}
+
+func (p *proxyBufferPool) Get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+func (p *proxyBufferPool) Put(b []byte) {
+	if cap(b) != p.size {
+		return // بافری که از این pool نیامده
+	}
+	b = b[:p.size]
+	p.pool.Put(&b)
+}
+
+// proxyFlushImmediate مقدار FlushInterval برای flush بعد از هر Write (مثل SSE)
+const proxyFlushImmediate = -1
+
+// parseFlushInterval مقدار PROXY_FLUSH_INTERVAL یا گزینه‌ی flush در PROXY_ROUTES را می‌خواند:
+// "immediate" یعنی flush بعد از هر Write، صفر یعنی فقط وقتی بافر پر شود (پاسخ‌های text/event-stream
+// و بدون Content-Length را ReverseProxy در هر حال فوراً flush می‌کند) و مدت مثبت یعنی flush دوره‌ای.
+func parseFlushInterval(v string) (time.Duration, error) {
+	if v == "immediate" {
+		return proxyFlushImmediate, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid flush interval %q (duration or immediate)", v)
+	}
+	return d, nil
+}
+
+// tune فاصله‌ی flush و pool بافر را روی proxy همه‌ی upstreamها می‌گذارد؛ فقط قبل از شروع سرور
+func (p *upstreamPool) tune(flush time.Duration, buffers httputil.BufferPool) {
+	for _, u := range p.upstreams {
+		u.proxy.FlushInterval = flush
+		u.proxy.BufferPool = buffers
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"expvar"   // شمارنده‌های تلاش دوباره
+	"net/http" // هسته HTTP در Go
+)
+
+// ================= Proxy Retries =================
+
+// metricهای تلاش دوباره در /debug/vars (و /admin/vars)
+var (
+	upstreamRetries          = expvar.NewMap("upstream_retries")           // تلاش‌های دوباره بر اساس host upstream
+	upstreamRetriesExhausted = expvar.NewInt("upstream_retries_exhausted") // درخواست‌هایی که همه‌ی تلاش‌هایشان شکست خورد
+)
+
+// retryable می‌گوید درخواست را می‌شود بدون عوارض دوباره فرستاد: فقط GET و HEAD بدون body.
+// POST و بقیه‌ی متدها هیچ‌وقت تکرار نمی‌شوند چون ممکن است upstream آن‌ها را اجرا کرده باشد.
+func retryable(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return r.ContentLength == 0 && len(r.TransferEncoding) == 0 // body یک بار خوانده می‌شود
+}
+
+// retryableStatus پاسخ‌های گذرای upstream؛ خطای اتصال هم با ErrorHandler به 502 تبدیل می‌شود
+func retryableStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// retryWriter پاسخ یک تلاش را تا رسیدن status نگه می‌دارد: status قابل تکرار دور ریخته می‌شود
+// و هر status دیگری همان لحظه (بدون بافر کردن body) به کلاینت می‌رسد.
+type retryWriter struct {
+	http.ResponseWriter
+	header    http.Header // هدرهای upstream تا تصمیم درباره‌ی پاسخ
+	status    int
+	committed bool // پاسخ به کلاینت فرستاده شده
+	discarded bool // پاسخ دور ریخته شده و تلاش دوباره لازم است
+}
+
+func newRetryWriter(w http.ResponseWriter) *retryWriter {
+	return &retryWriter{ResponseWriter: w, header: make(http.Header)}
+}
+
+func (rw *retryWriter) Header() http.Header {
+	if rw.committed {
+		return rw.ResponseWriter.Header() // مثلاً trailerها بعد از body
+	}
+	return rw.header
+}
+
+func (rw *retryWriter) WriteHeader(status int) {
+	if rw.committed || rw.discarded {
+		return
+	}
+	if status < http.StatusOK {
+		return // 1xx (مثل 103) در تلاشی که شاید دور ریخته شود فرستاده نمی‌شود
+	}
+
+	rw.status = status
+	if retryableStatus(status) {
+		rw.discarded = true
+		return
+	}
+
+	rw.committed = true
+	h := rw.ResponseWriter.Header()
+	for k, vv := range rw.header {
+		for _, v := range vv {
+			h.Add(k, v) // مثل ReverseProxy کنار هدرهایی که middlewareها گذاشته‌اند
+		}
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *retryWriter) Write(p []byte) (int, error) {
+	if !rw.committed && !rw.discarded {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.discarded {
+		return len(p), nil
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// Flush برای پاسخ‌های streaming (مثل SSE) که ReverseProxy فوراً flush می‌کند
+func (rw *retryWriter) Flush() {
+	if rw.committed {
+		_ = http.NewResponseController(rw.ResponseWriter).Flush()
+	}
+}
+
+// Unwrap برای http.ResponseController
+func (rw *retryWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"           // timeout هر route
+	"fmt"               // پیام خطای تنظیمات
+	"net/http"          // هسته HTTP در Go
+	"net/http/httputil" // pool بافر مشترک
+	"net/url"           // حذف رمز از آدرس upstream در لاگ
+	"strings"           // پارس تنظیمات route
+	"time"              // timeout هر route
+)
+
+// ================= Proxy Routes =================
+//
+// PROXY_ROUTES جدول prefix → upstream است، مثل location در nginx؛ هر route pool، circuit breaker
+// و retry خودش را دارد (با همان BREAKER_* و PROXY_RETRIES) و بدون تغییر کد اضافه می‌شود:
+//
+//	PROXY_ROUTES=/users/=http://users:8080;strip;timeout=5s,/legacy/=http://a:80|http://b:80=3;header=X-Env:prod
+//
+// بخش اول آدرس upstreamها با "|" (وزن اختیاری مثل UPSTREAMS) و بعد گزینه‌ها با ";":
+//
+//	strip                  → prefix قبل از ارسال حذف شود (/users/42 → /42)
+//	timeout=5s             → deadline کل درخواست؛ upstream کندتر 504 می‌گیرد و برای breaker خطا است
+//	header=Name:Value      → هدر درخواست upstream؛ Name: بدون مقدار یعنی حذف
+//	resp-header=Name:Value → هدر پاسخ به کلاینت؛ Name: بدون مقدار یعنی حذف
+//	flush=immediate        → مثل PROXY_FLUSH_INTERVAL فقط برای این route (immediate یا مدت)
+
+// proxyRoute تنظیمات پارس‌شده‌ی یک route
+type proxyRoute struct {
+	prefix          string
+	upstreams       []string
+	strip           bool
+	timeout         time.Duration
+	flush           time.Duration // فقط اگر hasFlush؛ وگرنه PROXY_FLUSH_INTERVAL
+	hasFlush        bool
+	requestHeaders  map[string]string
+	responseHeaders map[string]string
+}
+
+// parseProxyRoute مقدار یک route از PROXY_ROUTES را می‌خواند
+func parseProxyRoute(prefix, spec string) (proxyRoute, error) {
+	if !strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") || prefix == "/" {
+		return proxyRoute{}, fmt.Errorf("prefix must look like /name/, got %q", prefix)
+	}
+
+	parts := strings.Split(spec, ";")
+	pr := proxyRoute{prefix: prefix, requestHeaders: map[string]string{}, responseHeaders: map[string]string{}}
+	for _, u := range strings.Split(parts[0], "|") {
+		if u = strings.TrimSpace(u); u != "" {
+			pr.upstreams = append(pr.upstreams, u)
+		}
+	}
+
+	for _, opt := range parts[1:] {
+		name, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		switch name {
+		case "strip":
+			pr.strip = true
+		case "timeout":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return proxyRoute{}, fmt.Errorf("%s: invalid timeout %q", prefix, value)
+			}
+			pr.timeout = d
+		case "flush":
+			d, err := parseFlushInterval(value)
+			if err != nil {
+				return proxyRoute{}, fmt.Errorf("%s: %w", prefix, err)
+			}
+			pr.flush, pr.hasFlush = d, true
+		case "header", "resp-header":
+			k, v, ok := strings.Cut(value, ":")
+			if k = strings.TrimSpace(k); !ok || k == "" {
+				return proxyRoute{}, fmt.Errorf("%s: %s must look like Name:Value, got %q", prefix, name, value)
+			}
+			if name == "header" {
+				pr.requestHeaders[http.CanonicalHeaderKey(k)] = strings.TrimSpace(v)
+			} else {
+				pr.responseHeaders[http.CanonicalHeaderKey(k)] = strings.TrimSpace(v)
+			}
+		default:
+			return proxyRoute{}, fmt.Errorf("%s: unknown option %q (supported: strip, timeout, flush, header, resp-header)", prefix, opt)
+		}
+	}
+	return pr, nil
+}
+
+// handler pool این route را با strip و timeout می‌سازد؛ buffers بین همه‌ی routeها مشترک است
+func (pr proxyRoute) handler(cfg Config, buffers httputil.BufferPool) (*upstreamPool, http.Handler, error) {
+	pool, err := newUpstreamPool(pr.prefix, pr.upstreams, cfg.BreakerThreshold, cfg.BreakerCooldown, cfg.ProxyRetries, cfg.ProxyRetryWait)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", pr.prefix, err)
+	}
+	pool.requestHeaders, pool.responseHeaders = pr.requestHeaders, pr.responseHeaders
+	flush := cfg.ProxyFlush
+	if pr.hasFlush {
+		flush = pr.flush
+	}
+	pool.tune(flush, buffers)
+
+	var h http.Handler = pool
+	if pr.strip {
+		h = http.StripPrefix(strings.TrimSuffix(pr.prefix, "/"), h)
+	}
+	if pr.timeout > 0 {
+		h = proxyTimeout(pr.timeout, h)
+	}
+	return pool, h, nil
+}
+
+// proxyTimeout به درخواست deadline می‌دهد؛ برخلاف timeoutMiddleware پاسخ را بافر نمی‌کند
+// تا پاسخ‌های بزرگ و streaming upstream مستقیم به کلاینت برسند
+func proxyTimeout(d time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// redactProxyRoute رمز داخل آدرس upstreamهای یک route را برای لاگ حذف می‌کند
+func redactProxyRoute(spec string) string {
+	upstreams, opts, hasOpts := strings.Cut(spec, ";")
+	list := strings.Split(upstreams, "|")
+	for i, u := range list {
+		if parsed, err := url.Parse(strings.TrimSpace(u)); err == nil {
+			list[i] = parsed.Redacted()
+		}
+	}
+	out := strings.Join(list, "|")
+	if hasOpts {
+		out += ";" + opts
+	}
+	return out
+}
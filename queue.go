@@ -0,0 +1,119 @@
+package main
+
+import (
+	"expvar"   // metricهای صف در /debug/vars
+	"net/http" // هسته HTTP در Go
+	"time"     // مدت انتظار در صف
+)
+
+// ================= Request Queue =================
+
+// metricهای صف در /debug/vars (و /admin/vars)
+var (
+	queueActive   = expvar.NewInt("queue_active")    // درخواست‌هایی که الان slot دارند
+	queueWaiting  = expvar.NewInt("queue_waiting")   // عمق فعلی صف
+	queueRejected = expvar.NewMap("queue_rejected")  // ردشده‌ها بر اساس علت: full یا timeout
+	queueWait     = expvar.NewMap("queue_wait")      // count و total_ms انتظار درخواست‌هایی که slot گرفته‌اند
+	queueCanceled = expvar.NewInt("queue_cancelled") // کلاینت‌هایی که قبل از گرفتن slot رفته‌اند
+)
+
+// مسیرهایی که هیچ‌وقت پشت صف نمی‌مانند تا probeها و ادمین زیر بار هم جواب بگیرند
+var queueExempt = []string{"/admin/", "/debug/", "/health", "/readyz", "/livez"}
+
+// requestQueue تعداد درخواست‌های همزمان را به ظرفیت slots محدود می‌کند.
+// درخواست اضافه تا timeout برای slot صبر می‌کند و فقط وقتی صف انتظار هم پر باشد فوراً 503 می‌گیرد.
+type requestQueue struct {
+	slots    chan struct{} // هر عضو یک درخواست در حال اجرا
+	waiting  chan struct{} // هر عضو یک درخواست در صف انتظار
+	timeout  time.Duration // حداکثر انتظار برای slot
+	disabled bool
+}
+
+// newRequestQueue صفی با maxActive درخواست همزمان و حداکثر maxWaiting درخواست منتظر می‌سازد؛
+// maxActive صفر یعنی خاموش
+func newRequestQueue(maxActive, maxWaiting int, timeout time.Duration) *requestQueue {
+	if maxActive == 0 {
+		return &requestQueue{disabled: true}
+	}
+	return &requestQueue{
+		slots:   make(chan struct{}, maxActive),
+		waiting: make(chan struct{}, maxWaiting),
+		timeout: timeout,
+	}
+}
+
+// middleware درخواست را تا گرفتن slot نگه می‌دارد؛ لغو context کلاینت جای او را در صف آزاد می‌کند
+func (q *requestQueue) middleware(next http.Handler) http.Handler {
+	if q.disabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if hasAnyPrefix(r.URL.Path, queueExempt) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !q.acquire(w, r) {
+			return
+		}
+		queueActive.Add(1)
+		defer func() {
+			queueActive.Add(-1)
+			<-q.slots
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire یک slot می‌گیرد؛ false یعنی پاسخ (503) داده شده یا کلاینت رفته است
+func (q *requestQueue) acquire(w http.ResponseWriter, r *http.Request) bool {
+
+	// مسیر سریع: slot آزاد است
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	// صف انتظار هم پر است؛ منتظر ماندن فقط بار را بیشتر می‌کند
+	select {
+	case q.waiting <- struct{}{}:
+	default:
+		queueRejected.Add("full", 1)
+		q.reject(w, "Server is busy, please retry")
+		return false
+	}
+	queueWaiting.Add(1)
+	defer func() {
+		queueWaiting.Add(-1)
+		<-q.waiting
+	}()
+
+	start := time.Now()
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+
+	select {
+	case q.slots <- struct{}{}:
+		queueWait.Add("count", 1)
+		queueWait.Add("total_ms", time.Since(start).Milliseconds())
+		return true
+
+	case <-timer.C:
+		queueRejected.Add("timeout", 1)
+		q.reject(w, "Server is busy, timed out waiting for a free slot")
+		return false
+
+	case <-r.Context().Done():
+		queueCanceled.Add(1) // پاسخی لازم نیست؛ کلاینت دیگر منتظر نیست
+		return false
+	}
+}
+
+// reject پاسخ 503 را با Retry-After برابر مدت انتظار صف می‌فرستد
+func (q *requestQueue) reject(w http.ResponseWriter, msg string) {
+	writeRetryError(w, http.StatusServiceUnavailable, msg, q.timeout)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"   // توقف goroutine پاک‌سازی در خاموش‌سازی
+	"math"      // محاسبه‌ی زمان انتظار
+	"net/http"  // هسته HTTP در Go
+	"net/netip" // کلید bucket هر IP
+	"sync"      // دسترسی همزمان امن به bucketها
+	"time"      // پر شدن دوباره‌ی tokenها
+)
+
+// ================= Rate Limit Middleware =================
+
+// bucketهایی که این مدت استفاده نشده‌اند پاک می‌شوند
+const rateLimitIdleTTL = 3 * time.Minute
+
+// token bucket یک IP
+type bucket struct {
+	tokens float64   // tokenهای باقی‌مانده
+	last   time.Time // آخرین به‌روزرسانی
+}
+
+// rateLimiter برای هر IP یک token bucket نگه می‌دارد.
+// نرخ و ظرفیت در هر درخواست از RuntimeConfig خوانده می‌شود تا تغییرشان فوری اثر کند.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[netip.Addr]*bucket
+}
+
+// newRateLimiter limiter را می‌سازد و goroutine پاک‌سازی bucketهای قدیمی را تا لغو ctx راه می‌اندازد
+func newRateLimiter(ctx context.Context) *rateLimiter {
+	l := &rateLimiter{buckets: make(map[netip.Addr]*bucket)}
+
+	runEvery(ctx, time.Minute, l.cleanup)
+
+	return l
+}
+
+// allow یک token برای ip مصرف می‌کند؛ اگر token نبود، مدت انتظار را برمی‌گرداند
+func (l *rateLimiter) allow(ip netip.Addr, rps float64, burst int) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[ip] = b
+	}
+
+	// پر شدن tokenها به نسبت زمان گذشته، حداکثر تا ظرفیت
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rps)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / rps * float64(time.Second))
+	return false, wait
+}
+
+// cleanup bucketهای بی‌استفاده را حذف می‌کند تا حافظه بی‌حد رشد نکند
+func (l *rateLimiter) cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ip, b := range l.buckets {
+		if time.Since(b.last) > rateLimitIdleTTL {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// middleware درخواست‌های بیش از حد هر IP را با 429 رد می‌کند
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		rc := runtimeCfg.Load()
+		if rc.RateLimitRPS <= 0 {
+			next.ServeHTTP(w, r) // محدودیت خاموش است
+			return
+		}
+
+		ok, wait := l.allow(clientIP(r), rc.RateLimitRPS, rc.RateLimitBurst)
+		if !ok {
+			writeRetryError(w, http.StatusTooManyRequests, "Too Many Requests", wait)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
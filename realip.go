@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"   // ذخیره‌ی IP واقعی در context درخواست
+	"fmt"       // برای پیام خطای CIDR نامعتبر
+	"net"       // جدا کردن host و port
+	"net/http"  // هسته HTTP در Go
+	"net/netip" // پارس و مقایسه‌ی IP و CIDR
+	"strconv"   // پارس port کلاینت
+	"strings"   // کار با هدرها
+)
+
+// ================= Real IP Middleware =================
+
+// کلید context برای آدرس واقعی کلاینت (IP و در صورت وجود port)
+type clientAddrKey struct{}
+
+// کلید context برای امن بودن (HTTPS) اتصال کلاینت
+type secureKey struct{}
+
+// parsePrefixes لیست CIDR (یا IP تکی) را پارس می‌کند، مثل TRUSTED_PROXIES
+func parsePrefixes(list []string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, item := range list {
+
+		// IP تکی هم مجاز است (معادل /32 یا /128)
+		if addr, err := netip.ParseAddr(item); err == nil {
+			out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		p, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", item)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+// isTrusted بررسی می‌کند آدرس داخل یکی از رنج‌های مورد اعتماد باشد
+func isTrusted(trusted []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// realIPMiddleware آدرس واقعی کلاینت و امن بودن اتصال او را پیدا و در context ذخیره می‌کند.
+// هدرهای X-Forwarded-For و X-Forwarded-Proto فقط وقتی پذیرفته می‌شوند که اتصال از یک پروکسی مورد اعتماد باشد.
+// port کلاینت هم نگه داشته می‌شود (برای ردگیری کلاینت‌های پشت NAT)؛ پشت پروکسی فقط اگر در XFF آمده باشد.
+func realIPMiddleware(trusted []netip.Prefix) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			addr := remoteAddrPort(r.RemoteAddr)
+			secure := r.TLS != nil
+
+			// فقط پشت پروکسی مورد اعتماد به XFF و XFP نگاه می‌کنیم
+			if addr.Addr().IsValid() && isTrusted(trusted, addr.Addr()) {
+				if fwd, ok := forwardedClientAddr(r.Header.Values("X-Forwarded-For"), trusted); ok {
+					addr = fwd // port پروکسی ربطی به کلاینت ندارد؛ اگر XFF port نداشت صفر (نامعلوم) می‌ماند
+				}
+				if proto, ok := forwardedProto(r.Header.Values("X-Forwarded-Proto")); ok {
+					secure = proto == "https" // پروکسی TLS را خودش تمام کرده است
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), clientAddrKey{}, addr)
+			ctx = context.WithValue(ctx, secureKey{}, secure)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// forwardedClientAddr زنجیره‌ی XFF را از راست پیمایش می‌کند و
+// اولین آدرسی را که پروکسی مورد اعتماد نیست برمی‌گرداند
+func forwardedClientAddr(values []string, trusted []netip.Prefix) (netip.AddrPort, bool) {
+
+	var hops []string
+	for _, v := range values {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseForwardedHop(strings.TrimSpace(hops[i]))
+		if !ok {
+			return netip.AddrPort{}, false // هدر خراب؛ به RemoteAddr برمی‌گردیم
+		}
+		if !isTrusted(trusted, addr.Addr()) {
+			return addr, true
+		}
+	}
+	return netip.AddrPort{}, false
+}
+
+// parseForwardedHop یک عضو XFF را پارس می‌کند؛ بعضی پروکسی‌ها port کلاینت را هم می‌فرستند
+// (1.2.3.4:5678 یا [2001:db8::1]:5678). بدون port، port صفر یعنی نامعلوم.
+func parseForwardedHop(hop string) (netip.AddrPort, bool) {
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return netip.AddrPortFrom(addr.Unmap(), 0), true
+	}
+	ap, err := netip.ParseAddrPort(hop)
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()), true
+}
+
+// forwardedProto پروتکل کلاینت را از X-Forwarded-Proto می‌خواند. مثل XFF فقط راست‌ترین مقدار (در همه‌ی
+// خط‌های هدر) معتبر است: آن را پروکسی مورد اعتماد گذاشته؛ پروکسی‌ای که به‌جای بازنویسی اضافه می‌کند، مقدار
+// دلخواه کلاینت (مثلاً https روی اتصال HTTP ساده) را در سمت چپ نگه می‌دارد. مقدار ناشناخته نادیده گرفته می‌شود.
+func forwardedProto(values []string) (string, bool) {
+	if len(values) == 0 {
+		return "", false
+	}
+	last := values[len(values)-1]
+	if i := strings.LastIndexByte(last, ','); i >= 0 {
+		last = last[i+1:]
+	}
+	proto := strings.ToLower(strings.TrimSpace(last))
+	if proto != "http" && proto != "https" {
+		return "", false
+	}
+	return proto, true
+}
+
+// remoteAddrPort آدرس r.RemoteAddr (به شکل host:port) را پارس می‌کند؛ بدون port، port صفر است
+func remoteAddrPort(remoteAddr string) netip.AddrPort {
+	host, portStr, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host, portStr = remoteAddr, ""
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.AddrPort{}
+	}
+	port, _ := strconv.ParseUint(portStr, 10, 16) // port خراب یا خالی یعنی نامعلوم
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port))
+}
+
+// ================= IP Anonymization =================
+
+// اگر true باشد IPها قبل از لاگ شدن ناشناس می‌شوند (LOG_ANONYMIZE_IP)؛
+// فقط یک بار در شروع برنامه تنظیم می‌شود
+var anonymizeLogIPs bool
+
+// anonymizeIP برای رعایت حریم خصوصی (GDPR)، بخش آخر IP را صفر می‌کند:
+// در IPv4 اکتت آخر (/24) و در IPv6 هشتاد بیت آخر (/48).
+// هر جا IP لاگ یا ذخیره می‌شود باید از این تابع عبور کند؛ rate limit و بقیه‌ی
+// منطق داخلی همچنان از IP کامل استفاده می‌کنند.
+func anonymizeIP(ip netip.Addr) netip.Addr {
+	if !anonymizeLogIPs || !ip.IsValid() {
+		return ip
+	}
+
+	bits := 48
+	if ip.Is4() {
+		bits = 24
+	}
+
+	p, err := ip.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return p.Addr()
+}
+
+// clientAddr آدرس واقعی کلاینت (IP و port) را که realIPMiddleware پیدا کرده برمی‌گرداند؛
+// port صفر یعنی نامعلوم (مثلاً پشت پروکسی‌ای که port را در XFF نمی‌فرستد)
+func clientAddr(r *http.Request) netip.AddrPort {
+	if addr, ok := r.Context().Value(clientAddrKey{}).(netip.AddrPort); ok {
+		return addr
+	}
+	return remoteAddrPort(r.RemoteAddr) // اگر middleware روی مسیر نبود
+}
+
+// clientIP فقط IP واقعی کلاینت را برمی‌گرداند (برای rate limit، ACL و GeoIP)
+func clientIP(r *http.Request) netip.Addr {
+	return clientAddr(r).Addr()
+}
+
+// logClientAddr مقدار فیلد clientAddr در لاگ‌ها: IP (در صورت نیاز ناشناس‌شده) همراه با port اگر معلوم باشد،
+// مثل 203.0.113.7:51234 یا [2001:db8::1]:51234
+func logClientAddr(r *http.Request) string {
+	addr := clientAddr(r)
+	ip := anonymizeIP(addr.Addr())
+	if addr.Port() == 0 || !ip.IsValid() {
+		return ip.String()
+	}
+	return netip.AddrPortFrom(ip, addr.Port()).String()
+}
+
+// isSecure بررسی می‌کند کلاینت از HTTPS استفاده کرده باشد؛ مستقیم (TLS) یا
+// پشت پروکسی مورد اعتمادی که X-Forwarded-Proto: https فرستاده است
+func isSecure(r *http.Request) bool {
+	if secure, ok := r.Context().Value(secureKey{}).(bool); ok {
+		return secure
+	}
+	return r.TLS != nil // اگر middleware روی مسیر نبود
+}
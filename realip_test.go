@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestForwardedProto(t *testing.T) {
+	tests := []struct {
+		values []string
+		proto  string
+		ok     bool
+	}{
+		{nil, "", false},
+		{[]string{"https"}, "https", true},
+		{[]string{"HTTP"}, "http", true},
+		{[]string{" https "}, "https", true},
+		{[]string{"https, http"}, "http", true},
+		{[]string{"http,https"}, "https", true},
+		{[]string{"https", "http"}, "http", true},
+		{[]string{"http", "https"}, "https", true},
+		{[]string{"https", "ws"}, "", false},
+		{[]string{"https,"}, "", false},
+	}
+	for _, tt := range tests {
+		proto, ok := forwardedProto(tt.values)
+		if proto != tt.proto || ok != tt.ok {
+			t.Errorf("forwardedProto(%q) = %q, %v; want %q, %v", tt.values, proto, ok, tt.proto, tt.ok)
+		}
+	}
+}
+
+// کلاینت HTTP ساده نمی‌تواند با X-Forwarded-Proto خودش (که پروکسی به آن اضافه کرده) امن حساب شود
+func TestRealIPMiddlewareForwardedProto(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name   string
+		remote string
+		values []string
+		secure bool
+	}{
+		{"proxy sets https", "10.0.0.1:1234", []string{"https"}, true},
+		{"client value appended by proxy", "10.0.0.1:1234", []string{"https, http"}, false},
+		{"client line then proxy line", "10.0.0.1:1234", []string{"https", "http"}, false},
+		{"proxy appends https", "10.0.0.1:1234", []string{"http, https"}, true},
+		{"untrusted peer", "203.0.113.9:1234", []string{"https"}, false},
+		{"unknown value keeps the connection's", "10.0.0.1:1234", []string{"https, gopher"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var secure bool
+			h := realIPMiddleware(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				secure = isSecure(r)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.values {
+				r.Header.Add("X-Forwarded-Proto", v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if secure != tt.secure {
+				t.Errorf("isSecure = %v, want %v", secure, tt.secure)
+			}
+		})
+	}
+}
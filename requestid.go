@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"      // نگه‌داری شناسه در context
+	"crypto/rand"  // ساختن شناسه‌ی تصادفی
+	"encoding/hex" // تبدیل شناسه به رشته
+	"net/http"     // هسته HTTP در Go
+)
+
+// ================= Request ID =================
+
+// کلید شناسه‌ی درخواست در context
+type requestIDKey struct{}
+
+// حداکثر طول شناسه‌ای که از کلاینت یا پروکسی جلویی پذیرفته می‌شود
+const maxRequestIDLen = 128
+
+// requestIDMiddleware به هر درخواست یک شناسه می‌دهد و آن را در هدر X-Request-ID پاسخ برمی‌گرداند.
+// اگر پروکسی جلویی شناسه فرستاده باشد (و معتبر باشد) همان استفاده می‌شود تا لاگ‌ها به هم وصل شوند.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		// نگه‌دارنده‌ی فیلدهای لاگ همین‌جا ساخته می‌شود تا middlewareهای بعدی فیلد اضافه کنند
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = withLogFields(ctx, "request_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDFromContext شناسه‌ی درخواست را برمی‌گرداند (یا "" اگر نباشد)
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID فقط شناسه‌های کوتاه با کاراکترهای قابل چاپ را می‌پذیرد تا لاگ‌ها آلوده نشوند
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID یک شناسه‌ی تصادفی ۱۶ کاراکتری می‌سازد
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
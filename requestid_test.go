@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// logEntries خط‌های JSON لاگ‌های جمع‌شده با captureLogs را پارس می‌کند
+func logEntries(t *testing.T, logs *logBuffer) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("log line is not JSON: %v\n%s", err, line)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// یک خطای واقعی (upstream در دسترس نیست → 502) از کل زنجیره‌ی middlewareها: همان شناسه در هدر و body
+// پاسخ، خط access log، لاگ خطا و آخرین نمونه‌ی request_errors_last_id دیده می‌شود
+func TestRequestIDCorrelatesError(t *testing.T) {
+	logs := captureLogs(t)
+
+	// آدرسی که هیچ‌کس روی آن گوش نمی‌دهد
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := "http://" + ln.Addr().String()
+	ln.Close()
+
+	a, _ := newTestApp(t, map[string]string{"UPSTREAMS": dead})
+	ts := httptest.NewServer(a.handler)
+	t.Cleanup(ts.Close)
+
+	resp, err := http.Get(ts.URL + "/proxy/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", resp.StatusCode)
+	}
+	id := resp.Header.Get("X-Request-ID")
+	if id == "" {
+		t.Fatal("X-Request-ID missing")
+	}
+
+	var body apiError
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if body.RequestID != id {
+		t.Errorf("body request_id = %q, want %q", body.RequestID, id)
+	}
+
+	var access, errorLog map[string]any
+	for _, e := range logEntries(t, logs) {
+		switch msg, _ := e["msg"].(string); {
+		case strings.Contains(msg, "GET /proxy/orders"):
+			access = e
+		case msg == "server error":
+			errorLog = e
+		}
+	}
+	if access == nil || errorLog == nil {
+		t.Fatalf("missing access or error log line:\n%s", logs)
+	}
+	if access["request_id"] != id {
+		t.Errorf("access log request_id = %v, want %q", access["request_id"], id)
+	}
+	if errorLog["request_id"] != id {
+		t.Errorf("error log request_id = %v, want %q", errorLog["request_id"], id)
+	}
+	if errorLog["level"] != "ERROR" {
+		t.Errorf("error log level = %v", errorLog["level"])
+	}
+
+	if last, ok := requestErrorsID.Get("502").(*expvar.String); !ok || last.Value() != id {
+		t.Errorf("request_errors_last_id[502] = %v, want %q", requestErrorsID.Get("502"), id)
+	}
+}
+
+// شناسه‌ی معتبر کلاینت همان شناسه‌ی پاسخ و لاگ‌ها می‌ماند
+func TestRequestIDFromClient(t *testing.T) {
+	logs := captureLogs(t)
+	a, _ := newTestApp(t, nil)
+	ts := httptest.NewServer(a.handler)
+	t.Cleanup(ts.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/does-not-exist", nil)
+	req.Header.Set("X-Request-ID", "client-trace-42")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("X-Request-ID"); got != "client-trace-42" {
+		t.Fatalf("X-Request-ID = %q, want the client's", got)
+	}
+	var body apiError
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if body.RequestID != "client-trace-42" {
+		t.Errorf("body request_id = %q", body.RequestID)
+	}
+	if !strings.Contains(logs.String(), `"request_id":"client-trace-42"`) {
+		t.Errorf("access log lacks the client's request_id:\n%s", logs)
+	}
+}
+
+// لاگ‌هایی که وسط درخواست نوشته می‌شوند (اینجا احراز هویت ناموفق) فیلدهای درخواست، از جمله request_id، را دارند
+func TestRequestIDInRequestLogs(t *testing.T) {
+	logs := captureLogs(t)
+	a, _ := newTestApp(t, map[string]string{"KV_MAX_KEYS": "10", "ADMIN_PASSWORD": "secret"})
+	ts := httptest.NewServer(a.handler)
+	t.Cleanup(ts.Close)
+
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/kv/a", strings.NewReader("1"))
+	req.SetBasicAuth("admin", "wrong")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", resp.StatusCode)
+	}
+
+	id := resp.Header.Get("X-Request-ID")
+	for _, e := range logEntries(t, logs) {
+		if e["msg"] == "authentication failed" {
+			if e["request_id"] != id || e["level"] != "WARN" || e["path"] != "/api/kv/a" {
+				t.Errorf("log = %v, want request_id %q", e, id)
+			}
+			return
+		}
+	}
+	t.Fatalf("no authentication failed log:\n%s", logs)
+}
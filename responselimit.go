@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"   // خطای رسیدن به سقف
+	"net/http" // هسته HTTP در Go
+)
+
+// ================= Response Limit Middleware =================
+
+// خطایی که handler بعد از رسیدن پاسخ به سقف MAX_RESPONSE_BYTES از Write می‌گیرد
+var errResponseTooLarge = errors.New("response exceeds MAX_RESPONSE_BYTES")
+
+// responseLimitMiddleware حجم body پاسخ را به max بایت محدود می‌کند تا handler معیوب
+// نتواند بی‌نهایت داده بفرستد. status قبلاً ارسال شده و قابل تغییر نیست، پس فقط
+// بقیه‌ی پاسخ دور ریخته و رویداد لاگ می‌شود.
+func responseLimitMiddleware(max int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		if max <= 0 {
+			return next // سقف خاموش است
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			rec := newStatusRecorder(w)
+			rec.limit = max
+
+			next.ServeHTTP(rec, r)
+
+			if rec.truncated {
+				requestLogger(r.Context()).Warn("response truncated",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"status", rec.status,
+					"limit", max,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors" // خطای پشتیبانی نشدن
+	"net"    // listener
+)
+
+// ================= SO_REUSEPORT =================
+
+// listenReusePort روی این سیستم‌عامل در دسترس نیست؛ PREFORK فقط روی unix کار می‌کند
+func listenReusePort(addr string) (net.Listener, error) {
+	return nil, errors.New("SO_REUSEPORT is not supported on this platform")
+}
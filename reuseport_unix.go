@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+import (
+	"context" // امضای ListenConfig.Listen
+	"net"     // listener
+	"syscall" // دسترسی به socket خام
+
+	"golang.org/x/sys/unix" // گزینه‌ی SO_REUSEPORT
+)
+
+// ================= SO_REUSEPORT =================
+
+// listenReusePort روی addr با SO_REUSEPORT گوش می‌دهد تا چند پروسه بتوانند
+// همزمان روی یک پورت bind شوند و kernel اتصال‌ها را بینشان پخش کند
+func listenReusePort(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"net/http"    // هسته HTTP در Go
+	"sort"        // مرتب‌سازی مسیرهای prefix و متدها
+	"strings"     // ساختن هدر Allow
+	"sync"        // قفل برای نویسنده‌ها
+	"sync/atomic" // snapshot بدون قفل برای خواندن
+)
+
+// ================= Router =================
+
+// Router یک router ساده با امکان اضافه و حذف route در زمان اجرا است.
+// جدول routeها به صورت copy-on-write نگه داشته می‌شود: هر تغییر یک جدول جدید می‌سازد
+// و آن را به صورت atomic جایگزین می‌کند، پس مسیر داغ (ServeHTTP) هیچ قفلی نمی‌گیرد.
+//
+// الگوی مسیر مثل ServeMux است: مسیری که با "/" تمام شود یک زیرشاخه (prefix) است،
+// بقیه فقط با خود مسیر تطبیق پیدا می‌کنند. پسوند {$} (مثل "/{$}") یعنی فقط خود مسیر.
+//
+// درخواست OPTIONS روی مسیری که handler اختصاصی OPTIONS (یا handler همه‌ی متدها) ندارد
+// با 204 و هدر Allow جواب داده می‌شود.
+type Router struct {
+	mu    sync.Mutex                 // فقط Register/Unregister را سریال می‌کند
+	table atomic.Pointer[routeTable] // جدول فعلی
+
+	NotFound http.Handler // handler مسیرهای ناموجود (پیش‌فرض: http.NotFound)
+}
+
+// جدول routeها؛ بعد از ساخته شدن هرگز تغییر نمی‌کند
+type routeTable struct {
+	exact  map[string]*routeEntry // مسیرهای دقیق
+	prefix []*routeEntry          // زیرشاخه‌ها، از طولانی‌ترین به کوتاه‌ترین
+}
+
+// همه‌ی handlerهای یک الگوی مسیر، بر اساس متد ("" یعنی هر متدی)
+type routeEntry struct {
+	pattern  string // مسیر بدون {$}
+	exact    bool   // true یعنی فقط خود مسیر، نه زیرشاخه
+	handlers map[string]http.Handler
+}
+
+// newRouter یک router خالی می‌سازد
+func newRouter() *Router {
+	rt := &Router{}
+	rt.table.Store(&routeTable{exact: map[string]*routeEntry{}})
+	return rt
+}
+
+// Register یک handler را برای متد و الگوی مسیر ثبت (یا جایگزین) می‌کند.
+// method خالی یعنی همه‌ی متدها.
+func (rt *Router) Register(method, pattern string, h http.Handler) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	t := rt.table.Load().clone()
+	p, exact := normalizePattern(pattern)
+
+	e := t.find(p, exact)
+	if e == nil {
+		e = &routeEntry{pattern: p, exact: exact, handlers: map[string]http.Handler{}}
+		t.add(e)
+	}
+	e.handlers[method] = h
+
+	rt.table.Store(t)
+}
+
+// HandleFunc نسخه‌ی راحت‌تر Register برای توابع
+func (rt *Router) HandleFunc(method, pattern string, h http.HandlerFunc) {
+	rt.Register(method, pattern, h)
+}
+
+// RouteGroup routeهایی با prefix و middlewareهای مشترک است؛ با Router.Group ساخته می‌شود.
+// middlewareهای گروه فقط دور routeهای همان گروه پیچیده می‌شوند (داخل middlewareهای سراسری)،
+// پس مثلاً auth روی /api اعمال می‌شود بدون اینکه به فایل‌های static یا /health برسد:
+//
+//	api := router.Group("/api", authMiddleware)
+//	api.HandleFunc(http.MethodGet, "/time", apiTimeHandler) // → GET /api/time
+//	kv := api.Group("/kv", rateLimitMiddleware)           // auth و بعد rate limit
+//
+// middlewareها موقع ثبت route اعمال می‌شوند؛ تغییر گروه بعد از آن روی routeهای ثبت‌شده اثری ندارد.
+type RouteGroup struct {
+	rt     *Router
+	prefix string       // بدون "/" انتهایی؛ "" یعنی ریشه
+	mws    []Middleware // اولی بیرونی‌ترین، مثل chain
+}
+
+// Group یک گروه route زیر prefix با middlewareهای mws می‌سازد
+func (rt *Router) Group(prefix string, mws ...Middleware) *RouteGroup {
+	return &RouteGroup{rt: rt, prefix: strings.TrimSuffix(prefix, "/"), mws: mws}
+}
+
+// Group یک زیرگروه می‌سازد؛ prefixها پشت هم و middlewareهای گروه بیرونی بیرون‌تر قرار می‌گیرند
+func (g *RouteGroup) Group(prefix string, mws ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		rt:     g.rt,
+		prefix: g.prefix + strings.TrimSuffix(prefix, "/"),
+		mws:    append(g.mws[:len(g.mws):len(g.mws)], mws...),
+	}
+}
+
+// Register مثل Router.Register است ولی pattern نسبت به prefix گروه است
+// و handler داخل middlewareهای گروه قرار می‌گیرد
+func (g *RouteGroup) Register(method, pattern string, h http.Handler) {
+	g.rt.Register(method, g.prefix+pattern, chain(h, g.mws...))
+}
+
+// HandleFunc نسخه‌ی راحت‌تر Register برای توابع
+func (g *RouteGroup) HandleFunc(method, pattern string, h http.HandlerFunc) {
+	g.Register(method, pattern, h)
+}
+
+// Unregister مثل Router.Unregister با pattern نسبت به prefix گروه
+func (g *RouteGroup) Unregister(method, pattern string) bool {
+	return g.rt.Unregister(method, g.prefix+pattern)
+}
+
+// Unregister handler متد و الگوی مسیر را حذف می‌کند؛
+// اگر چنین routeی وجود نداشت false برمی‌گرداند
+func (rt *Router) Unregister(method, pattern string) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	t := rt.table.Load().clone()
+	p, exact := normalizePattern(pattern)
+
+	e := t.find(p, exact)
+	if e == nil {
+		return false
+	}
+	if _, ok := e.handlers[method]; !ok {
+		return false
+	}
+
+	delete(e.handlers, method)
+	if len(e.handlers) == 0 {
+		t.remove(e) // الگوی بدون handler کلاً حذف می‌شود
+	}
+
+	rt.table.Store(t)
+	return true
+}
+
+// ServeHTTP درخواست را به handler مناسب می‌فرستد
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	// خواندن snapshot بدون قفل
+	e := rt.table.Load().match(r.URL.Path)
+	if e == nil {
+		rt.notFound(w, r)
+		return
+	}
+
+	// نام route برای آمار /admin/stats و requests_by_route (الگوی ثبت‌شده، نه مسیر واقعی درخواست)
+	setMatchedRoute(r.Context(), metricMethod(r.Method)+" "+e.pattern)
+
+	if h := e.handler(r.Method); h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	// OPTIONS بدون handler اختصاصی: فقط متدهای مجاز اعلام می‌شوند و handlerی اجرا نمی‌شود
+	// (preflight CORS قبل از router در corsMiddleware جواب داده می‌شود)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", strings.Join(e.methods(), ", "))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// مسیر وجود دارد ولی برای این متد نه
+	w.Header().Set("Allow", strings.Join(e.methods(), ", "))
+	writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+}
+
+// notFound پاسخ مسیرهای ناموجود
+func (rt *Router) notFound(w http.ResponseWriter, r *http.Request) {
+	if rt.NotFound != nil {
+		rt.NotFound.ServeHTTP(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// handler مناسب متد را برمی‌گرداند؛ HEAD در نبود handler اختصاصی از GET استفاده می‌کند
+func (e *routeEntry) handler(method string) http.Handler {
+	if h, ok := e.handlers[method]; ok {
+		return h
+	}
+	if method == http.MethodHead {
+		if h, ok := e.handlers[http.MethodGet]; ok {
+			return h
+		}
+	}
+	return e.handlers[""]
+}
+
+// methods لیست مرتب متدهای ثبت‌شده برای هدر Allow؛
+// OPTIONS همیشه مجاز است چون router در نبود handler خودش به آن جواب می‌دهد
+func (e *routeEntry) methods() []string {
+	var out []string
+	for m := range e.handlers {
+		if m != "" {
+			out = append(out, m)
+		}
+	}
+	if _, ok := e.handlers[http.MethodGet]; ok {
+		if _, ok := e.handlers[http.MethodHead]; !ok {
+			out = append(out, http.MethodHead)
+		}
+	}
+	if _, ok := e.handlers[http.MethodOptions]; !ok {
+		out = append(out, http.MethodOptions)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// match بهترین route را برای مسیر پیدا می‌کند: اول تطبیق دقیق، بعد طولانی‌ترین prefix
+func (t *routeTable) match(path string) *routeEntry {
+	if e, ok := t.exact[path]; ok {
+		return e
+	}
+	for _, e := range t.prefix {
+		if strings.HasPrefix(path, e.pattern) {
+			return e
+		}
+	}
+	return nil
+}
+
+// find همان الگو (نه تطبیق مسیر) را در جدول پیدا می‌کند
+func (t *routeTable) find(pattern string, exact bool) *routeEntry {
+	if exact {
+		return t.exact[pattern]
+	}
+	for _, e := range t.prefix {
+		if e.pattern == pattern {
+			return e
+		}
+	}
+	return nil
+}
+
+// add الگوی جدید را اضافه و ترتیب prefixها را حفظ می‌کند
+func (t *routeTable) add(e *routeEntry) {
+	if e.exact {
+		t.exact[e.pattern] = e
+		return
+	}
+	t.prefix = append(t.prefix, e)
+	sort.SliceStable(t.prefix, func(i, j int) bool {
+		return len(t.prefix[i].pattern) > len(t.prefix[j].pattern)
+	})
+}
+
+// remove الگو را از جدول حذف می‌کند
+func (t *routeTable) remove(e *routeEntry) {
+	if e.exact {
+		delete(t.exact, e.pattern)
+		return
+	}
+	for i, p := range t.prefix {
+		if p.pattern == e.pattern {
+			t.prefix = append(t.prefix[:i:i], t.prefix[i+1:]...)
+			return
+		}
+	}
+}
+
+// clone یک کپی عمیق از جدول می‌سازد تا تغییرات روی snapshot فعلی اثر نگذارد
+func (t *routeTable) clone() *routeTable {
+	out := &routeTable{
+		exact:  make(map[string]*routeEntry, len(t.exact)),
+		prefix: make([]*routeEntry, 0, len(t.prefix)),
+	}
+	for k, e := range t.exact {
+		out.exact[k] = e.clone()
+	}
+	for _, e := range t.prefix {
+		out.prefix = append(out.prefix, e.clone())
+	}
+	return out
+}
+
+func (e *routeEntry) clone() *routeEntry {
+	out := &routeEntry{pattern: e.pattern, exact: e.exact, handlers: make(map[string]http.Handler, len(e.handlers))}
+	for m, h := range e.handlers {
+		out.handlers[m] = h
+	}
+	return out
+}
+
+// isPrefixPattern الگوهایی که با "/" تمام می‌شوند زیرشاخه هستند
+func isPrefixPattern(pattern string) bool {
+	return strings.HasSuffix(pattern, "/")
+}
+
+// normalizePattern پسوند {$} را حذف می‌کند؛ نتیجه یک مسیر دقیق است
+// (مثلاً "/{$}" فقط با خود "/" تطبیق دارد، نه با همه‌ی مسیرها)
+func normalizePattern(pattern string) (p string, exact bool) {
+	if p, ok := strings.CutSuffix(pattern, "{$}"); ok {
+		return p, true
+	}
+	return pattern, !isPrefixPattern(pattern)
+}
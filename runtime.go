@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"         // پیام خطای اعتبارسنجی
+	"io"          // مقصد لاگ
+	"log/slog"    // سطح لاگ قابل تغییر در زمان اجرا
+	"net/http"    // هسته HTTP در Go
+	"strings"     // مقایسه‌ی مسیرها و سطح لاگ
+	"sync/atomic" // snapshot بدون قفل
+	"time"        // Retry-After حالت تعمیرات
+)
+
+// ================= Runtime Config =================
+
+// RuntimeConfig تنظیماتی است که بدون ری‌استارت (از طریق /admin/config) قابل تغییر است.
+// هر نسخه بعد از ساخته شدن تغییر نمی‌کند؛ تغییر یعنی ساختن نسخه‌ی جدید و Store کردن آن.
+type RuntimeConfig struct {
+	Maintenance    bool    `json:"maintenance"`      // حالت تعمیرات: همه‌ی درخواست‌ها 503
+	RateLimitRPS   float64 `json:"rate_limit_rps"`   // تعداد درخواست مجاز در ثانیه برای هر IP (0 = خاموش)
+	RateLimitBurst int     `json:"rate_limit_burst"` // حداکثر درخواست پشت‌سرهم
+	LogLevel       string  `json:"log_level"`        // debug, info, warn, error
+
+	// feature flagها (featureGate و featureEnabled)؛ map هیچ‌وقت درجا تغییر نمی‌کند، نسخه‌ی جدید کپی است
+	Features map[string]bool `json:"features"`
+
+	// درصد ترافیک هر canary (0 تا 100)؛ مثل Features فقط با کپی عوض می‌شود
+	Canaries map[string]int `json:"canaries"`
+}
+
+// snapshot فعلی تنظیمات زمان اجرا؛ middlewareها در هر درخواست آن را Load می‌کنند
+var runtimeCfg atomic.Pointer[RuntimeConfig]
+
+// سطح فعلی لاگ؛ با تغییر LogLevel به‌روز می‌شود
+var logLevel = new(slog.LevelVar)
+
+// setupLogger لاگر پیش‌فرض را با سطح قابل تغییر و قالب text یا json روی out (ERROR_LOG_DEST) راه‌اندازی می‌کند.
+// خروجی log.Printf هم از همین لاگر (در سطح INFO) عبور می‌کند.
+// با combined فقط access log عوض می‌شود (setupAccessLog) و بقیه‌ی لاگ‌ها text می‌مانند.
+func setupLogger(format string, out io.Writer) {
+	slog.SetDefault(slog.New(newLogHandler(format, out)))
+}
+
+// newLogHandler یک handler با قالب text یا json و همان سطح قابل تغییر logLevel می‌سازد
+func newLogHandler(format string, out io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	if format == "json" {
+		return slog.NewJSONHandler(out, opts)
+	}
+	return slog.NewTextHandler(out, opts)
+}
+
+// applyRuntimeConfig نسخه‌ی جدید را اعتبارسنجی و فعال می‌کند
+func applyRuntimeConfig(rc RuntimeConfig) error {
+	if err := rc.validate(); err != nil {
+		return err
+	}
+
+	rc.LogLevel = strings.ToLower(rc.LogLevel)
+	level, _ := parseLogLevel(rc.LogLevel)
+	logLevel.Set(level)
+
+	runtimeCfg.Store(&rc)
+	return nil
+}
+
+// swapRuntimeConfig مثل applyRuntimeConfig است ولی rc را فقط وقتی فعال می‌کند که snapshot فعلی هنوز old
+// باشد؛ false یعنی کس دیگری در این فاصله تنظیمات را عوض کرده و rc باید از روی snapshot تازه دوباره ساخته شود.
+// rc بعد از فعال شدن نباید تغییر کند.
+func swapRuntimeConfig(old, rc *RuntimeConfig) (bool, error) {
+	if err := rc.validate(); err != nil {
+		return false, err
+	}
+
+	rc.LogLevel = strings.ToLower(rc.LogLevel)
+	if !runtimeCfg.CompareAndSwap(old, rc) {
+		return false, nil
+	}
+	level, _ := parseLogLevel(rc.LogLevel)
+	logLevel.Set(level)
+	return true, nil
+}
+
+// validate مقدارهای نامعتبر را رد می‌کند
+func (rc RuntimeConfig) validate() error {
+	if rc.RateLimitRPS < 0 {
+		return fmt.Errorf("rate_limit_rps must be >= 0")
+	}
+	if rc.RateLimitRPS > 0 && rc.RateLimitBurst < 1 {
+		return fmt.Errorf("rate_limit_burst must be >= 1 when rate limiting is enabled")
+	}
+	if _, ok := parseLogLevel(rc.LogLevel); !ok {
+		return fmt.Errorf("log_level must be one of debug, info, warn, error")
+	}
+	for name, percent := range rc.Canaries {
+		if err := validateCanary(name, percent); err != nil {
+			return err
+		}
+	}
+	for name := range rc.Features {
+		if !featureNameRe.MatchString(name) {
+			return fmt.Errorf("invalid feature name %q (use lowercase letters, digits, _ and -)", name)
+		}
+	}
+	return nil
+}
+
+// parseLogLevel نام سطح لاگ را به slog.Level تبدیل می‌کند
+func parseLogLevel(s string) (slog.Level, bool) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info", "":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+	return slog.LevelInfo, false
+}
+
+// ================= Maintenance Middleware =================
+
+// Retry-After پاسخ‌های حالت تعمیرات؛ مدت واقعی تعمیرات معلوم نیست
+const maintenanceRetryAfter = 60 * time.Second
+
+// مسیرهایی که در حالت تعمیرات هم در دسترس می‌مانند
+var maintenanceExempt = []string{"/admin/", "/debug/", "/health", "/readyz", "/livez"}
+
+// maintenanceMiddleware در حالت تعمیرات به همه‌ی درخواست‌ها (جز مسیرهای مدیریتی) 503 می‌دهد
+func maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if !runtimeCfg.Load().Maintenance || hasAnyPrefix(r.URL.Path, maintenanceExempt) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writeRetryError(w, http.StatusServiceUnavailable, "Service is under maintenance", maintenanceRetryAfter)
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"       // timeout بررسی‌ها و توقف تلاش دوباره
+	"crypto/tls"    // درخواست به HTTPS خود سرور
+	"errors"        // خطای هر بررسی
+	"fmt"           // پیام خطا
+	"log/slog"      // گزارش نتیجه‌ها
+	"net/http"      // درخواست به listener خود سرور
+	"os"            // خواندن فایل index
+	"path/filepath" // مسیر فایل index
+	"slices"        // بررسی فعال بودن هر check
+	"sync"          // اجرای همزمان بررسی‌ها
+	"sync/atomic"   // نتیجه‌ی آخرین اجرا برای /readyz
+	"time"          // فاصله‌ی تلاش دوباره
+)
+
+// ================= Startup Self-Test =================
+
+// بررسی‌های SELFTEST_CHECKS؛ پیش‌فرض همه
+var selfTestNames = []string{"listener", "static", "schemas", "dependencies"}
+
+// مقدارهای SELFTEST_ON_FAIL
+const (
+	selfTestWarn  = "warn"  // فقط لاگ؛ سرور مثل قبل آماده اعلام می‌شود
+	selfTestBlock = "block" // /readyz تا موفق شدن همه‌ی بررسی‌ها 503 می‌ماند
+	selfTestAbort = "abort" // سرور با خطا خارج می‌شود
+)
+
+// در حالت block بررسی‌های ناموفق هر این مدت دوباره اجرا می‌شوند
+const selfTestRetry = 5 * time.Second
+
+// schemaهایی که routeها با validateBody لازم دارند
+var routeSchemas = []string{"echo"}
+
+// نتیجه‌ی آخرین self-test برای /readyz؛ nil یعنی self-test خاموش است
+var selfTestResults atomic.Pointer[map[string]checkResult]
+
+// selfTest قبل از اعلام آماده بودن، اشکال‌های پیکربندی را پیدا می‌کند تا اولین درخواست کاربر به آن‌ها نخورد.
+// هر بررسی همان healthCheck است (همان timeout)؛ بررسی‌های critical در نتیجه هم critical علامت می‌خورند.
+type selfTest struct {
+	checks []healthCheck
+}
+
+// newSelfTest بررسی‌های فعال در enabled را می‌سازد؛ باید بعد از ثبت همه‌ی health checkها و شروع Serve صدا زده شود
+func newSelfTest(enabled []string, cfg Config, url string) *selfTest {
+	st := &selfTest{}
+	on := func(name string) bool { return slices.Contains(enabled, name) }
+
+	// listener: خود سرور از بیرون (همان مسیری که load balancer می‌آید) جواب می‌دهد
+	if on("listener") {
+		st.checks = append(st.checks, healthCheck{name: "listener", critical: true, check: func(ctx context.Context) error {
+			return pingSelf(ctx, url+"/api/ping")
+		}})
+	}
+
+	// static: پوشه‌ی سایت اصلی و سایت هر دامنه با فایل index خواندنی
+	if on("static") {
+		dirs := []string{"./static"}
+		for _, dir := range cfg.VHosts {
+			dirs = append(dirs, dir)
+		}
+		slices.Sort(dirs[1:])
+		for _, dir := range slices.Compact(dirs) {
+			st.checks = append(st.checks, healthCheck{name: "static " + dir, check: func(context.Context) error {
+				return checkStaticDir(dir, resolveIndexFile(dir, cfg.IndexFile))
+			}})
+		}
+	}
+
+	// schemas: schemaهای routeها (شاید از SCHEMA_DIR جایگزین شده باشند) ثبت شده‌اند
+	if on("schemas") {
+		st.checks = append(st.checks, healthCheck{name: "schemas", critical: true, check: func(context.Context) error {
+			for _, name := range routeSchemas {
+				if schemas[name] == nil {
+					return fmt.Errorf("schema %q is not registered", name)
+				}
+			}
+			return nil
+		}})
+	}
+
+	// dependencies: همه‌ی health checkهای /health (upstreamها، پوشه‌ی آپلود، ...)
+	if on("dependencies") {
+		healthMu.RLock()
+		for _, c := range healthChecks {
+			c.name = "dependency " + c.name
+			st.checks = append(st.checks, c)
+		}
+		healthMu.RUnlock()
+	}
+	return st
+}
+
+// pingSelf یک GET به url می‌فرستد؛ هر پاسخ HTTP (حتی 401 پشت ACCESS_TOKEN یا 503 در حالت تعمیرات)
+// یعنی listener کار می‌کند. HTTPS بدون بررسی cert است؛ اعتبار cert را certReloader بررسی کرده است.
+func pingSelf(ctx context.Context, url string) error {
+	client := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,                                  // اتصال در شمارش تخلیه‌ی خاموش‌سازی نماند
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, // فقط اتصال به خود سرور
+	}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "mini-http-server-selftest")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// checkStaticDir مثل staticSetupError و علاوه بر آن خواندنی بودن فایل index را بررسی می‌کند
+func checkStaticDir(dir, index string) error {
+	if problem := staticSetupError(dir, index); problem != "" {
+		return errors.New(problem)
+	}
+	f, err := os.Open(filepath.Join(dir, index))
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// run همه‌ی بررسی‌ها را همزمان اجرا، نتیجه را لاگ و برای /readyz ثبت می‌کند؛ true یعنی همه موفق
+func (st *selfTest) run(ctx context.Context) bool {
+	start := time.Now()
+
+	errs := make([]error, len(st.checks))
+	var wg sync.WaitGroup
+	for i, c := range st.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			errs[i] = runHealthCheck(cctx, c)
+		}()
+	}
+	wg.Wait()
+
+	results := make(map[string]checkResult, len(st.checks))
+	failed := 0
+	for i, c := range st.checks {
+		results[c.name] = checkResult{Status: "ok", Critical: c.critical}
+		if errs[i] != nil {
+			failed++
+			results[c.name] = checkResult{Status: "fail", Critical: c.critical, Error: errs[i].Error()}
+			slog.Error("self-test check failed", "check", c.name, "err", errs[i])
+		}
+	}
+	selfTestResults.Store(&results)
+
+	slog.Info("self-test finished",
+		"checks", len(st.checks),
+		"failed", failed,
+		"duration", time.Since(start).String(),
+	)
+	return failed == 0
+}
+
+// gate self-test را اجرا و ready را بر اساس onFail صدا می‌زند. در حالت block بررسی‌ها تا موفقیت یا لغو ctx
+// هر selfTestRetry تکرار می‌شوند؛ کانال برگشتی بعد از تمام شدن این کار بسته می‌شود تا خاموش‌سازی
+// بتواند قبل از 503 کردن /readyz منتظر آن بماند. خطا فقط در حالت abort است.
+func (st *selfTest) gate(ctx context.Context, onFail string, ready func()) (<-chan struct{}, error) {
+	done := make(chan struct{})
+
+	if len(st.checks) == 0 {
+		close(done)
+		ready()
+		return done, nil
+	}
+
+	if st.run(ctx) || onFail == selfTestWarn {
+		close(done)
+		ready()
+		return done, nil
+	}
+	if onFail == selfTestAbort {
+		close(done)
+		return done, errors.New("self-test failed (SELFTEST_ON_FAIL=abort)")
+	}
+
+	slog.Warn("not ready until the self-test passes", "retry", selfTestRetry.String())
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(selfTestRetry)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if st.run(ctx) {
+					ready()
+					return
+				}
+			}
+		}
+	}()
+	return done, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"  // نگه‌داری timingها در context درخواست
+	"fmt"      // قالب‌بندی مقدار dur
+	"net/http" // هسته HTTP در Go
+	"strings"  // ساختن هدر
+	"sync"     // افزودن همزمان timing
+	"time"     // اندازه‌گیری مدت‌ها
+)
+
+// ================= Server-Timing =================
+
+// serverTimings مدت‌های ثبت‌شده‌ی یک درخواست به ترتیب افزودن
+type serverTimings struct {
+	mu      sync.Mutex
+	entries []timingEntry
+}
+
+type timingEntry struct {
+	name string
+	dur  time.Duration
+}
+
+type serverTimingKey struct{}
+
+// addTiming یک مرحله‌ی زمان‌دار به هدر Server-Timing همین درخواست اضافه می‌کند.
+// name باید یک token ساده باشد (مثل db یا upstream). بیرون از serverTimingMiddleware کاری نمی‌کند.
+// فقط timingهایی که قبل از نوشتن هدرهای پاسخ اضافه شوند ارسال می‌شوند.
+func addTiming(ctx context.Context, name string, dur time.Duration) {
+	t, ok := ctx.Value(serverTimingKey{}).(*serverTimings)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	t.entries = append(t.entries, timingEntry{name: name, dur: dur})
+	t.mu.Unlock()
+}
+
+// serverTimingMiddleware هدر Server-Timing را به پاسخ اضافه می‌کند تا مدت پردازش
+// در DevTools مرورگر دیده شود: app کل زمان تا شروع پاسخ است و بقیه از addTiming می‌آیند.
+// مثال: Server-Timing: upstream;dur=8.1, app;dur=12.3
+func serverTimingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		t := &serverTimings{}
+		tw := &timingWriter{ResponseWriter: w, timings: t, start: time.Now()}
+
+		next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), serverTimingKey{}, t)))
+	})
+}
+
+// timingWriter هدر Server-Timing را درست قبل از ارسال هدرهای پاسخ می‌نویسد
+type timingWriter struct {
+	http.ResponseWriter
+	timings     *serverTimings
+	start       time.Time
+	wroteHeader bool
+}
+
+func (tw *timingWriter) WriteHeader(status int) {
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		tw.Header().Set("Server-Timing", tw.timings.header(time.Since(tw.start)))
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timingWriter) Write(p []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(p)
+}
+
+// Flush برای پاسخ‌های streaming به writer اصلی پاس داده می‌شود
+func (tw *timingWriter) Flush() {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(tw.ResponseWriter).Flush()
+}
+
+// Unwrap به http.ResponseController اجازه می‌دهد به writer اصلی برسد
+func (tw *timingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// header مقدار هدر Server-Timing را با مدت‌ها به میلی‌ثانیه می‌سازد
+func (t *serverTimings) header(app time.Duration) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parts := make([]string, 0, len(t.entries)+1)
+	for _, e := range t.entries {
+		parts = append(parts, formatTiming(e.name, e.dur))
+	}
+	parts = append(parts, formatTiming("app", app))
+	return strings.Join(parts, ", ")
+}
+
+func formatTiming(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.1f", name, float64(d)/float64(time.Millisecond))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"  // context خاموش‌سازی
+	"errors"   // جمع کردن خطاهای hookها
+	"fmt"      // خطای انتظار برای کارهای پس‌زمینه
+	"log/slog" // لاگ اجرای هر hook
+	"sync"     // ثبت همزمان امن
+	"time"     // مدت اجرای هر hook
+)
+
+// ================= Shutdown Hooks =================
+
+// shutdownHook یک کار پاک‌سازی که بعد از خاموش شدن سرور HTTP اجرا می‌شود
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+var (
+	shutdownMu    sync.Mutex
+	shutdownHooks []shutdownHook
+)
+
+// onShutdown یک hook ثبت می‌کند؛ اجزایی مثل goroutineهای پس‌زمینه یا فایل‌های باز
+// باید کار پاک‌سازی خود را اینجا ثبت کنند. hookها به ترتیب عکس ثبت اجرا می‌شوند.
+func onShutdown(name string, fn func(ctx context.Context) error) {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	shutdownHooks = append(shutdownHooks, shutdownHook{name: name, fn: fn})
+}
+
+// runShutdownHooks همه‌ی hookها را (آخرین ثبت‌شده اول) با context خاموش‌سازی اجرا می‌کند.
+// خطای یک hook مانع اجرای بقیه نمی‌شود؛ همه‌ی خطاها با هم برگردانده می‌شوند.
+func runShutdownHooks(ctx context.Context) error {
+	shutdownMu.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	shutdownMu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		start := time.Now()
+
+		if err := h.fn(ctx); err != nil {
+			slog.Error("shutdown hook failed", "hook", h.name, "err", err)
+			errs = append(errs, err)
+			continue
+		}
+		slog.Info("shutdown hook done", "hook", h.name, "duration", time.Since(start).String())
+	}
+
+	return errors.Join(errs...)
+}
+
+// ================= Background Tasks =================
+
+// backgroundTasks همه‌ی goroutineهای دوره‌ای را می‌شمارد تا خاموش‌سازی منتظر خروجشان بماند
+var backgroundTasks sync.WaitGroup
+
+// runEvery fn را هر interval یک بار در یک goroutine جدا اجرا می‌کند تا ctx لغو شود.
+// ctx باید context ریشه‌ای باشد که در خاموش‌سازی لغو می‌شود (نه context یک درخواست).
+func runEvery(ctx context.Context, interval time.Duration, fn func()) {
+	backgroundTasks.Add(1)
+	go func() {
+		defer backgroundTasks.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+}
+
+// waitBackground تا خروج همه‌ی goroutineهای runEvery یا تمام شدن ctx صبر می‌کند
+func waitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		backgroundTasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background tasks: %w", ctx.Err())
+	}
+}
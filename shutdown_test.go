@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// checkNoLeak start را با یک context اجرا و بعد لغو می‌کند و انتظار دارد همه‌ی goroutineهای آن
+// (از جمله آن‌هایی که backgroundTasks نمی‌شمارد) خارج شوند. شمارش runtime.NumGoroutine سراسری است،
+// پس تست‌های این فایل نباید Parallel باشند.
+func checkNoLeak(t *testing.T, start func(ctx context.Context)) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	start(ctx)
+	if n := runtime.NumGoroutine(); n <= before {
+		t.Fatalf("no goroutines started (%d before, %d after start)", before, n)
+	}
+	cancel()
+
+	wctx, wcancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer wcancel()
+	if err := waitBackground(wctx); err != nil {
+		t.Fatalf("waitBackground: %v", err)
+	}
+
+	// goroutineهای خارج از backgroundTasks (و اتصال‌های سرور تست) کمی بعدتر تمام می‌شوند
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%d goroutines leaked after cancel:\n%s", runtime.NumGoroutine()-before, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunEveryStopsOnCancel(t *testing.T) {
+	var ticks atomic.Int64
+	checkNoLeak(t, func(ctx context.Context) {
+		for range 3 {
+			runEvery(ctx, time.Millisecond, func() { ticks.Add(1) })
+		}
+		time.Sleep(20 * time.Millisecond)
+	})
+	if ticks.Load() == 0 {
+		t.Error("fn never ran")
+	}
+
+	// بعد از لغو دیگر اجرا نمی‌شود
+	n := ticks.Load()
+	time.Sleep(20 * time.Millisecond)
+	if got := ticks.Load(); got != n {
+		t.Errorf("fn ran %d times after cancel", got-n)
+	}
+}
+
+func TestWatchdogStopsOnCancel(t *testing.T) {
+	captureLogs(t)
+	ts := httptest.NewServer(http.HandlerFunc(apiPingHandler))
+	t.Cleanup(ts.Close)
+
+	var wd *watchdog
+	checkNoLeak(t, func(ctx context.Context) {
+		wd = newWatchdog(40*time.Millisecond, ts.URL, watchdogLivez)
+		start := wd.serve.Load()
+		wd.start(ctx)
+		for wd.serve.Load() == start { // دست‌کم یک probe کامل
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+	if part, _ := wd.stalled(); part != "" {
+		t.Errorf("stalled(%q) while probes were succeeding", part)
+	}
+	if liveWatchdog.Load() != nil {
+		t.Error("liveWatchdog still set after cancel")
+	}
+}
+
+func TestCertWatcherStopsOnCancel(t *testing.T) {
+	captureLogs(t)
+	certFile, keyFile := writeTestCert(t)
+	c, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// os/signal اولین Notify یک goroutine دائمی برای کل پروسه راه می‌اندازد؛ آن نشت نیست
+	warm := make(chan os.Signal, 1)
+	signal.Notify(warm, syscall.SIGHUP)
+	signal.Stop(warm)
+
+	checkNoLeak(t, func(ctx context.Context) {
+		c.watch(ctx, true) // checkFiles دوره‌ای و goroutine منتظر SIGHUP
+	})
+}
+
+// writeTestCert یک cert خودامضای معتبر و کلید آن را در پوشه‌ی موقت تست می‌نویسد
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// کل سرور با newApp و قابلیت‌هایی که goroutine پس‌زمینه دارند (آپلود، KV، cache، idempotency، rate limit)
+// ساخته می‌شود، چند درخواست می‌گیرد و بعد مثل run لغو و خاموش می‌شود؛ هیچ goroutineی نباید بماند
+func TestAppNoGoroutineLeak(t *testing.T) {
+	captureLogs(t)
+	ignore := goleak.IgnoreCurrent() // goroutineهای تست‌های قبلی و خود testing
+
+	cfg := newTestConfig(t, map[string]string{
+		"UPLOAD_MAX_BYTES":   "1024",
+		"UPLOAD_DIR":         t.TempDir(),
+		"KV_MAX_KEYS":        "10",
+		"ADMIN_PASSWORD":     "secret",
+		"RESPONSE_CACHE_TTL": "1m",
+		"IDEMPOTENCY_TTL":    "1m",
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	a, err := newApp(ctx, cfg)
+	if err != nil {
+		cancel()
+		t.Fatalf("newApp: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: a.handler}
+	srv.RegisterOnShutdown(a.streams.closeAll)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
+	tr := &http.Transport{}
+	client := &http.Client{Transport: tr}
+	base := "http://" + ln.Addr().String()
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodGet, "/api/ping", ""},
+		{http.MethodGet, "/api/time", ""},
+		{http.MethodGet, "/api/count?count=2&delay_ms=1", ""},
+		{http.MethodGet, "/api/kv/missing", ""},
+		{http.MethodPost, "/api/echo", `{"a":1}`},
+	} {
+		r, _ := http.NewRequest(req.method, base+req.path, strings.NewReader(req.body))
+		if req.body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatalf("%s %s: %v", req.method, req.path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	// همان ترتیب run: لغو کارهای پس‌زمینه، خاموش‌سازی سرور و انتظار برای backgroundTasks
+	cancel()
+	sctx, scancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer scancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Fatalf("Serve: %v", err)
+	}
+	if err := waitBackground(sctx); err != nil {
+		t.Fatalf("waitBackground: %v", err)
+	}
+	tr.CloseIdleConnections()
+
+	goleak.VerifyNone(t, ignore)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"      // پیام خطای نام سیگنال
+	"log/slog" // لاگ dump goroutineها
+	"os"       // نوع os.Signal
+	"runtime"  // گرفتن stack همه‌ی goroutineها
+	"strings"  // یکسان کردن نام سیگنال
+	"syscall"  // ثابت‌های سیگنال
+)
+
+// ================= Shutdown Signals =================
+
+// سیگنال‌هایی که می‌توانند graceful shutdown را شروع کنند (SHUTDOWN_SIGNALS)
+var knownSignals = map[string]os.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGHUP":  syscall.SIGHUP,
+}
+
+// parseSignals نام‌هایی مثل SIGTERM یا term را به سیگنال تبدیل می‌کند.
+// SIGQUIT همیشه جدا مدیریت می‌شود (dump goroutineها) و در این لیست مجاز نیست.
+func parseSignals(names []string) ([]os.Signal, error) {
+	sigs := make([]os.Signal, 0, len(names))
+	for _, name := range names {
+		n := strings.ToUpper(name)
+		if !strings.HasPrefix(n, "SIG") {
+			n = "SIG" + n
+		}
+		if n == "SIGQUIT" {
+			return nil, fmt.Errorf("SIGQUIT is always handled (goroutine dump, then shutdown) and cannot be listed")
+		}
+		sig, ok := knownSignals[n]
+		if !ok {
+			return nil, fmt.Errorf("unsupported signal %q (supported: SIGINT, SIGTERM, SIGHUP)", name)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// dumpGoroutines stack همه‌ی goroutineها را مثل رفتار پیش‌فرض Go برای SIGQUIT با پیام msg در لاگ می‌نویسد؛
+// با این تفاوت که بعد از آن پروسه به‌جای خروج فوری، graceful shutdown را طی می‌کند (watchdog هم از آن استفاده می‌کند)
+func dumpGoroutines(msg string) {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf)) // بافر کوچک بوده؛ با اندازه‌ی بزرگ‌تر دوباره
+	}
+
+	slog.Error(msg, "goroutines", runtime.NumGoroutine(), "stack", string(buf))
+}
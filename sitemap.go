@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"         // سرو sitemap با http.ServeContent
+	"encoding/xml"  // ساخت sitemap
+	"io/fs"         // پیمایش پوشه‌ی static
+	"log"           // لاگ خطای پیمایش
+	"net/http"      // هسته HTTP در Go
+	"net/url"       // escape کردن مسیر فایل‌ها
+	"path"          // جدا کردن نام فایل از پوشه
+	"path/filepath" // تبدیل مسیر دیسک به مسیر URL
+	"sort"          // ترتیب ثابت آدرس‌ها
+	"strings"       // بررسی پسوند و فایل‌های مخفی
+	"sync"          // دسترسی همزمان امن به sitemap
+	"time"          // lastmod و فاصله‌ی بررسی دوباره
+)
+
+// ================= Sitemap =================
+
+// namespace استاندارد sitemap (sitemaps.org)
+const sitemapXMLNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// ساختار XML خروجی
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"` // W3C datetime (RFC3339)
+}
+
+// staticSitemap فایل‌های .html پوشه‌ی static را در /sitemap.xml فهرست می‌کند.
+// پوشه حداکثر هر staticRevalidateInterval دوباره پیمایش می‌شود و sitemap فقط وقتی محتوایش عوض شود از نو ساخته می‌شود.
+type staticSitemap struct {
+	dir     string
+	index   string // فایل index که آدرس پوشه‌اش (/ یا /static/docs/) در sitemap می‌آید
+	baseURL string // بدون / انتهایی، مثل https://example.com
+
+	mu      sync.Mutex
+	body    []byte // XML آماده
+	etag    string
+	built   time.Time // زمان آخرین تغییر sitemap
+	scanned time.Time // زمان آخرین پیمایش پوشه
+}
+
+// newStaticSitemap sitemap پوشه‌ی dir را با آدرس‌های baseURL می‌سازد
+func newStaticSitemap(dir, index, baseURL string) *staticSitemap {
+	return &staticSitemap{dir: dir, index: index, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// build پوشه را پیمایش و XML sitemap را تولید می‌کند
+func (s *staticSitemap) build() []byte {
+
+	set := sitemapURLSet{XMLNS: sitemapXMLNS}
+
+	err := filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// فایل‌ها و پوشه‌های مخفی (مثل .git) در sitemap نمی‌آیند
+		if strings.HasPrefix(d.Name(), ".") && p != s.dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.EqualFold(path.Ext(d.Name()), ".html") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil // فایل وسط پیمایش حذف شده
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     s.baseURL + s.urlPath(filepath.ToSlash(rel)),
+			LastMod: info.ModTime().UTC().Format(time.RFC3339),
+		})
+		return nil
+	})
+	if err != nil {
+		log.Printf("Sitemap error: %v", err)
+	}
+
+	sort.Slice(set.URLs, func(i, j int) bool { return set.URLs[i].Loc < set.URLs[j].Loc })
+
+	body, _ := xml.MarshalIndent(set, "", "  ") // فقط رشته‌ها؛ همیشه encode می‌شود
+	return append([]byte(xml.Header), body...)
+}
+
+// urlPath مسیر عمومی یک فایل: index ریشه همان / است، index زیرپوشه‌ها آدرس پوشه
+// و بقیه‌ی فایل‌ها زیر /static/
+func (s *staticSitemap) urlPath(rel string) string {
+	if rel == s.index {
+		return "/"
+	}
+
+	dir, name := path.Split(rel)
+	if name == s.index {
+		rel = dir
+	}
+	return "/static/" + (&url.URL{Path: rel}).EscapedPath()
+}
+
+// refresh اگر از آخرین پیمایش به اندازه‌ی کافی گذشته باشد sitemap را دوباره می‌سازد.
+// قفل در طول پیمایش نگه داشته می‌شود تا درخواست‌های همزمان پیمایش تکراری نکنند.
+func (s *staticSitemap) refresh() ([]byte, string, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.body == nil || time.Since(s.scanned) >= staticRevalidateInterval {
+		body := s.build()
+		s.scanned = time.Now()
+		if !bytes.Equal(body, s.body) {
+			s.body, s.etag, s.built = body, strongETag(body), s.scanned
+		}
+	}
+	return s.body, s.etag, s.built
+}
+
+// /sitemap.xml → sitemap صفحه‌های HTML سایت static
+func (s *staticSitemap) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	body, etag, built := s.refresh()
+
+	// sitemap با اضافه شدن صفحه عوض می‌شود؛ crawler همیشه با ETag بررسی کند
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "sitemap.xml", built, bytes.NewReader(body))
+}
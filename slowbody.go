@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"  // رساندن guard به handlerها
+	"errors"   // خطای body کند و تشخیص timeout
+	"expvar"   // شمارنده‌ی bodyهای کند
+	"io"       // پیچیدن body درخواست
+	"log/slog" // لاگ بستن اتصال کند
+	"net/http" // هسته HTTP در Go
+	"os"       // خطای deadline اتصال
+	"time"     // deadline خواندن
+)
+
+// ================= Slow Body Protection =================
+
+// تعداد درخواست‌هایی که body آن‌ها کندتر از MIN_BODY_RATE رسیده و اتصالشان بسته شده است
+var slowBodies = expvar.NewInt("slow_bodies")
+
+// errBodyTooSlow خطای خواندن body وقتی کلاینت بایت‌ها را قطره‌قطره می‌فرستد
+var errBodyTooSlow = errors.New("request body is arriving too slowly")
+
+type bodyRateKey struct{}
+
+// minBodyRateMiddleware از کلاینت می‌خواهد body را بعد از grace با میانگین دست‌کم rate بایت در ثانیه بفرستد.
+// ReadTimeout سرور فقط سقف کل است؛ آپلودها آن را تا چند دقیقه بالا می‌برند و کلاینتی که هر چند ثانیه
+// یک بایت می‌فرستد (slowloris روی body) در این مدت یک goroutine و اتصال را اشغال می‌کند.
+// قبل از هر Read، deadline اتصال زمانی گذاشته می‌شود که با آن نرخ باید بایت بعدی رسیده باشد؛
+// اگر نرسد خواندن با errBodyTooSlow شکست می‌خورد و اتصال بعد از پاسخ بسته می‌شود.
+func minBodyRateMiddleware(rate int64, grace, readTimeout time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if rate <= 0 {
+			return next // خاموش
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength == 0 {
+				next.ServeHTTP(w, r) // درخواست بدون body (مثل GET)
+				return
+			}
+
+			now := time.Now()
+			bw := &bodyRateWriter{ResponseWriter: w}
+			b := &minRateBody{
+				ReadCloser: r.Body,
+				w:          w,
+				rc:         http.NewResponseController(w),
+				rate:       rate,
+				grace:      grace,
+				start:      now,
+				limit:      now.Add(readTimeout),
+			}
+			r = r.WithContext(context.WithValue(r.Context(), bodyRateKey{}, b))
+			r.Body = b
+			next.ServeHTTP(bw, r)
+
+			// خطای خواندن اتصال context درخواست را لغو می‌کند و handlerها (مثل timeoutMiddleware)
+			// آن را رفتن کلاینت می‌دانند و چیزی نمی‌نویسند؛ پس 408 را خود این middleware می‌فرستد
+			if b.tripped && !bw.wrote {
+				writeError(w, http.StatusRequestTimeout, errBodyTooSlow.Error())
+			}
+		})
+	}
+}
+
+// bodyRateWriter فقط ثبت می‌کند handler پاسخی نوشته است یا نه
+type bodyRateWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (bw *bodyRateWriter) WriteHeader(status int) {
+	if status >= http.StatusOK {
+		bw.wrote = true
+	}
+	bw.ResponseWriter.WriteHeader(status)
+}
+
+func (bw *bodyRateWriter) Write(p []byte) (int, error) {
+	bw.wrote = true
+	return bw.ResponseWriter.Write(p)
+}
+
+// Unwrap به http.ResponseController اجازه می‌دهد به writer اصلی برسد
+func (bw *bodyRateWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+// setBodyReadDeadline سقف کل خواندن body را برای این درخواست عوض می‌کند (مثلاً آپلود تکه‌های بزرگ).
+// اگر MIN_BODY_RATE فعال باشد، حداقل نرخ همچنان تا این سقف اعمال می‌شود.
+func setBodyReadDeadline(w http.ResponseWriter, r *http.Request, t time.Time) {
+	if b, ok := r.Context().Value(bodyRateKey{}).(*minRateBody); ok {
+		b.limit = t
+	}
+	_ = http.NewResponseController(w).SetReadDeadline(t)
+}
+
+// minRateBody بایت‌های خوانده‌شده را می‌شمارد و deadline اتصال را با آن جلو می‌برد
+type minRateBody struct {
+	io.ReadCloser
+	w  http.ResponseWriter
+	rc *http.ResponseController
+
+	rate  int64         // حداقل بایت در ثانیه
+	grace time.Duration // مهلت اولیه قبل از اعمال نرخ
+	start time.Time
+	limit time.Time // سقف کل خواندن body
+
+	n       int64 // بایت‌های خوانده‌شده
+	tripped bool
+}
+
+func (b *minRateBody) Read(p []byte) (int, error) {
+	if b.tripped {
+		return 0, errBodyTooSlow
+	}
+
+	// تا این لحظه باید دست‌کم n بایت رسیده باشد: start + grace + n/rate
+	deadline := b.start.Add(b.grace + time.Duration(b.n)*time.Second/time.Duration(b.rate))
+	if deadline.After(b.limit) {
+		deadline = b.limit
+	}
+	if b.rc != nil {
+		if err := b.rc.SetReadDeadline(deadline); err != nil {
+			b.rc = nil // مثلاً اتصال deadline را پشتیبانی نمی‌کند؛ فقط ReadTimeout سرور می‌ماند
+		}
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+
+	// رسیدن به سقف کل (limit) خطای عادی timeout است، نه کندی کلاینت
+	if err != nil && errors.Is(err, os.ErrDeadlineExceeded) && deadline.Before(b.limit) {
+		b.tripped = true
+		slowBodies.Add(1)
+		b.w.Header().Set("Connection", "close")
+		slog.Debug("slow request body, closing connection", "bytes", b.n, "elapsed", time.Since(b.start).Round(time.Millisecond), "min_rate", b.rate)
+		return n, errBodyTooSlow
+	}
+	return n, err
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"log"           // لاگ فایل index جایگزین
+	"log/slog"      // هشدار نبودن پوشه‌ی static
+	"net/http"      // هسته HTTP در Go
+	"os"            // بررسی وجود فایل index
+	"path"          // تمیز کردن مسیر URL
+	"path/filepath" // مسیر فایل روی دیسک
+	"strings"       // بررسی / انتهای مسیر
+)
+
+// ================= Static Index =================
+
+// نام فایل index پیش‌فرض؛ FileServer خودش همین نام را برای پوشه‌ها سرو می‌کند
+const defaultIndexFile = "index.html"
+
+// resolveIndexFile وجود فایل index را در پوشه‌ی static بررسی می‌کند
+// و اگر نبود به index.html برمی‌گردد
+func resolveIndexFile(dir, name string) string {
+	if name == defaultIndexFile {
+		return name
+	}
+	if info, err := os.Stat(filepath.Join(dir, name)); err != nil || info.IsDir() {
+		return defaultIndexFile
+	}
+	return name
+}
+
+// indexFileHandler درخواست پوشه‌ها (مسیرهای تمام‌شده با /) را به فایل index همان پوشه می‌فرستد.
+// با index.html نیازی به آن نیست چون FileServer خودش این کار را می‌کند.
+func indexFileHandler(dir, index string, next http.Handler) http.Handler {
+	if index == defaultIndexFile {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+			p := path.Clean("/" + r.URL.Path)
+			if p != "/" {
+				p += "/"
+			}
+
+			// فقط اگر پوشه فایل index داشته باشد؛ وگرنه رفتار عادی FileServer
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(p), index)); err == nil {
+				r = r.Clone(r.Context())
+				r.URL.Path = p + index
+				r.URL.RawPath = ""
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ================= Missing Static Directory =================
+
+// staticSetupError می‌گوید چرا سایت static قابل سرو نیست ("" یعنی مشکلی نیست):
+// پوشه وجود ندارد یا فایل index در آن نیست
+func staticSetupError(dir, index string) string {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "static directory " + dir + " does not exist"
+	}
+	if info, err := os.Stat(filepath.Join(dir, index)); err != nil || info.IsDir() {
+		return "index file " + index + " not found in " + dir
+	}
+	return ""
+}
+
+// staticMissingHandler به جای 404 بی‌توضیح FileServer، یک پاسخ JSON می‌دهد که اشکال پیکربندی را توضیح می‌دهد
+func staticMissingHandler(problem string) http.Handler {
+	details := map[string]string{
+		"problem": problem,
+		"hint":    "create the static directory next to the binary with an index file (see INDEX_FILE); API-only deployments can ignore this",
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeErrorDetails(w, http.StatusNotFound, "Static site is not configured", details)
+	})
+}
+
+// ================= Static Site =================
+
+// staticSite handlerهای یک سایت static: صفحه‌ی اصلی (/) و فایل‌ها (/static/*)
+type staticSite struct {
+	dir   string
+	index http.Handler // برای الگوی /{$}
+	files http.Handler // برای الگوی /static/ (StripPrefix شامل آن است)
+}
+
+// newStaticSite handlerهای پوشه‌ی dir را با تنظیمات static (cache، manifest، Cache-Control و index) می‌سازد.
+// بدون پوشه یا فایل index سرور همچنان بالا می‌آید، ولی / و /static/ توضیح JSON می‌دهند.
+func newStaticSite(dir string, cfg Config) *staticSite {
+
+	// فایل صفحه‌ی اصلی؛ اگر INDEX_FILE وجود نداشته باشد index.html استفاده می‌شود
+	indexFile := resolveIndexFile(dir, cfg.IndexFile)
+	if indexFile != cfg.IndexFile {
+		log.Printf("INDEX_FILE %q not found in %s, using %s", cfg.IndexFile, dir, indexFile)
+	}
+
+	_, dirErr := os.Stat(dir)
+	problem := staticSetupError(dir, indexFile)
+	if problem != "" {
+		slog.Warn("STATIC SITE NOT AVAILABLE: / and /static/ return a configuration error", "problem", problem)
+	}
+
+	// ارسال فایل index
+	var index http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(dir, indexFile))
+	})
+	if problem != "" {
+		index = staticMissingHandler(problem)
+	}
+
+	// سرو فایل‌های استاتیک مثل css, js, txt
+	var fs http.Handler = http.FileServer(http.Dir(dir))
+
+	// فایل‌های دیسک (مثل دانلودهای بزرگ) ETag قوی و Repr-Digest می‌گیرند تا ادامه‌ی دانلود
+	// با If-Range امن باشد و کلاینت بتواند فایل کامل را بررسی کند
+	if cfg.StaticDigest {
+		fs = newFileDigests(dir).handler(fs)
+	}
+
+	// cache حافظه برای محتوای فایل‌ها؛ فایل‌های بزرگ یا ناموجود از دیسک سرو می‌شوند
+	if cfg.StaticCacheBytes > 0 {
+		cache := newStaticCache(dir, cfg.StaticCacheBytes, cfg.StaticCacheMaxFileBytes)
+
+		// فایل‌های پرکاربرد از قبل بارگذاری می‌شوند تا اولین درخواست هم سریع باشد
+		if len(cfg.StaticPreload) > 0 {
+			cache.preload(cfg.StaticPreload)
+		}
+
+		fs = cache.handler(fs)
+	}
+
+	// نام‌های hashدار (app.3f2a1b9c.js) و /static/manifest.json برای frontend
+	if cfg.StaticManifest && dirErr == nil {
+		if _, err := os.Stat(filepath.Join(dir, manifestName)); err == nil {
+			log.Printf("STATIC_MANIFEST: %s/%s is shadowed by the generated manifest", dir, manifestName)
+		}
+		fs = newStaticManifest(dir, cfg.StaticManifestReload).handler(fs)
+	}
+
+	// Cache-Control به ازای پسوند (STATIC_MAXAGE_MAP)؛ روی پاسخ cache حافظه هم اعمال می‌شود
+	fs = staticCacheControl(newStaticMaxAge(cfg.StaticMaxAge, cfg.StaticMaxAgeMap), fs)
+
+	// پوشه‌ها (مثل /static/docs/) فایل index خودشان را نشان می‌دهند
+	fs = indexFileHandler(dir, indexFile, fs)
+
+	// بدون پوشه همه‌ی /static/* همان توضیح را می‌گیرند؛ نبودن فقط index بقیه‌ی فایل‌ها را از کار نمی‌اندازد
+	if dirErr != nil {
+		fs = staticMissingHandler(problem)
+	}
+
+	return &staticSite{dir: dir, index: index, files: http.StripPrefix("/static/", fs)}
+}
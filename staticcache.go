@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"          // سرو محتوای حافظه با http.ServeContent
+	"compress/gzip"  // پیش‌فشرده‌سازی فایل‌های متنی
+	"container/list" // لیست LRU
+	"crypto/sha256"  // hash محتوا برای ETag و digest
+	"io/fs"          // پیمایش پوشه‌ی static
+	"log"            // لاگ نتیجه‌ی preload
+	"mime"           // تشخیص Content-Type از پسوند
+	"net/http"       // هسته HTTP در Go
+	"os"             // خواندن فایل‌ها از دیسک
+	"path"           // تطبیق glob و تمیز کردن مسیر
+	"path/filepath"  // تبدیل مسیر دیسک به مسیر URL
+	"strings"        // بررسی Accept-Encoding و نوع محتوا
+	"sync"           // دسترسی همزمان امن به cache
+	"time"           // زمان آخرین تغییر فایل
+)
+
+// ================= Static Cache =================
+
+// فاصله‌ی بررسی دوباره‌ی modtime هر فایل؛ تا این مدت بدون stat از حافظه سرو می‌شود
+const staticRevalidateInterval = time.Second
+
+// یک فایل static که در حافظه نگه داشته شده است
+type staticEntry struct {
+	rel         string    // مسیر نسبی (کلید cache)
+	data        []byte    // محتوای اصلی فایل
+	gz          []byte    // نسخه‌ی gzip (اگر فشرده‌سازی ارزش داشت)
+	contentType string    // نوع محتوا بر اساس پسوند
+	modTime     time.Time // زمان آخرین تغییر فایل روی دیسک
+	etag        string    // ETag محتوای اصلی
+	digest      string    // digest محتوای اصلی (Repr-Digest)
+	gzDigest    string    // digest نسخه‌ی gzip؛ نمایش دیگری است با hash خودش
+	checked     time.Time // آخرین باری که modtime با دیسک مقایسه شد
+}
+
+// size حجمی که این entry از cache می‌گیرد
+func (e *staticEntry) size() int64 {
+	return int64(len(e.data) + len(e.gz))
+}
+
+// staticCache یک cache از نوع LRU با سقف حجم برای محتوای فایل‌های static است.
+// فایل‌ها در اولین درخواست (یا در preload) خوانده می‌شوند و اگر modtime روی دیسک
+// عوض شود، entry باطل و دوباره خوانده می‌شود.
+type staticCache struct {
+	dir          string // پوشه‌ی static روی دیسک
+	maxBytes     int64  // حداکثر حجم کل cache
+	maxFileBytes int64  // فایل‌های بزرگ‌تر از این مستقیم از دیسک سرو می‌شوند
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // کلید: مسیر نسبی مثل css/app.css
+	lru     *list.List               // جلوی لیست = تازه‌ترین استفاده
+	size    int64                    // حجم فعلی cache (اصلی + gzip)
+}
+
+// newStaticCache یک cache خالی برای پوشه‌ی dir می‌سازد
+func newStaticCache(dir string, maxBytes, maxFileBytes int64) *staticCache {
+	return &staticCache{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		maxFileBytes: maxFileBytes,
+		entries:      make(map[string]*list.Element),
+		lru:          list.New(),
+	}
+}
+
+// preload فایل‌هایی که با یکی از globها تطبیق دارند را از قبل در حافظه بارگذاری می‌کند.
+// glob هم با مسیر نسبی (css/*.css) و هم با نام فایل (*.js) مقایسه می‌شود.
+// preload چیزی را بیرون نمی‌اندازد؛ وقتی cache پر شد بقیه‌ی فایل‌ها رد می‌شوند.
+func (c *staticCache) preload(patterns []string) {
+
+	start := time.Now()
+	loaded := 0
+
+	err := filepath.WalkDir(c.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(c.dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if !matchAny(patterns, rel) {
+			return nil
+		}
+
+		e, ok := c.read(rel)
+		if !ok {
+			return nil
+		}
+
+		c.mu.Lock()
+		fits := c.size+e.size() <= c.maxBytes
+		if fits {
+			c.insert(e)
+		}
+		c.mu.Unlock()
+
+		if !fits {
+			log.Printf("Static preload: cache full, skipping %s", rel)
+			return nil
+		}
+
+		loaded++
+		return nil
+	})
+	if err != nil {
+		log.Printf("Static preload error: %v", err)
+	}
+
+	// get همزمان c.size را عوض می‌کند؛ فقط زیر قفل خوانده شود
+	c.mu.Lock()
+	size := c.size
+	c.mu.Unlock()
+
+	log.Printf("Static preload: %d files, %d bytes in %s", loaded, size, time.Since(start))
+}
+
+// read یک فایل را از دیسک می‌خواند و در صورت امکان فشرده می‌کند.
+// فایل‌های بزرگ‌تر از maxFileBytes خوانده نمی‌شوند (ok=false).
+func (c *staticCache) read(rel string) (*staticEntry, bool) {
+
+	full := filepath.Join(c.dir, filepath.FromSlash(rel))
+
+	info, err := os.Stat(full)
+	if err != nil || info.IsDir() || info.Size() > c.maxFileBytes {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return nil, false
+	}
+
+	sum := sha256.Sum256(data)
+	e := &staticEntry{
+		rel:         rel,
+		data:        data,
+		contentType: mime.TypeByExtension(path.Ext(rel)),
+		modTime:     info.ModTime(),
+		etag:        etagFromSum(sum),
+		digest:      contentDigest(sum),
+		checked:     time.Now(),
+	}
+	if e.contentType == "" {
+		e.contentType = http.DetectContentType(data)
+	}
+
+	// فقط محتوای متنی ارزش فشرده‌سازی دارد
+	if isCompressible(e.contentType) {
+		if gz := gzipBytes(data); len(gz) < len(data) {
+			e.gz = gz
+			e.gzDigest = contentDigest(sha256.Sum256(gz))
+		}
+	}
+
+	return e, true
+}
+
+// insert entry را به cache اضافه و تا جای کافی، قدیمی‌ترین‌ها را حذف می‌کند.
+// باید با قفل c.mu صدا زده شود.
+func (c *staticCache) insert(e *staticEntry) {
+
+	// entry قبلی با همین کلید (مثلاً نسخه‌ی قدیمی فایل) حذف می‌شود
+	if old, ok := c.entries[e.rel]; ok {
+		c.remove(old)
+	}
+
+	for c.size+e.size() > c.maxBytes && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+
+	c.entries[e.rel] = c.lru.PushFront(e)
+	c.size += e.size()
+}
+
+// remove یک entry را از cache حذف می‌کند (با قفل c.mu)
+func (c *staticCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*staticEntry)
+	delete(c.entries, e.rel)
+	c.size -= e.size()
+}
+
+// get entry معتبر فایل را برمی‌گرداند؛ در صورت miss یا تغییر فایل آن را از دیسک می‌خواند
+func (c *staticCache) get(rel string) (*staticEntry, bool) {
+
+	c.mu.Lock()
+	el, ok := c.entries[rel]
+	if ok {
+		c.lru.MoveToFront(el)
+		e := el.Value.(*staticEntry)
+
+		// تا وقتی بازه‌ی بررسی نگذشته، بدون هیچ syscall سرو می‌کنیم
+		if time.Since(e.checked) < staticRevalidateInterval {
+			c.mu.Unlock()
+			return e, true
+		}
+		c.mu.Unlock()
+
+		// بررسی modtime بیرون از قفل تا درخواست‌های دیگر معطل دیسک نشوند
+		info, err := os.Stat(filepath.Join(c.dir, filepath.FromSlash(rel)))
+		if err == nil && info.ModTime().Equal(e.modTime) {
+			c.mu.Lock()
+			e.checked = time.Now()
+			c.mu.Unlock()
+			return e, true
+		}
+	} else {
+		c.mu.Unlock()
+	}
+
+	// miss یا فایل تغییر کرده: خواندن دوباره از دیسک
+	e, ok := c.read(rel)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !ok {
+		// فایل حذف شده یا برای cache بزرگ است؛ entry قدیمی دیگر معتبر نیست
+		if el, found := c.entries[rel]; found {
+			c.remove(el)
+		}
+		return nil, false
+	}
+
+	if e.size() > c.maxBytes {
+		return nil, false
+	}
+
+	c.insert(e)
+	return e, true
+}
+
+// handler فایل‌ها را از cache سرو می‌کند و فایل‌های بزرگ یا ناموجود را به fallback (دیسک) می‌دهد.
+// مسیر درخواست باید نسبت به پوشه‌ی static باشد (یعنی بعد از StripPrefix).
+func (c *staticCache) handler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		rel := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+		// مسیر پوشه (مثل /static/) را FileServer خودش مدیریت می‌کند
+		if rel == "" || strings.HasSuffix(r.URL.Path, "/") {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		e, ok := c.get(rel)
+		if !ok {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		body, digest := e.data, e.digest
+		w.Header().Set("Content-Type", e.contentType)
+		w.Header().Set("ETag", e.etag)
+
+		if e.gz != nil {
+			addVary(w.Header(), "Accept-Encoding")
+
+			// نسخه‌ی gzip فقط برای درخواست‌های بدون Range (بازه روی نسخه‌ی اصلی معنی دارد)
+			if r.Header.Get("Range") == "" && acceptsGzip(r) {
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Header().Set("ETag", "W/"+e.etag) // نمایش متفاوت از همان محتوا
+				body, digest = e.gz, e.gzDigest
+			}
+		}
+		setDigest(w.Header(), digest)
+
+		// ServeContent خودش If-None-Match، If-Modified-Since و Range را مدیریت می‌کند
+		http.ServeContent(w, r, rel, e.modTime, bytes.NewReader(body))
+	})
+}
+
+// matchAny بررسی می‌کند مسیر با یکی از globها تطبیق دارد یا نه
+func matchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip بررسی می‌کند کلاینت gzip را قبول می‌کند
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") && strings.TrimSpace(params) != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipBytes محتوا را با بیشترین فشرده‌سازی gzip می‌کند (فقط یک بار در شروع)
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	return buf.Bytes()
+}
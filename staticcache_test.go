@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// preload کنار get همزمان که با جا به جا کردن فایل‌ها مدام c.size را عوض می‌کند؛
+// با go test -race هر دسترسی بی‌قفل به c.size گزارش می‌شود
+func TestStaticCachePreloadConcurrentGet(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 50 {
+		for _, ext := range []string{"css", "js"} {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.%s", i, ext)), []byte("0123456789"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// جای 20 فایل: get فایل‌های js را مدام بیرون می‌اندازد و دوباره می‌خواند
+	c := newStaticCache(dir, 200, 1<<10)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			c.get(fmt.Sprintf("f%d.js", i%50))
+		}
+	}()
+	c.preload([]string{"*.css"})
+	close(done)
+	<-stopped
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size > c.maxBytes {
+		t.Errorf("cache size %d exceeds %d", c.size, c.maxBytes)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"  // نگه‌داری route تطبیق‌یافته در context
+	"expvar"   // شمارنده‌های سراسری درخواست‌ها
+	"net/http" // هسته HTTP در Go
+	"slices"   // مرتب‌سازی نمونه‌ها برای محاسبه‌ی صدک
+	"strconv"  // کلید status در request_errors
+	"sync"     // دسترسی همزمان امن به آمار
+	"time"     // مدت پاسخ
+)
+
+// ================= Request Counters =================
+
+// شمارنده‌های سراسری در /debug/vars (و /admin/vars)؛ loggingMiddleware آن‌ها را به‌روز می‌کند
+var (
+	requestsTotal    = expvar.NewInt("requests_total")         // همه‌ی درخواست‌های پاسخ‌داده‌شده
+	requestsInFlight = expvar.NewInt("requests_in_flight")     // درخواست‌های در حال رسیدگی
+	requestErrors    = expvar.NewMap("request_errors")         // پاسخ‌های 4xx و 5xx بر اساس status
+	requestErrorsID  = expvar.NewMap("request_errors_last_id") // شناسه‌ی آخرین درخواست هر status خطا، برای رسیدن به لاگ آن
+	requestsByRoute  = expvar.NewMap("requests_by_route")      // درخواست‌ها بر اساس "متد الگوی route"، مثل "GET /api/kv/"
+)
+
+// countRequest پایان یک درخواست را در شمارنده‌ها ثبت می‌کند؛
+// رفتن کلاینت (499) خطا حساب نمی‌شود و جدا در client_disconnects شمرده شده است
+func countRequest(route string, status int, requestID string) {
+	requestsTotal.Add(1)
+	requestsByRoute.Add(routeLabel(route), 1)
+	if status >= 400 && status != statusClientClosed {
+		key := strconv.Itoa(status)
+		requestErrors.Add(key, 1)
+
+		// خود شناسه برچسب نیست (تعداد کلیدها بی‌حد می‌شد)؛ فقط آخرین نمونه‌ی هر status
+		id := new(expvar.String)
+		id.Set(requestID)
+		requestErrorsID.Set(key, id)
+	}
+}
+
+// ================= Latency Stats =================
+
+// تعداد آخرین نمونه‌هایی که برای هر route نگه داشته می‌شود؛
+// صدک‌ها روی همین پنجره حساب می‌شوند تا حافظه محدود بماند
+const statsWindow = 1024
+
+// کلید route تطبیق‌یافته در context؛ مقدار آن یک *string است که router پر می‌کند
+type routeKey struct{}
+
+// درخواست‌هایی که به هیچ routeی نخورده‌اند زیر این نام جمع می‌شوند
+// تا مسیرهای دلخواه کلاینت تعداد کلیدها را بی‌حد زیاد نکنند
+const unmatchedRoute = "other"
+
+// متدهایی که در نام route می‌آیند؛ بقیه (متدهای دلخواه کلاینت) OTHER می‌شوند
+var metricMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// metricMethod متد درخواست را برای نام route محدود می‌کند تا متدهای ساختگی کلید جدید نسازند
+func metricMethod(method string) string {
+	if slices.Contains(metricMethods, method) {
+		return method
+	}
+	return "OTHER"
+}
+
+// routeLabel نام route برای آمار و metricها؛ همیشه الگوی ثبت‌شده است و هیچ‌وقت مسیر واقعی درخواست
+func routeLabel(route string) string {
+	if route == "" {
+		return unmatchedRoute
+	}
+	return route
+}
+
+// routeStats آمار یک route: تعداد کل و ring buffer آخرین مدت‌ها
+type routeStats struct {
+	count   uint64
+	samples [statsWindow]time.Duration
+	next    int  // خانه‌ی بعدی برای نوشتن
+	filled  bool // ring buffer یک دور کامل پر شده است
+}
+
+// latencyStats آمار همه‌ی routeها
+type latencyStats struct {
+	mu     sync.Mutex
+	routes map[string]*routeStats
+}
+
+// آمار سراسری؛ loggingMiddleware آن را پر می‌کند و /admin/stats می‌خواند
+var stats = &latencyStats{routes: make(map[string]*routeStats)}
+
+// withRouteHolder جایی در context می‌سازد تا router نام route را در آن بنویسد
+func withRouteHolder(r *http.Request) (*http.Request, *string) {
+	route := new(string)
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, route)), route
+}
+
+// setMatchedRoute نام route تطبیق‌یافته را (اگر کسی منتظرش باشد) ثبت می‌کند
+func setMatchedRoute(ctx context.Context, route string) {
+	if p, ok := ctx.Value(routeKey{}).(*string); ok {
+		*p = route
+	}
+}
+
+// matchedRoute نام route تطبیق‌یافته‌ی درخواست را برمی‌گرداند ("" اگر معلوم نباشد)
+func matchedRoute(ctx context.Context) string {
+	if p, ok := ctx.Value(routeKey{}).(*string); ok {
+		return *p
+	}
+	return ""
+}
+
+// observe یک نمونه برای route ثبت می‌کند
+func (s *latencyStats) observe(route string, d time.Duration) {
+	route = routeLabel(route)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rs, ok := s.routes[route]
+	if !ok {
+		rs = &routeStats{}
+		s.routes[route] = rs
+	}
+
+	rs.count++
+	rs.samples[rs.next] = d
+	rs.next = (rs.next + 1) % statsWindow
+	if rs.next == 0 {
+		rs.filled = true
+	}
+}
+
+// routeSummary خلاصه‌ی قابل خواندن آمار یک route (مدت‌ها به میلی‌ثانیه)
+type routeSummary struct {
+	Count uint64  `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+}
+
+// snapshot خلاصه‌ی همه‌ی routeها را می‌سازد
+func (s *latencyStats) snapshot() map[string]routeSummary {
+
+	// نمونه‌ها زیر قفل کپی می‌شوند و مرتب‌سازی بیرون از قفل انجام می‌شود
+	type copied struct {
+		count   uint64
+		samples []time.Duration
+	}
+
+	s.mu.Lock()
+	all := make(map[string]copied, len(s.routes))
+	for route, rs := range s.routes {
+		n := rs.next
+		if rs.filled {
+			n = statsWindow
+		}
+		all[route] = copied{count: rs.count, samples: slices.Clone(rs.samples[:n])}
+	}
+	s.mu.Unlock()
+
+	out := make(map[string]routeSummary, len(all))
+	for route, c := range all {
+		slices.Sort(c.samples)
+		out[route] = routeSummary{
+			Count: c.count,
+			P50:   percentileMillis(c.samples, 0.50),
+			P90:   percentileMillis(c.samples, 0.90),
+			P99:   percentileMillis(c.samples, 0.99),
+		}
+	}
+	return out
+}
+
+// percentileMillis صدک q را از نمونه‌های مرتب‌شده (به روش nearest-rank) برمی‌گرداند
+func percentileMillis(sorted []time.Duration, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q*float64(len(sorted))+0.5) - 1
+	i = max(0, min(i, len(sorted)-1))
+	return float64(sorted[i]) / float64(time.Millisecond)
+}
+
+// /admin/stats → تعداد درخواست و صدک‌های مدت پاسخ هر route
+func adminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"window": statsWindow,
+		"routes": stats.snapshot(),
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json" // encode هر آیتم
+	"fmt"           // محل خطا در پاسخ 500
+	"iter"          // منبع آیتم‌ها
+	"net/http"      // هسته HTTP در Go
+)
+
+// ================= Streaming JSON Arrays =================
+//
+// writeJSONStream یک آرایه‌ی JSON را آیتم به آیتم می‌نویسد و بعد از هر آیتم flush می‌کند؛
+// پس حافظه به اندازه‌ی یک آیتم است نه کل مجموعه:
+//
+//	writeJSONStream(w, r, func(yield func(row, error) bool) {
+//		for rows.Next() {
+//			var x row
+//			if !yield(x, rows.Scan(&x)) {
+//				return // کلاینت رفته یا نوشتن شکست خورده
+//			}
+//		}
+//	})
+//
+// تا قبل از اولین آیتم هنوز چیزی ارسال نشده و خطا با پاسخ 500 معمولی برمی‌گردد. بعد از آن status 200
+// رفته است؛ خطا فقط لاگ می‌شود و آرایه بدون "]" رها می‌شود تا کلاینت body ناقص را JSON معتبر نپندارد.
+// مسیرهای streaming نباید پشت timeoutMiddleware باشند (پاسخ را بافر می‌کند).
+
+// writeJSONStream آیتم‌های items را به شکل یک آرایه‌ی JSON با status 200 stream می‌کند
+func writeJSONStream[T any](w http.ResponseWriter, r *http.Request, items iter.Seq2[T, error]) {
+	rc := http.NewResponseController(w)
+	ctx := r.Context()
+
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte{'['})
+	}
+
+	n := 0
+	for item, err := range items {
+		if ctx.Err() != nil {
+			return // کلاینت رفته یا deadline گذشته؛ کسی منتظر بقیه نیست
+		}
+
+		// آیتم اول کامل marshal می‌شود؛ آیتم خراب نیمه‌کاره نوشته نمی‌شود
+		var b []byte
+		if err == nil {
+			b, err = json.Marshal(item)
+		}
+		if err != nil {
+			if !started {
+				writeServerError(w, http.StatusInternalServerError, fmt.Errorf("writeJSONStream: %w", err))
+				return
+			}
+			requestLogger(r.Context()).Error("writeJSONStream: truncated",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"items", n,
+				"err", err,
+			)
+			return
+		}
+
+		if !started {
+			start()
+		}
+		if n > 0 {
+			_, _ = w.Write([]byte{','})
+		}
+		_, _ = w.Write(b)
+		n++
+
+		// آیتم همین حالا به کلاینت می‌رسد حتی اگر آیتم بعدی دیر تولید شود؛
+		// writer بدون Flush (ErrNotSupported) فقط بافر می‌کند و خطای اتصال را ctx در دور بعد می‌بیند
+		_ = rc.Flush()
+	}
+
+	if !started {
+		start() // مجموعه‌ی خالی: []
+	}
+	_, _ = w.Write([]byte{']', '\n'})
+}
+
+// chanSeq یک کانال را به منبع writeJSONStream تبدیل می‌کند؛ فرستنده با بستن کانال پایان را اعلام می‌کند
+// و اگر کلاینت زودتر برود، خودش باید با context درخواست متوقف شود.
+func chanSeq[T any](ch <-chan T) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for v := range ch {
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// حداکثر آیتم‌های /api/sequence
+const sequenceMaxCount = 100_000
+
+// /api/sequence?count=N → نمونه‌ی stream: آرایه‌ی {"n": 1} تا {"n": N} بدون ساختن کل آرایه در حافظه
+func apiSequenceHandler(w http.ResponseWriter, r *http.Request) {
+
+	count, err := queryInt(r.URL.Query(), "count", 100, 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	count = min(count, sequenceMaxCount)
+
+	type entry struct {
+		N int `json:"n"`
+	}
+	writeJSONStream(w, r, func(yield func(entry, error) bool) {
+		for i := 1; i <= count; i++ {
+			if !yield(entry{N: i}, nil) {
+				return
+			}
+		}
+	})
+}
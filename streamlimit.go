@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"  // لغو streamها در خاموش‌سازی
+	"expvar"   // gauge اتصال‌های stream
+	"log/slog" // لاگ بستن streamها
+	"mime"     // پارس هدر Accept
+	"net/http" // هسته HTTP در Go
+	"strings"  // پارس هدرهای Connection و Upgrade
+	"sync"     // دسترسی همزمان امن به لیست streamها
+	"time"     // Retry-After
+)
+
+// ================= Stream Client Limit =================
+
+// metricهای streamها در /debug/vars (و /admin/vars)
+var (
+	streamClients  = expvar.NewMap("stream_clients")  // streamهای باز بر اساس نوع: sse، websocket
+	streamRejected = expvar.NewMap("stream_rejected") // ردشده‌ها بر اساس علت: full یا shutdown
+)
+
+// پیشنهاد Retry-After برای stream ردشده؛ stream باز معمولاً زود تمام نمی‌شود
+const streamRetryAfter = 5 * time.Second
+
+// streamLimiter اتصال‌های طولانی (SSE و WebSocket، که در این سرور از پروکسی عبور می‌کنند) را
+// می‌شمارد و بیشتر از max را با 503 رد می‌کند تا چند کلاینت پایدار همه‌ی ظرفیت را نگیرند.
+// srv.Shutdown منتظر SSE می‌ماند و WebSocket را (چون hijack شده) اصلاً نمی‌بیند؛
+// پس closeAll همان ابتدای خاموش‌سازی context همه‌ی streamها را لغو می‌کند.
+type streamLimiter struct {
+	max int // 0 یعنی بدون سقف (ولی همچنان شمرده و در خاموش‌سازی بسته می‌شوند)
+
+	mu      sync.Mutex
+	streams map[*context.CancelFunc]struct{}
+	closed  bool
+}
+
+// newStreamLimiter یک limiter با سقف maxClients stream همزمان می‌سازد
+func newStreamLimiter(maxClients int) *streamLimiter {
+	return &streamLimiter{max: maxClients, streams: make(map[*context.CancelFunc]struct{})}
+}
+
+// streamKind نوع stream درخواست را برمی‌گرداند؛ "" یعنی درخواست معمولی
+func streamKind(r *http.Request) string {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") && headerHasToken(r.Header, "Connection", "upgrade") {
+		return "websocket"
+	}
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, err := mime.ParseMediaType(v); err == nil && mt == "text/event-stream" {
+			return "sse"
+		}
+	}
+	return ""
+}
+
+// headerHasToken بررسی می‌کند یکی از مقدارهای جداشده با ویرگول هدر name برابر token باشد
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for t := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// middleware streamها را ثبت و در صورت پر بودن ظرفیت رد می‌کند؛ درخواست‌های معمولی دست نمی‌خورند
+func (l *streamLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		kind := streamKind(r)
+		if kind == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		l.mu.Lock()
+		switch {
+		case l.closed:
+			l.mu.Unlock()
+			streamRejected.Add("shutdown", 1)
+			w.Header().Set("Connection", "close")
+			writeRetryError(w, http.StatusServiceUnavailable, "server is shutting down", streamRetryAfter)
+			return
+		case l.max > 0 && len(l.streams) >= l.max:
+			l.mu.Unlock()
+			streamRejected.Add("full", 1)
+			writeRetryError(w, http.StatusServiceUnavailable, "too many stream clients", streamRetryAfter)
+			return
+		}
+		l.streams[&cancel] = struct{}{}
+		l.mu.Unlock()
+
+		streamClients.Add(kind, 1)
+		defer func() {
+			l.mu.Lock()
+			delete(l.streams, &cancel)
+			l.mu.Unlock()
+			streamClients.Add(kind, -1)
+		}()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// closeAll همه‌ی streamهای باز را می‌بندد و stream جدید نمی‌پذیرد؛
+// با srv.RegisterOnShutdown همان ابتدای خاموش‌سازی صدا زده می‌شود
+func (l *streamLimiter) closeAll() {
+	l.mu.Lock()
+	l.closed = true
+	n := len(l.streams)
+	for cancel := range l.streams {
+		(*cancel)()
+	}
+	l.mu.Unlock()
+
+	if n > 0 {
+		slog.Info("stream clients closed", "count", n)
+	}
+}
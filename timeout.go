@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"    // بافر پاسخ تا قبل از پایان handler
+	"context"  // deadline درخواست
+	"errors"   // تشخیص نوع پایان context
+	"net/http" // هسته HTTP در Go
+	"slices"   // مرتب‌سازی الگوهای بی‌استفاده
+	"strconv"  // پارس مقدار میلی‌ثانیه
+	"strings"  // تمیز کردن مقدار هدر
+	"sync"     // همزمانی بین handler و timeout
+	"time"     // مدت‌زمان‌ها
+)
+
+// ================= Timeout Middleware =================
+
+// timeoutMiddleware برای هر درخواست یک deadline روی context می‌گذارد.
+// کلاینت می‌تواند با هدر X-Request-Timeout (مثل 1500 به میلی‌ثانیه یا 2s) بگوید
+// چقدر صبر می‌کند؛ این مقدار به max محدود می‌شود. بدون هدر، def استفاده می‌شود.
+// اگر deadline بگذرد و handler هنوز جواب نداده باشد، پاسخ 504 ارسال می‌شود.
+//
+// پاسخ handler تا پایان کارش بافر می‌شود، پس این middleware برای مسیرهای
+// streaming یا فایل‌های بزرگ مناسب نیست.
+func timeoutMiddleware(def, max time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			d := requestTimeout(r, def, max)
+			if d <= 0 {
+				next.ServeHTTP(w, r) // هیچ timeoutی تعریف نشده است
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			// هدرهایی که middlewareهای بیرونی گذاشته‌اند (مثل X-Request-ID) برای handler هم دیده می‌شوند
+			tw := &timeoutWriter{header: w.Header().Clone(), status: http.StatusOK}
+			done := make(chan struct{})
+			panicCh := make(chan any, 1)
+
+			go func() {
+				// panic داخل goroutine را به goroutine اصلی برمی‌گردانیم تا recoveryMiddleware آن را بگیرد
+				defer func() {
+					if p := recover(); p != nil {
+						panicCh <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicCh:
+				panic(p)
+
+			case <-done:
+				// handler به موقع تمام شد؛ پاسخ بافرشده ارسال می‌شود
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				for k, v := range tw.header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(tw.status)
+				_, _ = w.Write(tw.buf.Bytes())
+
+			case <-ctx.Done():
+				tw.mu.Lock()
+				tw.timedOut = true // نوشتن‌های بعدی handler دور ریخته می‌شوند
+				tw.mu.Unlock()
+
+				// اگر خود کلاینت رفته باشد، پاسخی لازم نیست
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					writeErrorDetails(w, http.StatusGatewayTimeout, "request timed out", timeoutDetails{
+						Route:   matchedRoute(r.Context()),
+						Timeout: d.String(),
+					})
+				}
+			}
+		})
+	}
+}
+
+// timeoutDetails جزئیات پاسخ 504 برای پیدا کردن route کند
+type timeoutDetails struct {
+	Route   string `json:"route,omitempty"` // مثل "POST /api/echo"
+	Timeout string `json:"timeout"`         // مهلتی که تمام شد
+}
+
+// routeTimeouts با timeout پیش‌فرض و override هر الگوی مسیر (ROUTE_TIMEOUTS)
+// timeoutMiddleware مناسب هر route را می‌سازد
+type routeTimeouts struct {
+	def, max  time.Duration
+	overrides map[string]time.Duration
+	used      map[string]bool // الگوهایی که واقعاً به routeی رسیده‌اند
+}
+
+func newRouteTimeouts(def, max time.Duration, overrides map[string]time.Duration) *routeTimeouts {
+	return &routeTimeouts{def: def, max: max, overrides: overrides, used: make(map[string]bool)}
+}
+
+// forRoute middleware timeout الگوی pattern را برمی‌گرداند؛ بدون override همان پیش‌فرض است
+func (rt *routeTimeouts) forRoute(pattern string) Middleware {
+	d := rt.def
+	if o, ok := rt.overrides[pattern]; ok {
+		d = o
+		rt.used[pattern] = true
+	}
+	return timeoutMiddleware(d, rt.max)
+}
+
+// unused الگوهایی از ROUTE_TIMEOUTS که به هیچ route با timeout نخورده‌اند (احتمالاً اشتباه تایپی)
+func (rt *routeTimeouts) unused() []string {
+	var out []string
+	for p := range rt.overrides {
+		if !rt.used[p] {
+			out = append(out, p)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// requestTimeout مدت timeout این درخواست را از هدر X-Request-Timeout یا مقدار پیش‌فرض پیدا می‌کند
+func requestTimeout(r *http.Request, def, max time.Duration) time.Duration {
+
+	d := def
+	if v := strings.TrimSpace(r.Header.Get("X-Request-Timeout")); v != "" {
+		if parsed, ok := parseTimeoutHeader(v); ok {
+			d = parsed
+		}
+	}
+
+	if max > 0 && (d <= 0 || d > max) {
+		d = max // بودجه‌ی کلاینت هیچ‌وقت از سقف سرور بیشتر نمی‌شود
+	}
+	return d
+}
+
+// parseTimeoutHeader هم عدد خالی (میلی‌ثانیه) و هم duration مثل 2s را می‌پذیرد
+func parseTimeoutHeader(v string) (time.Duration, bool) {
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if ms <= 0 {
+			return 0, false
+		}
+		return time.Duration(ms) * time.Millisecond, true
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// timeoutWriter پاسخ handler را بافر می‌کند تا در صورت timeout بتوان 504 فرستاد
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	wrote    bool // WriteHeader یا Write صدا زده شده
+	timedOut bool // بعد از timeout هیچ نوشتنی پذیرفته نمی‌شود
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wrote {
+		return
+	}
+	tw.status = status
+	tw.wrote = true
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.wrote = true
+	return tw.buf.Write(p)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"     // توقف بررسی دوره‌ای
+	"crypto/tls"  // بارگذاری cert و key
+	"errors"      // خطای cert منقضی
+	"fmt"         // پیام خطای بارگذاری
+	"log/slog"    // لاگ reload
+	"os"          // modtime فایل‌ها
+	"os/signal"   // reload با SIGHUP
+	"sync"        // سریال کردن reloadها
+	"sync/atomic" // cert فعلی بدون قفل در handshake
+	"syscall"     // SIGHUP
+	"time"        // دوره‌ی بررسی و انقضا
+)
+
+// ================= TLS Certificates =================
+
+// هر چند وقت modtime فایل‌های cert و key بررسی شود
+const certCheckInterval = 30 * time.Second
+
+// certReloader جفت cert/key را از دیسک می‌خواند و از tls.Config.GetCertificate سرو می‌کند.
+// با تغییر modtime فایل‌ها (مثلاً تمدید certbot) یا SIGHUP دوباره خوانده می‌شود؛ اتصال‌های باز
+// دست نمی‌خورند و فقط handshakeهای بعدی cert جدید را می‌بینند. اگر cert جدید خراب، ناجور با key
+// یا منقضی باشد، خطا لاگ و همان cert قبلی سرو می‌شود.
+type certReloader struct {
+	certFile, keyFile string
+
+	cert atomic.Pointer[tls.Certificate]
+
+	mu              sync.Mutex // reloadهای همزمان (تیک و SIGHUP)
+	certMod, keyMod time.Time  // modtime فایل‌ها در آخرین بارگذاری
+}
+
+// newCertReloader cert را یک بار می‌خواند؛ خطا در شروع برنامه یعنی پیکربندی اشتباه است
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate برای tls.Config؛ همیشه آخرین cert معتبر را برمی‌گرداند
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// reload فایل‌ها را می‌خواند و فقط اگر معتبر باشند جایگزین cert فعلی می‌کند
+func (c *certReloader) reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	certMod, keyMod := modTime(c.certFile), modTime(c.keyFile)
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile) // key ناجور با cert هم خطا است
+	if err != nil {
+		return fmt.Errorf("load %s: %w", c.certFile, err)
+	}
+	if time.Now().After(cert.Leaf.NotAfter) {
+		return fmt.Errorf("load %s: %w", c.certFile, errors.New("certificate has expired"))
+	}
+
+	c.cert.Store(&cert)
+	c.certMod, c.keyMod = certMod, keyMod
+	slog.Info("tls certificate loaded",
+		"file", c.certFile,
+		"subject", cert.Leaf.Subject.String(),
+		"not_after", cert.Leaf.NotAfter.UTC().Format(time.RFC3339),
+	)
+	return nil
+}
+
+// checkFiles اگر modtime یکی از فایل‌ها عوض شده باشد reload می‌کند.
+// certbot اول cert و بعد key را می‌نویسد؛ اگر reload وسط این دو ناجور باشد، تیک بعدی دوباره امتحان می‌کند.
+func (c *certReloader) checkFiles() {
+	c.mu.Lock()
+	changed := !modTime(c.certFile).Equal(c.certMod) || !modTime(c.keyFile).Equal(c.keyMod)
+	c.mu.Unlock()
+
+	if changed {
+		if err := c.reload(); err != nil {
+			slog.Error("tls certificate reload failed, keeping the current one", "err", err)
+		}
+	}
+}
+
+// watch فایل‌ها را هر certCheckInterval بررسی می‌کند و اگر onSIGHUP باشد با SIGHUP هم reload می‌کند
+func (c *certReloader) watch(ctx context.Context, onSIGHUP bool) {
+	runEvery(ctx, certCheckInterval, c.checkFiles)
+	if !onSIGHUP {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	backgroundTasks.Add(1)
+	go func() {
+		defer backgroundTasks.Done()
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				slog.Info("signal received, reloading tls certificate", "signal", "SIGHUP")
+				if err := c.reload(); err != nil {
+					slog.Error("tls certificate reload failed, keeping the current one", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// modTime زمان تغییر فایل؛ صفر اگر خوانده نشود (مثلاً وسط جایگزینی)
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
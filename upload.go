@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"       // بررسی سلامت و توقف پاک‌سازی
+	"crypto/rand"   // شناسه‌ی تصادفی upload
+	"encoding/hex"  // تبدیل شناسه به رشته
+	"errors"        // تشخیص خطای حجم بیش از حد
+	"fmt"           // پارس Content-Range
+	"io"            // کپی body در فایل
+	"log/slog"      // لاگ پاک‌سازی
+	"net/http"      // هسته HTTP در Go
+	"os"            // فایل‌های موقت
+	"path/filepath" // مسیر فایل هر upload
+	"strconv"       // هدرهای Upload-Offset و Upload-Length
+	"strings"       // جدا کردن شناسه از مسیر
+	"sync"          // دسترسی همزمان امن به uploadها
+	"time"          // TTL و deadline خواندن
+)
+
+// ================= Resumable Uploads =================
+
+// هر تکه‌ی PATCH حداکثر این مدت برای رسیدن کامل فرصت دارد؛
+// ReadTimeout سرور برای تکه‌های بزرگ روی اتصال کند کافی نیست
+const uploadChunkTimeout = 10 * time.Minute
+
+// Retry-After وقتی سقف UPLOAD_MAX_ACTIVE پر است؛ پاک‌سازی هر دقیقه جا باز می‌کند
+const uploadRetryAfter = time.Minute
+
+// upload وضعیت یک آپلود در حال انجام
+type upload struct {
+	mu       sync.Mutex // فقط یک PATCH همزمان برای هر upload
+	path     string     // فایل موقت
+	filename string     // نام فایل کلاینت در فرم multipart؛ برای آپلود تکه‌ای خالی است
+	length   int64      // حجم کل اعلام‌شده
+	offset   int64      // تعداد بایت‌های دریافت‌شده
+	updated  time.Time  // آخرین فعالیت
+}
+
+// uploadStore آپلودهای قابل ادامه را نگه می‌دارد (پروتکلی ساده شبیه tus):
+//
+//	POST  /api/uploads       با Upload-Length → ساخت upload و Location
+//	POST  /api/uploads       با multipart/form-data → ذخیره‌ی یک‌جای فایل‌ها (multipart.go)
+//	HEAD  /api/uploads/{id}  → Upload-Offset فعلی
+//	PATCH /api/uploads/{id}  با Upload-Offset (یا Content-Range) → افزودن تکه
+//	GET   /api/uploads/{id}  → دانلود upload کامل (با Range)
+type uploadStore struct {
+	dir      string        // پوشه‌ی فایل‌های موقت
+	maxBytes int64         // سقف حجم کل هر upload (و هر فایل در multipart)
+	maxParts int           // سقف تعداد partهای فرم multipart
+	maxCount int           // سقف تعداد uploadهای نگه‌داشته‌شده (ناتمام و کامل)
+	ttl      time.Duration // uploadهایی که این مدت فعالیت نداشته‌اند (ناتمام یا کامل) پاک می‌شوند
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+}
+
+// newUploadStore پوشه را می‌سازد و goroutine پاک‌سازی uploadهای رهاشده را تا لغو ctx راه می‌اندازد
+func newUploadStore(ctx context.Context, dir string, maxBytes int64, maxParts, maxCount int, ttl time.Duration) (*uploadStore, error) {
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	s := &uploadStore{dir: dir, maxBytes: maxBytes, maxParts: maxParts, maxCount: maxCount, ttl: ttl, uploads: make(map[string]*upload)}
+
+	runEvery(ctx, time.Minute, s.cleanup)
+
+	return s, nil
+}
+
+// cleanup uploadهایی را که ttl فعالیت نداشته‌اند با فایلشان حذف می‌کند: ناتمام یعنی رها شده و کامل
+// یعنی مصرف‌کننده‌ی آن (که فایل را از UPLOAD_DIR برمی‌دارد) فرصتش را داشته است
+func (s *uploadStore) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, u := range s.uploads {
+		// uploadی که الان PATCH در جریان دارد رها نشده است
+		if !u.mu.TryLock() {
+			continue
+		}
+		if time.Since(u.updated) > s.ttl {
+			_ = os.Remove(u.path)
+			delete(s.uploads, id)
+			if u.offset < u.length {
+				slog.Info("upload abandoned, removed", "id", id, "offset", u.offset, "length", u.length)
+			} else {
+				slog.Info("upload expired, removed", "id", id, "length", u.length)
+			}
+		}
+		u.mu.Unlock()
+	}
+}
+
+// add upload را ثبت می‌کند؛ false یعنی سقف maxCount پر است و upload ثبت نشد
+func (s *uploadStore) add(id string, u *upload) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.uploads) >= s.maxCount {
+		return false
+	}
+	s.uploads[id] = u
+	return true
+}
+
+// full می‌گوید سقف maxCount پر است؛ برای رد کردن درخواست قبل از خواندن body
+func (s *uploadStore) full() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads) >= s.maxCount
+}
+
+// writeUploadsFull پاسخ 503 وقتی سقف UPLOAD_MAX_ACTIVE پر است
+func writeUploadsFull(w http.ResponseWriter) {
+	writeRetryError(w, http.StatusServiceUnavailable, "too many uploads in progress", uploadRetryAfter)
+}
+
+// healthCheck بررسی می‌کند پوشه‌ی آپلود هنوز وجود دارد
+func (s *uploadStore) healthCheck(ctx context.Context) error {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.dir)
+	}
+	return nil
+}
+
+// get upload با شناسه‌ی id را برمی‌گرداند
+func (s *uploadStore) get(id string) *upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploads[id]
+}
+
+// create → POST /api/uploads
+func (s *uploadStore) create(w http.ResponseWriter, r *http.Request) {
+
+	if isMultipart(r) {
+		s.createMultipart(w, r)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeError(w, http.StatusBadRequest, "Upload-Length header is required")
+		return
+	}
+	if length > s.maxBytes {
+		writeBodyError(w, newBodyTooLarge(s.maxBytes))
+		return
+	}
+	if s.full() {
+		writeUploadsFull(w)
+		return
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		writeServerError(w, http.StatusInternalServerError, fmt.Errorf("upload id: %w", err))
+		return
+	}
+
+	path := filepath.Join(s.dir, id)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		writeServerError(w, http.StatusInternalServerError, fmt.Errorf("upload create: %w", err))
+		return
+	}
+	f.Close()
+
+	// درخواست همزمان دیگری ممکن است آخرین جا را گرفته باشد
+	if !s.add(id, &upload{path: path, length: length, updated: time.Now()}) {
+		_ = os.Remove(path)
+		writeUploadsFull(w)
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads/"+id)
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// serveUpload → HEAD و PATCH روی /api/uploads/{id}
+func (s *uploadStore) serveUpload(w http.ResponseWriter, r *http.Request) {
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/uploads/")
+	u := s.get(id)
+	if u == nil {
+		writeError(w, http.StatusNotFound, "upload not found")
+		return
+	}
+
+	if !u.mu.TryLock() {
+		writeError(w, http.StatusConflict, "another request is writing to this upload")
+		return
+	}
+	defer u.mu.Unlock()
+
+	w.Header().Set("Cache-Control", "no-store") // offset همیشه باید تازه خوانده شود
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.length, 10))
+
+	if r.Method == http.MethodHead {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.offset, 10))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	s.appendChunk(w, r, id, u)
+}
+
+// download → GET /api/uploads/{id}: upload کامل با serveDownload به‌عنوان attachment فرستاده می‌شود
+func (s *uploadStore) download(w http.ResponseWriter, r *http.Request) {
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/uploads/")
+	u := s.get(id)
+	if u == nil {
+		writeError(w, http.StatusNotFound, "upload not found")
+		return
+	}
+
+	// فقط برای خواندن وضعیت و باز کردن فایل؛ خود دانلود قفل را نگه نمی‌دارد تا دانلودهای همزمان
+	// ممکن باشند. فایل باز با حذف cleanup هم تا آخر خوانده می‌شود.
+	if !u.mu.TryLock() {
+		writeError(w, http.StatusConflict, "another request is writing to this upload")
+		return
+	}
+	if u.offset < u.length {
+		u.mu.Unlock()
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.offset, 10))
+		writeError(w, http.StatusConflict, "upload is not complete")
+		return
+	}
+	f, err := os.Open(u.path)
+	filename := u.filename
+	u.mu.Unlock()
+	if err != nil {
+		writeServerError(w, http.StatusInternalServerError, fmt.Errorf("upload %s open: %w", id, err))
+		return
+	}
+	defer f.Close()
+
+	if filename == "" {
+		filename = id
+	}
+	serveDownload(w, r, f, filename, "")
+}
+
+// appendChunk یک تکه را از offset فعلی به فایل اضافه می‌کند؛ باید زیر قفل u صدا زده شود
+func (s *uploadStore) appendChunk(w http.ResponseWriter, r *http.Request, id string, u *upload) {
+
+	offset, err := chunkOffset(r, u.length)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// کلاینت باید از همان جایی ادامه دهد که سرور دارد
+	if offset != u.offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.offset, 10))
+		writeError(w, http.StatusConflict, "offset mismatch")
+		return
+	}
+
+	// تکه‌های بزرگ روی اتصال کند بیشتر از ReadTimeout سرور طول می‌کشند
+	setBodyReadDeadline(w, r, time.Now().Add(uploadChunkTimeout)) // MIN_BODY_RATE همچنان اعمال می‌شود
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(uploadChunkTimeout))
+
+	f, err := os.OpenFile(u.path, os.O_WRONLY, 0)
+	if err != nil {
+		writeServerError(w, http.StatusInternalServerError, fmt.Errorf("upload %s open: %w", id, err))
+		return
+	}
+	defer f.Close()
+
+	// بیشتر از حجم باقی‌مانده پذیرفته نمی‌شود
+	body := http.MaxBytesReader(w, r.Body, u.length-u.offset)
+	n, err := io.Copy(io.NewOffsetWriter(f, u.offset), body)
+
+	// حتی اگر اتصال وسط کار قطع شود، بایت‌های رسیده حفظ می‌شوند تا کلاینت ادامه دهد
+	u.offset += n
+	u.updated = time.Now()
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.offset, 10))
+
+	if n > 0 && u.offset == u.length {
+		requestLogger(r.Context()).Info("upload complete", "id", id, "length", u.length, "path", u.path)
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeBodyError(w, err) // سقف همان بایت‌های باقی‌مانده تا Upload-Length است
+		return
+	case errors.Is(err, errBodyTooSlow):
+		writeError(w, http.StatusRequestTimeout, errBodyTooSlow.Error()) // کلاینت با Upload-Offset ادامه می‌دهد
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, "failed to read chunk")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// chunkOffset شروع تکه را از Upload-Offset یا Content-Range (مثل bytes 0-99/1000) می‌خواند
+func chunkOffset(r *http.Request, length int64) (int64, error) {
+
+	if v := r.Header.Get("Upload-Offset"); v != "" {
+		offset, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || offset < 0 {
+			return 0, fmt.Errorf("invalid Upload-Offset")
+		}
+		return offset, nil
+	}
+
+	if v := r.Header.Get("Content-Range"); v != "" {
+		var start, end, total int64
+		if _, err := fmt.Sscanf(v, "bytes %d-%d/%d", &start, &end, &total); err != nil || start < 0 || end < start {
+			return 0, fmt.Errorf("invalid Content-Range")
+		}
+		if total != length {
+			return 0, fmt.Errorf("Content-Range total does not match Upload-Length")
+		}
+		return start, nil
+	}
+
+	return 0, fmt.Errorf("Upload-Offset or Content-Range header is required")
+}
+
+// newUploadID یک شناسه‌ی تصادفی غیرقابل حدس می‌سازد
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestUploads یک uploadStore در پوشه‌ی موقت تست می‌سازد
+func newTestUploads(t *testing.T, maxBytes int64, maxCount int) *uploadStore {
+	t.Helper()
+	s, err := newUploadStore(t.Context(), t.TempDir(), maxBytes, 10, maxCount, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// createUpload یک upload با Upload-Length می‌سازد و شناسه‌ی آن را برمی‌گرداند
+func createUpload(t *testing.T, s *uploadStore, length string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/api/uploads", nil)
+	r.Header.Set("Upload-Length", length)
+	w := httptest.NewRecorder()
+	s.create(w, r)
+	return w, strings.TrimPrefix(w.Header().Get("Location"), "/api/uploads/")
+}
+
+// patchUpload یک تکه با هدرهای داده‌شده (Upload-Offset یا Content-Range) می‌فرستد
+func patchUpload(s *uploadStore, id, body string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPatch, "/api/uploads/"+id, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/offset+octet-stream")
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	s.serveUpload(w, r)
+	return w
+}
+
+func headUpload(s *uploadStore, id string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.serveUpload(w, httptest.NewRequest(http.MethodHead, "/api/uploads/"+id, nil))
+	return w
+}
+
+func TestUploadCreate(t *testing.T) {
+	s := newTestUploads(t, 100, 10)
+
+	tests := []struct {
+		length string
+		status int
+	}{
+		{"11", http.StatusCreated},
+		{"0", http.StatusCreated},
+		{"100", http.StatusCreated},
+		{"101", http.StatusRequestEntityTooLarge},
+		{"", http.StatusBadRequest},
+		{"-1", http.StatusBadRequest},
+		{"x", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w, id := createUpload(t, s, tt.length)
+		if w.Code != tt.status {
+			t.Errorf("Upload-Length %q: status = %d, want %d", tt.length, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusCreated {
+			continue
+		}
+		if id == "" || w.Header().Get("Upload-Offset") != "0" {
+			t.Errorf("Upload-Length %q: Location %q, Upload-Offset %q", tt.length, w.Header().Get("Location"), w.Header().Get("Upload-Offset"))
+		}
+		if h := headUpload(s, id); h.Code != http.StatusOK || h.Header().Get("Upload-Offset") != "0" || h.Header().Get("Upload-Length") != tt.length {
+			t.Errorf("HEAD: %d, offset %q, length %q", h.Code, h.Header().Get("Upload-Offset"), h.Header().Get("Upload-Length"))
+		}
+	}
+
+	if h := headUpload(s, "does-not-exist"); h.Code != http.StatusNotFound {
+		t.Errorf("HEAD unknown id: status = %d, want 404", h.Code)
+	}
+}
+
+func TestUploadChunks(t *testing.T) {
+	s := newTestUploads(t, 100, 10)
+	_, id := createUpload(t, s, "11")
+
+	steps := []struct {
+		name   string
+		body   string
+		header map[string]string
+		status int
+		offset string
+	}{
+		{"first chunk", "hello", map[string]string{"Upload-Offset": "0"}, http.StatusNoContent, "5"},
+		{"offset behind", "hello", map[string]string{"Upload-Offset": "0"}, http.StatusConflict, "5"},
+		{"offset ahead", "world", map[string]string{"Upload-Offset": "6"}, http.StatusConflict, "5"},
+		{"Content-Range total mismatch", " ", map[string]string{"Content-Range": "bytes 5-5/12"}, http.StatusBadRequest, ""},
+		{"Content-Range malformed", " ", map[string]string{"Content-Range": "bytes 5-/11"}, http.StatusBadRequest, ""},
+		{"Content-Range end before start", " ", map[string]string{"Content-Range": "bytes 5-4/11"}, http.StatusBadRequest, ""},
+		{"Content-Range wrong start", " ", map[string]string{"Content-Range": "bytes 4-4/11"}, http.StatusConflict, "5"},
+		{"Content-Range chunk", " ", map[string]string{"Content-Range": "bytes 5-5/11"}, http.StatusNoContent, "6"},
+		{"no offset header", "world", nil, http.StatusBadRequest, ""},
+		{"invalid Upload-Offset", "world", map[string]string{"Upload-Offset": "-1"}, http.StatusBadRequest, ""},
+		{"past Upload-Length", "world!", map[string]string{"Upload-Offset": "6"}, http.StatusRequestEntityTooLarge, "11"},
+	}
+	for _, st := range steps {
+		w := patchUpload(s, id, st.body, st.header)
+		if w.Code != st.status {
+			t.Fatalf("%s: status = %d, want %d: %s", st.name, w.Code, st.status, w.Body)
+		}
+		if got := w.Header().Get("Upload-Offset"); got != st.offset {
+			t.Errorf("%s: Upload-Offset = %q, want %q", st.name, got, st.offset)
+		}
+	}
+
+	// بایت‌های تکه‌ی آخر تا Upload-Length نگه داشته شده‌اند
+	got, err := os.ReadFile(s.get(id).path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello world" {
+		t.Errorf("file = %q, want %q", got, "hello world")
+	}
+	if h := headUpload(s, id); h.Header().Get("Upload-Offset") != "11" {
+		t.Errorf("HEAD after completion: Upload-Offset = %q", h.Header().Get("Upload-Offset"))
+	}
+}
+
+// uploadی که PATCH در جریان دارد درخواست دوم را با 409 رد می‌کند
+func TestUploadConcurrentPatch(t *testing.T) {
+	s := newTestUploads(t, 100, 10)
+	_, id := createUpload(t, s, "5")
+
+	u := s.get(id)
+	u.mu.Lock()
+	w := patchUpload(s, id, "hello", map[string]string{"Upload-Offset": "0"})
+	u.mu.Unlock()
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409", w.Code)
+	}
+}
+
+func TestUploadCleanup(t *testing.T) {
+	s := newTestUploads(t, 100, 10)
+
+	_, incomplete := createUpload(t, s, "11")
+	patchUpload(s, incomplete, "hello", map[string]string{"Upload-Offset": "0"})
+	_, complete := createUpload(t, s, "5")
+	patchUpload(s, complete, "hello", map[string]string{"Upload-Offset": "0"})
+	_, fresh := createUpload(t, s, "5")
+	_, busy := createUpload(t, s, "5")
+
+	old := time.Now().Add(-2 * s.ttl)
+	for _, id := range []string{incomplete, complete, busy} {
+		s.get(id).updated = old
+	}
+	paths := map[string]string{incomplete: s.get(incomplete).path, complete: s.get(complete).path}
+
+	b := s.get(busy)
+	b.mu.Lock() // PATCH در جریان
+	s.cleanup()
+	b.mu.Unlock()
+
+	for _, id := range []string{incomplete, complete} {
+		if s.get(id) != nil {
+			t.Errorf("upload %s still registered after TTL", id)
+		}
+		if _, err := os.Stat(paths[id]); !os.IsNotExist(err) {
+			t.Errorf("file of %s not removed: %v", id, err)
+		}
+	}
+	for _, id := range []string{fresh, busy} {
+		if s.get(id) == nil {
+			t.Errorf("upload %s removed before TTL or while busy", id)
+		}
+	}
+}
+
+// بعد از UPLOAD_MAX_ACTIVE آپلود، ساختن آپلود تازه 503 با Retry-After است تا پاک‌سازی جا باز کند
+func TestUploadMaxActive(t *testing.T) {
+	s := newTestUploads(t, 100, 2)
+	for range 2 {
+		if w, _ := createUpload(t, s, "5"); w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want 201", w.Code)
+		}
+	}
+
+	w, _ := createUpload(t, s, "5")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After missing")
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("%d files in UPLOAD_DIR, want 2", len(entries))
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http" // هسته HTTP در Go
+	"strconv"  // پیام خطا
+)
+
+// ================= URL Length Limit =================
+
+// urlLengthMiddleware درخواست‌هایی را که URL (مسیر به‌علاوه‌ی query) آن‌ها از max بایت بلندتر است
+// قبل از رسیدن به router و فایل‌های static با 414 رد می‌کند. سقف هدرهای net/http
+// (MaxHeaderBytes) حدود 1MB است که برای URL خیلی زیاد است.
+func urlLengthMiddleware(max int) Middleware {
+	return func(next http.Handler) http.Handler {
+		if max <= 0 {
+			return next // سقف خاموش است
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if n := len(r.RequestURI); n > max {
+				requestLogger(r.Context()).Debug("request rejected, URL too long",
+					"method", r.Method,
+					"length", n,
+					"limit", max,
+				)
+				writeError(w, http.StatusRequestURITooLong, "URI Too Long: limit is "+strconv.Itoa(max)+" bytes")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"         // برای ساختن دوباره‌ی body بعد از خواندن
+	"embed"         // برای جاسازی schemaهای پیش‌فرض داخل باینری
+	"encoding/json" // برای دیکد schema و body
+	"fmt"           // برای ساختن پیام‌های خطا
+	"io"            // برای خواندن کامل body
+	"io/fs"         // برای پیمایش فایل‌های schema
+	"math"          // برای تشخیص عدد صحیح
+	"net/http"      // هسته HTTP در Go
+	"os"            // برای خواندن schemaها از دیسک
+	"path"          // برای استخراج نام schema از مسیر فایل
+	"regexp"        // برای کلمه‌ی کلیدی pattern
+	"sort"          // ترتیب ثابت خطاها در پاسخ
+	"strings"       // کار با رشته‌ها
+	"unicode/utf8"  // شمارش کاراکترها برای minLength/maxLength
+)
+
+// ================= JSON Schema =================
+
+// schemaهای پیش‌فرض که همراه باینری ساخته می‌شوند
+//
+//go:embed schemas/*.json
+var embeddedSchemas embed.FS
+
+// schemaهای کامپایل‌شده بر اساس نام (نام فایل بدون .json)
+// فقط در شروع برنامه پر می‌شود، پس خواندن همزمان آن امن است
+var schemas = map[string]*jsonSchema{}
+
+// jsonSchema زیرمجموعه‌ای از JSON Schema است که برای bodyهای API کافی است:
+// type, required, properties, additionalProperties, items, enum,
+// minimum/maximum, minLength/maxLength, minItems/maxItems, pattern
+type jsonSchema struct {
+	Type                 typeList               `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []any                  `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Pattern              string                 `json:"pattern"`
+
+	pattern *regexp.Regexp // pattern کامپایل‌شده
+}
+
+// typeList هم "type": "string" و هم "type": ["string", "null"] را می‌پذیرد
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = typeList{one}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*t = many
+	return nil
+}
+
+// خطای اعتبارسنجی یک فیلد
+type fieldError struct {
+	Field   string `json:"field"`   // مسیر فیلد، مثل user.name یا tags[2]
+	Message string `json:"message"` // توضیح خطا
+}
+
+// loadSchemas schemaهای جاسازی‌شده و (در صورت وجود) پوشه‌ی dir را کامپایل می‌کند.
+// فایل‌های dir هم‌نام با schemaهای پیش‌فرض، آن‌ها را جایگزین می‌کنند.
+func loadSchemas(dir string) error {
+
+	if err := compileSchemaFS(embeddedSchemas, "schemas"); err != nil {
+		return err
+	}
+
+	if dir == "" {
+		return nil
+	}
+
+	return compileSchemaFS(os.DirFS(dir), ".")
+}
+
+// compileSchemaFS همه‌ی فایل‌های .json زیر root را کامپایل و ثبت می‌کند
+func compileSchemaFS(fsys fs.FS, root string) error {
+	return fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(p) != ".json" {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+
+		s, err := compileSchema(data)
+		if err != nil {
+			return fmt.Errorf("schema %s: %w", p, err)
+		}
+
+		schemas[strings.TrimSuffix(path.Base(p), ".json")] = s
+		return nil
+	})
+}
+
+// compileSchema متن schema را پارس و regexها را از قبل کامپایل می‌کند
+func compileSchema(data []byte) (*jsonSchema, error) {
+	var s jsonSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *jsonSchema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+
+	for name, p := range s.Properties {
+		if err := p.compile(); err != nil {
+			return fmt.Errorf("property %s: %w", name, err)
+		}
+	}
+
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// validate مقدار دیکدشده (با UseNumber) را بررسی و همه‌ی خطاها را برمی‌گرداند
+func (s *jsonSchema) validate(v any) []fieldError {
+	var errs []fieldError
+	s.validateAt("", v, &errs)
+
+	// ترتیب پیمایش map ثابت نیست؛ خطاها را بر اساس نام فیلد مرتب می‌کنیم
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+func (s *jsonSchema) validateAt(field string, v any, errs *[]fieldError) {
+
+	// ثبت خطا برای فیلد فعلی
+	fail := func(format string, args ...any) {
+		name := field
+		if name == "" {
+			name = "body" // خطا روی خود body
+		}
+		*errs = append(*errs, fieldError{Field: name, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// -------- type --------
+	if len(s.Type) > 0 && !s.Type.matches(v) {
+		fail("must be of type %s", strings.Join(s.Type, " or "))
+		return // بقیه‌ی قیدها برای نوع اشتباه معنی ندارند
+	}
+
+	// -------- enum --------
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		fail("must be one of the allowed values")
+	}
+
+	switch val := v.(type) {
+
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			fail("must match pattern %s", s.Pattern)
+		}
+
+	case json.Number:
+		f, _ := val.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+
+	case []any:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			fail("must contain at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			fail("must contain at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				s.Items.validateAt(fmt.Sprintf("%s[%d]", field, i), item, errs)
+			}
+		}
+
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				*errs = append(*errs, fieldError{Field: joinField(field, name), Message: "is required"})
+			}
+		}
+		for name, item := range val {
+			if p, ok := s.Properties[name]; ok {
+				p.validateAt(joinField(field, name), item, errs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*errs = append(*errs, fieldError{Field: joinField(field, name), Message: "is not allowed"})
+			}
+		}
+	}
+}
+
+// matches بررسی می‌کند نوع v با یکی از typeهای schema یکی باشد
+func (t typeList) matches(v any) bool {
+	for _, name := range t {
+		switch val := v.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case json.Number:
+			if name == "number" {
+				return true
+			}
+			if name == "integer" {
+				f, err := val.Float64()
+				if err == nil && f == math.Trunc(f) {
+					return true
+				}
+			}
+		case []any:
+			if name == "array" {
+				return true
+			}
+		case map[string]any:
+			if name == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inEnum مقایسه‌ی مقدار با لیست enum (بر اساس شکل JSON هر دو)
+func inEnum(enum []any, v any) bool {
+	got, _ := json.Marshal(v)
+	for _, e := range enum {
+		want, _ := json.Marshal(e)
+		if bytes.Equal(got, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinField ساختن مسیر فیلد تو در تو
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// validateBody بدنه‌ی درخواست را با schema ثبت‌شده بررسی و سپس با readJSON در dst دیکد می‌کند.
+// اگر false برگرداند، پاسخ خطا (400 یا 422) قبلاً ارسال شده است. opts همان گزینه‌های readJSON هستند.
+func validateBody(w http.ResponseWriter, r *http.Request, schemaName string, dst any, opts ...jsonOption) bool {
+
+	s, ok := schemas[schemaName]
+	if !ok {
+		// این یعنی خطای برنامه‌نویسی است، نه خطای کلاینت
+		writeServerError(w, http.StatusInternalServerError, fmt.Errorf("validateBody: unknown schema %q", schemaName))
+		return false
+	}
+
+	// body را یک بار کامل می‌خوانیم تا هم اعتبارسنجی شود و هم دیکد
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes))
+	if err != nil {
+		writeBodyError(w, err) // مثلاً body بزرگ‌تر از سقف → 413
+		return false
+	}
+
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber() // اعداد بدون از دست رفتن دقت بررسی می‌شوند
+	if err := dec.Decode(&doc); err != nil {
+		writeBodyError(w, err)
+		return false
+	}
+
+	if errs := s.validate(doc); len(errs) > 0 {
+		writeErrorDetails(w, http.StatusUnprocessableEntity, "validation failed", errs)
+		return false
+	}
+
+	// بازگرداندن body برای readJSON
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err := readJSON(w, r, dst, opts...); err != nil {
+		writeBodyError(w, err)
+		return false
+	}
+
+	return true
+}
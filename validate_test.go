@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// jsonOfSize یک body معتبر {"msg":"aaa..."} با دقیقاً n بایت می‌سازد
+func jsonOfSize(n int) string {
+	const frame = `{"msg":""}`
+	return `{"msg":"` + strings.Repeat("a", n-len(frame)) + `"}`
+}
+
+// هر body بزرگ‌تر از MAX_JSON_BODY_BYTES، با Content-Length یا chunked و از readJSON یا validateBody،
+// همان 413 با limit_bytes را می‌گیرد؛ body دقیقاً هم‌اندازه‌ی سقف پذیرفته می‌شود
+func TestBodyLimit(t *testing.T) {
+	const limit = 64
+	prevLimit := maxJSONBodyBytes
+	maxJSONBodyBytes = limit
+	t.Cleanup(func() { maxJSONBodyBytes = prevLimit })
+
+	schema, err := compileSchema([]byte(`{"type":"object","properties":{"msg":{"type":"string"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas["test-limit"] = schema
+	t.Cleanup(func() { delete(schemas, "test-limit") })
+
+	type msg struct {
+		Msg string `json:"msg"`
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/read", func(w http.ResponseWriter, r *http.Request) {
+		var m msg
+		if err := readJSON(w, r, &m); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		w.Header().Set("X-Content-Length", r.Header.Get("Content-Length"))
+	})
+	mux.HandleFunc("/validate", func(w http.ResponseWriter, r *http.Request) {
+		var m msg
+		if validateBody(w, r, "test-limit", &m) {
+			w.Header().Set("X-Content-Length", r.Header.Get("Content-Length"))
+		}
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	tests := []struct {
+		name    string
+		size    int
+		chunked bool
+		status  int
+	}{
+		{"exactly at limit", limit, false, http.StatusOK},
+		{"limit+1", limit + 1, false, http.StatusRequestEntityTooLarge},
+		{"far over limit", 10 * limit, false, http.StatusRequestEntityTooLarge},
+		{"chunked at limit", limit, true, http.StatusOK},
+		{"chunked limit+1", limit + 1, true, http.StatusRequestEntityTooLarge},
+		{"chunked far over limit", 10 * limit, true, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, path := range []string{"/read", "/validate"} {
+		for _, tt := range tests {
+			t.Run(path+"/"+tt.name, func(t *testing.T) {
+				body := jsonOfSize(tt.size)
+				if len(body) != tt.size {
+					t.Fatalf("body is %d bytes, want %d", len(body), tt.size)
+				}
+
+				req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+				if tt.chunked {
+					req.Body = io.NopCloser(strings.NewReader(body)) // حجم نامعلوم → Transfer-Encoding: chunked
+					req.ContentLength = -1
+				}
+
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+
+				if resp.StatusCode != tt.status {
+					t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+				}
+				if resp.StatusCode == http.StatusOK {
+					if got := resp.Header.Get("X-Content-Length"); tt.chunked != (got == "") {
+						t.Errorf("server saw Content-Length %q (chunked = %v)", got, tt.chunked)
+					}
+					return
+				}
+
+				var e struct {
+					Error   string `json:"error"`
+					Details struct {
+						Limit int64 `json:"limit_bytes"`
+					} `json:"details"`
+				}
+				if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+					t.Fatalf("body is not JSON: %v", err)
+				}
+				if want := "request body must not exceed 64 bytes"; e.Error != want {
+					t.Errorf("error = %q, want %q", e.Error, want)
+				}
+				if e.Details.Limit != limit {
+					t.Errorf("limit_bytes = %d, want %d", e.Details.Limit, limit)
+				}
+			})
+		}
+	}
+}
+
+// newBodyError هر شکل *http.MaxBytesError (حتی پیچیده در خطای دیگر) را به همان 413 نگاشت می‌کند
+func TestNewBodyErrorTooLarge(t *testing.T) {
+	for _, err := range []error{
+		&http.MaxBytesError{Limit: 10},
+		fmt.Errorf("upload chunk: %w", &http.MaxBytesError{Limit: 10}),
+		newBodyTooLarge(10),
+	} {
+		be := newBodyError(err)
+		if be.Status != http.StatusRequestEntityTooLarge || be.Limit != 10 || be.Message != "request body must not exceed 10 bytes" {
+			t.Errorf("newBodyError(%T) = %d %q limit %d", err, be.Status, be.Message, be.Limit)
+		}
+	}
+}
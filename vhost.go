@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"  // health check پوشه‌ی هر سایت
+	"net"      // جدا کردن پورت از Host
+	"net/http" // هسته HTTP در Go
+	"os"       // بررسی وجود پوشه
+	"strings"  // یکسان کردن نام host
+)
+
+// ================= Virtual Hosts =================
+
+// مقدارهای VHOST_FALLBACK برای hostهایی که در VHOSTS نیستند
+const (
+	vhostFallbackDefault  = "default" // سایت اصلی (./static)
+	vhostFallbackNotFound = "404"     // پاسخ 404؛ فقط دامنه‌های تعریف‌شده سایت دارند
+)
+
+// vhosts سایت static هر درخواست را از روی هدر Host انتخاب می‌کند.
+// فقط / و /static/ به host بستگی دارند؛ routeهای API بین همه‌ی دامنه‌ها مشترک‌اند.
+type vhosts struct {
+	sites    map[string]*staticSite // host با حروف کوچک و بدون پورت → سایت
+	fallback *staticSite            // nil یعنی host ناشناخته 404 می‌گیرد
+}
+
+// newVHosts برای هر host در spec (host → پوشه) یک سایت static با همان تنظیمات سایت اصلی می‌سازد
+func newVHosts(spec map[string]string, fallback string, def *staticSite, cfg Config) *vhosts {
+	v := &vhosts{sites: make(map[string]*staticSite, len(spec))}
+	if fallback == vhostFallbackDefault {
+		v.fallback = def
+	}
+
+	for host, dir := range spec {
+		host = normalizeHost(host)
+		v.sites[host] = newStaticSite(dir, cfg)
+
+		// نبودن پوشه‌ی یک دامنه بقیه‌ی سایت‌ها را خراب نمی‌کند؛ پس critical نیست
+		registerHealthCheck("vhost "+host, false, func(ctx context.Context) error {
+			_, err := os.Stat(dir)
+			return err
+		})
+	}
+	return v
+}
+
+// site سایت مربوط به host درخواست (یا fallback) را برمی‌گرداند
+func (v *vhosts) site(r *http.Request) *staticSite {
+	if s, ok := v.sites[normalizeHost(r.Host)]; ok {
+		return s
+	}
+	return v.fallback
+}
+
+// index handler صفحه‌ی اصلی سایت هر host
+func (v *vhosts) index() http.Handler {
+	return v.dispatch(func(s *staticSite) http.Handler { return s.index })
+}
+
+// files handler فایل‌های /static/ سایت هر host
+func (v *vhosts) files() http.Handler {
+	return v.dispatch(func(s *staticSite) http.Handler { return s.files })
+}
+
+// dispatch درخواست را به handler (pick) سایت host می‌دهد؛ host ناشناخته بدون fallback پاسخ 404 می‌گیرد
+func (v *vhosts) dispatch(pick func(*staticSite) http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := v.site(r)
+		if s == nil {
+			writeError(w, http.StatusNotFound, "Unknown host")
+			return
+		}
+		pick(s).ServeHTTP(w, r)
+	})
+}
+
+// normalizeHost پورت، نقطه‌ی انتهایی و حروف بزرگ را از host حذف می‌کند (Example.com:8080 → example.com)
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"     // timeout هر probe و توقف watchdog
+	"log/slog"    // لاگ گیر کردن پروسه
+	"os"          // خروج در WATCHDOG_ACTION=exit
+	"sync/atomic" // زمان آخرین پیشرفت
+	"time"        // فاصله‌ها و timeout
+)
+
+// ================= Liveness Watchdog =================
+
+// مقدارهای WATCHDOG_ACTION
+const (
+	watchdogLivez = "livez" // فقط /livez با 503 جواب می‌دهد تا orchestrator پروسه را restart کند
+	watchdogExit  = "exit"  // stack goroutineها لاگ و پروسه با کد 1 خارج می‌شود
+)
+
+// watchdog فعال برای /livez؛ nil یعنی WATCHDOG_TIMEOUT خاموش است
+var liveWatchdog atomic.Pointer[watchdog]
+
+// watchdog پیشرفت دو چیز را دنبال می‌کند: یک درخواست واقعی به /api/ping از مسیر listener و کل زنجیره‌ی
+// middlewareها (accept و سرو درخواست) و یک goroutine پس‌زمینه با runEvery (scheduler و tickerها).
+// اگر یکی از آن‌ها بیشتر از timeout پیشرفت نکند، پروسه گیر کرده است (مثلاً deadlock روی یک قفل سراسری)
+// حتی اگر هنوز زنده به نظر برسد.
+type watchdog struct {
+	timeout time.Duration
+	url     string // آدرس /api/ping خود سرور
+	action  string
+
+	serve      atomic.Int64 // unix nano آخرین probe موفق
+	background atomic.Int64 // unix nano آخرین heartbeat پس‌زمینه
+	wedged     atomic.Bool  // برای یک بار لاگ کردن هر گیر کردن
+}
+
+// newWatchdog یک watchdog می‌سازد؛ url آدرس پایه‌ی خود سرور است (serverURL)
+func newWatchdog(timeout time.Duration, url, action string) *watchdog {
+	wd := &watchdog{timeout: timeout, url: url + "/api/ping", action: action}
+	now := time.Now().UnixNano()
+	wd.serve.Store(now)
+	wd.background.Store(now)
+	return wd
+}
+
+// start probe، heartbeat و بررسی را هر یک‌چهارم timeout اجرا می‌کند تا لغو ctx
+// (که باید با شروع خاموش‌سازی باشد؛ بعد از آن listener بسته است و probeها شکست می‌خورند)
+func (wd *watchdog) start(ctx context.Context) {
+	interval := wd.timeout / 4
+	liveWatchdog.Store(wd)
+
+	runEvery(ctx, interval, func() {
+		wd.background.Store(time.Now().UnixNano())
+	})
+	runEvery(ctx, interval, func() {
+		pctx, cancel := context.WithTimeout(ctx, wd.timeout)
+		defer cancel()
+		if err := pingSelf(pctx, wd.url); err == nil {
+			wd.serve.Store(time.Now().UnixNano())
+		} else if ctx.Err() == nil {
+			slog.Debug("watchdog probe failed", "err", err)
+		}
+	})
+	runEvery(ctx, interval, wd.check)
+
+	go func() {
+		<-ctx.Done()
+		liveWatchdog.Store(nil) // در خاموش‌سازی /livez دیگر گیر کردن گزارش نمی‌کند
+	}()
+}
+
+// stalled نام بخشی که بیشتر از timeout پیشرفت نکرده و مدت آن؛ "" یعنی سالم
+func (wd *watchdog) stalled() (string, time.Duration) {
+	now := time.Now()
+	if d := now.Sub(time.Unix(0, wd.serve.Load())); d > wd.timeout {
+		return "serve", d
+	}
+	if d := now.Sub(time.Unix(0, wd.background.Load())); d > wd.timeout {
+		return "background", d
+	}
+	return "", 0
+}
+
+// check گیر کردن را لاگ و در WATCHDOG_ACTION=exit پروسه را متوقف می‌کند؛ خاموش‌سازی عادی ممکن نیست
+// چون همان درخواست‌های گیرکرده هیچ‌وقت تمام نمی‌شوند
+func (wd *watchdog) check() {
+	part, d := wd.stalled()
+	if part == "" {
+		if wd.wedged.Swap(false) {
+			slog.Info("watchdog: progress resumed")
+		}
+		return
+	}
+	if wd.wedged.Swap(true) && wd.action != watchdogExit {
+		return
+	}
+
+	slog.Error("watchdog: no progress, process looks wedged", "part", part, "since", d.Round(time.Millisecond).String(), "timeout", wd.timeout.String(), "action", wd.action)
+	if wd.action == watchdogExit {
+		dumpGoroutines("watchdog: goroutine dump before exit")
+		os.Exit(1)
+	}
+}